@@ -0,0 +1,119 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package access decides what the clients can do with the lists and their
+// tasks. The principal of a call travels in its context, from the api to
+// the db package where every query is checked
+package access
+
+import (
+	"context"
+	"errors"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// ErrForbidden is returned when the role of the principal does not allow
+// the call
+var ErrForbidden = errors.New("Your role does not allow it")
+
+// anonymousRole is the role of the anonymous clients on the open lists,
+// they are only accepted when authentication is not required
+const anonymousRole = model.RoleEditor
+
+// Principal is who a call is made for
+type Principal struct {
+	// User is the user signed in, nil for anonymous clients and the system
+	User *model.User
+
+	// system is the server itself, or its operator running a command
+	system bool
+}
+
+type principalKey struct{}
+
+// WithUser records the user a call is made for
+func WithUser(ctx context.Context, user model.User) context.Context {
+	return context.WithValue(ctx, principalKey{}, Principal{User: &user})
+}
+
+// AsSystem records the call is made by the server itself, or an operator
+// with access to the database, who can do anything
+func AsSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, principalKey{}, Principal{system: true})
+}
+
+// From returns the principal of the call, an anonymous client when none
+// was recorded
+func From(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// Admin tells if the principal can do anything, with every list
+func (p Principal) Admin() bool {
+	return p.system || (p.User != nil && p.User.Role == model.RoleAdmin)
+}
+
+// CheckAdmin returns ErrForbidden unless the principal is an admin
+func (p Principal) CheckAdmin() error {
+	if !p.Admin() {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// ListRole is the role of the principal on a list, given whether the list
+// has members and the roles of the memberships of the principal, as a user
+// or through a group. It is empty when the principal can not see the list
+func (p Principal) ListRole(shared bool, memberships []string) string {
+	if p.Admin() {
+		return model.RoleAdmin
+	}
+
+	if !shared {
+		if p.User == nil {
+			return anonymousRole
+		}
+
+		return p.User.Role
+	}
+
+	role := ""
+
+	// anonymous clients are never members
+	if p.User == nil {
+		return role
+	}
+
+	for _, r := range memberships {
+		if model.RoleRank(r) > model.RoleRank(role) {
+			role = r
+		}
+	}
+
+	return role
+}
+
+// Allows tells if a role can do what the needed role can
+func Allows(role string, needed string) bool {
+	return model.RoleRank(role) > 0 && model.RoleRank(role) >= model.RoleRank(needed)
+}
@@ -0,0 +1,113 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package access
+
+import (
+	"context"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+var principals = map[string]context.Context{
+	"anonymous": context.Background(),
+	"system":    AsSystem(context.Background()),
+	"viewer":    WithUser(context.Background(), model.User{ID: 1, Name: "vera", Role: model.RoleViewer}),
+	"editor":    WithUser(context.Background(), model.User{ID: 2, Name: "ed", Role: model.RoleEditor, Groups: []string{"staff"}}),
+	"admin":     WithUser(context.Background(), model.User{ID: 3, Name: "ada", Role: model.RoleAdmin}),
+}
+
+func TestListRole(t *testing.T) {
+	tests := []struct {
+		principal   string
+		shared      bool
+		memberships []string
+		want        string
+	}{
+		{"anonymous", false, nil, model.RoleEditor},
+		{"anonymous", true, nil, ""},
+		{"anonymous", true, []string{model.RoleAdmin}, ""},
+		{"system", false, nil, model.RoleAdmin},
+		{"system", true, nil, model.RoleAdmin},
+		{"viewer", false, nil, model.RoleViewer},
+		{"viewer", true, nil, ""},
+		{"viewer", true, []string{model.RoleEditor}, model.RoleEditor},
+		{"editor", false, nil, model.RoleEditor},
+		{"editor", true, nil, ""},
+		{"editor", true, []string{model.RoleViewer}, model.RoleViewer},
+		{"editor", true, []string{model.RoleViewer, model.RoleAdmin, model.RoleEditor}, model.RoleAdmin},
+		{"admin", false, nil, model.RoleAdmin},
+		{"admin", true, nil, model.RoleAdmin},
+	}
+
+	for _, test := range tests {
+		got := From(principals[test.principal]).ListRole(test.shared, test.memberships)
+
+		if got != test.want {
+			t.Errorf("%s on a list shared %t with %q: %q, want %q", test.principal, test.shared, test.memberships, got, test.want)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	// the operations on the tasks of a list and the role they need
+	operations := []struct {
+		name   string
+		needed string
+	}{
+		{"read", model.RoleViewer},
+		{"create", model.RoleEditor},
+		{"update", model.RoleEditor},
+		{"delete", model.RoleEditor},
+		{"manage members", model.RoleAdmin},
+	}
+
+	allowed := map[string][]bool{
+		"":               {false, false, false, false, false},
+		model.RoleViewer: {true, false, false, false, false},
+		model.RoleEditor: {true, true, true, true, false},
+		model.RoleAdmin:  {true, true, true, true, true},
+	}
+
+	for role, want := range allowed {
+		for i, op := range operations {
+			if got := Allows(role, op.needed); got != want[i] {
+				t.Errorf("%q can %s: %t, want %t", role, op.name, got, want[i])
+			}
+		}
+	}
+}
+
+func TestCheckAdmin(t *testing.T) {
+	admins := map[string]bool{"anonymous": false, "system": true, "viewer": false, "editor": false, "admin": true}
+
+	for name, ctx := range principals {
+		err := From(ctx).CheckAdmin()
+
+		if admins[name] && err != nil {
+			t.Errorf("%s is not an admin: %v", name, err)
+		}
+
+		if !admins[name] && err != ErrForbidden {
+			t.Errorf("%s is an admin: %v", name, err)
+		}
+	}
+}
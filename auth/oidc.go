@@ -0,0 +1,259 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/servian/TechChallengeApp/model"
+	"golang.org/x/oauth2"
+)
+
+// Errors of a sign in with an identity provider
+var (
+	// ErrFlow is returned when the callback does not belong to a sign in
+	// started by the same browser, or it expired
+	ErrFlow = errors.New("The sign in expired or was not started from this browser, sign in again")
+
+	// ErrRefused is returned when the identity provider did not sign the
+	// user in
+	ErrRefused = errors.New("The identity provider refused the sign in")
+
+	// ErrNoRole is returned when none of the groups of the user has a role
+	// and there is no default role
+	ErrNoRole = errors.New("None of your groups can use the application")
+)
+
+// OIDCConfig configures the sign in with an OpenID Connect provider
+type OIDCConfig struct {
+	// Issuer is the url of the provider, its configuration is discovered
+	// from /.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the callback of the server the provider sends the
+	// users back to
+	RedirectURL string
+	Scopes      []string
+
+	// UsernameClaim and GroupsClaim are the claims of the ID token with the
+	// name and the groups of the user
+	UsernameClaim string
+	GroupsClaim   string
+
+	// Roles maps groups to the role of their members, a user gets the most
+	// powerful role of their groups
+	Roles map[string]string
+
+	// DefaultRole is the role of the users in none of the groups of Roles,
+	// they can not sign in when empty
+	DefaultRole string
+}
+
+// Identity is a user as the identity provider knows them, the subject is
+// their id at the issuer
+type Identity struct {
+	Issuer  string
+	Subject string
+	User    model.User
+}
+
+// flowCookie keeps the state, nonce and PKCE verifier of a sign in between
+// the redirect to the provider and its callback
+const flowCookie = "oidc_flow"
+
+// flowMaxAge is how long the user has to sign in at the provider
+const flowMaxAge = 10 * time.Minute
+
+// providerTimeout bounds the requests made to the provider
+const providerTimeout = 10 * time.Second
+
+// OIDC signs the users in with the authorization code flow of an OpenID
+// Connect provider, with PKCE
+type OIDC struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDC returns the sign in with the provider of cfg, the provider is
+// only contacted on the first sign in
+func NewOIDC(cfg OIDCConfig) *OIDC {
+	return &OIDC{cfg: cfg, client: &http.Client{Timeout: providerTimeout}}
+}
+
+// discover fetches the configuration of the provider, until it succeeds
+// once
+func (o *OIDC) discover() (*oidc.Provider, oauth2.Config, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider == nil {
+		// the context is kept by the provider to fetch its keys later
+		provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), o.client), o.cfg.Issuer)
+
+		if err != nil {
+			return nil, oauth2.Config{}, err
+		}
+
+		o.provider = provider
+	}
+
+	return o.provider, oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		RedirectURL:  o.cfg.RedirectURL,
+		Endpoint:     o.provider.Endpoint(),
+		Scopes:       o.cfg.Scopes,
+	}, nil
+}
+
+// Begin starts a sign in, it returns the url of the provider to send the
+// user to. The state, nonce and verifier are kept in a sealed cookie
+func (o *OIDC) Begin(w http.ResponseWriter, sessions *Sessions, secure bool) (string, error) {
+	_, config, err := o.discover()
+
+	if err != nil {
+		return "", err
+	}
+
+	state := randomString(32)
+	nonce := randomString(32)
+	verifier := oauth2.GenerateVerifier()
+
+	sessions.SetSealed(w, flowCookie, state+" "+nonce+" "+verifier, flowMaxAge, secure)
+
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Finish completes the sign in the provider redirected the user back from,
+// it returns the identity of the user with the role of their groups
+func (o *OIDC) Finish(w http.ResponseWriter, r *http.Request, sessions *Sessions, secure bool) (Identity, error) {
+	query := r.URL.Query()
+	flow, ok := sessions.Sealed(w, r, flowCookie, secure)
+	parts := strings.Split(flow, " ")
+
+	if !ok || len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(query.Get("state"))) != 1 {
+		return Identity{}, ErrFlow
+	}
+
+	nonce, verifier := parts[1], parts[2]
+
+	if query.Get("error") != "" {
+		return Identity{}, fmt.Errorf("%w: %s %s", ErrRefused, query.Get("error"), query.Get("error_description"))
+	}
+
+	provider, config, err := o.discover()
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	ctx := oidc.ClientContext(r.Context(), o.client)
+	token, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrRefused, err)
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: no ID token", ErrRefused)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: o.cfg.ClientID}).Verify(ctx, raw)
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrRefused, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return Identity{}, ErrFlow
+	}
+
+	var claims map[string]interface{}
+
+	err = idToken.Claims(&claims)
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrRefused, err)
+	}
+
+	return o.identity(idToken.Issuer, idToken.Subject, claims)
+}
+
+// identity maps the claims of an ID token to a user
+func (o *OIDC) identity(issuer string, subject string, claims map[string]interface{}) (Identity, error) {
+	name, _ := claims[o.cfg.UsernameClaim].(string)
+
+	if name == "" {
+		name, _ = claims["email"].(string)
+	}
+
+	if name == "" {
+		name = subject
+	}
+
+	groups := []string{}
+
+	switch value := claims[o.cfg.GroupsClaim].(type) {
+	case string:
+		groups = append(groups, value)
+	case []interface{}:
+		for _, group := range value {
+			if group, ok := group.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	role := o.cfg.DefaultRole
+
+	for _, group := range groups {
+		if mapped := o.cfg.Roles[group]; model.RoleRank(mapped) > model.RoleRank(role) {
+			role = mapped
+		}
+	}
+
+	identity := Identity{
+		Issuer:  issuer,
+		Subject: subject,
+		User:    model.User{Name: name, Role: role, Groups: groups},
+	}
+
+	if role == "" {
+		return identity, ErrNoRole
+	}
+
+	return identity, nil
+}
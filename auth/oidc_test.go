@@ -0,0 +1,268 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/auth/oidctest"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+const testRedirectURL = "https://tasks.example.com/api/v1/auth/oidc/callback"
+
+func newTestOIDC(provider *oidctest.Provider) *OIDC {
+	return NewOIDC(OIDCConfig{
+		Issuer:        provider.URL,
+		ClientID:      provider.ClientID,
+		ClientSecret:  provider.ClientSecret,
+		RedirectURL:   testRedirectURL,
+		Scopes:        []string{"openid", "profile", "groups"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		Roles:         map[string]string{"task-admins": model.RoleAdmin, "staff": model.RoleEditor},
+	})
+}
+
+// testFlow is a sign in started by a browser, the cookies it was given and
+// the url of the provider it was sent to
+type testFlow struct {
+	authURL *url.URL
+	cookies []*http.Cookie
+}
+
+func begin(t *testing.T, o *OIDC, sessions *Sessions) testFlow {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	authURL, err := o.Begin(w, sessions, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testFlow{authURL: u, cookies: w.Result().Cookies()}
+}
+
+// callback is the request of the browser coming back from the provider
+func (f testFlow) callback(callback *url.URL) *http.Request {
+	r := httptest.NewRequest("GET", callback.String(), nil)
+
+	for _, cookie := range f.cookies {
+		r.AddCookie(cookie)
+	}
+
+	return r
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	provider := oidctest.NewProvider("tasks", "s3cret")
+	defer provider.Close()
+
+	provider.Subject = "0a1b2c"
+	provider.Claims = map[string]interface{}{"preferred_username": "alice", "groups": []string{"staff", "task-admins"}}
+
+	o := newTestOIDC(provider)
+	sessions := NewSessions(MemoryStore(), "", time.Hour)
+	flow := begin(t, o, sessions)
+
+	query := flow.authURL.Query()
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("state") == "" || query.Get("nonce") == "" {
+		t.Errorf("sign in without PKCE, state or nonce: %s", flow.authURL)
+	}
+
+	if query.Get("redirect_uri") != testRedirectURL || query.Get("scope") != "openid profile groups" {
+		t.Errorf("sign in with the wrong redirect or scopes: %s", flow.authURL)
+	}
+
+	callback, err := provider.SignIn(flow.authURL.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	identity, err := o.Finish(w, flow.callback(callback), sessions, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Identity{
+		Issuer:  provider.URL,
+		Subject: "0a1b2c",
+		User:    model.User{Name: "alice", Role: model.RoleAdmin, Groups: []string{"staff", "task-admins"}},
+	}
+
+	if !reflect.DeepEqual(identity, want) {
+		t.Errorf("identity %+v, want %+v", identity, want)
+	}
+
+	// the flow cookie is deleted once used
+	deleted := false
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == flowCookie && cookie.MaxAge < 0 {
+			deleted = true
+		}
+	}
+
+	if !deleted {
+		t.Error("the flow cookie is kept")
+	}
+
+	// the code can not be used twice
+	_, err = o.Finish(httptest.NewRecorder(), flow.callback(callback), sessions, false)
+
+	if !errors.Is(err, ErrRefused) {
+		t.Errorf("code used twice: %v, want %v", err, ErrRefused)
+	}
+}
+
+func TestOIDCFlowChecks(t *testing.T) {
+	provider := oidctest.NewProvider("tasks", "s3cret")
+	defer provider.Close()
+
+	provider.Claims = map[string]interface{}{"preferred_username": "bob", "groups": []string{"staff"}}
+
+	o := newTestOIDC(provider)
+	sessions := NewSessions(MemoryStore(), "", time.Hour)
+
+	tests := []struct {
+		name string
+		// finish returns the callback request of a sign in
+		finish func(t *testing.T) *http.Request
+		want   error
+	}{
+		{"state of another sign in", func(t *testing.T) *http.Request {
+			flow := begin(t, o, sessions)
+			callback, _ := provider.SignIn(flow.authURL.String())
+
+			query := callback.Query()
+			query.Set("state", "forged")
+			callback.RawQuery = query.Encode()
+
+			return flow.callback(callback)
+		}, ErrFlow},
+		{"without the flow cookie", func(t *testing.T) *http.Request {
+			flow := begin(t, o, sessions)
+			callback, _ := provider.SignIn(flow.authURL.String())
+
+			return httptest.NewRequest("GET", callback.String(), nil)
+		}, ErrFlow},
+		{"flow cookie of another server", func(t *testing.T) *http.Request {
+			other := NewSessions(MemoryStore(), "", time.Hour)
+			flow := begin(t, o, other)
+			callback, _ := provider.SignIn(flow.authURL.String())
+
+			return flow.callback(callback)
+		}, ErrFlow},
+		{"code of another sign in", func(t *testing.T) *http.Request {
+			// the code is bound to the PKCE challenge of the first sign
+			// in, the verifier of the second one does not match it
+			first := begin(t, o, sessions)
+			second := begin(t, o, sessions)
+			callback, _ := provider.SignIn(first.authURL.String())
+
+			query := callback.Query()
+			query.Set("state", second.authURL.Query().Get("state"))
+			callback.RawQuery = query.Encode()
+
+			return second.callback(callback)
+		}, ErrRefused},
+		{"ID token with another nonce", func(t *testing.T) *http.Request {
+			provider.Nonce = "replayed"
+			defer func() { provider.Nonce = "" }()
+
+			flow := begin(t, o, sessions)
+			callback, _ := provider.SignIn(flow.authURL.String())
+
+			return flow.callback(callback)
+		}, ErrFlow},
+		{"refused by the provider", func(t *testing.T) *http.Request {
+			flow := begin(t, o, sessions)
+			callback, _ := url.Parse(testRedirectURL + "?error=access_denied&state=" + flow.authURL.Query().Get("state"))
+
+			return flow.callback(callback)
+		}, ErrRefused},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := o.Finish(httptest.NewRecorder(), test.finish(t), sessions, false)
+
+			if !errors.Is(err, test.want) {
+				t.Errorf("%v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestOIDCIdentity(t *testing.T) {
+	roles := map[string]string{"task-admins": model.RoleAdmin, "staff": model.RoleEditor, "guests": model.RoleViewer}
+
+	tests := []struct {
+		name        string
+		defaultRole string
+		claims      map[string]interface{}
+		want        model.User
+		err         error
+	}{
+		{"most powerful role of the groups", "", map[string]interface{}{"preferred_username": "alice", "groups": []interface{}{"guests", "task-admins", "staff"}},
+			model.User{Name: "alice", Role: model.RoleAdmin, Groups: []string{"guests", "task-admins", "staff"}}, nil},
+		{"single group", "", map[string]interface{}{"preferred_username": "bob", "groups": "staff"},
+			model.User{Name: "bob", Role: model.RoleEditor, Groups: []string{"staff"}}, nil},
+		{"name from the email", "", map[string]interface{}{"email": "carol@example.com", "groups": []interface{}{"guests"}},
+			model.User{Name: "carol@example.com", Role: model.RoleViewer, Groups: []string{"guests"}}, nil},
+		{"name from the subject", "", map[string]interface{}{"groups": []interface{}{"guests"}},
+			model.User{Name: "0a1b2c", Role: model.RoleViewer, Groups: []string{"guests"}}, nil},
+		{"default role without groups", model.RoleViewer, map[string]interface{}{"preferred_username": "dave"},
+			model.User{Name: "dave", Role: model.RoleViewer, Groups: []string{}}, nil},
+		{"default role of unknown groups", model.RoleViewer, map[string]interface{}{"preferred_username": "erin", "groups": []interface{}{"sales"}},
+			model.User{Name: "erin", Role: model.RoleViewer, Groups: []string{"sales"}}, nil},
+		{"groups above the default role", model.RoleViewer, map[string]interface{}{"preferred_username": "frank", "groups": []interface{}{"staff"}},
+			model.User{Name: "frank", Role: model.RoleEditor, Groups: []string{"staff"}}, nil},
+		{"no role", "", map[string]interface{}{"preferred_username": "grace", "groups": []interface{}{"sales"}},
+			model.User{Name: "grace", Role: "", Groups: []string{"sales"}}, ErrNoRole},
+	}
+
+	for _, test := range tests {
+		o := NewOIDC(OIDCConfig{UsernameClaim: "preferred_username", GroupsClaim: "groups", Roles: roles, DefaultRole: test.defaultRole})
+		identity, err := o.identity("https://login.example.com", "0a1b2c", test.claims)
+
+		if err != test.err || !reflect.DeepEqual(identity.User, test.want) {
+			t.Errorf("%s: %+v %v, want %+v %v", test.name, identity.User, err, test.want, test.err)
+		}
+	}
+}
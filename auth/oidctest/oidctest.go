@@ -0,0 +1,288 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package oidctest runs an OpenID Connect provider for the tests of the
+// sign in, like net/http/httptest runs servers. It serves the discovery
+// document, the keys, the authorization and the token endpoints of the
+// authorization code flow with PKCE
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// keyID identifies the signing key in the ID tokens and the key set
+const keyID = "oidctest"
+
+// authorization is a code given to the client, with what the token request
+// must match
+type authorization struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      map[string]interface{}
+}
+
+// Provider is an identity provider signing in every user it is asked to,
+// as the subject and with the claims set before the sign in
+type Provider struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	// Subject and Claims are put in the ID token of the next sign in
+	Subject string
+	Claims  map[string]interface{}
+
+	// Nonce replaces the nonce of the next ID token when set, as an
+	// attacker replaying a token would
+	Nonce string
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// NewProvider starts a provider for the client, it is stopped with Close
+func NewProvider(clientID string, clientSecret string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		panic(err)
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Subject:      "user-1",
+		Claims:       map[string]interface{}{},
+		key:          key,
+		codes:        make(map[string]authorization),
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	router.HandleFunc("/keys", p.keys)
+	router.HandleFunc("/authorize", p.authorize)
+	router.HandleFunc("/token", p.token)
+
+	p.Server = httptest.NewServer(router)
+
+	return p
+}
+
+// SignIn follows the url of the provider a client sends the user to, it
+// returns the url of the client the provider sends the user back to
+func (p *Provider) SignIn(authURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Get(authURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, errors.New("the provider refused the sign in: " + resp.Status)
+	}
+
+	return url.Parse(resp.Header.Get("Location"))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (p *Provider) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, 200, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   encode(p.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs the user in at once and sends them back with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != p.ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "unknown client or response type", 400)
+		return
+	}
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", 400)
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+
+	if err != nil || query.Get("state") == "" {
+		http.Error(w, "invalid redirect_uri or state", 400)
+		return
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	code := hex.EncodeToString(b)
+
+	p.mu.Lock()
+	claims := map[string]interface{}{}
+
+	for name, value := range p.Claims {
+		claims[name] = value
+	}
+
+	nonce := query.Get("nonce")
+
+	if p.Nonce != "" {
+		nonce = p.Nonce
+	}
+
+	claims["sub"] = p.Subject
+	p.codes[code] = authorization{redirectURI: redirect.String(), challenge: query.Get("code_challenge"), nonce: nonce, claims: claims}
+	p.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", query.Get("state"))
+	redirect.RawQuery = back.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token, once, when the client proves it
+// holds the verifier of the challenge of the code
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+
+	if !ok {
+		clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	if clientID != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, 401, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+	if !ok || auth.redirectURI != r.PostFormValue("redirect_uri") || encode(challenge[:]) != auth.challenge {
+		writeJSON(w, 400, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := auth.claims
+	claims["iss"] = p.URL
+	claims["aud"] = p.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	claims["nonce"] = auth.nonce
+
+	idToken, err := p.sign(claims)
+
+	if err != nil {
+		writeJSON(w, 500, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, 200, map[string]interface{}{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// sign returns the claims as a JWT signed with RS256
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + encode(signature), nil
+}
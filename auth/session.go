@@ -0,0 +1,220 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Cookies and header of the sessions
+const (
+	// SessionCookie carries the encrypted id of the session, the scripts
+	// of the pages can not read it
+	SessionCookie = "session"
+
+	// CSRFCookie carries the csrf token of the session for the scripts of
+	// the web UI to send it back in CSRFHeader
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Sessions starts and ends the sessions of the web UI. The id of a session
+// is encrypted and authenticated with the key before it is sent in a
+// cookie, the session itself is kept in the store
+type Sessions struct {
+	store  Store
+	aead   cipher.AEAD
+	maxAge time.Duration
+}
+
+// NewSessions returns the sessions kept in store, which last maxAge. An
+// empty key is replaced by a random one, the sessions then end with the
+// process
+func NewSessions(store Store, key string, maxAge time.Duration) *Sessions {
+	secret := []byte(key)
+
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+
+	// the key can be any string, AES needs 32 bytes
+	sum := sha256.Sum256(secret)
+	block, _ := aes.NewCipher(sum[:])
+	aead, _ := cipher.NewGCM(block)
+
+	return &Sessions{store: store, aead: aead, maxAge: maxAge}
+}
+
+// Start creates a session for the user and sets its cookies, they are only
+// sent over https when secure
+func (s *Sessions) Start(ctx context.Context, w http.ResponseWriter, userID int, secure bool) (model.Session, error) {
+	session := model.Session{
+		ID:      randomString(32),
+		UserID:  userID,
+		CSRF:    randomString(32),
+		Expires: time.Now().Add(s.maxAge),
+	}
+
+	err := s.store.Save(ctx, session)
+
+	if err != nil {
+		return session, err
+	}
+
+	http.SetCookie(w, s.cookie(SessionCookie, s.seal(SessionCookie, session.ID), s.maxAge, secure, true))
+	http.SetCookie(w, s.cookie(CSRFCookie, session.CSRF, s.maxAge, secure, false))
+
+	return session, nil
+}
+
+// Get returns the session of the request, ErrNoSession when the request has
+// no valid session cookie
+func (s *Sessions) Get(r *http.Request) (model.Session, error) {
+	cookie, err := r.Cookie(SessionCookie)
+
+	if err != nil {
+		return model.Session{}, ErrNoSession
+	}
+
+	id, ok := s.open(SessionCookie, cookie.Value)
+
+	if !ok {
+		return model.Session{}, ErrNoSession
+	}
+
+	return s.store.Get(r.Context(), id)
+}
+
+// End deletes the session of the request, if any, and its cookies
+func (s *Sessions) End(w http.ResponseWriter, r *http.Request, secure bool) error {
+	http.SetCookie(w, s.cookie(SessionCookie, "", -1, secure, true))
+	http.SetCookie(w, s.cookie(CSRFCookie, "", -1, secure, false))
+
+	session, err := s.Get(r)
+
+	if err == ErrNoSession {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.store.Delete(r.Context(), session.ID)
+}
+
+// cookie is a cookie of the sessions, deleted when maxAge is negative. Lax
+// cookies are not sent with the requests other sites make with unsafe
+// methods, the csrf token covers the browsers ignoring SameSite
+func (s *Sessions) cookie(name string, value string, maxAge time.Duration, secure bool, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Secure:   secure,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge.Seconds())
+	}
+
+	return cookie
+}
+
+// SetSealed sets a cookie whose value is encrypted with the key, only the
+// server can read it
+func (s *Sessions) SetSealed(w http.ResponseWriter, name string, value string, maxAge time.Duration, secure bool) {
+	http.SetCookie(w, s.cookie(name, s.seal(name, value), maxAge, secure, true))
+}
+
+// Sealed returns the value of a cookie set by SetSealed and deletes it,
+// false when the request does not have it
+func (s *Sessions) Sealed(w http.ResponseWriter, r *http.Request, name string, secure bool) (string, bool) {
+	cookie, err := r.Cookie(name)
+
+	if err != nil {
+		return "", false
+	}
+
+	http.SetCookie(w, s.cookie(name, "", -1, secure, true))
+
+	return s.open(name, cookie.Value)
+}
+
+// seal encrypts the value of the cookie name, the name is authenticated
+// too so a value can not be moved to another cookie
+func (s *Sessions) seal(name string, value string) string {
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// open decrypts the value of the cookie name, it fails when the cookie was
+// not sealed with the key
+func (s *Sessions) open(name string, value string) (string, bool) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", false
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+
+	if err != nil {
+		return "", false
+	}
+
+	return string(plain), true
+}
+
+// CheckCSRF tells if the request carries the csrf token of the session both
+// in CSRFHeader and in CSRFCookie. Other sites can make a browser send the
+// cookies, but they can neither read them nor set the header
+func CheckCSRF(r *http.Request, session model.Session) bool {
+	header := r.Header.Get(CSRFHeader)
+	cookie, err := r.Cookie(CSRFCookie)
+
+	if err != nil || header == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(header), []byte(session.CSRF)) == 1
+}
@@ -0,0 +1,251 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// started starts a session of the user 7, and returns it with the request
+// of the browser sending its cookies back
+func started(t *testing.T, s *Sessions) (model.Session, *http.Request) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	session, err := s.Start(context.Background(), w, 7, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/api/v1/task/", nil)
+
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	return session, r
+}
+
+func TestSessionCookies(t *testing.T) {
+	s := NewSessions(MemoryStore(), "a key of at least thirty-two characters", time.Hour)
+
+	w := httptest.NewRecorder()
+	session, err := s.Start(context.Background(), w, 7, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := map[string]*http.Cookie{}
+
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	id, csrf := cookies[SessionCookie], cookies[CSRFCookie]
+
+	if id == nil || csrf == nil {
+		t.Fatalf("got the cookies %v, want the session and its csrf token", cookies)
+	}
+
+	if strings.Contains(id.Value, session.ID) || !id.HttpOnly || !id.Secure || id.SameSite != http.SameSiteLaxMode || id.MaxAge != 3600 {
+		t.Errorf("session cookie %+v, want the sealed id in an http only, secure and lax cookie", id)
+	}
+
+	// the scripts of the ui read the csrf token
+	if csrf.Value != session.CSRF || csrf.HttpOnly || !csrf.Secure || csrf.MaxAge != 3600 {
+		t.Errorf("csrf cookie %+v, want the token readable by the scripts", csrf)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(id)
+
+	if got, err := s.Get(r); err != nil || got.ID != session.ID || got.UserID != 7 {
+		t.Errorf("got the session %+v %v, want %+v", got, err, session)
+	}
+}
+
+func TestSealedCookiesCanNotBeForged(t *testing.T) {
+	s := NewSessions(MemoryStore(), "a key of at least thirty-two characters", time.Hour)
+	session, r := started(t, s)
+	sealed, _ := r.Cookie(SessionCookie)
+
+	tampered := []byte(sealed.Value)
+	tampered[len(tampered)/2] ^= 'A' ^ 'B'
+
+	values := map[string]string{
+		"the plain id":          session.ID,
+		"a tampered value":      string(tampered),
+		"a truncated value":     sealed.Value[:10],
+		"a value not in base64": "not base64!",
+	}
+
+	for name, value := range values {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookie, Value: value})
+
+		if _, err := s.Get(r); err != ErrNoSession {
+			t.Errorf("%s: %v, want ErrNoSession", name, err)
+		}
+	}
+
+	// another key can not open the cookie
+	other := NewSessions(MemoryStore(), "another key of thirty-two characters", time.Hour)
+
+	if _, err := other.Get(r); err != ErrNoSession {
+		t.Errorf("cookie opened with another key: %v, want ErrNoSession", err)
+	}
+
+	// nor can the cookie be moved to another sealed cookie
+	w := httptest.NewRecorder()
+	moved := httptest.NewRequest("GET", "/", nil)
+	moved.AddCookie(&http.Cookie{Name: "oidc_state", Value: sealed.Value})
+
+	if value, ok := s.Sealed(w, moved, "oidc_state", true); ok {
+		t.Errorf("the session cookie opened as oidc_state: %q", value)
+	}
+}
+
+func TestSealed(t *testing.T) {
+	s := NewSessions(MemoryStore(), "", time.Hour)
+
+	w := httptest.NewRecorder()
+	s.SetSealed(w, "oidc_state", "state and verifier", 10*time.Minute, false)
+
+	cookie := w.Result().Cookies()[0]
+
+	if strings.Contains(cookie.Value, "state") || !cookie.HttpOnly || cookie.MaxAge != 600 {
+		t.Errorf("cookie %+v, want the value sealed in an http only cookie", cookie)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+
+	if value, ok := s.Sealed(w, r, "oidc_state", false); !ok || value != "state and verifier" {
+		t.Errorf("got %q %v, want the value", value, ok)
+	}
+
+	// the cookie is only read once
+	if deleted := w.Result().Cookies(); len(deleted) != 1 || deleted[0].MaxAge != -1 {
+		t.Errorf("got the cookies %v, want oidc_state deleted", deleted)
+	}
+
+	if _, ok := s.Sealed(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), "oidc_state", false); ok {
+		t.Error("opened a missing cookie")
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	s := NewSessions(MemoryStore(), "", time.Hour)
+	session, _ := started(t, s)
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   bool
+	}{
+		{"token in the header and the cookie", session.CSRF, session.CSRF, true},
+		{"no header", "", session.CSRF, false},
+		{"no cookie", session.CSRF, "", false},
+		{"header not the cookie", "forged", session.CSRF, false},
+		{"token of another session", "forged", "forged", false},
+		{"prefix of the token", session.CSRF[:8], session.CSRF[:8], false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/api/v1/task/", nil)
+
+		if test.header != "" {
+			r.Header.Set(CSRFHeader, test.header)
+		}
+
+		if test.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: test.cookie})
+		}
+
+		if got := CheckCSRF(r, session); got != test.want {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	store := MemoryStore()
+	s := NewSessions(store, "", time.Hour)
+	session, r := started(t, s)
+
+	session.Expires = time.Now().Add(-time.Second)
+
+	if err := store.Save(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(r); err != ErrNoSession {
+		t.Errorf("expired session: %v, want ErrNoSession", err)
+	}
+
+	// the expired sessions are dropped when the next one is saved
+	started(t, s)
+
+	if _, err := store.Get(context.Background(), session.ID); err != ErrNoSession {
+		t.Errorf("expired session kept: %v", err)
+	}
+
+	if kept := len(store.(*memoryStore).sessions); kept != 1 {
+		t.Errorf("%d sessions kept, want the one that has not expired", kept)
+	}
+}
+
+func TestEndSession(t *testing.T) {
+	s := NewSessions(MemoryStore(), "", time.Hour)
+	_, r := started(t, s)
+
+	w := httptest.NewRecorder()
+
+	if err := s.End(w, r, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge != -1 {
+			t.Errorf("cookie %s kept", cookie.Name)
+		}
+	}
+
+	if _, err := s.Get(r); err != ErrNoSession {
+		t.Errorf("ended session: %v, want ErrNoSession", err)
+	}
+
+	// ending without a session only deletes the cookies
+	if err := s.End(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil), true); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// ErrNoSession is returned for the sessions that do not exist or expired
+var ErrNoSession = errors.New("No session")
+
+// Store keeps the sessions on the server, the cookies only carry their id
+type Store interface {
+	Save(ctx context.Context, session model.Session) error
+
+	// Get returns ErrNoSession when the session does not exist or expired
+	Get(ctx context.Context, id string) (model.Session, error)
+
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]model.Session
+}
+
+// MemoryStore keeps the sessions in the process, they are lost on restart
+// and not shared with the other instances
+func MemoryStore() Store {
+	return &memoryStore{sessions: make(map[string]model.Session)}
+}
+
+func (s *memoryStore) Save(ctx context.Context, session model.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for id, other := range s.sessions {
+		if now.After(other.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+
+	s.sessions[session.ID] = session
+
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id string) (model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+
+	if !ok || time.Now().After(session.Expires) {
+		return model.Session{}, ErrNoSession
+	}
+
+	return session, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+
+	return nil
+}
+
+type postgresStore struct {
+	cfg db.Config
+}
+
+// PostgresStore keeps the sessions in the sessions table, shared by every
+// instance using the database
+func PostgresStore(cfg db.Config) Store {
+	return postgresStore{cfg: cfg}
+}
+
+func (s postgresStore) Save(ctx context.Context, session model.Session) error {
+	return db.SaveSession(ctx, s.cfg, session)
+}
+
+func (s postgresStore) Get(ctx context.Context, id string) (model.Session, error) {
+	session, err := db.GetSession(ctx, s.cfg, id)
+
+	if err == db.ErrNotFound {
+		return session, ErrNoSession
+	}
+
+	return session, err
+}
+
+func (s postgresStore) Delete(ctx context.Context, id string) error {
+	return db.DeleteSession(ctx, s.cfg, id)
+}
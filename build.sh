@@ -10,9 +10,8 @@ go mod tidy
 
 CGO_ENABLED="0" go build -ldflags="-s -w" -a -v -o TechChallengeApp .
 
-pushd ui
-rice append --exec ../TechChallengeApp
-popd
+# fail the build when the OpenAPI document and the routes drift apart
+./TechChallengeApp openapi --check || exit 1
 
 cp TechChallengeApp dist/
 cp conf.toml dist/
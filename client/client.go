@@ -0,0 +1,351 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package client talks to the REST api of a running server
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Config configuration for the client package
+type Config struct {
+	// URL of the server, e.g. http://localhost:3000, the api is under /api/v1
+	URL string
+
+	// Token is sent as a bearer token when set
+	Token string
+
+	Client *http.Client
+}
+
+// Client calls the api of a server
+type Client struct {
+	cfg Config
+}
+
+// New returns a client of the server of cfg
+func New(cfg Config) *Client {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+
+	return &Client{cfg: cfg}
+}
+
+// TaskFilter selects tasks, the zero value selects all of them
+type TaskFilter struct {
+	// Complete selects the finished or the open tasks when set
+	Complete *bool
+	// Search selects the tasks whose title contains it, ignoring case
+	Search string
+	// DueBefore selects the tasks due before it
+	DueBefore *time.Time
+	// DueAfter selects the tasks due after it
+	DueAfter *time.Time
+}
+
+func (f TaskFilter) query() url.Values {
+	query := url.Values{}
+
+	if f.Complete != nil {
+		query.Set("complete", strconv.FormatBool(*f.Complete))
+	}
+
+	if f.Search != "" {
+		query.Set("search", f.Search)
+	}
+
+	if f.DueBefore != nil {
+		query.Set("dueBefore", f.DueBefore.Format(time.RFC3339))
+	}
+
+	if f.DueAfter != nil {
+		query.Set("dueAfter", f.DueAfter.Format(time.RFC3339))
+	}
+
+	return query
+}
+
+// Error is an error response of the api
+type Error struct {
+	Status int
+	Detail string
+	Errors []string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	if len(e.Errors) > 0 {
+		msg += " (" + strings.Join(e.Errors, ", ") + ")"
+	}
+
+	return msg
+}
+
+// ListTasks returns the tasks matching the filter, by id
+func (c *Client) ListTasks(ctx context.Context, filter TaskFilter) ([]model.Task, error) {
+	var tasks []model.Task
+
+	path := "/task/"
+
+	if query := filter.query(); len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	err := c.do(ctx, "GET", path, nil, &tasks)
+
+	return tasks, err
+}
+
+// GetTask returns the task with the id, there is no endpoint for a single
+// task so it is picked from the list
+func (c *Client) GetTask(ctx context.Context, id int) (model.Task, error) {
+	tasks, err := c.ListTasks(ctx, TaskFilter{})
+
+	if err != nil {
+		return model.Task{}, err
+	}
+
+	for _, task := range tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+
+	return model.Task{}, &Error{Status: http.StatusNotFound, Detail: fmt.Sprintf("task %d does not exist", id)}
+}
+
+// AddTask creates the task, its id is ignored
+func (c *Client) AddTask(ctx context.Context, task model.Task) (model.Task, error) {
+	var created model.Task
+
+	err := c.do(ctx, "POST", "/task/", task, &created)
+
+	return created, err
+}
+
+// UpdateTask replaces the task with the id of task
+func (c *Client) UpdateTask(ctx context.Context, task model.Task) (model.Task, error) {
+	var updated model.Task
+
+	err := c.do(ctx, "PUT", fmt.Sprintf("/task/%d/", task.ID), task, &updated)
+
+	return updated, err
+}
+
+// DeleteTask deletes the task with the id
+func (c *Client) DeleteTask(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/task/%d/", id), nil, nil)
+}
+
+// TaskEvent is a change made to a task, deleted tasks only have their id
+type TaskEvent struct {
+	// Type is created, updated or deleted
+	Type string
+	Task model.Task
+}
+
+// WatchTasks streams the changes made to the tasks until ctx is done or
+// the server closes the stream, the channel is closed then
+func (c *Client) WatchTasks(ctx context.Context) (<-chan TaskEvent, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.cfg.URL+"/api/v1/task/stream", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("User-Agent", "TechChallengeApp-Client")
+
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	// the stream outlives the timeout of the other calls
+	stream := *c.cfg.Client
+	stream.Timeout = 0
+
+	resp, err := stream.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+
+	events := make(chan TaskEvent)
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		var event TaskEvent
+		var data string
+
+		scanner := bufio.NewScanner(resp.Body)
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event.Type = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			case line == "" && data != "":
+				if json.Unmarshal([]byte(data), &event.Task) == nil {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				event, data = TaskEvent{}, ""
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// do calls the api, sending in as JSON when set and reading the data of
+// the response envelope into out when set
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		js, err := json.Marshal(in)
+
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.URL+"/api/v1"+path, body)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "TechChallengeApp-Client")
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	resp, err := c.cfg.Client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return readError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{out}
+
+	return json.NewDecoder(resp.Body).Decode(&envelope)
+}
+
+// readError reads the problem details, or the message, of an error response
+func readError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	if mediaType != "application/problem+json" {
+		apiErr.Detail = strings.TrimSpace(string(b))
+		return apiErr
+	}
+
+	var problem struct {
+		Detail string `json:"detail"`
+		Errors []struct {
+			Detail    string `json:"detail"`
+			Pointer   string `json:"pointer"`
+			Parameter string `json:"parameter"`
+		} `json:"errors"`
+	}
+
+	if json.Unmarshal(b, &problem) != nil {
+		apiErr.Detail = strings.TrimSpace(string(b))
+		return apiErr
+	}
+
+	apiErr.Detail = problem.Detail
+
+	for _, e := range problem.Errors {
+		where := e.Parameter
+
+		if e.Pointer != "" {
+			where = e.Pointer
+		}
+
+		if where != "" {
+			apiErr.Errors = append(apiErr.Errors, where+": "+e.Detail)
+		} else {
+			apiErr.Errors = append(apiErr.Errors, e.Detail)
+		}
+	}
+
+	return apiErr
+}
@@ -0,0 +1,402 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// fakeAPI answers the task routes of /api/v1 from memory, the way the
+// server does: in the data envelope, with problem details on errors
+type fakeAPI struct {
+	mu       sync.Mutex
+	tasks    []model.Task
+	next     int
+	requests []*http.Request
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r)
+
+	if r.Header.Get("Authorization") == "Bearer bad" {
+		problem(w, http.StatusUnauthorized, "The token is not valid", nil)
+		return
+	}
+
+	// a proxy in front of the server answers with text
+	if r.Header.Get("Authorization") == "Bearer proxied" {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/task/")
+
+	switch {
+	case path == "" && r.Method == "GET":
+		var tasks []model.Task
+
+		for _, task := range f.tasks {
+			if search := r.URL.Query().Get("search"); !strings.Contains(task.Title, search) {
+				continue
+			}
+
+			if complete := r.URL.Query().Get("complete"); complete != "" && complete != strconv.FormatBool(task.Complete) {
+				continue
+			}
+
+			tasks = append(tasks, task)
+		}
+
+		envelope(w, http.StatusOK, tasks)
+	case path == "" && r.Method == "POST":
+		var task model.Task
+		json.NewDecoder(r.Body).Decode(&task)
+
+		if task.Title == "" {
+			problem(w, http.StatusBadRequest, "The task is not valid", []map[string]string{{"pointer": "/title", "detail": "is required"}})
+			return
+		}
+
+		f.next++
+		task.ID = f.next
+		f.tasks = append(f.tasks, task)
+
+		envelope(w, http.StatusCreated, task)
+	default:
+		id, _ := strconv.Atoi(strings.TrimSuffix(path, "/"))
+
+		for i, task := range f.tasks {
+			if task.ID != id {
+				continue
+			}
+
+			if r.Method == "DELETE" {
+				f.tasks = append(f.tasks[:i], f.tasks[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			json.NewDecoder(r.Body).Decode(&f.tasks[i])
+			f.tasks[i].ID = id
+
+			envelope(w, http.StatusOK, f.tasks[i])
+			return
+		}
+
+		problem(w, http.StatusNotFound, fmt.Sprintf("Task %d does not exist", id), nil)
+	}
+}
+
+func envelope(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func problem(w http.ResponseWriter, status int, detail string, errs []map[string]string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "detail": detail, "errors": errs})
+}
+
+// testClient returns a client of a fake api holding the tasks
+func testClient(t *testing.T, token string, tasks ...model.Task) (*Client, *fakeAPI) {
+	api := &fakeAPI{tasks: tasks, next: len(tasks)}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	return New(Config{URL: server.URL + "/", Token: token}), api
+}
+
+func TestTasks(t *testing.T) {
+	ctx := context.Background()
+	c, _ := testClient(t, "")
+
+	created, err := c.AddTask(ctx, model.Task{ID: 9, Title: "Write tests", Priority: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created != (model.Task{ID: 1, Title: "Write tests", Priority: 2}) {
+		t.Errorf("created %+v", created)
+	}
+
+	created.Complete = true
+	updated, err := c.UpdateTask(ctx, created)
+
+	if err != nil || !updated.Complete {
+		t.Fatalf("updated %+v: %v", updated, err)
+	}
+
+	got, err := c.GetTask(ctx, 1)
+
+	if err != nil || got != updated {
+		t.Errorf("got %+v, want %+v: %v", got, updated, err)
+	}
+
+	if err := c.DeleteTask(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := c.ListTasks(ctx, TaskFilter{})
+
+	if err != nil || len(tasks) != 0 {
+		t.Errorf("got %+v: %v", tasks, err)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	c, api := testClient(t, "secret", model.Task{ID: 1, Title: "Task"})
+
+	c.ListTasks(context.Background(), TaskFilter{})
+	c.AddTask(context.Background(), model.Task{Title: "Task"})
+
+	get, post := api.requests[0], api.requests[1]
+
+	for _, r := range api.requests {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("%s: Authorization is %q", r.Method, got)
+		}
+
+		if got := r.Header.Get("Accept"); got != "application/json" {
+			t.Errorf("%s: Accept is %q", r.Method, got)
+		}
+
+		if got := r.Header.Get("User-Agent"); got != "TechChallengeApp-Client" {
+			t.Errorf("%s: User-Agent is %q", r.Method, got)
+		}
+	}
+
+	if get.URL.Path != "/api/v1/task/" || get.Header.Get("Content-Type") != "" {
+		t.Errorf("GET %s with Content-Type %q", get.URL.Path, get.Header.Get("Content-Type"))
+	}
+
+	if post.URL.Path != "/api/v1/task/" || post.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("POST %s with Content-Type %q", post.URL.Path, post.Header.Get("Content-Type"))
+	}
+
+	c, api = testClient(t, "")
+	c.ListTasks(context.Background(), TaskFilter{})
+
+	if got := api.requests[0].Header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization is %q without a token", got)
+	}
+}
+
+func TestTaskFilter(t *testing.T) {
+	done := true
+	before := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2029, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter TaskFilter
+		query  string
+	}{
+		{"none", TaskFilter{}, ""},
+		{"complete", TaskFilter{Complete: &done}, "complete=true"},
+		{"search", TaskFilter{Search: "a b&c"}, "search=a+b%26c"},
+		{"due", TaskFilter{DueBefore: &before, DueAfter: &after}, "dueAfter=2029-01-02T15%3A04%3A05Z&dueBefore=2030-01-02T00%3A00%3A00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, api := testClient(t, "")
+
+			if _, err := c.ListTasks(context.Background(), tt.filter); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := api.requests[0].URL.RawQuery; got != tt.query {
+				t.Errorf("query is %q, want %q", got, tt.query)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		token string
+		call  func(c *Client) error
+		want  Error
+	}{
+		{"unknown task", "", func(c *Client) error { return c.DeleteTask(ctx, 7) },
+			Error{Status: 404, Detail: "Task 7 does not exist"}},
+		{"not listed", "", func(c *Client) error { _, err := c.GetTask(ctx, 7); return err },
+			Error{Status: 404, Detail: "task 7 does not exist"}},
+		{"invalid", "", func(c *Client) error { _, err := c.AddTask(ctx, model.Task{}); return err },
+			Error{Status: 400, Detail: "The task is not valid", Errors: []string{"/title: is required"}}},
+		{"unauthorized", "bad", func(c *Client) error { _, err := c.ListTasks(ctx, TaskFilter{}); return err },
+			Error{Status: 401, Detail: "The token is not valid"}},
+		{"not a problem", "proxied", func(c *Client) error { _, err := c.UpdateTask(ctx, model.Task{ID: 1}); return err },
+			Error{Status: 502, Detail: "upstream unavailable"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := testClient(t, tt.token)
+
+			var apiErr *Error
+
+			if err := tt.call(c); !errors.As(err, &apiErr) {
+				t.Fatalf("got %v, want an *Error", err)
+			}
+
+			if !reflect.DeepEqual(*apiErr, tt.want) {
+				t.Errorf("got %+v, want %+v", *apiErr, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Status: 400, Detail: "The task is not valid", Errors: []string{"/title: is required", "/priority: is negative"}}
+
+	if got, want := err.Error(), "400 Bad Request: The task is not valid (/title: is required, /priority: is negative)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := (&Error{Status: 503}).Error(), "503 Service Unavailable"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWatchTasks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/task/stream" || r.Header.Get("Accept") != "text/event-stream" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": comment\n\n")
+		fmt.Fprint(w, "event: created\ndata: {\"id\":1,\"title\":\"New\"}\n\n")
+		fmt.Fprint(w, "event: updated\ndata: not json\n\n")
+		fmt.Fprint(w, "event: deleted\ndata: {\"id\":1}\n\n")
+	}))
+	defer server.Close()
+
+	// the timeout of the calls does not end the stream
+	c := New(Config{URL: server.URL, Client: &http.Client{Timeout: time.Nanosecond}})
+
+	events, err := c.WatchTasks(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []TaskEvent
+
+	for event := range events {
+		got = append(got, event)
+	}
+
+	want := []TaskEvent{
+		{Type: "created", Task: model.Task{ID: 1, Title: "New"}},
+		{Type: "deleted", Task: model.Task{ID: 1}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWatchTasksErrors(t *testing.T) {
+	c, _ := testClient(t, "bad")
+
+	_, err := c.WatchTasks(context.Background())
+
+	var apiErr *Error
+
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("got %v, want a 401", err)
+	}
+}
+
+func TestWatchTasksEndsWithTheContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for {
+			if _, err := fmt.Fprint(w, "event: created\ndata: {\"id\":1}\n\n"); err != nil {
+				return
+			}
+
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := New(Config{URL: server.URL}).WatchTasks(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-events
+	cancel()
+
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("the events are not closed")
+	case <-drain(events):
+	}
+}
+
+// drain reads the events until they are closed
+func drain(events <-chan TaskEvent) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		for range events {
+		}
+
+		close(done)
+	}()
+
+	return done
+}
@@ -0,0 +1,103 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/servian/TechChallengeApp/config"
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspects the configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Shows the configuration",
+	Long: `Shows the configuration files in the order they are merged, and every value and where it comes from:
+its default, the configuration file,
+an environment variable or the --set flag, and the reference it was read from, e.g. file:///run/secrets/db.
+Secrets are redacted`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(conf.Files) == 0 {
+			fmt.Print("No configuration file, searched in: ", strings.Join(config.SearchPath(), ", "), "\n\n")
+		} else {
+			fmt.Println("Configuration files, later files override earlier ones:")
+
+			for i, file := range conf.Files {
+				fmt.Printf("  %d. %s\n", i+1, file)
+			}
+
+			fmt.Println()
+		}
+
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "KEY\tVALUE\tSOURCE\tREFERENCE")
+
+		for _, v := range conf.Values() {
+			value := v.Value
+
+			if v.Secret && value != "" {
+				value = "<redacted>"
+			}
+
+			source := v.Source
+
+			if v.File != "" {
+				source += " " + v.File
+			}
+
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", v.Key, value, source, v.Ref)
+		}
+
+		table.Flush()
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the configuration",
+	Long:  `Checks the configuration, listing every invalid value and unknown key. Exits with 1 when it is invalid`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := conf.Validate()
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "The configuration is invalid:\n%s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("The configuration is valid")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd, configValidateCmd)
+}
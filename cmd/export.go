@@ -0,0 +1,127 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/taskio"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports tasks",
+	Long: `Exports all tasks from the database defined in the configuration file as a JSON array,
+a CSV file, a Markdown checklist or an iCalendar file. The format is inferred from the output file extension
+unless --format is used`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := exportTasks(cfg.UI.DB)
+
+		if err != nil {
+			slog.Error("Error exporting tasks", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var exportFormatOption string
+var exportOutputOption string
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportFormatOption, "format", "f", "", "Format of the export: json, csv, md or ics (default json)")
+	exportCmd.Flags().StringVarP(&exportOutputOption, "output", "o", "-", "File to write to, - for stdout")
+}
+
+func exportTasks(cfg db.Config) error {
+	format, err := fileFormat(exportFormatOption, exportOutputOption)
+
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+
+	if exportOutputOption != "-" {
+		out, err = os.Create(exportOutputOption)
+
+		if err != nil {
+			return err
+		}
+
+		defer out.Close()
+	}
+
+	buf := bufio.NewWriter(out)
+
+	writer, err := taskio.NewWriter(buf, format)
+
+	if err != nil {
+		return err
+	}
+
+	// whoever can reach the database can export every list
+	err = db.ForEachTask(access.AsSystem(context.Background()), cfg, 0, writer.Write)
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+
+	if err != nil {
+		return err
+	}
+
+	err = buf.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	if out != os.Stdout {
+		return out.Close()
+	}
+
+	return nil
+}
+
+// fileFormat picks the format from the flag, or the file extension when
+// the flag is not set, json is used for stdin and stdout
+func fileFormat(flag string, file string) (taskio.Format, error) {
+	if flag != "" {
+		return taskio.ParseFormat(flag)
+	}
+
+	if file == "-" {
+		return taskio.JSON, nil
+	}
+
+	return taskio.FormatFromFilename(file)
+}
@@ -0,0 +1,140 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/taskio"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Imports tasks",
+	Long: `Imports tasks from a JSON array, a CSV file, a Markdown checklist or an iCalendar file into the database
+defined in the configuration file. Use - to read from stdin. The format is inferred from the
+file extension unless --format is used. The running servers see the imported tasks when DbNotify is set`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var broker *events.Broker
+
+		if cfg.Notify {
+			broker = events.NewBroker()
+			err := broker.ListenPostgres(cfg.UI.DB)
+
+			if err != nil {
+				slog.Error("Error notifying the servers", "error", err)
+				os.Exit(1)
+			}
+
+			defer broker.Close()
+		}
+
+		err := importTasks(cfg.UI.DB, broker, args[0])
+
+		if err != nil {
+			slog.Error("Error importing tasks", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var importFormatOption string
+var importDryRunOption bool
+var importConflictOption string
+var importListOption int
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVarP(&importFormatOption, "format", "f", "", "Format of the file: json, csv, md or ics")
+	importCmd.Flags().BoolVarP(&importDryRunOption, "dry-run", "n", false, "Report what would be imported without importing anything")
+	importCmd.Flags().StringVarP(&importConflictOption, "conflict", "c", db.ConflictSkip, "What to do with tasks whose id already exists: skip, overwrite or fail")
+	importCmd.Flags().IntVarP(&importListOption, "list", "l", 0, "Id of the list of the tasks without one, the first list when not set")
+}
+
+// importTasks imports the file, the events of the tasks are published to
+// broker when it is not nil
+func importTasks(cfg db.Config, broker *events.Broker, file string) error {
+	format, err := fileFormat(importFormatOption, file)
+
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+
+	if file != "-" {
+		f, err := os.Open(file)
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		in = f
+	}
+
+	reader, err := taskio.NewReader(bufio.NewReader(in), format)
+
+	if err != nil {
+		return err
+	}
+
+	// whoever can reach the database can import to any list
+	ctx := access.AsSystem(context.Background())
+
+	result, err := db.ImportTasks(ctx, cfg, reader.Read, db.ImportOptions{
+		Conflict: importConflictOption,
+		DryRun:   importDryRunOption,
+		ListID:   importListOption,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if result.DryRun {
+		fmt.Print("Dry run, nothing was imported. ")
+	} else if broker != nil {
+		for _, task := range result.CreatedTasks {
+			broker.Publish(ctx, events.Event{Type: events.TaskCreated, Task: task})
+		}
+
+		for _, task := range result.UpdatedTasks {
+			broker.Publish(ctx, events.Event{Type: events.TaskUpdated, Task: task})
+		}
+	}
+
+	fmt.Printf("Created: %d, updated: %d, skipped: %d\n", result.Created, result.Updated, result.Skipped)
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/servian/TechChallengeApp/ui"
+	"github.com/spf13/cobra"
+)
+
+// openapiCmd represents the openapi command
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Prints the OpenAPI document of the api",
+	Long: `Prints the OpenAPI 3 document served at /api/v1/openapi.json.
+
+With --check the document is validated and compared with the routes of the
+api instead, the command fails when a route is not documented, a documented
+operation is not routed, or a schema does not match its go type.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if checkSpecOption {
+			err := ui.CheckSpec()
+
+			if err != nil {
+				slog.Error("Error checking the OpenAPI document", "error", err)
+				os.Exit(1)
+			}
+
+			slog.Info("The OpenAPI document matches the routes")
+			return
+		}
+
+		spec, err := ui.Spec()
+
+		if err != nil {
+			slog.Error("Error generating the OpenAPI document", "error", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(spec))
+	},
+}
+
+var checkSpecOption bool
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+	openapiCmd.Flags().BoolVar(&checkSpecOption, "check", false, "Fail when the document and the routes of the api drift apart")
+}
@@ -22,15 +22,24 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/servian/TechChallengeApp/auth"
+	"github.com/servian/TechChallengeApp/client"
 	"github.com/servian/TechChallengeApp/config"
 	"github.com/servian/TechChallengeApp/daemon"
+	"github.com/servian/TechChallengeApp/logging"
 	"github.com/spf13/cobra"
 )
 
-var cfgFile string
+var cfgFiles []string
+var cfgEnv string
 var cfg *daemon.Config
+var clientCfg client.Config
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -57,25 +66,89 @@ Please visit http://Servian.com for more details`,
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		slog.Error("Error running command", "error", err)
 		os.Exit(1)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().StringArrayVar(&cfgFiles, "config", nil, "Configuration file, toml, yaml or json, can be repeated to merge files in order (default the conf files of the search path)")
+	rootCmd.PersistentFlags().StringVar(&cfgEnv, "env", "", "Environment whose overlays are merged after the configuration files, e.g. production for conf.production.toml (default $VTT_ENV)")
+	rootCmd.PersistentFlags().StringArrayVar(&cfgOverrides, "set", nil, "Sets a configuration value, e.g. --set ListenPort=8080, can be repeated")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if configExempt(cmd) {
+			return
+		}
+
+		if err := conf.Validate(); err != nil {
+			slog.Error("Invalid configuration, see TechChallengeApp config validate", "error", err)
+			os.Exit(1)
+		}
+	}
 }
 
+var cfgOverrides []string
+var conf *config.Config
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	conf, err := config.LoadConfig()
+	overrides := map[string]string{}
+
+	for _, o := range cfgOverrides {
+		key, value, found := strings.Cut(o, "=")
+
+		if !found {
+			slog.Error("Error loading configuration", "error", fmt.Errorf("--set must be like Key=Value, not %q", o))
+			os.Exit(1)
+		}
+
+		overrides[strings.TrimSpace(key)] = value
+	}
+
+	var err error
+	conf, err = config.LoadConfig(config.Options{Files: cfgFiles, Env: cfgEnv, Overrides: overrides})
 
 	if err != nil {
-		fmt.Print(err)
+		slog.Error("Error loading configuration", "error", err)
 		os.Exit(1)
 	}
 
-	cfg = &daemon.Config{}
+	// an invalid log configuration is reported by the validation
+	logger, err := logging.New(os.Stderr, logging.Config{Format: conf.LogFormat, Level: conf.LogLevel})
+
+	if err == nil {
+		slog.SetDefault(logger)
+	}
+
+	cfg = daemonConfig(conf)
+	cfg.Reload = func() (*daemon.Config, error) {
+		next, err := config.LoadConfig(config.Options{Files: cfgFiles, Env: cfgEnv, Overrides: overrides})
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = next.Validate()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return daemonConfig(next), nil
+	}
+
+	clientCfg.URL = conf.ApiUrl
+	clientCfg.Token = conf.ApiToken
+
+	if clientCfg.URL == "" {
+		clientCfg.URL = "http://" + net.JoinHostPort(localHost(conf.ListenHost), conf.ListenPort)
+	}
+}
+
+// daemonConfig is the configuration of the daemon package
+func daemonConfig(conf *config.Config) *daemon.Config {
+	cfg := &daemon.Config{}
 	cfg.UI.DB.DbName = conf.DbName
 	cfg.UI.DB.DbPassword = conf.DbPassword
 	cfg.UI.DB.DbUser = conf.DbUser
@@ -83,4 +156,85 @@ func initConfig() {
 	cfg.UI.DB.DbPort = conf.DbPort
 	cfg.ListenSpec = conf.ListenHost + ":" + conf.ListenPort
 
+	if conf.GrpcPort != "" {
+		cfg.GrpcListenSpec = conf.ListenHost + ":" + conf.GrpcPort
+	}
+
+	if conf.MetricsPort != "" {
+		cfg.MetricsListenSpec = conf.ListenHost + ":" + conf.MetricsPort
+	}
+
+	cfg.Notify = conf.DbNotify
+	cfg.Tracing.Exporter = conf.TraceExporter
+	cfg.Tracing.Endpoint = conf.TraceEndpoint
+	cfg.Tracing.File = conf.TraceFile
+	cfg.Tracing.SampleRatio = conf.TraceSampleRatio
+	cfg.Tracing.Version = rootCmd.Version
+
+	cfg.UI.RateLimit.Rate = conf.RateLimit
+	cfg.UI.RateLimit.Burst = conf.RateBurst
+	cfg.UI.MaxBodySize = int64(conf.MaxBodySize)
+
+	cfg.UI.CORS.Origins = config.List(conf.CorsOrigins)
+	cfg.UI.CORS.Methods = config.List(conf.CorsMethods)
+	cfg.UI.CORS.Headers = config.List(conf.CorsHeaders)
+	cfg.UI.CORS.Credentials = conf.CorsCredentials
+	cfg.UI.CORS.MaxAge = time.Duration(conf.CorsMaxAge) * time.Second
+	cfg.UI.Security.HSTS = time.Duration(conf.HstsMaxAge) * time.Second
+	cfg.UI.Security.FrameAncestors = config.List(conf.FrameAncestors)
+
+	sessions := auth.PostgresStore(cfg.UI.DB)
+
+	if strings.EqualFold(conf.SessionStore, "memory") {
+		sessions = auth.MemoryStore()
+	}
+
+	cfg.UI.Auth.Sessions = auth.NewSessions(sessions, conf.SessionKey, time.Duration(conf.SessionMaxAge)*time.Second)
+	cfg.UI.Auth.Required = conf.AuthRequired
+
+	if conf.OidcIssuer != "" {
+		// invalid roles are reported by the validation
+		roles, _ := config.ParseRoles(conf.OidcRoles)
+
+		cfg.UI.Auth.OIDC = auth.NewOIDC(auth.OIDCConfig{
+			Issuer:        conf.OidcIssuer,
+			ClientID:      conf.OidcClientId,
+			ClientSecret:  conf.OidcClientSecret,
+			RedirectURL:   conf.OidcRedirectUrl,
+			Scopes:        config.List(conf.OidcScopes),
+			UsernameClaim: conf.OidcUsernameClaim,
+			GroupsClaim:   conf.OidcGroupsClaim,
+			Roles:         roles,
+			DefaultRole:   strings.ToLower(conf.OidcDefaultRole),
+		})
+	}
+
+	// invalid dates and proxies are reported by the validation
+	cfg.UI.TrustedProxies, _ = config.ParseProxies(conf.TrustedProxies)
+	cfg.UI.LegacyAPI.Deprecated, _ = config.ParseDate("ApiDeprecation", conf.ApiDeprecation)
+	cfg.UI.LegacyAPI.Sunset, _ = config.ParseDate("ApiSunset", conf.ApiSunset)
+
+	return cfg
+}
+
+// configExempt tells if the command runs with an invalid configuration,
+// the config commands report the problems and completion does not use it
+func configExempt(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == configCmd || c.Name() == "completion" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localHost is the host to reach a server listening on host from the same
+// machine, the loopback address when it listens on every address
+func localHost(host string) string {
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		return "localhost"
+	}
+
+	return host
 }
@@ -21,8 +21,7 @@
 package cmd
 
 import (
-	"log"
-	"net/http"
+	"log/slog"
 
 	"github.com/servian/TechChallengeApp/daemon"
 	"github.com/spf13/cobra"
@@ -35,10 +34,12 @@ var serveCmd = &cobra.Command{
 	Long: `Starts the web server and starts serving connection on port and hostname 
 			defined in the configuration file`,
 	Run: func(cmd *cobra.Command, args []string) {
-		setupHTTPAssets(cfg)
+		if conf.SessionKey == "" {
+			slog.Warn("SessionKey is not set, the sessions of the web UI end when the server stops")
+		}
 
 		if err := daemon.Run(cfg); err != nil {
-			log.Printf("Error in main: %v", err)
+			slog.Error("Error in main", "error", err)
 		}
 	},
 }
@@ -46,10 +47,3 @@ var serveCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(serveCmd)
 }
-
-func setupHTTPAssets(cfg *daemon.Config) {
-	assetPath := "assets"
-
-	log.Printf("Assets served from %q.", assetPath)
-	cfg.UI.Assets = http.Dir(assetPath)
-}
@@ -0,0 +1,441 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/servian/TechChallengeApp/client"
+	"github.com/servian/TechChallengeApp/config"
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// taskCmd represents the task command
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "Manages the tasks of a running server",
+	Long: `Lists, adds, finishes, edits and removes the tasks of a running server through its REST api.
+The server is the one of the configuration file unless --url is used`,
+}
+
+var taskListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "Lists the tasks",
+	Long:    `Lists the tasks by id, or the ones matching the filters`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := taskListFilter(cmd)
+
+		if err == nil {
+			var tasks []model.Task
+			tasks, err = taskClient().ListTasks(cmd.Context(), filter)
+
+			if err == nil {
+				err = writeTasks(cmd.OutOrStdout(), tasks)
+			}
+		}
+
+		exitOnError("Error listing tasks", err)
+	},
+}
+
+var taskAddCmd = &cobra.Command{
+	Use:   "add TITLE",
+	Short: "Adds a task",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		task := model.Task{Title: args[0], Priority: taskPriorityOption}
+		err := applyDue(cmd, &task)
+
+		if err == nil {
+			task, err = taskClient().AddTask(cmd.Context(), task)
+
+			if err == nil {
+				err = writeTasks(cmd.OutOrStdout(), []model.Task{task})
+			}
+		}
+
+		exitOnError("Error adding task", err)
+	},
+}
+
+var taskDoneCmd = &cobra.Command{
+	Use:               "done ID...",
+	Short:             "Marks tasks as finished",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeTaskIDs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := editTasks(cmd.Context(), cmd.OutOrStdout(), args, func(task *model.Task) error {
+			task.Complete = true
+			return nil
+		})
+
+		exitOnError("Error finishing task", err)
+	},
+}
+
+var taskEditCmd = &cobra.Command{
+	Use:   "edit ID",
+	Short: "Changes a task",
+	Long: `Changes the fields of a task set with flags, the other fields are kept.
+--complete=false reopens a finished task and --no-due removes the due date`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeTaskIDs,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := editTasks(cmd.Context(), cmd.OutOrStdout(), args, func(task *model.Task) error {
+			flags := cmd.Flags()
+
+			if flags.Changed("title") {
+				task.Title = taskTitleOption
+			}
+
+			if flags.Changed("priority") {
+				task.Priority = taskPriorityOption
+			}
+
+			if flags.Changed("complete") {
+				task.Complete = taskCompleteOption
+			}
+
+			if taskNoDueOption {
+				task.Due = nil
+			}
+
+			return applyDue(cmd, task)
+		})
+
+		exitOnError("Error editing task", err)
+	},
+}
+
+var taskRmCmd = &cobra.Command{
+	Use:               "rm ID...",
+	Aliases:           []string{"delete"},
+	Short:             "Removes tasks",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeTaskIDs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ids, err := taskIDs(args)
+
+		for _, id := range ids {
+			if err != nil {
+				break
+			}
+
+			err = taskClient().DeleteTask(cmd.Context(), id)
+		}
+
+		exitOnError("Error removing task", err)
+	},
+}
+
+var taskURLOption string
+var taskTokenOption string
+var taskOutputOption string
+
+var taskCompleteOption bool
+var taskSearchOption string
+var taskDueBeforeOption string
+var taskDueAfterOption string
+
+var taskTitleOption string
+var taskPriorityOption int
+var taskDueOption string
+var taskNoDueOption bool
+
+// taskOutputFormats are the formats of --output
+var taskOutputFormats = []string{"table", "json", "yaml"}
+
+func init() {
+	rootCmd.AddCommand(taskCmd)
+	taskCmd.AddCommand(taskListCmd, taskAddCmd, taskDoneCmd, taskEditCmd, taskRmCmd)
+
+	taskCmd.PersistentFlags().StringVar(&taskURLOption, "url", "", "URL of the server, ApiUrl of the configuration by default")
+	taskCmd.PersistentFlags().StringVar(&taskTokenOption, "token", "", "Token sent to the server, ApiToken of the configuration by default")
+	taskCmd.PersistentFlags().StringVarP(&taskOutputOption, "output", "o", "table", "Output format: table, json or yaml")
+	taskCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(taskOutputFormats, cobra.ShellCompDirectiveNoFileComp))
+
+	taskListCmd.Flags().BoolVar(&taskCompleteOption, "complete", false, "Only the finished tasks, or the open ones with --complete=false")
+	taskListCmd.Flags().StringVar(&taskSearchOption, "search", "", "Only the tasks whose title contains the text, ignoring case")
+	taskListCmd.Flags().StringVar(&taskDueBeforeOption, "due-before", "", "Only the tasks due before the date")
+	taskListCmd.Flags().StringVar(&taskDueAfterOption, "due-after", "", "Only the tasks due after the date")
+
+	for _, c := range []*cobra.Command{taskAddCmd, taskEditCmd} {
+		c.Flags().IntVarP(&taskPriorityOption, "priority", "p", 0, "Where the task fits in the list")
+		c.Flags().StringVar(&taskDueOption, "due", "", "When the task is due, like 2006-01-02 or 2006-01-02T15:04:05Z")
+	}
+
+	taskEditCmd.Flags().StringVarP(&taskTitleOption, "title", "t", "", "The new title")
+	taskEditCmd.Flags().BoolVar(&taskCompleteOption, "complete", false, "Whether the task is finished")
+	taskEditCmd.Flags().BoolVar(&taskNoDueOption, "no-due", false, "Removes the due date")
+	taskEditCmd.MarkFlagsMutuallyExclusive("due", "no-due")
+}
+
+// taskClient is the client of the server of the configuration, or of the flags
+func taskClient() *client.Client {
+	c := clientCfg
+	c.URL = taskClientURL()
+
+	if taskTokenOption != "" {
+		c.Token = taskTokenOption
+	}
+
+	return client.New(c)
+}
+
+func taskClientURL() string {
+	if taskURLOption != "" {
+		return taskURLOption
+	}
+
+	return clientCfg.URL
+}
+
+func exitOnError(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, "error", err)
+		os.Exit(1)
+	}
+}
+
+func taskListFilter(cmd *cobra.Command) (client.TaskFilter, error) {
+	filter := client.TaskFilter{Search: taskSearchOption}
+
+	if cmd.Flags().Changed("complete") {
+		filter.Complete = &taskCompleteOption
+	}
+
+	for _, option := range []struct {
+		flag  string
+		value string
+		field **time.Time
+	}{
+		{"--due-before", taskDueBeforeOption, &filter.DueBefore},
+		{"--due-after", taskDueAfterOption, &filter.DueAfter},
+	} {
+		date, err := config.ParseDate(option.flag, option.value)
+
+		if err != nil {
+			return filter, err
+		}
+
+		if !date.IsZero() {
+			*option.field = &date
+		}
+	}
+
+	return filter, nil
+}
+
+// applyDue sets the due date of the task to --due when it is set
+func applyDue(cmd *cobra.Command, task *model.Task) error {
+	if !cmd.Flags().Changed("due") {
+		return nil
+	}
+
+	due, err := config.ParseDate("--due", taskDueOption)
+
+	if err != nil {
+		return err
+	}
+
+	if !due.IsZero() {
+		task.Due = &due
+	}
+
+	return nil
+}
+
+func taskIDs(args []string) ([]int, error) {
+	var ids []int
+
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("%q is not a task id", arg)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// editTasks changes each task with edit and prints the updated tasks to w
+func editTasks(ctx context.Context, w io.Writer, args []string, edit func(task *model.Task) error) error {
+	ids, err := taskIDs(args)
+
+	if err != nil {
+		return err
+	}
+
+	c := taskClient()
+	var updated []model.Task
+
+	for _, id := range ids {
+		task, err := c.GetTask(ctx, id)
+
+		if err != nil {
+			return err
+		}
+
+		err = edit(&task)
+
+		if err != nil {
+			return err
+		}
+
+		task, err = c.UpdateTask(ctx, task)
+
+		if err != nil {
+			return err
+		}
+
+		updated = append(updated, task)
+	}
+
+	return writeTasks(w, updated)
+}
+
+// writeTasks prints the tasks in the format of --output
+func writeTasks(w io.Writer, tasks []model.Task) error {
+	if tasks == nil {
+		tasks = []model.Task{}
+	}
+
+	switch taskOutputOption {
+	case "table":
+		return writeTaskTable(w, tasks)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(tasks)
+	case "yaml":
+		return writeYAML(w, tasks)
+	default:
+		return fmt.Errorf("--output must be %s, not %q", strings.Join(taskOutputFormats, ", "), taskOutputOption)
+	}
+}
+
+func writeTaskTable(w io.Writer, tasks []model.Task) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tPRIORITY\tDONE\tDUE\tTITLE")
+
+	for _, task := range tasks {
+		done := ""
+
+		if task.Complete {
+			done = "x"
+		}
+
+		due := ""
+
+		if task.Due != nil {
+			due = task.Due.Format(time.DateOnly)
+
+			if task.Due.Truncate(24*time.Hour) != *task.Due {
+				due = task.Due.Format(time.RFC3339)
+			}
+		}
+
+		fmt.Fprintf(table, "%d\t%d\t%s\t%s\t%s\n", task.ID, task.Priority, done, due, task.Title)
+	}
+
+	return table.Flush()
+}
+
+// writeYAML prints v as YAML with the field names and order of its JSON
+func writeYAML(w io.Writer, v interface{}) error {
+	js, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+
+	// JSON is YAML, written in the flow style the encoder keeps
+	err = yaml.Unmarshal(js, &node)
+
+	if err != nil {
+		return err
+	}
+
+	blockStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	err = encoder.Encode(&node)
+
+	if err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// completeTaskIDs completes the ids of the tasks of the server, with their
+// titles as descriptions
+func completeTaskIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tasks, err := taskClient().ListTasks(ctx, client.TaskFilter{})
+
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var ids []string
+
+	for _, task := range tasks {
+		id := strconv.Itoa(task.ID)
+
+		if strings.HasPrefix(id, toComplete) {
+			ids = append(ids, id+"\t"+task.Title)
+		}
+	}
+
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
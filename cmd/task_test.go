@@ -0,0 +1,310 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// taskServer answers the task routes of /api/v1 from memory
+type taskServer struct {
+	mu      sync.Mutex
+	tasks   []model.Task
+	queries []string
+	tokens  []string
+}
+
+func (s *taskServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = append(s.tokens, r.Header.Get("Authorization"))
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/task/")
+
+	var data interface{}
+
+	switch {
+	case path == "" && r.Method == "GET":
+		s.queries = append(s.queries, r.URL.RawQuery)
+		data = s.tasks
+	case path == "" && r.Method == "POST":
+		var task model.Task
+		json.NewDecoder(r.Body).Decode(&task)
+
+		task.ID = len(s.tasks) + 1
+		s.tasks = append(s.tasks, task)
+		data = task
+	default:
+		id, _ := strconv.Atoi(strings.TrimSuffix(path, "/"))
+
+		for i := range s.tasks {
+			if s.tasks[i].ID != id {
+				continue
+			}
+
+			if r.Method == "DELETE" {
+				s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			s.tasks[i] = model.Task{}
+			json.NewDecoder(r.Body).Decode(&s.tasks[i])
+			data = s.tasks[i]
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func date(s string) *time.Time {
+	d, _ := time.Parse(time.DateOnly, s)
+	return &d
+}
+
+// testServer returns the url of a server holding the tasks
+func testServer(t *testing.T, tasks ...model.Task) (string, *taskServer) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	s := &taskServer{tasks: tasks}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	return server.URL, s
+}
+
+// runTask runs the task command with the arguments and returns what it
+// printed, the flags are reset first as the commands keep them
+func runTask(t *testing.T, args ...string) string {
+	var reset func(c *cobra.Command)
+
+	reset = func(c *cobra.Command) {
+		c.LocalFlags().VisitAll(func(f *pflag.Flag) {
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		})
+
+		for _, child := range c.Commands() {
+			reset(child)
+		}
+	}
+
+	reset(taskCmd)
+
+	var out bytes.Buffer
+
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs(append([]string{"task"}, args...))
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func TestTaskList(t *testing.T) {
+	url, _ := testServer(t,
+		model.Task{ID: 1, Title: "Open", Priority: 2, Due: date("2030-01-02")},
+		model.Task{ID: 12, Title: "Finished", Complete: true},
+	)
+
+	want := "ID  PRIORITY  DONE  DUE         TITLE\n" +
+		"1   2               2030-01-02  Open\n" +
+		"12  0         x                 Finished\n"
+
+	if got := runTask(t, "list", "--url", url); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTaskListFilters(t *testing.T) {
+	url, s := testServer(t)
+
+	runTask(t, "list", "--url", url)
+	runTask(t, "ls", "--url", url, "--complete=false", "--search", "report", "--due-before", "2030-01-02", "--due-after", "2029-01-02T15:04:05Z")
+	runTask(t, "list", "--url", url, "--complete")
+
+	want := []string{
+		"",
+		"complete=false&dueAfter=2029-01-02T15%3A04%3A05Z&dueBefore=2030-01-02T00%3A00%3A00Z&search=report",
+		"complete=true",
+	}
+
+	if !reflect.DeepEqual(s.queries, want) {
+		t.Errorf("got %q, want %q", s.queries, want)
+	}
+}
+
+func TestTaskOutput(t *testing.T) {
+	url, _ := testServer(t, model.Task{ID: 1, Title: "Open", Priority: 2, Due: date("2030-01-02")})
+
+	json := runTask(t, "list", "--url", url, "-o", "json")
+
+	if want := "[\n  {\n    \"id\": 1,\n    \"priority\": 2,\n    \"title\": \"Open\",\n    \"complete\": false,\n    \"due\": \"2030-01-02T00:00:00Z\",\n    \"listId\": 0\n  }\n]\n"; json != want {
+		t.Errorf("json:\n%s\nwant\n%s", json, want)
+	}
+
+	yaml := runTask(t, "list", "--url", url, "--output", "yaml")
+
+	if want := "- id: 1\n  priority: 2\n  title: Open\n  complete: false\n  due: \"2030-01-02T00:00:00Z\"\n  listId: 0\n"; yaml != want {
+		t.Errorf("yaml:\n%s\nwant\n%s", yaml, want)
+	}
+}
+
+func TestTaskAdd(t *testing.T) {
+	url, s := testServer(t)
+
+	out := runTask(t, "add", "Write the report", "--url", url, "--priority", "3", "--due", "2030-01-02", "-o", "json")
+
+	want := model.Task{ID: 1, Title: "Write the report", Priority: 3, Due: date("2030-01-02")}
+
+	if !reflect.DeepEqual(s.tasks, []model.Task{want}) {
+		t.Errorf("the server has %+v", s.tasks)
+	}
+
+	if !strings.Contains(out, `"title": "Write the report"`) {
+		t.Errorf("printed %s", out)
+	}
+}
+
+func TestTaskDone(t *testing.T) {
+	url, s := testServer(t, model.Task{ID: 1, Title: "One"}, model.Task{ID: 2, Title: "Two"}, model.Task{ID: 3, Title: "Three"})
+
+	out := runTask(t, "done", "1", "3", "--url", url)
+
+	for _, task := range s.tasks {
+		if task.Complete != (task.ID != 2) {
+			t.Errorf("task %d is complete: %v", task.ID, task.Complete)
+		}
+	}
+
+	if !strings.Contains(out, "One") || strings.Contains(out, "Two") || !strings.Contains(out, "Three") {
+		t.Errorf("printed %s", out)
+	}
+}
+
+func TestTaskEdit(t *testing.T) {
+	task := model.Task{ID: 1, Title: "Draft", Priority: 2, Complete: true, Due: date("2030-01-02")}
+
+	tests := []struct {
+		name string
+		args []string
+		want model.Task
+	}{
+		{"title", []string{"--title", "Final"}, model.Task{ID: 1, Title: "Final", Priority: 2, Complete: true, Due: date("2030-01-02")}},
+		{"priority", []string{"-p", "5"}, model.Task{ID: 1, Title: "Draft", Priority: 5, Complete: true, Due: date("2030-01-02")}},
+		{"reopen", []string{"--complete=false"}, model.Task{ID: 1, Title: "Draft", Priority: 2, Due: date("2030-01-02")}},
+		{"due", []string{"--due", "2031-05-06"}, model.Task{ID: 1, Title: "Draft", Priority: 2, Complete: true, Due: date("2031-05-06")}},
+		{"no due", []string{"--no-due"}, model.Task{ID: 1, Title: "Draft", Priority: 2, Complete: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, s := testServer(t, task)
+
+			runTask(t, append([]string{"edit", "1", "--url", url}, tt.args...)...)
+
+			if !reflect.DeepEqual(s.tasks[0], tt.want) {
+				t.Errorf("got %+v, want %+v", s.tasks[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskRm(t *testing.T) {
+	url, s := testServer(t, model.Task{ID: 1, Title: "One"}, model.Task{ID: 2, Title: "Two"}, model.Task{ID: 3, Title: "Three"})
+
+	runTask(t, "rm", "1", "3", "--url", url)
+
+	if !reflect.DeepEqual(s.tasks, []model.Task{{ID: 2, Title: "Two"}}) {
+		t.Errorf("the server has %+v", s.tasks)
+	}
+}
+
+func TestTaskToken(t *testing.T) {
+	url, s := testServer(t)
+
+	runTask(t, "list", "--url", url)
+	runTask(t, "list", "--url", url, "--token", "secret")
+
+	if want := []string{"", "Bearer secret"}; !reflect.DeepEqual(s.tokens, want) {
+		t.Errorf("got %q, want %q", s.tokens, want)
+	}
+}
+
+func TestCompleteTaskIDs(t *testing.T) {
+	url, _ := testServer(t, model.Task{ID: 1, Title: "One"}, model.Task{ID: 12, Title: "Twelve"}, model.Task{ID: 2, Title: "Two"})
+
+	taskURLOption = url
+	defer func() { taskURLOption = "" }()
+
+	ids, directive := completeTaskIDs(taskDoneCmd, nil, "1")
+
+	if want := []string{"1\tOne", "12\tTwelve"}; !reflect.DeepEqual(ids, want) || directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("got %q %v, want %q", ids, directive, want)
+	}
+
+	taskURLOption = "http://127.0.0.1:0"
+
+	if _, directive := completeTaskIDs(taskDoneCmd, nil, ""); directive != cobra.ShellCompDirectiveError {
+		t.Errorf("got %v without a server", directive)
+	}
+}
+
+func TestTaskIDs(t *testing.T) {
+	if ids, err := taskIDs([]string{"1", "20"}); err != nil || !reflect.DeepEqual(ids, []int{1, 20}) {
+		t.Errorf("got %v: %v", ids, err)
+	}
+
+	for _, arg := range []string{"one", "-1", "1.5", ""} {
+		if _, err := taskIDs([]string{"1", arg}); err == nil {
+			t.Errorf("%q is a task id", arg)
+		}
+	}
+}
+
+func TestWriteTasksUnknownFormat(t *testing.T) {
+	taskOutputOption = "csv"
+	defer func() { taskOutputOption = "table" }()
+
+	err := writeTasks(&bytes.Buffer{}, nil)
+
+	if err == nil || !strings.Contains(err.Error(), `not "csv"`) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/tui"
+	"github.com/spf13/cobra"
+)
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Manages the tasks in a full screen terminal UI",
+	Long: `Shows the tasks in a full screen terminal UI to add, finish, edit, reprioritise, delete and search them.
+The tasks are the ones of the server of the configuration file, or of --url. With --local the database of the
+configuration file is used directly instead. The list refreshes live when the task stream of the server is available,
+or with --local when DbNotify is set`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tcfg := tui.Config{Store: tui.RemoteStore(taskClient()), Source: taskClientURL()}
+
+		if tuiLocalOption {
+			var broker *events.Broker
+
+			if cfg.Notify {
+				broker = events.NewBroker()
+				err := broker.ListenPostgres(cfg.UI.DB)
+
+				if err != nil {
+					slog.Error("Error listening for changes made by the servers", "error", err)
+					os.Exit(1)
+				}
+
+				defer broker.Close()
+			}
+
+			tcfg = tui.Config{Store: tui.LocalStore(cfg.UI.DB, broker), Source: "database " + cfg.UI.DB.DbName}
+		}
+
+		err := tui.Run(tcfg)
+
+		if err != nil {
+			slog.Error("Error running the terminal UI", "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var tuiLocalOption bool
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+	tuiCmd.Flags().BoolVar(&tuiLocalOption, "local", false, "Use the database of the configuration file instead of a server")
+	tuiCmd.Flags().StringVar(&taskURLOption, "url", "", "URL of the server, ApiUrl of the configuration by default")
+	tuiCmd.Flags().StringVar(&taskTokenOption, "token", "", "Token sent to the server, ApiToken of the configuration by default")
+	tuiCmd.MarkFlagsMutuallyExclusive("local", "url")
+}
@@ -21,7 +21,8 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"os"
 
 	"github.com/servian/TechChallengeApp/db"
@@ -37,39 +38,46 @@ var updatedbCmd = &cobra.Command{
 		err := updateDb(cfg.UI.DB)
 
 		if err != nil {
-			fmt.Println(err)
+			slog.Error("Error updating the database", "error", err)
 			os.Exit(1)
 		}
 	},
 }
 
 var skipCreateDbOption bool
+var migrateOnlyOption bool
 
 func init() {
 	rootCmd.AddCommand(updatedbCmd)
 	updatedbCmd.Flags().BoolVarP(&skipCreateDbOption, "skip-create-db", "s", false, "Use to skip the creation of the database")
+	updatedbCmd.Flags().BoolVarP(&migrateOnlyOption, "migrate", "m", false, "Only apply pending migrations, keeping the existing data")
 }
 
 func updateDb(cfg db.Config) error {
 
+	if migrateOnlyOption {
+		slog.Info("Applying pending migrations")
+		return db.Migrate(context.Background(), cfg)
+	}
+
 	if !skipCreateDbOption {
-		fmt.Println("Dropping and recreating database: " + cfg.DbName)
-		err := db.RebuildDb(cfg)
+		slog.Info("Dropping and recreating database", "database", cfg.DbName)
+		err := db.RebuildDb(context.Background(), cfg)
 
 		if err != nil {
 			return err
 		}
 	}
 
-	fmt.Println("Dropping and recreating table: tasks")
-	err := db.CreateTable(cfg)
+	slog.Info("Dropping and recreating tables")
+	err := db.CreateTable(context.Background(), cfg)
 
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Seeding table with data")
-	err = db.SeedData(cfg)
+	slog.Info("Seeding table with data")
+	err = db.SeedData(context.Background(), cfg)
 
 	return err
 }
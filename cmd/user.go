@@ -0,0 +1,210 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/servian/TechChallengeApp/auth"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// userCmd represents the user command
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manages the users signing in to the server",
+	Long: `Adds and removes the users of the database, sets their passwords and creates their api tokens.
+The users sign in to the web UI with their password, and call the api with their tokens`,
+}
+
+var userListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "Lists the users",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		users, err := db.GetUsers(cmd.Context(), cfg.UI.DB)
+
+		if err == nil {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tROLE\tGROUPS")
+
+			for _, user := range users {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.ID, user.Name, user.Role, strings.Join(user.Groups, ","))
+			}
+
+			err = w.Flush()
+		}
+
+		exitOnError("Error listing users", err)
+	},
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add NAME",
+	Short: "Adds a user",
+	Long:  `Adds a user signing in with the password typed, or read from the standard input when it is not a terminal`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := checkRole(userRoleOption)
+
+		if err == nil {
+			var hash string
+			hash, err = readPassword()
+
+			if err == nil {
+				_, err = db.AddUser(cmd.Context(), cfg.UI.DB, model.User{Name: args[0], Role: userRoleOption}, hash)
+			}
+		}
+
+		exitOnError("Error adding user", err)
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd NAME",
+	Short: "Changes the password of a user",
+	Long:  `Changes the password of a user and ends their sessions, the password is read as by user add`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hash, err := readPassword()
+
+		if err == nil {
+			err = db.SetUserPassword(cmd.Context(), cfg.UI.DB, args[0], hash)
+		}
+
+		exitOnError("Error changing password", err)
+	},
+}
+
+var userRoleCmd = &cobra.Command{
+	Use:       "role NAME ROLE",
+	Short:     "Changes the role of a user",
+	Long:      `Changes the role of a user: viewer, editor or admin. The users signing in with single sign on get the role of their groups again on their next sign in`,
+	Args:      cobra.ExactArgs(2),
+	ValidArgs: model.Roles,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := checkRole(args[1])
+
+		if err == nil {
+			err = db.SetUserRole(cmd.Context(), cfg.UI.DB, args[0], args[1])
+		}
+
+		exitOnError("Error changing role", err)
+	},
+}
+
+var userRmCmd = &cobra.Command{
+	Use:     "rm NAME",
+	Aliases: []string{"remove"},
+	Short:   "Removes a user with their api tokens and sessions",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError("Error removing user", db.DeleteUser(cmd.Context(), cfg.UI.DB, args[0]))
+	},
+}
+
+var userTokenCmd = &cobra.Command{
+	Use:   "token NAME",
+	Short: "Creates an api token for a user",
+	Long: `Creates an api token for a user and prints it, it is the only time the token is shown.
+Clients send it in the Authorization header as a bearer token, e.g. with ApiToken for the task commands`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		user, _, err := db.GetUserByName(cmd.Context(), cfg.UI.DB, args[0])
+
+		if err == nil {
+			token := auth.NewToken()
+			err = db.AddApiToken(cmd.Context(), cfg.UI.DB, user.ID, userTokenNameOption, token)
+
+			if err == nil {
+				fmt.Println(token)
+			}
+		}
+
+		exitOnError("Error creating api token", err)
+	},
+}
+
+var userTokenNameOption string
+var userRoleOption string
+
+func init() {
+	rootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userListCmd, userAddCmd, userPasswdCmd, userRoleCmd, userRmCmd, userTokenCmd)
+	userAddCmd.Flags().StringVar(&userRoleOption, "role", model.RoleEditor, "What the user can do: viewer, editor or admin")
+	userTokenCmd.Flags().StringVar(&userTokenNameOption, "name", "cli", "What the token is for")
+}
+
+func checkRole(role string) error {
+	if model.RoleRank(role) == 0 {
+		return fmt.Errorf("The role must be %s, not %q", strings.Join(model.Roles, ", "), role)
+	}
+
+	return nil
+}
+
+// readPassword reads a password and returns its hash, it is typed twice
+// on a terminal
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+		if err != nil && (err != io.EOF || line == "") {
+			return "", errors.New("No password on the standard input")
+		}
+
+		return auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Repeat the password: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(again) {
+		return "", errors.New("The passwords do not match")
+	}
+
+	return auth.HashPassword(string(password))
+}
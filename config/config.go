@@ -21,57 +21,707 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
 // internalConfig wraps the config values as the toml library was
 // having issue with getters and setters on the struct
 type Config struct {
-	DbUser     string
-	DbPassword string
-	DbName     string
-	DbHost     string
-	DbPort     string
-	ListenHost string
-	ListenPort string
+	DbUser      string
+	DbPassword  string
+	DbName      string
+	DbHost      string
+	DbPort      string
+	ListenHost  string
+	ListenPort  string
+	GrpcPort    string
+	MetricsPort string
+	DbNotify    bool
+	LogFormat   string
+	LogLevel    string
+
+	TraceExporter    string
+	TraceEndpoint    string
+	TraceFile        string
+	TraceSampleRatio float64
+
+	ApiDeprecation string
+	ApiSunset      string
+
+	ApiUrl   string
+	ApiToken string
+
+	RateLimit      float64
+	RateBurst      int
+	TrustedProxies string
+	MaxBodySize    int
+
+	CorsOrigins     string
+	CorsMethods     string
+	CorsHeaders     string
+	CorsCredentials bool
+	CorsMaxAge      int
+
+	HstsMaxAge     int
+	FrameAncestors string
+
+	AuthRequired  bool
+	SessionKey    string
+	SessionStore  string
+	SessionMaxAge int
+
+	OidcIssuer        string
+	OidcClientId      string
+	OidcClientSecret  string
+	OidcRedirectUrl   string
+	OidcScopes        string
+	OidcUsernameClaim string
+	OidcGroupsClaim   string
+	OidcRoles         string
+	OidcDefaultRole   string
+
+	// Files are the configuration files read, in the order they were merged
+	Files []string
+
+	values   []Value
+	problems []error
+}
+
+// Sources of a configuration value
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Value is a configuration value as it was loaded
+type Value struct {
+	Key    string
+	Value  string
+	Source string
+
+	// File is the file the value was read from when its source is a file
+	File string
+
+	// Ref is the reference the value was read from, e.g.
+	// file:///run/secrets/db_password, empty when it was not a reference
+	Ref string
+
+	Secret bool
+}
+
+// Options chooses where the configuration is loaded from, environment
+// variables are always read
+type Options struct {
+	// Files are the configuration files, merged in order, the files found
+	// in the search path are read when empty
+	Files []string
+
+	// Env selects the overlays merged after the files, e.g. production for
+	// conf.production.toml, VTT_ENV when empty
+	Env string
+
+	// Overrides are values set with flags, by key
+	Overrides map[string]string
+}
+
+// envPrefix prefixes the environment variables, e.g. VTT_LISTENPORT
+const envPrefix = "VTT"
+
+// defaults are the configuration keys and their default values, in the
+// order they are shown
+var defaults = []struct {
+	key   string
+	value interface{}
+}{
+	{"DbUser", "postgres"},
+	{"DbPassword", "postgres"},
+	{"DbName", "postgres"},
+	{"DbPort", "5432"},
+	{"DbHost", "localhost"},
+
+	{"ListenHost", "127.0.0.1"},
+	{"ListenPort", "3000"},
+	{"GrpcPort", ""},
+	{"MetricsPort", ""},
+
+	{"DbNotify", false},
+
+	{"LogFormat", "text"},
+	{"LogLevel", "info"},
+
+	{"TraceExporter", "none"},
+	{"TraceEndpoint", ""},
+	{"TraceFile", "traces.json"},
+	{"TraceSampleRatio", 1.0},
+
+	{"ApiDeprecation", ""},
+	{"ApiSunset", ""},
+
+	{"ApiUrl", ""},
+	{"ApiToken", ""},
+
+	{"RateLimit", 20.0},
+	{"RateBurst", 40},
+	{"TrustedProxies", ""},
+	{"MaxBodySize", 32 << 20},
+
+	{"CorsOrigins", ""},
+	{"CorsMethods", "GET, POST, PUT, PATCH, DELETE"},
+	{"CorsHeaders", "Authorization, Content-Type"},
+	{"CorsCredentials", false},
+	{"CorsMaxAge", 600},
+
+	{"HstsMaxAge", 31536000},
+	{"FrameAncestors", ""},
+
+	{"AuthRequired", false},
+	{"SessionKey", ""},
+	{"SessionStore", "postgres"},
+	{"SessionMaxAge", 43200},
+
+	{"OidcIssuer", ""},
+	{"OidcClientId", ""},
+	{"OidcClientSecret", ""},
+	{"OidcRedirectUrl", ""},
+	{"OidcScopes", "openid, profile, email"},
+	{"OidcUsernameClaim", "preferred_username"},
+	{"OidcGroupsClaim", "groups"},
+	{"OidcRoles", ""},
+	{"OidcDefaultRole", ""},
 }
 
-func LoadConfig() (*Config, error) {
+// secrets are the keys whose values are never shown
+var secrets = map[string]bool{
+	"DbPassword": true,
+	"ApiToken":   true,
+	"SessionKey": true,
+
+	"OidcClientSecret": true,
+}
+
+// LoadConfig reads the configuration from the file, the environment and
+// the overrides. It only fails when the file can not be read, the other
+// problems are reported by Validate
+func LoadConfig(opts Options) (*Config, error) {
 	var conf = &Config{}
 
 	v := viper.New()
 
-	v.SetConfigName("conf")
-	v.SetConfigType("toml")
-	v.AddConfigPath(".")
-
-	v.SetEnvPrefix("VTT")
+	v.SetEnvPrefix(envPrefix)
 	v.AutomaticEnv()
 
-	v.SetDefault("DbUser", "postgres")
-	v.SetDefault("DbPassword", "postgres")
-	v.SetDefault("DbName", "postgres")
-	v.SetDefault("DbPort", "postgres")
-	v.SetDefault("DbHost", "localhost")
+	known := map[string]bool{}
 
-	v.SetDefault("ListenHost", "127.0.0.1")
-	v.SetDefault("ListenPort", "3000")
+	for _, d := range defaults {
+		v.SetDefault(d.key, d.value)
+		known[strings.ToLower(d.key)] = true
+	}
 
-	err := v.ReadInConfig() // Find and read the config file
+	files, err := configFiles(opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	conf.DbUser = strings.TrimSpace(v.GetString("DbUser"))
-	conf.DbPassword = strings.TrimSpace(v.GetString("DbPassword"))
-	conf.DbName = strings.TrimSpace(v.GetString("DbName"))
-	conf.DbHost = strings.TrimSpace(v.GetString("DbHost"))
-	conf.DbPort = strings.TrimSpace(v.GetString("DbPort"))
-	conf.ListenHost = strings.TrimSpace(v.GetString("ListenHost"))
-	conf.ListenPort = strings.TrimSpace(v.GetString("ListenPort"))
+	// the file each key was last read from
+	keyFiles := map[string]string{}
+
+	for _, file := range files {
+		f := viper.New()
+		f.SetConfigFile(file)
+
+		err := f.ReadInConfig()
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		for _, key := range f.AllKeys() {
+			if !known[key] {
+				conf.problems = append(conf.problems, fmt.Errorf("%s: unknown key in %s", key, file))
+			}
+
+			keyFiles[key] = file
+		}
+
+		err = v.MergeConfigMap(f.AllSettings())
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	conf.Files = files
+
+	for key, value := range opts.Overrides {
+		if !known[strings.ToLower(key)] {
+			conf.problems = append(conf.problems, fmt.Errorf("%s: unknown key set with a flag", key))
+			continue
+		}
+
+		v.Set(key, value)
+	}
+
+	l := loader{v: v, overrides: opts.Overrides, files: keyFiles, conf: conf}
+
+	conf.DbUser = l.string("DbUser")
+	conf.DbPassword = l.string("DbPassword")
+	conf.DbName = l.string("DbName")
+	conf.DbPort = l.string("DbPort")
+	conf.DbHost = l.string("DbHost")
+	conf.ListenHost = l.string("ListenHost")
+	conf.ListenPort = l.string("ListenPort")
+	conf.GrpcPort = l.string("GrpcPort")
+	conf.MetricsPort = l.string("MetricsPort")
+	conf.DbNotify = l.bool("DbNotify")
+	conf.LogFormat = l.string("LogFormat")
+	conf.LogLevel = l.string("LogLevel")
+	conf.TraceExporter = l.string("TraceExporter")
+	conf.TraceEndpoint = l.string("TraceEndpoint")
+	conf.TraceFile = l.string("TraceFile")
+	conf.TraceSampleRatio = l.float("TraceSampleRatio")
+	conf.ApiDeprecation = l.string("ApiDeprecation")
+	conf.ApiSunset = l.string("ApiSunset")
+	conf.ApiUrl = l.string("ApiUrl")
+	conf.ApiToken = l.string("ApiToken")
+	conf.RateLimit = l.float("RateLimit")
+	conf.RateBurst = l.int("RateBurst")
+	conf.TrustedProxies = l.string("TrustedProxies")
+	conf.MaxBodySize = l.int("MaxBodySize")
+	conf.CorsOrigins = l.string("CorsOrigins")
+	conf.CorsMethods = l.string("CorsMethods")
+	conf.CorsHeaders = l.string("CorsHeaders")
+	conf.CorsCredentials = l.bool("CorsCredentials")
+	conf.CorsMaxAge = l.int("CorsMaxAge")
+	conf.HstsMaxAge = l.int("HstsMaxAge")
+	conf.FrameAncestors = l.string("FrameAncestors")
+	conf.AuthRequired = l.bool("AuthRequired")
+	conf.SessionKey = l.string("SessionKey")
+	conf.SessionStore = l.string("SessionStore")
+	conf.SessionMaxAge = l.int("SessionMaxAge")
+	conf.OidcIssuer = l.string("OidcIssuer")
+	conf.OidcClientId = l.string("OidcClientId")
+	conf.OidcClientSecret = l.string("OidcClientSecret")
+	conf.OidcRedirectUrl = l.string("OidcRedirectUrl")
+	conf.OidcScopes = l.string("OidcScopes")
+	conf.OidcUsernameClaim = l.string("OidcUsernameClaim")
+	conf.OidcGroupsClaim = l.string("OidcGroupsClaim")
+	conf.OidcRoles = l.string("OidcRoles")
+	conf.OidcDefaultRole = l.string("OidcDefaultRole")
 
 	return conf, nil
 }
+
+// loader reads the values of the configuration, recording their source
+// and the ones of the wrong type
+type loader struct {
+	v         *viper.Viper
+	overrides map[string]string
+	files     map[string]string
+	conf      *Config
+}
+
+func (l loader) source(key string) string {
+	for k := range l.overrides {
+		if strings.EqualFold(k, key) {
+			return SourceFlag
+		}
+	}
+
+	// viper ignores empty environment variables
+	if os.Getenv(envName(key)) != "" || os.Getenv(envName(key)+"_FILE") != "" {
+		return SourceEnv
+	}
+
+	if l.v.InConfig(key) {
+		return SourceFile
+	}
+
+	return SourceDefault
+}
+
+func (l loader) problem(err error) {
+	l.conf.problems = append(l.conf.problems, err)
+}
+
+// raw returns the value of key, read from the file named by its _FILE
+// environment variable when it is set, with its secret reference resolved
+func (l loader) raw(key string) interface{} {
+	value := l.v.Get(key)
+	source := l.source(key)
+
+	if path := os.Getenv(envName(key) + "_FILE"); path != "" && source != SourceFlag {
+		if os.Getenv(envName(key)) != "" {
+			l.problem(fmt.Errorf("%s: only one of %s and %s_FILE can be set", key, envName(key), envName(key)))
+		}
+
+		value = "file://" + path
+	}
+
+	ref := ""
+
+	if s, ok := value.(string); ok {
+		secret, r, err := resolve(strings.TrimSpace(s))
+
+		if err != nil {
+			l.problem(fmt.Errorf("%s: can not read %s: %w", key, r, err))
+		}
+
+		value, ref = secret, r
+	}
+
+	file := ""
+
+	if source == SourceFile {
+		file = l.files[strings.ToLower(key)]
+	}
+
+	l.conf.values = append(l.conf.values, Value{
+		Key:    key,
+		Value:  cast.ToString(value),
+		Source: source,
+		File:   file,
+		Ref:    ref,
+		Secret: secrets[key],
+	})
+
+	return value
+}
+
+func (l loader) string(key string) string {
+	return cast.ToString(l.raw(key))
+}
+
+func (l loader) bool(key string) bool {
+	raw := l.raw(key)
+	value, err := cast.ToBoolE(raw)
+
+	if err != nil {
+		l.problem(fmt.Errorf("%s: must be true or false, not %q", key, cast.ToString(raw)))
+	}
+
+	return value
+}
+
+func (l loader) float(key string) float64 {
+	raw := l.raw(key)
+	value, err := cast.ToFloat64E(raw)
+
+	if err != nil {
+		l.problem(fmt.Errorf("%s: must be a number, not %q", key, cast.ToString(raw)))
+	}
+
+	return value
+}
+
+func (l loader) int(key string) int {
+	raw := l.raw(key)
+	value, err := cast.ToIntE(raw)
+
+	if err != nil {
+		l.problem(fmt.Errorf("%s: must be a whole number, not %q", key, cast.ToString(raw)))
+	}
+
+	return value
+}
+
+// envName is the environment variable of key, e.g. VTT_LISTENPORT
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(key)
+}
+
+// Values returns every value of the configuration with its source, in
+// the order of the keys
+func (c *Config) Values() []Value {
+	return c.values
+}
+
+// Validate reports every problem of the configuration, one error per key
+func (c *Config) Validate() error {
+	problems := append([]error{}, c.problems...)
+
+	check := func(key string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	check("DbUser", required(c.DbUser))
+	check("DbName", required(c.DbName))
+	check("DbHost", required(c.DbHost))
+	check("DbPort", port(c.DbPort))
+	check("ListenPort", port(c.ListenPort))
+
+	if c.GrpcPort != "" {
+		check("GrpcPort", port(c.GrpcPort))
+
+		if c.GrpcPort == c.ListenPort {
+			check("GrpcPort", errors.New("must not be ListenPort, gRPC is served on its own port"))
+		}
+	}
+
+	if c.MetricsPort != "" {
+		check("MetricsPort", port(c.MetricsPort))
+
+		if c.MetricsPort == c.ListenPort || c.MetricsPort == c.GrpcPort {
+			check("MetricsPort", errors.New("must not be ListenPort or GrpcPort, the metrics are served on their own port"))
+		}
+	}
+
+	check("LogFormat", oneOf(c.LogFormat, "text", "json"))
+	check("LogLevel", oneOf(c.LogLevel, "debug", "info", "warn", "error"))
+	check("TraceExporter", oneOf(c.TraceExporter, "none", "stdout", "file", "otlp"))
+
+	if c.TraceEndpoint != "" {
+		check("TraceEndpoint", httpURL(c.TraceEndpoint))
+	}
+
+	if strings.EqualFold(c.TraceExporter, "file") {
+		check("TraceFile", required(c.TraceFile))
+	}
+
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		check("TraceSampleRatio", fmt.Errorf("must be between 0 and 1, not %g", c.TraceSampleRatio))
+	}
+
+	deprecated, err := ParseDate("ApiDeprecation", c.ApiDeprecation)
+
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	sunset, err := ParseDate("ApiSunset", c.ApiSunset)
+
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	if !deprecated.IsZero() && !sunset.IsZero() && sunset.Before(deprecated) {
+		check("ApiSunset", errors.New("must not be before ApiDeprecation"))
+	}
+
+	if c.ApiUrl != "" {
+		check("ApiUrl", httpURL(c.ApiUrl))
+	}
+
+	if c.RateLimit < 0 {
+		check("RateLimit", fmt.Errorf("must be 0 or more, not %g", c.RateLimit))
+	}
+
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		check("RateBurst", fmt.Errorf("must be 1 or more, not %d", c.RateBurst))
+	}
+
+	_, err = ParseProxies(c.TrustedProxies)
+	check("TrustedProxies", err)
+
+	if c.MaxBodySize < 1024 {
+		check("MaxBodySize", fmt.Errorf("must be at least 1024 bytes, not %d", c.MaxBodySize))
+	}
+
+	origins := List(c.CorsOrigins)
+
+	for _, origin := range origins {
+		if origin != "*" {
+			check("CorsOrigins", webOrigin(origin))
+		}
+	}
+
+	if c.CorsCredentials && slices.Contains(origins, "*") {
+		check("CorsCredentials", errors.New("can not be used when CorsOrigins allows every origin"))
+	}
+
+	if len(origins) > 0 && len(List(c.CorsMethods)) == 0 {
+		check("CorsMethods", errors.New("must be set when CorsOrigins is"))
+	}
+
+	if c.CorsMaxAge < 0 {
+		check("CorsMaxAge", fmt.Errorf("must be 0 or more, not %d", c.CorsMaxAge))
+	}
+
+	if c.HstsMaxAge < 0 {
+		check("HstsMaxAge", fmt.Errorf("must be 0 or more, not %d", c.HstsMaxAge))
+	}
+
+	for _, origin := range List(c.FrameAncestors) {
+		check("FrameAncestors", webOrigin(origin))
+	}
+
+	if c.SessionKey != "" && len(c.SessionKey) < 32 {
+		check("SessionKey", fmt.Errorf("must be at least 32 characters long, not %d", len(c.SessionKey)))
+	}
+
+	check("SessionStore", oneOf(c.SessionStore, "postgres", "memory"))
+
+	if c.SessionMaxAge < 60 {
+		check("SessionMaxAge", fmt.Errorf("must be at least 60 seconds, not %d", c.SessionMaxAge))
+	}
+
+	if c.OidcIssuer != "" {
+		check("OidcIssuer", httpURL(c.OidcIssuer))
+		check("OidcClientId", required(c.OidcClientId))
+		check("OidcRedirectUrl", httpURL(c.OidcRedirectUrl))
+		check("OidcUsernameClaim", required(c.OidcUsernameClaim))
+
+		if !slices.Contains(List(c.OidcScopes), "openid") {
+			check("OidcScopes", errors.New("must include openid"))
+		}
+	}
+
+	_, err = ParseRoles(c.OidcRoles)
+	check("OidcRoles", err)
+
+	if c.OidcDefaultRole != "" {
+		check("OidcDefaultRole", oneOf(c.OidcDefaultRole, model.Roles...))
+	}
+
+	return errors.Join(problems...)
+}
+
+func required(value string) error {
+	if value == "" {
+		return errors.New("must be set")
+	}
+
+	return nil
+}
+
+func port(value string) error {
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("must be a port number from 1 to 65535, not %q", value)
+	}
+
+	return nil
+}
+
+func oneOf(value string, allowed ...string) error {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("must be %s or %s, not %q", strings.Join(allowed[:len(allowed)-1], ", "), allowed[len(allowed)-1], value)
+}
+
+func httpURL(value string) error {
+	u, err := url.Parse(value)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https url, not %q", value)
+	}
+
+	return nil
+}
+
+// webOrigin checks an origin of a browser, a scheme and a host without a
+// path, e.g. https://example.com:8443
+func webOrigin(value string) error {
+	u, err := url.Parse(value)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("must be origins like https://example.com, not %q", value)
+	}
+
+	return nil
+}
+
+// List reads a comma separated list, without the blank items
+func List(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// ParseRoles reads a comma separated list of groups and the role of their
+// members, e.g. task-admins=admin, staff=editor
+func ParseRoles(value string) (map[string]string, error) {
+	roles := map[string]string{}
+
+	for _, item := range List(value) {
+		group, role, ok := strings.Cut(item, "=")
+		group = strings.TrimSpace(group)
+		role = strings.ToLower(strings.TrimSpace(role))
+
+		if !ok || group == "" || model.RoleRank(role) == 0 {
+			return nil, fmt.Errorf("must be groups and roles like staff=editor, with the roles %s, not %q", strings.Join(model.Roles, ", "), item)
+		}
+
+		roles[group] = role
+	}
+
+	return roles, nil
+}
+
+// ParseProxies reads a comma separated list of addresses and networks,
+// e.g. 10.0.0.0/8, 192.168.1.10
+func ParseProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+
+		if item == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(item)
+
+			if addrErr != nil {
+				return nil, fmt.Errorf("must be addresses or networks like 10.0.0.0/8, not %q", item)
+			}
+
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// ParseDate reads a date of the configuration, as 2006-01-02 or RFC 3339,
+// the zero time when empty
+func ParseDate(key string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		date, err := time.Parse(layout, value)
+
+		if err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%s: must be a date like 2006-01-02 or 2006-01-02T15:04:05Z, not %q", key, value)
+}
@@ -0,0 +1,261 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a configuration file in a directory of the test, and
+// returns its path
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// loadDefaults loads the defaults, without the files of the search path
+func loadDefaults(t *testing.T) *Config {
+	t.Helper()
+
+	c, err := LoadConfig(Options{Files: []string{writeFile(t, "conf.toml", "")}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// problems are the keys of the problems reported by Validate
+func problems(err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	var keys []string
+
+	for _, line := range strings.Split(err.Error(), "\n") {
+		key, _, _ := strings.Cut(line, ":")
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	if err := loadDefaults(t).Validate(); err != nil {
+		t.Errorf("the defaults are invalid: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		key    string
+	}{
+		{"no database user", func(c *Config) { c.DbUser = "" }, "DbUser"},
+		{"no database name", func(c *Config) { c.DbName = "" }, "DbName"},
+		{"no database host", func(c *Config) { c.DbHost = "" }, "DbHost"},
+		{"database port not a number", func(c *Config) { c.DbPort = "pg" }, "DbPort"},
+		{"listen port out of range", func(c *Config) { c.ListenPort = "65536" }, "ListenPort"},
+		{"listen port 0", func(c *Config) { c.ListenPort = "0" }, "ListenPort"},
+		{"grpc port not a number", func(c *Config) { c.GrpcPort = "grpc" }, "GrpcPort"},
+		{"grpc port on the listen port", func(c *Config) { c.GrpcPort = c.ListenPort }, "GrpcPort"},
+		{"metrics port out of range", func(c *Config) { c.MetricsPort = "-1" }, "MetricsPort"},
+		{"metrics port on the listen port", func(c *Config) { c.MetricsPort = c.ListenPort }, "MetricsPort"},
+		{"metrics port on the grpc port", func(c *Config) { c.GrpcPort, c.MetricsPort = "9000", "9000" }, "MetricsPort"},
+		{"unknown log format", func(c *Config) { c.LogFormat = "xml" }, "LogFormat"},
+		{"unknown log level", func(c *Config) { c.LogLevel = "verbose" }, "LogLevel"},
+		{"unknown trace exporter", func(c *Config) { c.TraceExporter = "jaeger" }, "TraceExporter"},
+		{"trace endpoint not a url", func(c *Config) { c.TraceEndpoint = "collector:4318" }, "TraceEndpoint"},
+		{"trace file exporter without a file", func(c *Config) { c.TraceExporter, c.TraceFile = "file", "" }, "TraceFile"},
+		{"sample ratio over 1", func(c *Config) { c.TraceSampleRatio = 1.5 }, "TraceSampleRatio"},
+		{"negative sample ratio", func(c *Config) { c.TraceSampleRatio = -0.1 }, "TraceSampleRatio"},
+		{"deprecation not a date", func(c *Config) { c.ApiDeprecation = "soon" }, "ApiDeprecation"},
+		{"sunset not a date", func(c *Config) { c.ApiSunset = "01/02/2027" }, "ApiSunset"},
+		{"sunset before the deprecation", func(c *Config) { c.ApiDeprecation, c.ApiSunset = "2027-01-01", "2026-12-31" }, "ApiSunset"},
+		{"api url not a url", func(c *Config) { c.ApiUrl = "localhost:3000" }, "ApiUrl"},
+		{"negative rate limit", func(c *Config) { c.RateLimit = -1 }, "RateLimit"},
+		{"rate limit without a burst", func(c *Config) { c.RateBurst = 0 }, "RateBurst"},
+		{"trusted proxy not an address", func(c *Config) { c.TrustedProxies = "10.0.0.0/8, proxy" }, "TrustedProxies"},
+		{"body size too small", func(c *Config) { c.MaxBodySize = 1023 }, "MaxBodySize"},
+		{"cors origin with a path", func(c *Config) { c.CorsOrigins = "https://example.com/app" }, "CorsOrigins"},
+		{"cors origin without a scheme", func(c *Config) { c.CorsOrigins = "example.com" }, "CorsOrigins"},
+		{"cors credentials for every origin", func(c *Config) { c.CorsOrigins, c.CorsCredentials = "*", true }, "CorsCredentials"},
+		{"cors origins without methods", func(c *Config) { c.CorsOrigins, c.CorsMethods = "https://example.com", " , " }, "CorsMethods"},
+		{"negative cors max age", func(c *Config) { c.CorsMaxAge = -1 }, "CorsMaxAge"},
+		{"negative hsts max age", func(c *Config) { c.HstsMaxAge = -1 }, "HstsMaxAge"},
+		{"frame ancestor with a query", func(c *Config) { c.FrameAncestors = "https://example.com?embed=1" }, "FrameAncestors"},
+		{"short session key", func(c *Config) { c.SessionKey = "too short" }, "SessionKey"},
+		{"unknown session store", func(c *Config) { c.SessionStore = "redis" }, "SessionStore"},
+		{"short session max age", func(c *Config) { c.SessionMaxAge = 59 }, "SessionMaxAge"},
+		{"oidc issuer not a url", func(c *Config) {
+			c.OidcIssuer, c.OidcClientId, c.OidcRedirectUrl = "accounts.example.com", "tasks", "https://tasks.example.com/callback"
+		}, "OidcIssuer"},
+		{"oidc without a client id", func(c *Config) {
+			c.OidcIssuer, c.OidcRedirectUrl = "https://accounts.example.com", "https://tasks.example.com/callback"
+		}, "OidcClientId"},
+		{"oidc without a redirect url", func(c *Config) { c.OidcIssuer, c.OidcClientId = "https://accounts.example.com", "tasks" }, "OidcRedirectUrl"},
+		{"oidc without a username claim", func(c *Config) {
+			c.OidcIssuer, c.OidcClientId, c.OidcRedirectUrl, c.OidcUsernameClaim = "https://accounts.example.com", "tasks", "https://tasks.example.com/callback", ""
+		}, "OidcUsernameClaim"},
+		{"oidc scopes without openid", func(c *Config) {
+			c.OidcIssuer, c.OidcClientId, c.OidcRedirectUrl, c.OidcScopes = "https://accounts.example.com", "tasks", "https://tasks.example.com/callback", "profile, email"
+		}, "OidcScopes"},
+		{"unknown role of a group", func(c *Config) { c.OidcRoles = "staff=owner" }, "OidcRoles"},
+		{"group without a role", func(c *Config) { c.OidcRoles = "staff" }, "OidcRoles"},
+		{"unknown default role", func(c *Config) { c.OidcDefaultRole = "guest" }, "OidcDefaultRole"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := loadDefaults(t)
+			test.change(c)
+
+			got := problems(c.Validate())
+
+			if len(got) != 1 || got[0] != test.key {
+				t.Errorf("got the problems of %v, want only %s", got, test.key)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	c := loadDefaults(t)
+	c.DbPort = "pg"
+	c.LogLevel = "verbose"
+	c.SessionStore = "redis"
+
+	got := problems(c.Validate())
+
+	if strings.Join(got, " ") != "DbPort LogLevel SessionStore" {
+		t.Errorf("got the problems of %v, want DbPort, LogLevel and SessionStore", got)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	base := writeFile(t, "conf.toml", `
+ListenPort = "4000"
+DbHost = "db.internal"
+DbName = "tasks"
+LogLevel = "warn"
+`)
+	overlay := writeFile(t, "conf.yaml", `
+DbHost: db.overlay
+DbName: overlay
+`)
+
+	t.Setenv("VTT_DBNAME", "from-env")
+	t.Setenv("VTT_LOGLEVEL", "debug")
+
+	c, err := LoadConfig(Options{Files: []string{base, overlay}, Overrides: map[string]string{"loglevel": "error"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		key    string
+		value  string
+		source string
+		file   string
+	}{
+		{"DbUser", "postgres", SourceDefault, ""},
+		{"ListenPort", "4000", SourceFile, base},
+		{"DbHost", "db.overlay", SourceFile, overlay},
+		{"DbName", "from-env", SourceEnv, ""},
+		{"LogLevel", "error", SourceFlag, ""},
+	}
+
+	for _, w := range want {
+		v := value(t, c, w.key)
+
+		if v.Value != w.value || v.Source != w.source || v.File != w.file {
+			t.Errorf("%s: got %q from the %s %s, want %q from the %s %s", w.key, v.Value, v.Source, v.File, w.value, w.source, w.file)
+		}
+	}
+
+	if c.ListenPort != "4000" || c.DbHost != "db.overlay" || c.DbName != "from-env" || c.LogLevel != "error" {
+		t.Errorf("got %+v", c)
+	}
+
+	if strings.Join(c.Files, " ") != base+" "+overlay {
+		t.Errorf("got the files %v, want them in the order they were given", c.Files)
+	}
+
+	if keys := len(c.Values()); keys != len(defaults) {
+		t.Errorf("got %d values, want one per key", keys)
+	}
+}
+
+func TestEmptyEnvironmentVariablesAreIgnored(t *testing.T) {
+	t.Setenv("VTT_LISTENPORT", "")
+
+	c, err := LoadConfig(Options{Files: []string{writeFile(t, "conf.toml", `ListenPort = "4000"`)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := value(t, c, "ListenPort"); c.ListenPort != "4000" || v.Source != SourceFile {
+		t.Errorf("got the port %s from the %s, want the one of the file", c.ListenPort, v.Source)
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	file := writeFile(t, "conf.toml", `
+ListenPort = "4000"
+ListenPrt = "5000"
+RateLimit = "fast"
+`)
+	t.Setenv("VTT_AUTHREQUIRED", "maybe")
+
+	c, err := LoadConfig(Options{Files: []string{file}, Overrides: map[string]string{"RateBurst": "many", "Verbose": "true"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := problems(c.Validate())
+	want := "listenprt Verbose RateLimit RateBurst AuthRequired"
+
+	if strings.Join(got, " ") != want {
+		t.Errorf("got the problems of %v, want %s", got, want)
+	}
+
+	_, err = LoadConfig(Options{Files: []string{writeFile(t, "conf.toml", `ListenPort = `)}})
+
+	if err == nil {
+		t.Error("loaded a file that does not parse")
+	}
+}
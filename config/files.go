@@ -0,0 +1,158 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// formats are the extensions of the configuration files, in the order they
+// are looked for
+var formats = []string{".toml", ".yaml", ".yml", ".json"}
+
+// envPattern matches the name of the environment of the overlays
+var envPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SearchPath returns the directories the configuration files are looked for
+// in, in the order they are merged
+func SearchPath() []string {
+	dirs := []string{"/etc/techchallengeapp"}
+
+	// $XDG_CONFIG_HOME, or ~/.config, on Linux
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "techchallengeapp"))
+	}
+
+	return append(dirs, ".")
+}
+
+// configFiles returns the files of the configuration in the order they are
+// merged: the files, or the conf files of the search path, then their
+// overlays of the environment
+func configFiles(opts Options) ([]string, error) {
+	env := opts.Env
+
+	if env == "" {
+		env = os.Getenv(envPrefix + "_ENV")
+	}
+
+	if env != "" && !envPattern.MatchString(env) {
+		return nil, fmt.Errorf("the environment must only have letters, digits, - and _, not %q", env)
+	}
+
+	var files []string
+	var overlays []string
+
+	if len(opts.Files) > 0 {
+		for _, file := range opts.Files {
+			ext := filepath.Ext(file)
+
+			if !supported(ext) {
+				return nil, fmt.Errorf("%s: the format is inferred from the extension, use %s", file, strings.Join(formats, ", "))
+			}
+
+			// an explicit file must exist
+			_, err := os.Stat(file)
+
+			if err != nil {
+				return nil, err
+			}
+
+			files = append(files, file)
+
+			if overlay := strings.TrimSuffix(file, ext) + "." + env + ext; env != "" && exists(overlay) {
+				overlays = append(overlays, overlay)
+			}
+		}
+
+		return append(files, overlays...), nil
+	}
+
+	for _, dir := range SearchPath() {
+		file, err := find(dir, "conf")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if file != "" {
+			files = append(files, file)
+		}
+
+		if env == "" {
+			continue
+		}
+
+		overlay, err := find(dir, "conf."+env)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if overlay != "" {
+			overlays = append(overlays, overlay)
+		}
+	}
+
+	return append(files, overlays...), nil
+}
+
+// find returns the file of name in dir in one of the formats, empty when
+// there is none
+func find(dir string, name string) (string, error) {
+	var found []string
+
+	for _, ext := range formats {
+		if file := filepath.Join(dir, name+ext); exists(file) {
+			found = append(found, file)
+		}
+	}
+
+	if len(found) > 1 {
+		return "", fmt.Errorf("%s are all configuration files, keep only one", strings.Join(found, ", "))
+	}
+
+	if len(found) == 0 {
+		return "", nil
+	}
+
+	return found[0], nil
+}
+
+func supported(ext string) bool {
+	for _, format := range formats {
+		if strings.EqualFold(ext, format) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func exists(file string) bool {
+	info, err := os.Stat(file)
+
+	return err == nil && !info.IsDir()
+}
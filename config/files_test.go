@@ -0,0 +1,147 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// inDir runs the rest of the test in dir
+func inDir(t *testing.T, dir string) {
+	wd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touch creates the files, and returns their paths
+func touch(t *testing.T, dir string, names ...string) []string {
+	var files []string
+
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+func TestOverlaysOfTheFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := touch(t, dir, "base.toml", "local.json", "base.production.toml", "local.staging.json")
+
+	got, err := configFiles(Options{Files: files[:2], Env: "production"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the overlays are merged after every file
+	if want := []string{files[0], files[1], files[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	t.Setenv("VTT_ENV", "staging")
+
+	got, err = configFiles(Options{Files: files[:2]})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{files[0], files[1], files[3]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with VTT_ENV got %v, want %v", got, want)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	home := t.TempDir()
+	wd := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+	inDir(t, wd)
+
+	user := touch(t, home, "techchallengeapp/conf.yaml", "techchallengeapp/conf.production.yaml")
+	local := touch(t, wd, "conf.toml", "conf.production.toml", "conf.staging.toml")
+
+	got, err := configFiles(Options{Env: "production"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files of the search path, then their overlays, each in the
+	// order of the search path. /etc/techchallengeapp may hold files of
+	// the machine
+	var want []string
+
+	for _, file := range got {
+		if filepath.Dir(file) != "/etc/techchallengeapp" {
+			want = append(want, file)
+		}
+	}
+
+	if !reflect.DeepEqual(want, []string{user[0], "conf.toml", user[1], "conf.production.toml"}) {
+		t.Errorf("got %v, want the files of %s and %s, then their overlays", got, home, local[0])
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	inDir(t, dir)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"unknown extension", Options{Files: touch(t, dir, "conf.ini")}},
+		{"missing file", Options{Files: []string{filepath.Join(dir, "missing.toml")}}},
+		{"environment with a path", Options{Env: "../prod"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if files, err := configFiles(test.opts); err == nil {
+				t.Errorf("got the files %v, want an error", files)
+			}
+		})
+	}
+
+	touch(t, dir, "conf.toml", "conf.yaml")
+
+	if files, err := configFiles(Options{}); err == nil {
+		t.Errorf("got the files %v with two conf files in a directory, want an error", files)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SecretProvider resolves the references to secrets of a scheme, e.g.
+// file:///run/secrets/db_password, so they need not be written in the
+// configuration
+type SecretProvider interface {
+	Resolve(ref *url.URL) (string, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]SecretProvider{
+		"file": FileProvider{},
+		"env":  EnvProvider{},
+	}
+)
+
+// RegisterSecretProvider resolves the references of scheme with provider,
+// replacing the provider of the scheme when there is one
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[strings.ToLower(scheme)] = provider
+}
+
+// resolve returns the secret a value references, the value itself when it
+// is not a reference. ref is the reference, empty when there is none
+func resolve(value string) (secret string, ref string, err error) {
+	scheme, _, found := strings.Cut(value, "://")
+
+	if !found {
+		return value, "", nil
+	}
+
+	providersMu.RLock()
+	provider, ok := providers[strings.ToLower(scheme)]
+	providersMu.RUnlock()
+
+	// other urls, e.g. ApiUrl, are values
+	if !ok {
+		return value, "", nil
+	}
+
+	u, err := url.Parse(value)
+
+	if err != nil {
+		return "", value, err
+	}
+
+	secret, err = provider.Resolve(u)
+
+	return secret, value, err
+}
+
+// FileProvider reads secrets from local files, file:///run/secrets/db or
+// file://secrets/db relative to the working directory. The newline ending
+// the file is removed
+type FileProvider struct{}
+
+func (FileProvider) Resolve(ref *url.URL) (string, error) {
+	b, err := os.ReadFile(ref.Host + ref.Path)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"), nil
+}
+
+// EnvProvider reads secrets from environment variables, env://DB_PASSWORD
+type EnvProvider struct{}
+
+func (EnvProvider) Resolve(ref *url.URL) (string, error) {
+	value, ok := os.LookupEnv(ref.Host)
+
+	if !ok {
+		return "", fmt.Errorf("the environment variable %s is not set", ref.Host)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,204 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// value is the loaded value of key
+func value(t *testing.T, c *Config, key string) Value {
+	t.Helper()
+
+	for _, v := range c.Values() {
+		if v.Key == key {
+			return v
+		}
+	}
+
+	t.Fatalf("no value of %s", key)
+	return Value{}
+}
+
+func TestFileSecrets(t *testing.T) {
+	secret := writeFile(t, "db_password", "s3cret\n")
+	c, err := LoadConfig(Options{Files: []string{writeFile(t, "conf.toml", `DbPassword = "file://`+secret+`"`)}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.DbPassword != "s3cret" {
+		t.Errorf("got the password %q, want the content of the file without its newline", c.DbPassword)
+	}
+
+	if v := value(t, c, "DbPassword"); v.Ref != "file://"+secret || v.Source != SourceFile || !v.Secret {
+		t.Errorf("got the value %+v, want the reference read from the file", v)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRelativeFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte("relative\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VTT_SESSIONKEY", "file://key")
+
+	if c := loadDefaults(t); c.SessionKey != "relative" {
+		t.Errorf("got the key %q, want the file of the working directory", c.SessionKey)
+	}
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("TEST_DB_PASSWORD", "from the env")
+	t.Setenv("VTT_DBPASSWORD", "env://TEST_DB_PASSWORD")
+
+	c := loadDefaults(t)
+
+	if c.DbPassword != "from the env" {
+		t.Errorf("got the password %q, want the one of TEST_DB_PASSWORD", c.DbPassword)
+	}
+
+	if v := value(t, c, "DbPassword"); v.Ref != "env://TEST_DB_PASSWORD" || v.Source != SourceEnv {
+		t.Errorf("got the value %+v, want the reference read from the environment", v)
+	}
+}
+
+func TestFileVariables(t *testing.T) {
+	t.Setenv("VTT_DBPASSWORD_FILE", writeFile(t, "db_password", "from the file"))
+
+	c := loadDefaults(t)
+
+	if c.DbPassword != "from the file" || value(t, c, "DbPassword").Source != SourceEnv {
+		t.Errorf("got the password %q, want the content of VTT_DBPASSWORD_FILE", c.DbPassword)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// the flags win over the files of the environment
+	c, err := LoadConfig(Options{Files: []string{writeFile(t, "conf.toml", "")}, Overrides: map[string]string{"DbPassword": "from a flag"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.DbPassword != "from a flag" || value(t, c, "DbPassword").Source != SourceFlag {
+		t.Errorf("got the password %q, want the one of the flag", c.DbPassword)
+	}
+
+	t.Setenv("VTT_DBPASSWORD", "plain")
+
+	if got := problems(loadDefaults(t).Validate()); len(got) != 1 || got[0] != "DbPassword" {
+		t.Errorf("got the problems of %v with both VTT_DBPASSWORD and VTT_DBPASSWORD_FILE, want DbPassword", got)
+	}
+}
+
+func TestUnreadableSecrets(t *testing.T) {
+	t.Setenv("VTT_DBPASSWORD", "file://"+filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("VTT_APITOKEN", "env://TEST_MISSING_TOKEN")
+
+	err := loadDefaults(t).Validate()
+
+	if got := problems(err); strings.Join(got, " ") != "DbPassword ApiToken" {
+		t.Fatalf("got the problems of %v, want DbPassword and ApiToken", got)
+	}
+
+	if !strings.Contains(err.Error(), "TEST_MISSING_TOKEN is not set") {
+		t.Errorf("got %v, want the missing variable named", err)
+	}
+}
+
+func TestOtherUrlsAreValues(t *testing.T) {
+	t.Setenv("VTT_APIURL", "https://tasks.example.com")
+
+	c := loadDefaults(t)
+
+	if v := value(t, c, "ApiUrl"); c.ApiUrl != "https://tasks.example.com" || v.Ref != "" {
+		t.Errorf("got the url %q read from %q, want the url itself", c.ApiUrl, v.Ref)
+	}
+}
+
+// vault answers the references of a test scheme from a map
+type vault map[string]string
+
+func (v vault) Resolve(ref *url.URL) (string, error) {
+	secret, ok := v[ref.Host+ref.Path]
+
+	if !ok {
+		return "", errors.New("no such secret")
+	}
+
+	return secret, nil
+}
+
+func TestRegisterSecretProvider(t *testing.T) {
+	RegisterSecretProvider("Vault", vault{"kv/oidc": "client secret"})
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(providers, "vault")
+		providersMu.Unlock()
+	})
+
+	t.Setenv("VTT_OIDCCLIENTSECRET", "vault://kv/oidc")
+
+	if c := loadDefaults(t); c.OidcClientSecret != "client secret" {
+		t.Errorf("got the secret %q, want the one of the provider", c.OidcClientSecret)
+	}
+}
+
+// the daemon reloads the configuration on SIGHUP, the rotated secrets are
+// read again
+func TestSecretsAreReadAgain(t *testing.T) {
+	secret := writeFile(t, "db_password", "before")
+	t.Setenv("VTT_DBPASSWORD_FILE", secret)
+
+	if c := loadDefaults(t); c.DbPassword != "before" {
+		t.Fatalf("got the password %q, want before", c.DbPassword)
+	}
+
+	if err := os.WriteFile(secret, []byte("after"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := loadDefaults(t); c.DbPassword != "after" {
+		t.Errorf("got the password %q once rotated, want after", c.DbPassword)
+	}
+}
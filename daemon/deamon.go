@@ -21,49 +21,157 @@
 package daemon
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/rpc"
+	"github.com/servian/TechChallengeApp/tracing"
 	"github.com/servian/TechChallengeApp/ui"
+	"github.com/servian/TechChallengeApp/webhook"
 )
 
 // Config - configuration for daemon package
 type Config struct {
 	ListenSpec string
 
+	// GrpcListenSpec is where the gRPC api listens, disabled when empty
+	GrpcListenSpec string
+
+	// MetricsListenSpec is where the metrics are served to anyone, they are
+	// served to the admins with the api when empty
+	MetricsListenSpec string
+
+	// Notify shares task events with other instances using postgres LISTEN/NOTIFY
+	Notify bool
+
+	Tracing tracing.Config
+
 	UI ui.Config
+
+	// Reload loads the configuration again on SIGHUP, the secrets that can
+	// change while running are applied, e.g. the database password
+	Reload func() (*Config, error)
 }
 
 // Run - starts the daemon
 func Run(cfg *Config) error {
-	log.Printf("Starting HTTP server on: %s\n", cfg.ListenSpec)
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
+
+	cfg.UI.Events = events.NewBroker()
+
+	// the http and grpc servers count the invalid tokens together
+	cfg.UI.Failures = ui.NewFailures(cfg.UI.RateLimit)
+
+	if cfg.Notify {
+		err := cfg.UI.Events.ListenPostgres(cfg.UI.DB)
+
+		if err != nil {
+			slog.Error("Error listening for events from other instances", "error", err)
+		}
+	}
+
+	defer cfg.UI.Events.Close()
+
+	dispatcher := webhook.NewDispatcher(webhook.Config{DB: cfg.UI.DB})
+	dispatcher.Start(cfg.UI.Events)
+	defer dispatcher.Stop()
+
+	slog.Info("Starting HTTP server", "listen", cfg.ListenSpec)
 
 	listener, err := net.Listen("tcp", cfg.ListenSpec)
+
 	if err != nil {
-		log.Printf("Error creating listener - %v\n", err)
+		return err
 	}
 
-	ui.Start(cfg.UI, listener)
+	var metricsListener net.Listener
+
+	if cfg.MetricsListenSpec != "" {
+		slog.Info("Starting metrics server", "listen", cfg.MetricsListenSpec)
 
-	waitForSignal()
+		metricsListener, err = net.Listen("tcp", cfg.MetricsListenSpec)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	ui.Start(cfg.UI, listener, metricsListener)
+
+	if cfg.GrpcListenSpec != "" {
+		slog.Info("Starting gRPC server", "listen", cfg.GrpcListenSpec)
+
+		grpcListener, err := net.Listen("tcp", cfg.GrpcListenSpec)
+
+		if err != nil {
+			return err
+		}
+
+		stop := rpc.Start(rpc.Config{DB: cfg.UI.DB, Events: cfg.UI.Events, AuthRequired: cfg.UI.Auth.Required, Failures: cfg.UI.Failures}, grpcListener)
+		defer stop()
+	}
+
+	waitForSignal(cfg)
 
 	return nil
 }
 
-func waitForSignal() {
-	xsig := make(chan os.Signal)
+// reload applies the rotated secrets of the configuration loaded again
+func reload(cfg *Config, password *string) {
+	if cfg.Reload == nil {
+		return
+	}
+
+	next, err := cfg.Reload()
+
+	if err != nil {
+		slog.Error("Error reloading the configuration, keeping the current secrets", "error", err)
+		return
+	}
+
+	if next.UI.DB.DbPassword != *password {
+		db.SetPassword(cfg.UI.DB, next.UI.DB.DbPassword)
+		*password = next.UI.DB.DbPassword
+		slog.Info("The database password changed, new connections use it")
+	}
+}
+
+func waitForSignal(cfg *Config) {
+	password := cfg.UI.DB.DbPassword
+
+	xsig := make(chan os.Signal, 1)
 	signal.Notify(xsig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	hsig := make(chan os.Signal)
+	hsig := make(chan os.Signal, 1)
 	signal.Notify(hsig, syscall.SIGHUP)
 	for {
 		select {
 		case s := <-xsig:
-			log.Fatalf("Got signal: %v, exiting.", s)
+			// returning lets Run stop the background work and flush the traces
+			slog.Info("Got signal, exiting", "signal", s)
+			return
 		case s := <-hsig:
-			log.Printf("Got signal: %v, continue.", s)
+			slog.Info("Got signal, reloading the secrets", "signal", s)
+			reload(cfg, &password)
 		}
 	}
 }
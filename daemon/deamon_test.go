@@ -0,0 +1,132 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// rotating returns a configuration whose Reload loads the password
+func rotating(name string, password string, err error) *Config {
+	cfg := &Config{}
+	cfg.UI.DB.DbName = name
+	cfg.UI.DB.DbPassword = "before"
+
+	cfg.Reload = func() (*Config, error) {
+		if err != nil {
+			return nil, err
+		}
+
+		next := &Config{}
+		next.UI.DB = cfg.UI.DB
+		next.UI.DB.DbPassword = password
+
+		return next, nil
+	}
+
+	return cfg
+}
+
+func TestReloadRotatesThePassword(t *testing.T) {
+	cfg := rotating(t.Name(), "after", nil)
+	password := cfg.UI.DB.DbPassword
+
+	reload(cfg, &password)
+
+	if password != "after" {
+		t.Errorf("got the password %q, want after", password)
+	}
+}
+
+func TestReloadKeepsThePasswordOnErrors(t *testing.T) {
+	cfg := rotating(t.Name(), "after", errors.New("DbPort: must be a port number"))
+	password := cfg.UI.DB.DbPassword
+
+	reload(cfg, &password)
+
+	if password != "before" {
+		t.Errorf("got the password %q, want it kept", password)
+	}
+
+	cfg.Reload = nil
+	reload(cfg, &password)
+
+	if password != "before" {
+		t.Errorf("got the password %q without Reload, want it kept", password)
+	}
+}
+
+func TestSighupReloads(t *testing.T) {
+	reloaded := make(chan struct{}, 1)
+
+	cfg := rotating(t.Name(), "after", nil)
+	next := cfg.Reload
+	cfg.Reload = func() (*Config, error) {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+
+		return next()
+	}
+
+	// the signals sent before waitForSignal listens must not kill the test
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGHUP, syscall.SIGTERM)
+	defer signal.Stop(ignored)
+
+	done := make(chan struct{})
+
+	go func() {
+		waitForSignal(cfg)
+		close(done)
+	}()
+
+	// signal until waitForSignal listens
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+
+	for sent := false; !sent; {
+		syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+		select {
+		case <-reloaded:
+			sent = true
+		case <-tick.C:
+		case <-deadline:
+			t.Fatal("SIGHUP did not reload the configuration")
+		}
+	}
+
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM did not stop waiting")
+	}
+}
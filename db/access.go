@@ -0,0 +1,160 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// ErrNoList is returned when adding a task without a list, and the
+// principal can not edit any list
+var ErrNoList = fmt.Errorf("%w: there is no list you can add tasks to", access.ErrForbidden)
+
+// querier runs the queries of the access checks, in a transaction or not
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// listRoles returns the lists the principal of ctx can see, by id, with
+// its role on each of them
+func listRoles(ctx context.Context, q querier) ([]model.List, error) {
+	p := access.From(ctx)
+
+	var userID int
+	groups := []string{}
+
+	if p.User != nil {
+		userID = p.User.ID
+		groups = p.User.Groups
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT l.id, l.name, COUNT(m.id) > 0,
+	COALESCE(array_agg(m.role) FILTER (WHERE m.user_id = $1 OR m.group_name = ANY($2)), '{}')
+FROM lists l LEFT JOIN list_members m ON m.list_id = l.id
+GROUP BY l.id ORDER BY l.id`, userID, pq.Array(groups))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var lists []model.List
+
+	for rows.Next() {
+		var list model.List
+		var memberships []string
+
+		err = rows.Scan(&list.ID, &list.Name, &list.Shared, pq.Array(&memberships))
+
+		if err != nil {
+			return nil, err
+		}
+
+		list.Role = p.ListRole(list.Shared, memberships)
+
+		if list.Role != "" {
+			lists = append(lists, list)
+		}
+	}
+
+	return lists, rows.Err()
+}
+
+// checkList returns the list when the principal of ctx has at least the
+// role on it, ErrNotFound when the list does not exist or the principal can
+// not see it, access.ErrForbidden when its role is not enough
+func checkList(ctx context.Context, q querier, id int, role string) (model.List, error) {
+	lists, err := listRoles(ctx, q)
+
+	if err != nil {
+		return model.List{}, err
+	}
+
+	for _, list := range lists {
+		if list.ID != id {
+			continue
+		}
+
+		if !access.Allows(list.Role, role) {
+			return list, access.ErrForbidden
+		}
+
+		return list, nil
+	}
+
+	return model.List{}, ErrNotFound
+}
+
+// taskList returns the list a task is added to, the first list the
+// principal of ctx can edit when id is 0
+func taskList(ctx context.Context, q querier, id int) (int, error) {
+	if id != 0 {
+		_, err := checkList(ctx, q, id, model.RoleEditor)
+		return id, err
+	}
+
+	lists, err := listRoles(ctx, q)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, list := range lists {
+		if access.Allows(list.Role, model.RoleEditor) {
+			return list.ID, nil
+		}
+	}
+
+	return 0, ErrNoList
+}
+
+// readable adds the condition selecting the tasks of the lists the
+// principal of ctx can see to the conditions of a query on tasks, numbering
+// its argument after args. Nothing is added for the admins
+func readable(ctx context.Context, q querier, conditions []string, args []interface{}) ([]string, []interface{}, error) {
+	if access.From(ctx).Admin() {
+		return conditions, args, nil
+	}
+
+	lists, err := listRoles(ctx, q)
+
+	if err != nil {
+		return conditions, args, err
+	}
+
+	ids := make([]int64, 0, len(lists))
+
+	for _, list := range lists {
+		ids = append(ids, int64(list.ID))
+	}
+
+	args = append(args, pq.Array(ids))
+	conditions = append(conditions, fmt.Sprintf("list_id = ANY($%d)", len(args)))
+
+	return conditions, args, nil
+}
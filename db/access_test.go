@@ -0,0 +1,297 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+var testPrincipals = map[string]context.Context{
+	"anonymous": context.Background(),
+	"system":    access.AsSystem(context.Background()),
+	"viewer":    access.WithUser(context.Background(), model.User{ID: 1, Name: "vera", Role: model.RoleViewer}),
+	"editor":    access.WithUser(context.Background(), model.User{ID: 2, Name: "ed", Role: model.RoleEditor, Groups: []string{"staff", "leads"}}),
+	"admin":     access.WithUser(context.Background(), model.User{ID: 3, Name: "ada", Role: model.RoleAdmin}),
+}
+
+// outcomes of an operation on the lists 1, 2 and 3 of testDB
+const (
+	ok        = "ok"
+	notFound  = "404"
+	forbidden = "403"
+)
+
+// outcome names the error of an operation
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return ok
+	case errors.Is(err, ErrNotFound):
+		return notFound
+	case errors.Is(err, access.ErrForbidden):
+		return forbidden
+	}
+
+	return err.Error()
+}
+
+// what each principal gets on the lists 1, 2 and 3 with the operations
+// needing a role
+var (
+	viewing = map[string][3]string{
+		"anonymous": {ok, notFound, notFound},
+		"system":    {ok, ok, ok},
+		"viewer":    {ok, ok, notFound},
+		"editor":    {ok, ok, ok},
+		"admin":     {ok, ok, ok},
+	}
+
+	editing = map[string][3]string{
+		"anonymous": {ok, notFound, notFound},
+		"system":    {ok, ok, ok},
+		"viewer":    {forbidden, ok, notFound},
+		"editor":    {ok, forbidden, ok},
+		"admin":     {ok, ok, ok},
+	}
+
+	administering = map[string][3]string{
+		"anonymous": {forbidden, notFound, notFound},
+		"system":    {ok, ok, ok},
+		"viewer":    {forbidden, forbidden, notFound},
+		"editor":    {forbidden, forbidden, ok},
+		"admin":     {ok, ok, ok},
+	}
+)
+
+func TestListAccess(t *testing.T) {
+	// each operation runs on a new database, changed tells whether it
+	// changed the list id or its task, which has the same id
+	operations := []struct {
+		name    string
+		want    map[string][3]string
+		run     func(ctx context.Context, cfg Config, id int) error
+		changed func(ctx context.Context, cfg Config, id int) bool
+	}{
+		{"get list", viewing, func(ctx context.Context, cfg Config, id int) error {
+			_, err := GetList(ctx, cfg, id)
+			return err
+		}, nil},
+		{"filter tasks", viewing, func(ctx context.Context, cfg Config, id int) error {
+			tasks, err := FilterTasks(ctx, cfg, TaskFilter{ListID: id})
+
+			if err == nil && (len(tasks) != 1 || tasks[0].ID != id) {
+				return errors.New("wrong tasks")
+			}
+
+			return err
+		}, nil},
+		{"add task", editing, func(ctx context.Context, cfg Config, id int) error {
+			_, err := AddTask(ctx, cfg, model.Task{Title: "New", ListID: id})
+			return err
+		}, func(ctx context.Context, cfg Config, id int) bool {
+			count, _ := CountMatchingTasks(access.AsSystem(ctx), cfg, TaskFilter{ListID: id})
+			return count == 2
+		}},
+		{"update task", editing, func(ctx context.Context, cfg Config, id int) error {
+			_, err := UpdateTask(ctx, cfg, model.Task{ID: id, Title: "Renamed"})
+			return err
+		}, func(ctx context.Context, cfg Config, id int) bool {
+			tasks, _ := GetTasks(access.AsSystem(ctx), cfg, []int{id})
+			return len(tasks) == 1 && tasks[0].Title == "Renamed"
+		}},
+		{"delete task", editing, func(ctx context.Context, cfg Config, id int) error {
+			_, err := DeleteTask(ctx, cfg, model.Task{ID: id})
+			return err
+		}, func(ctx context.Context, cfg Config, id int) bool {
+			tasks, _ := GetTasks(access.AsSystem(ctx), cfg, []int{id})
+			return len(tasks) == 0
+		}},
+		{"rename list", administering, func(ctx context.Context, cfg Config, id int) error {
+			_, err := UpdateList(ctx, cfg, model.List{ID: id, Name: "Renamed"})
+			return err
+		}, func(ctx context.Context, cfg Config, id int) bool {
+			list, _ := GetList(access.AsSystem(ctx), cfg, id)
+			return list.Name == "Renamed"
+		}},
+		{"delete list", administering, func(ctx context.Context, cfg Config, id int) error {
+			return DeleteList(ctx, cfg, id)
+		}, func(ctx context.Context, cfg Config, id int) bool {
+			_, err := GetList(access.AsSystem(ctx), cfg, id)
+			return errors.Is(err, ErrNotFound)
+		}},
+		{"get members", administering, func(ctx context.Context, cfg Config, id int) error {
+			_, err := GetMembers(ctx, cfg, id)
+			return err
+		}, nil},
+		{"add member", administering, func(ctx context.Context, cfg Config, id int) error {
+			_, err := AddMember(ctx, cfg, model.Member{ListID: id, Group: "interns", Role: model.RoleViewer})
+			return err
+		}, func(ctx context.Context, cfg Config, id int) bool {
+			members, _ := GetMembers(access.AsSystem(ctx), cfg, id)
+
+			for _, m := range members {
+				if m.Group == "interns" {
+					return true
+				}
+			}
+
+			return false
+		}},
+	}
+
+	for _, op := range operations {
+		for name, ctx := range testPrincipals {
+			for i, want := range op.want[name] {
+				id := i + 1
+				cfg, _ := testDB(t)
+
+				got := outcome(op.run(ctx, cfg, id))
+
+				if got != want {
+					t.Errorf("%s %s on list %d: %s, want %s", name, op.name, id, got, want)
+				}
+
+				if op.changed == nil {
+					continue
+				}
+
+				if changed := op.changed(ctx, cfg, id); changed != (want == ok) {
+					t.Errorf("%s %s on list %d: changed %v, want %v", name, op.name, id, changed, want == ok)
+				}
+			}
+		}
+	}
+}
+
+func TestTaskMovedToAnotherList(t *testing.T) {
+	cfg, _ := testDB(t)
+
+	// the viewer edits the shared list, but only views the open one
+	_, err := UpdateTask(testPrincipals["viewer"], cfg, model.Task{ID: 2, Title: "Moved", ListID: 1})
+
+	if !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("viewer moves a task to a list it views: %v, want %v", err, access.ErrForbidden)
+	}
+
+	// the editor edits the open and private lists
+	moved, err := UpdateTask(testPrincipals["editor"], cfg, model.Task{ID: 3, Title: "Moved", ListID: 1})
+
+	if err != nil || moved.ListID != 1 {
+		t.Errorf("editor moves a task to the open list: %+v %v", moved, err)
+	}
+}
+
+func TestListRoles(t *testing.T) {
+	cfg, _ := testDB(t)
+	pool, _ := getDb(cfg)
+
+	lists, err := listRoles(testPrincipals["editor"], pool)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []model.List{
+		{ID: 1, Name: "Open", Shared: false, Role: model.RoleEditor},
+		{ID: 2, Name: "Shared", Shared: true, Role: model.RoleViewer},
+		{ID: 3, Name: "Private", Shared: true, Role: model.RoleAdmin},
+	}
+
+	if len(lists) != len(want) {
+		t.Fatalf("lists %v, want %v", lists, want)
+	}
+
+	for i := range want {
+		if lists[i] != want[i] {
+			t.Errorf("list %v, want %v", lists[i], want[i])
+		}
+	}
+}
+
+func TestTaskListByDefault(t *testing.T) {
+	cfg, fake := testDB(t)
+
+	// the first list the principal can edit
+	want := map[string]int{"anonymous": 1, "system": 1, "viewer": 2, "editor": 1, "admin": 1}
+
+	for name, ctx := range testPrincipals {
+		task, err := AddTask(ctx, cfg, model.Task{Title: "New"})
+
+		if err != nil || task.ListID != want[name] {
+			t.Errorf("%s adds to list %d: %v, want %d", name, task.ListID, err, want[name])
+		}
+	}
+
+	// a viewer of the open list only
+	viewer := fake.AddUser(model.User{Name: "val", Role: model.RoleViewer})
+	_, err := AddTask(access.WithUser(context.Background(), viewer), cfg, model.Task{Title: "New"})
+
+	if !errors.Is(err, ErrNoList) {
+		t.Errorf("a viewer of the open list only adds a task: %v, want %v", err, ErrNoList)
+	}
+}
+
+func TestReadable(t *testing.T) {
+	cfg, _ := testDB(t)
+	pool, _ := getDb(cfg)
+
+	// the lists whose tasks each principal reads, none means every list
+	want := map[string]string{
+		"anonymous": "{1}",
+		"system":    "",
+		"viewer":    "{1,2}",
+		"editor":    "{1,2,3}",
+		"admin":     "",
+	}
+
+	for name, ctx := range testPrincipals {
+		conditions, args, err := readable(ctx, pool, []string{"complete = $1"}, []interface{}{true})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want[name] == "" {
+			if len(conditions) != 1 || len(args) != 1 {
+				t.Errorf("%s reads %q %v, want every list", name, conditions, args)
+			}
+
+			continue
+		}
+
+		if len(conditions) != 2 || conditions[1] != "list_id = ANY($2)" || len(args) != 2 {
+			t.Errorf("%s reads %q %v", name, conditions, args)
+			continue
+		}
+
+		ids, _ := args[1].(driver.Valuer).Value()
+
+		if ids != want[name] {
+			t.Errorf("%s reads the lists %v, want %s", name, ids, want[name])
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// TaskFilter selects tasks, the zero value selects all of them
+type TaskFilter struct {
+	// Complete selects the finished or the open tasks when set
+	Complete *bool
+	// Search selects the tasks whose title contains it, ignoring case
+	Search string
+	// DueBefore selects the tasks due before it
+	DueBefore *time.Time
+	// DueAfter selects the tasks due after it
+	DueAfter *time.Time
+	// ListID selects the tasks of a list when set
+	ListID int
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where returns the conditions of the filter, numbering its arguments
+// after args
+func (f TaskFilter) where(args []interface{}) ([]string, []interface{}) {
+	var conditions []string
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Complete != nil {
+		add("completed = $%d", *f.Complete)
+	}
+
+	if f.Search != "" {
+		add("title ILIKE '%%' || $%d || '%%'", likeEscaper.Replace(f.Search))
+	}
+
+	if f.DueBefore != nil {
+		add("due < $%d", *f.DueBefore)
+	}
+
+	if f.DueAfter != nil {
+		add("due > $%d", *f.DueAfter)
+	}
+
+	if f.ListID != 0 {
+		add("list_id = $%d", f.ListID)
+	}
+
+	return conditions, args
+}
+
+// conditions returns the conditions of the filter, along with the ones
+// selecting the tasks the principal of ctx can see. The list of the filter
+// is ErrNotFound when the principal can not see it
+func (f TaskFilter) conditions(ctx context.Context, q querier, args []interface{}) ([]string, []interface{}, error) {
+	if f.ListID != 0 {
+		_, err := checkList(ctx, q, f.ListID, model.RoleViewer)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conditions, args := f.where(args)
+
+	return readable(ctx, q, conditions, args)
+}
+
+// FindTasks lists, by id, at most limit tasks matching the filter with an
+// id greater than after
+func FindTasks(ctx context.Context, cfg Config, filter TaskFilter, after int, limit int) ([]model.Task, error) {
+	var tasks []model.Task
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args, err := filter.conditions(ctx, db, []interface{}{after, limit})
+
+	if err != nil {
+		return nil, err
+	}
+
+	conditions = append(conditions, "id > $1")
+
+	rows, err := db.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+strings.Join(conditions, " AND ")+" ORDER BY id LIMIT $2", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// FilterTasks lists, by id, every task matching the filter the principal
+// of ctx can see
+func FilterTasks(ctx context.Context, cfg Config, filter TaskFilter) ([]model.Task, error) {
+	var tasks []model.Task
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args, err := filter.conditions(ctx, db, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks"+whereClause(conditions)+" ORDER BY id", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// CountMatchingTasks returns how many tasks match the filter
+func CountMatchingTasks(ctx context.Context, cfg Config, filter TaskFilter) (int, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return 0, err
+	}
+
+	conditions, args, err := filter.conditions(ctx, db, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks"+whereClause(conditions), args...).Scan(&count)
+
+	return count, err
+}
+
+// GetTasks returns the tasks with the given ids, in no particular order,
+// the ids without a task the principal of ctx can see are skipped
+func GetTasks(ctx context.Context, cfg Config, ids []int) ([]model.Task, error) {
+	var tasks []model.Task
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args, err := readable(ctx, db, []string{"id = ANY($1)"}, []interface{}{pq.Array(ids)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks"+whereClause(conditions), args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetWebhooks returns the webhooks with the given ids, in no particular
+// order, the ids without a webhook are skipped
+func GetWebhooks(ctx context.Context, cfg Config, ids []int) ([]model.Webhook, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return nil, err
+	}
+
+	var hooks []model.Webhook
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ANY($1)", pq.Array(ids))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// GetDeliveriesOfWebhooks lists the latest deliveries of each webhook,
+// at most limit per webhook, newest first
+func GetDeliveriesOfWebhooks(ctx context.Context, cfg Config, ids []int, limit int) ([]model.WebhookDelivery, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return nil, err
+	}
+
+	var deliveries []model.WebhookDelivery
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM (
+  SELECT *, row_number() OVER (PARTITION BY webhook_id ORDER BY id DESC) AS n
+  FROM webhook_deliveries WHERE webhook_id = ANY($1)
+) d WHERE n <= $2 ORDER BY webhook_id, id DESC`, pq.Array(ids), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
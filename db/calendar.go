@@ -0,0 +1,183 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// hashToken is what is stored of a feed token, an api token or a session
+// id, so they stay secret to whoever can read the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// feedColumns are the columns of the calendar feeds, in the order scanFeed
+// reads them
+const feedColumns = "id, name, COALESCE(list_id, 0), user_id"
+
+func scanFeed(row interface{ Scan(...interface{}) error }) (model.CalendarFeed, error) {
+	feed := model.CalendarFeed{}
+
+	err := row.Scan(&feed.ID, &feed.Name, &feed.ListID, &feed.UserID)
+
+	return feed, err
+}
+
+// GetCalendarFeeds lists the calendar feeds of the user of ctx, without
+// their tokens. The admins see the feeds of every user
+func GetCalendarFeeds(ctx context.Context, cfg Config) ([]model.CalendarFeed, error) {
+	p := access.From(ctx)
+
+	if p.User == nil && !p.Admin() {
+		return nil, access.ErrForbidden
+	}
+
+	var feeds []model.CalendarFeed
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+
+	if p.Admin() {
+		rows, err = db.QueryContext(ctx, "SELECT "+feedColumns+" FROM calendar_feeds ORDER BY id")
+	} else {
+		rows, err = db.QueryContext(ctx, "SELECT "+feedColumns+" FROM calendar_feeds WHERE user_id=$1 ORDER BY id", p.User.ID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		feed, err := scanFeed(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, rows.Err()
+}
+
+// GetCalendarFeedByToken finds the feed a token belongs to
+func GetCalendarFeedByToken(ctx context.Context, cfg Config, token string) (model.CalendarFeed, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return model.CalendarFeed{}, err
+	}
+
+	feed, err := scanFeed(db.QueryRowContext(ctx, "SELECT "+feedColumns+" FROM calendar_feeds WHERE token_hash=$1", hashToken(token)))
+
+	if err == sql.ErrNoRows {
+		return feed, ErrNotFound
+	}
+
+	return feed, err
+}
+
+// AddCalendarFeed creates a feed of the tasks the user of ctx can see, of
+// a list it can see when the feed has one
+func AddCalendarFeed(ctx context.Context, cfg Config, feed model.CalendarFeed) (model.CalendarFeed, error) {
+	user := access.From(ctx).User
+
+	// the feeds show the tasks of a user, anonymous clients have none
+	if user == nil {
+		return feed, access.ErrForbidden
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return feed, err
+	}
+
+	if feed.ListID != 0 {
+		_, err = checkList(ctx, db, feed.ListID, model.RoleViewer)
+
+		if err != nil {
+			return feed, err
+		}
+	}
+
+	feed.UserID = user.ID
+
+	err = db.QueryRowContext(ctx, "INSERT INTO calendar_feeds (name, token_hash, list_id, user_id) VALUES($1, $2, NULLIF($3, 0), $4) returning id",
+		feed.Name, hashToken(feed.Token), feed.ListID, feed.UserID).Scan(&feed.ID)
+
+	return feed, err
+}
+
+// DeleteCalendarFeed revokes a calendar feed of the user of ctx, or of any
+// user for the admins
+func DeleteCalendarFeed(ctx context.Context, cfg Config, id int) error {
+	p := access.From(ctx)
+
+	if p.User == nil && !p.Admin() {
+		return access.ErrForbidden
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	var res sql.Result
+
+	if p.Admin() {
+		res, err = db.ExecContext(ctx, "DELETE FROM calendar_feeds WHERE id=$1", id)
+	} else {
+		res, err = db.ExecContext(ctx, "DELETE FROM calendar_feeds WHERE id=$1 AND user_id=$2", id, p.User.ID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	affect, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affect < 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+func TestCalendarFeedsNeedAUser(t *testing.T) {
+	ctx := context.Background()
+
+	// refused before reaching the database, anonymous clients have no feeds
+	_, err := GetCalendarFeeds(ctx, Config{})
+
+	if !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("anonymous client lists the feeds: %v, want %v", err, access.ErrForbidden)
+	}
+
+	_, err = AddCalendarFeed(ctx, Config{}, model.CalendarFeed{Name: "phone"})
+
+	if !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("anonymous client adds a feed: %v, want %v", err, access.ErrForbidden)
+	}
+
+	err = DeleteCalendarFeed(ctx, Config{}, 1)
+
+	if !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("anonymous client deletes a feed: %v, want %v", err, access.ErrForbidden)
+	}
+
+	// the system has no user to show the tasks of
+	_, err = AddCalendarFeed(access.AsSystem(ctx), Config{}, model.CalendarFeed{Name: "phone"})
+
+	if !errors.Is(err, access.ErrForbidden) {
+		t.Errorf("the system adds a feed: %v, want %v", err, access.ErrForbidden)
+	}
+}
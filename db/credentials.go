@@ -0,0 +1,78 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// passwords are the passwords set after the configuration was loaded, by
+// the connection info of the configuration
+var (
+	passwordsMu sync.RWMutex
+	passwords   = make(map[string]string)
+)
+
+// SetPassword changes the password of the database user of cfg, used by
+// the new connections of its pool and of the listeners started after it.
+// Open connections are kept, postgres does not close them when the
+// password changes
+func SetPassword(cfg Config, password string) {
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+
+	passwords[getDbInfo(cfg)] = password
+}
+
+// withPassword returns cfg with its current password
+func withPassword(cfg Config) Config {
+	passwordsMu.RLock()
+	defer passwordsMu.RUnlock()
+
+	if password, ok := passwords[getDbInfo(cfg)]; ok {
+		cfg.DbPassword = password
+	}
+
+	return cfg
+}
+
+// connector connects to the database of cfg with its current password
+type connector struct {
+	cfg Config
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	pc, err := pq.NewConnector(getDbInfo(withPassword(c.cfg)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pc.Connect(ctx)
+}
+
+func (c connector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
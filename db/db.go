@@ -21,13 +21,18 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/lib/pq"
 
 	_ "github.com/lib/pq"
+	"github.com/servian/TechChallengeApp/access"
 	"github.com/servian/TechChallengeApp/model"
 )
 
@@ -45,24 +50,58 @@ func getDbInfo(cfg Config) string {
 		cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbPassword, cfg.DbName)
 }
 
-// RebuildDb drops the database and recreates it
-func RebuildDb(cfg Config) error {
-	dbinfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=postgres sslmode=disable",
-		cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbPassword)
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[string]*sql.DB)
+)
 
-	db, err := sql.Open("postgres", dbinfo)
+// getDb returns the connection pool of the database, it is shared by every
+// call using the same configuration and is never closed
+func getDb(cfg Config) (*sql.DB, error) {
+	dbinfo := getDbInfo(cfg)
 
-	if err != nil {
-		return err
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	if db, ok := pools[dbinfo]; ok {
+		return db, nil
 	}
 
+	db := openDb(connector{cfg}, cfg.DbName)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	pools[dbinfo] = db
+
+	return db, nil
+}
+
+// SetPool makes the calls using the configuration run on pool instead of
+// connecting to postgres, the tests use it with a fake database
+func SetPool(cfg Config, pool *sql.DB) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	pools[getDbInfo(cfg)] = pool
+}
+
+// Pool returns the connection pool of the database, for instrumentation
+func Pool(cfg Config) (*sql.DB, error) {
+	return getDb(cfg)
+}
+
+// RebuildDb drops the database and recreates it
+func RebuildDb(ctx context.Context, cfg Config) error {
+	server := withPassword(cfg)
+	server.DbName = "postgres"
+
+	db := openDb(connector{server}, "postgres")
 	defer db.Close()
 
 	query := "DROP DATABASE IF EXISTS " + cfg.DbName
 
-	fmt.Println(query)
+	slog.Debug("Executing query", "sql", query)
 
-	_, err = db.Query(query)
+	_, err := db.QueryContext(ctx, query)
 
 	if err != nil {
 		return err
@@ -78,25 +117,21 @@ TABLESPACE = pg_default
 CONNECTION LIMIT = -1
 TEMPLATE template0;`, cfg.DbName, cfg.DbUser)
 
-	fmt.Println(query)
+	slog.Debug("Executing query", "sql", query)
 
-	_, err = db.Query(query)
+	_, err = db.QueryContext(ctx, query)
 
 	return err
 }
 
-func CreateTable(cfg Config) error {
-	dbinfo := getDbInfo(cfg)
-
-	db, err := sql.Open("postgres", dbinfo)
+func CreateTable(ctx context.Context, cfg Config) error {
+	db, err := getDb(cfg)
 
 	if err != nil {
 		return err
 	}
 
-	defer db.Close()
-
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 
 	if err != nil {
 		return err
@@ -104,25 +139,17 @@ func CreateTable(cfg Config) error {
 
 	defer tx.Rollback()
 
-	query := "DROP TABLE IF EXISTS tasks CASCADE"
+	query := "DROP TABLE IF EXISTS " + strings.Join(tables, ", ") + " CASCADE"
 
-	fmt.Println(query)
+	slog.Debug("Executing query", "sql", query)
 
-	_, err = tx.Exec(query)
+	_, err = tx.ExecContext(ctx, query)
 
 	if err != nil {
 		return err
 	}
 
-	query = "CREATE TABLE tasks ( id SERIAL PRIMARY KEY, completed boolean NOT NULL, priority integer NOT NULL, title text NOT NULL)"
-
-	fmt.Println(query)
-
-	_, err = tx.Exec(query)
-
-	if err != nil {
-		return err
-	}
+	err = migrate(ctx, tx)
 
 	if err != nil {
 		return err
@@ -133,19 +160,15 @@ func CreateTable(cfg Config) error {
 	return err
 }
 
-func SeedData(cfg Config) error {
+func SeedData(ctx context.Context, cfg Config) error {
 
-	dbinfo := getDbInfo(cfg)
-
-	db, err := sql.Open("postgres", dbinfo)
+	db, err := getDb(cfg)
 
 	if err != nil {
 		return err
 	}
 
-	defer db.Close()
-
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 
 	if err != nil {
 		return err
@@ -153,7 +176,8 @@ func SeedData(cfg Config) error {
 
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(pq.CopyIn("tasks", "completed", "priority", "title"))
+	// the seed tasks go to the first list
+	listID, err := taskList(access.AsSystem(ctx), tx, 0)
 
 	if err != nil {
 		return err
@@ -161,28 +185,68 @@ func SeedData(cfg Config) error {
 
 	tasks := getSeedTasks()
 
-	for _, task := range tasks {
-		_, err = stmt.Exec(task.Complete, task.Priority, task.Title)
-		if err != nil {
-			return err
-		}
+	for i := range tasks {
+		tasks[i].ListID = listID
 	}
 
-	_, err = stmt.Exec()
+	err = copyTasks(ctx, tx, tasks, false)
 
 	if err != nil {
 		return err
 	}
 
-	err = stmt.Close()
+	err = tx.Commit()
+
+	return err
+}
+
+// copyTasks bulk loads tasks using COPY, the ids of the tasks are kept
+// when keepID is set, otherwise new ids are assigned. The lists of the
+// tasks must be set, their completion times are set as they are stored
+func copyTasks(ctx context.Context, tx *sql.Tx, tasks []model.Task, keepID bool) error {
+	columns := []string{"completed", "priority", "title", "due", "completed_at", "list_id"}
+
+	if keepID {
+		columns = append(columns, "id")
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("tasks", columns...))
 
 	if err != nil {
 		return err
 	}
 
-	err = tx.Commit()
+	now := time.Now()
 
-	return err
+	for i := range tasks {
+		task := &tasks[i]
+
+		if !task.Complete {
+			task.CompletedAt = nil
+		} else if task.CompletedAt == nil {
+			task.CompletedAt = &now
+		}
+
+		values := []interface{}{task.Complete, task.Priority, task.Title, task.Due, task.CompletedAt, task.ListID}
+
+		if keepID {
+			values = append(values, task.ID)
+		}
+
+		_, err = stmt.ExecContext(ctx, values...)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return stmt.Close()
 }
 
 func getSeedTasks() []model.Task {
@@ -194,119 +258,245 @@ func getSeedTasks() []model.Task {
 	return tasks
 }
 
-// GetAllTasks lists all tasks in the database
-func GetAllTasks(cfg Config) ([]model.Task, error) {
+// taskColumns are the columns read by scanTask
+const taskColumns = "id, completed, priority, title, due, completed_at, list_id"
 
-	var tasks []model.Task
+func scanTask(row interface{ Scan(...interface{}) error }) (model.Task, error) {
+	task := model.Task{}
 
-	dbinfo := getDbInfo(cfg)
+	err := row.Scan(&task.ID, &task.Complete, &task.Priority, &task.Title, &task.Due, &task.CompletedAt, &task.ListID)
+
+	return task, err
+}
 
-	db, err := sql.Open("postgres", dbinfo)
+// GetAllTasks lists all tasks of the lists the principal of ctx can see
+func GetAllTasks(ctx context.Context, cfg Config) ([]model.Task, error) {
+
+	var tasks []model.Task
+
+	db, err := getDb(cfg)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer db.Close()
+	conditions, args, err := readable(ctx, db, nil, nil)
 
-	rows, err := db.Query("SELECT * FROM tasks")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks"+whereClause(conditions), args...)
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
-		task := model.Task{}
+		task, err := scanTask(rows)
 
-		rows.Scan(&task.ID, &task.Complete, &task.Priority, &task.Title)
+		if err != nil {
+			return nil, err
+		}
 
 		tasks = append(tasks, task)
 	}
 
-	return tasks, nil
+	return tasks, rows.Err()
 }
 
-func AddTask(cfg Config, task model.Task) (model.Task, error) {
-	dbinfo := getDbInfo(cfg)
+// CountTasks returns how many tasks the principal of ctx can see are still
+// open and how many are completed
+func CountTasks(ctx context.Context, cfg Config) (int, int, error) {
+	db, err := getDb(cfg)
 
-	db, err := sql.Open("postgres", dbinfo)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	conditions, args, err := readable(ctx, db, nil, nil)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var open, completed int
+
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FILTER (WHERE NOT completed), COUNT(*) FILTER (WHERE completed) FROM tasks"+whereClause(conditions), args...).Scan(&open, &completed)
+
+	return open, completed, err
+}
+
+// AddTask adds a task to its list, or to the first list the principal of
+// ctx can edit when it has none
+func AddTask(ctx context.Context, cfg Config, task model.Task) (model.Task, error) {
+	db, err := getDb(cfg)
 
 	if err != nil {
 		return task, err
 	}
 
-	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
 
-	err = db.QueryRow("INSERT INTO tasks (completed, priority, title) VALUES($1, $2, $3) returning id",
-		task.Complete, task.Priority, task.Title).Scan(&task.ID)
+	if err != nil {
+		return task, err
+	}
+
+	defer tx.Rollback()
+
+	task.ListID, err = taskList(ctx, tx, task.ListID)
 
 	if err != nil {
 		return task, err
 	}
 
-	return task, nil
-}
+	err = tx.QueryRowContext(ctx, `INSERT INTO tasks (completed, priority, title, due, completed_at, list_id)
+VALUES($1, $2, $3, $4, CASE WHEN $1 THEN now() END, $5) returning id, completed_at`,
+		task.Complete, task.Priority, task.Title, task.Due, task.ListID).Scan(&task.ID, &task.CompletedAt)
 
-func DeleteTask(cfg Config, task model.Task) error {
-	dbInfo := getDbInfo(cfg)
+	if err != nil {
+		return task, err
+	}
 
-	db, err := sql.Open("postgres", dbInfo)
+	err = queueDeliveries(ctx, tx, model.EventTaskCreated, []model.Task{task})
 
 	if err != nil {
-		return err
+		return task, err
 	}
 
-	defer db.Close()
+	return task, tx.Commit()
+}
 
-	stmt, err := db.Prepare("DELETE FROM tasks WHERE id=$1")
+// DeleteTask deletes a task the principal of ctx can edit, and returns it
+func DeleteTask(ctx context.Context, cfg Config, task model.Task) (model.Task, error) {
+	db, err := getDb(cfg)
 
 	if err != nil {
-		return err
+		return task, err
 	}
 
-	res, err := stmt.Exec(task.ID)
+	tx, err := db.BeginTx(ctx, nil)
 
 	if err != nil {
-		return err
+		return task, err
 	}
 
-	affect, err := res.RowsAffected()
+	defer tx.Rollback()
+
+	_, err = editableTask(ctx, tx, task.ID)
 
 	if err != nil {
-		return err
+		return task, err
 	}
 
-	if affect < 1 {
-		return errors.New("Nothing was deleted")
+	task, err = scanTask(tx.QueryRowContext(ctx, "DELETE FROM tasks WHERE id=$1 RETURNING "+taskColumns, task.ID))
+
+	if err != nil {
+		return task, err
 	}
 
-	return nil
+	err = queueDeliveries(ctx, tx, model.EventTaskDeleted, []model.Task{task})
+
+	if err != nil {
+		return task, err
+	}
 
+	return task, tx.Commit()
 }
 
-func UpdateTask(cfg Config, task model.Task) (model.Task, error) {
+// UpdateTask updates a task the principal of ctx can edit, it stays in its
+// list unless the list of task is set, to another list it can edit
+func UpdateTask(ctx context.Context, cfg Config, task model.Task) (model.Task, error) {
 
-	dbInfo := getDbInfo(cfg)
+	db, err := getDb(cfg)
 
-	db, err := sql.Open("postgres", dbInfo)
+	if err != nil {
+		return task, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
 
 	if err != nil {
 		return task, err
 	}
 
-	defer db.Close()
+	defer tx.Rollback()
+
+	listID, err := editableTask(ctx, tx, task.ID)
+
+	if err != nil {
+		return task, err
+	}
+
+	if task.ListID != 0 && task.ListID != listID {
+		_, err = checkList(ctx, tx, task.ListID, model.RoleEditor)
+
+		if err != nil {
+			return task, err
+		}
 
-	stmt, err := db.Prepare("UPDATE tasks SET completed=$1, priority=$2, title=$3 WHERE id=$4")
+		listID = task.ListID
+	}
+
+	// completed_at is kept while the task stays complete
+	task, err = scanTask(tx.QueryRowContext(ctx, `UPDATE tasks
+SET completed=$1, priority=$2, title=$3, due=$4, completed_at=CASE WHEN $1 THEN COALESCE(completed_at, now()) END, list_id=$5
+WHERE id=$6 RETURNING `+taskColumns,
+		task.Complete, task.Priority, task.Title, task.Due, listID, task.ID))
 
 	if err != nil {
 		return task, err
 	}
 
-	_, err = stmt.Exec(task.Complete, task.Priority, task.Title, task.ID)
+	err = queueDeliveries(ctx, tx, model.EventTaskUpdated, []model.Task{task})
 
 	if err != nil {
-		return task, nil
+		return task, err
+	}
+
+	return task, tx.Commit()
+}
+
+// editableTask locks a task until the end of the transaction, and returns
+// its list. It fails with ErrNotFound when the task does not exist or the
+// principal of ctx can not see it, access.ErrForbidden when it can not
+// edit it
+func editableTask(ctx context.Context, tx *sql.Tx, id int) (int, error) {
+	var listID int
+
+	err := tx.QueryRowContext(ctx, "SELECT list_id FROM tasks WHERE id=$1 FOR UPDATE", id).Scan(&listID)
+
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = checkList(ctx, tx, listID, model.RoleEditor)
+
+	return listID, err
+}
+
+// whereClause joins the conditions of a query, it is empty without any
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// Ping checks a connection to the database can be used
+func Ping(ctx context.Context, cfg Config) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
 	}
 
-	return task, nil
+	return db.PingContext(ctx)
 }
@@ -0,0 +1,1177 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package dbtest is a fake postgres database for the tests of the packages
+// calling the db package. It keeps its tables in memory and answers the
+// queries the db package sends, the way postgres would, without a server.
+// A query it does not know fails the test with its text.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// member is a row of list_members
+type member struct {
+	id     int
+	listID int
+	userID int
+	group  string
+	role   string
+}
+
+// tables are the rows of the database
+type tables struct {
+	lists      []model.List
+	members    []member
+	users      []model.User
+	tasks      []model.Task
+	webhooks   []model.Webhook
+	deliveries []model.WebhookDelivery
+	seq        map[string]int
+
+	// schema is the last migration applied, 0 when schema_migrations does
+	// not exist
+	schema int
+}
+
+// clone copies the rows, for the transactions to roll back to
+func (t *tables) clone() *tables {
+	c := &tables{
+		lists:      append([]model.List(nil), t.lists...),
+		members:    append([]member(nil), t.members...),
+		users:      append([]model.User(nil), t.users...),
+		tasks:      append([]model.Task(nil), t.tasks...),
+		webhooks:   append([]model.Webhook(nil), t.webhooks...),
+		deliveries: append([]model.WebhookDelivery(nil), t.deliveries...),
+		seq:        make(map[string]int),
+		schema:     t.schema,
+	}
+
+	for k, v := range t.seq {
+		c.seq[k] = v
+	}
+
+	return c
+}
+
+// next returns the next id of a table
+func (t *tables) next(table string) int {
+	t.seq[table]++
+	return t.seq[table]
+}
+
+// DB is a fake database, every connection opened on it shares its tables.
+// Transactions are serialized, a transaction rolled back restores the
+// tables as they were when it began.
+type DB struct {
+	mu   sync.Mutex
+	t    *tables
+	fail []*regexp.Regexp
+
+	// txMu is held by the transaction in progress
+	txMu sync.Mutex
+}
+
+// New creates an empty database
+func New() *DB {
+	return &DB{t: &tables{seq: make(map[string]int)}}
+}
+
+// NewWithLists creates the database of the access tests. Its users are
+// vera (1), a viewer, ed (2), an editor of the groups staff and leads, ada
+// (3), an admin, and nina (4), a viewer. Its lists are an open list (1), a
+// list shared with vera as an editor and the group staff as viewers (2),
+// and a list shared with nina and the group leads as admins (3). Each list
+// has a task with the id of the list.
+func NewWithLists() *DB {
+	d := New()
+
+	d.AddUser(model.User{Name: "vera", Role: model.RoleViewer})
+	d.AddUser(model.User{Name: "ed", Role: model.RoleEditor, Groups: []string{"staff", "leads"}})
+	d.AddUser(model.User{Name: "ada", Role: model.RoleAdmin})
+	nina := d.AddUser(model.User{Name: "nina", Role: model.RoleViewer})
+
+	open := d.AddList("Open")
+	shared := d.AddList("Shared")
+	private := d.AddList("Private")
+
+	d.AddMember(shared, 1, "", model.RoleEditor)
+	d.AddMember(shared, 0, "staff", model.RoleViewer)
+	d.AddMember(private, nina.ID, "", model.RoleAdmin)
+	d.AddMember(private, 0, "leads", model.RoleAdmin)
+
+	for _, id := range []int{open, shared, private} {
+		d.AddTask(model.Task{ID: id, Title: "Task", ListID: id})
+	}
+
+	return d
+}
+
+// Open returns a connection pool to the database
+func (d *DB) Open() *sql.DB {
+	return sql.OpenDB(d.Connector())
+}
+
+// Connector connects to the database, for the pools opened with other
+// options
+func (d *DB) Connector() driver.Connector {
+	return connector{d}
+}
+
+// FailOn makes the queries matching the pattern fail, as if the database
+// refused them
+func (d *DB) FailOn(pattern string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.fail = append(d.fail, regexp.MustCompile(pattern))
+}
+
+// SetSchemaVersion sets the version of the last migration applied to the
+// database
+func (d *DB) SetSchemaVersion(version int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.t.schema = version
+}
+
+// AddUser adds a user and returns it with its id
+func (d *DB) AddUser(user model.User) model.User {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user.ID = d.t.next("users")
+
+	if user.Groups == nil {
+		user.Groups = []string{}
+	}
+
+	d.t.users = append(d.t.users, user)
+
+	return user
+}
+
+// AddList adds a list without members and returns its id
+func (d *DB) AddList(name string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := d.t.next("lists")
+	d.t.lists = append(d.t.lists, model.List{ID: id, Name: name})
+
+	return id
+}
+
+// AddMember shares a list with a user, by id, or a group
+func (d *DB) AddMember(listID int, userID int, group string, role string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.t.members = append(d.t.members, member{id: d.t.next("list_members"), listID: listID, userID: userID, group: group, role: role})
+}
+
+// AddTask adds a task, with a new id unless it has one
+func (d *DB) AddTask(task model.Task) model.Task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if task.ID == 0 {
+		task.ID = d.t.next("tasks")
+	} else if task.ID > d.t.seq["tasks"] {
+		d.t.seq["tasks"] = task.ID
+	}
+
+	d.t.tasks = append(d.t.tasks, task)
+
+	return task
+}
+
+// AddWebhook adds a webhook and returns it with its id
+func (d *DB) AddWebhook(hook model.Webhook) model.Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hook.ID = d.t.next("webhooks")
+
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+
+	d.t.webhooks = append(d.t.webhooks, hook)
+
+	return hook
+}
+
+// Tasks returns the tasks, by id
+func (d *DB) Tasks() []model.Task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tasks := append([]model.Task(nil), d.t.tasks...)
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	return tasks
+}
+
+// Task returns a task by id
+func (d *DB) Task(id int) (model.Task, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, task := range d.t.tasks {
+		if task.ID == id {
+			return task, true
+		}
+	}
+
+	return model.Task{}, false
+}
+
+// Lists returns the ids and names of the lists, by id
+func (d *DB) Lists() []model.List {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]model.List(nil), d.t.lists...)
+}
+
+// Members returns how many members a list has
+func (d *DB) Members(listID int) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	count := 0
+
+	for _, m := range d.t.members {
+		if m.listID == listID {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Deliveries returns the webhook deliveries, by id
+func (d *DB) Deliveries() []model.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]model.WebhookDelivery(nil), d.t.deliveries...)
+}
+
+// query is a query the database answers, the submatches of its pattern are
+// given to run along with the arguments
+type query struct {
+	pattern *regexp.Regexp
+	run     func(t *tables, m []string, args []driver.Value) (*result, error)
+}
+
+// result is the answer to a query, the rows it returns or how many it changed
+type result struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+func (r *result) LastInsertId() (int64, error) {
+	return 0, errors.New("not supported")
+}
+
+func (r *result) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+func (r *result) Columns() []string {
+	return r.columns
+}
+
+func (r *result) Close() error {
+	return nil
+}
+
+func (r *result) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+// rows is the result of a query returning rows, one column per value
+func rows(values ...[]driver.Value) *result {
+	r := &result{rows: values, affected: int64(len(values))}
+
+	if len(values) > 0 {
+		r.columns = make([]string, len(values[0]))
+	}
+
+	for i := range r.columns {
+		r.columns[i] = "c" + strconv.Itoa(i)
+	}
+
+	return r
+}
+
+// columns is a result without rows returning n columns
+func columns(n int) *result {
+	r := &result{columns: make([]string, n)}
+
+	for i := range r.columns {
+		r.columns[i] = "c" + strconv.Itoa(i)
+	}
+
+	return r
+}
+
+const taskColumns = `id, completed, priority, title, due, completed_at, list_id`
+
+func taskRow(task model.Task) []driver.Value {
+	return []driver.Value{int64(task.ID), task.Complete, int64(task.Priority), task.Title, timeValue(task.Due), timeValue(task.CompletedAt), int64(task.ListID)}
+}
+
+func timeValue(t *time.Time) driver.Value {
+	if t == nil {
+		return nil
+	}
+
+	return *t
+}
+
+func timeArg(v driver.Value) *time.Time {
+	t, ok := v.(time.Time)
+
+	if !ok {
+		return nil
+	}
+
+	return &t
+}
+
+func intArg(v driver.Value) int {
+	switch v := v.(type) {
+	case int64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+
+	return 0
+}
+
+// arrayArg reads an array sent with pq.Array, NULL is an empty array
+func arrayArg(v driver.Value) []string {
+	s, ok := v.(string)
+
+	if !ok {
+		if b, isBytes := v.([]byte); isBytes {
+			s = string(b)
+		}
+	}
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+
+	if s == "" {
+		return nil
+	}
+
+	var values []string
+	var value strings.Builder
+	quoted := false
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted && i+1 < len(s):
+			i++
+			value.WriteByte(s[i])
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			values = append(values, value.String())
+			value.Reset()
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return append(values, value.String())
+}
+
+func intsArg(v driver.Value) map[int]bool {
+	ids := make(map[int]bool)
+
+	for _, s := range arrayArg(v) {
+		id, _ := strconv.Atoi(s)
+		ids[id] = true
+	}
+
+	return ids
+}
+
+func arrayValue(values []string) string {
+	quoted := make([]string, len(values))
+
+	for i, v := range values {
+		quoted[i] = `"` + v + `"`
+	}
+
+	return "{" + strings.Join(quoted, ",") + "}"
+}
+
+// param is the argument of a $n placeholder
+func param(args []driver.Value, n string) driver.Value {
+	i, _ := strconv.Atoi(n)
+	return args[i-1]
+}
+
+var (
+	condListIn  = regexp.MustCompile(`^list_id = ANY\(\$(\d+)\)$`)
+	condIDIn    = regexp.MustCompile(`^id = ANY\(\$(\d+)\)$`)
+	condList    = regexp.MustCompile(`^list_id = \$(\d+)$`)
+	condDone    = regexp.MustCompile(`^completed = \$(\d+)$`)
+	condAfter   = regexp.MustCompile(`^id > \$(\d+)$`)
+	condDueLess = regexp.MustCompile(`^due < \$(\d+)$`)
+	condDueMore = regexp.MustCompile(`^due > \$(\d+)$`)
+	condSearch  = regexp.MustCompile(`^title ILIKE '%' \|\| \$(\d+) \|\| '%'$`)
+	unescape    = strings.NewReplacer(`\\`, `\`, `\%`, `%`, `\_`, `_`)
+)
+
+// matchTasks returns the tasks matching the conditions of a WHERE clause
+func matchTasks(t *tables, where string, args []driver.Value) ([]model.Task, error) {
+	var conditions []string
+
+	if where != "" {
+		conditions = strings.Split(where, " AND ")
+	}
+
+	var tasks []model.Task
+
+	for _, task := range t.tasks {
+		ok := true
+
+		for _, c := range conditions {
+			match, err := matchTask(task, c, args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ok = ok && match
+		}
+
+		if ok {
+			tasks = append(tasks, task)
+		}
+	}
+
+	return tasks, nil
+}
+
+func matchTask(task model.Task, c string, args []driver.Value) (bool, error) {
+	if m := condListIn.FindStringSubmatch(c); m != nil {
+		return intsArg(param(args, m[1]))[task.ListID], nil
+	}
+
+	if m := condIDIn.FindStringSubmatch(c); m != nil {
+		return intsArg(param(args, m[1]))[task.ID], nil
+	}
+
+	if m := condList.FindStringSubmatch(c); m != nil {
+		return task.ListID == intArg(param(args, m[1])), nil
+	}
+
+	if m := condDone.FindStringSubmatch(c); m != nil {
+		return task.Complete == param(args, m[1]).(bool), nil
+	}
+
+	if m := condAfter.FindStringSubmatch(c); m != nil {
+		return task.ID > intArg(param(args, m[1])), nil
+	}
+
+	if m := condDueLess.FindStringSubmatch(c); m != nil {
+		return task.Due != nil && task.Due.Before(param(args, m[1]).(time.Time)), nil
+	}
+
+	if m := condDueMore.FindStringSubmatch(c); m != nil {
+		return task.Due != nil && task.Due.After(param(args, m[1]).(time.Time)), nil
+	}
+
+	if m := condSearch.FindStringSubmatch(c); m != nil {
+		search := unescape.Replace(param(args, m[1]).(string))
+		return strings.Contains(strings.ToLower(task.Title), strings.ToLower(search)), nil
+	}
+
+	return false, fmt.Errorf("dbtest: unknown condition: %s", c)
+}
+
+func (t *tables) taskIndex(id int) int {
+	for i, task := range t.tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (t *tables) listExists(id int) bool {
+	for _, list := range t.lists {
+		if list.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queries are the queries of the db package the database answers
+var queries = []query{
+	// listRoles
+	{regexp.MustCompile(`^SELECT l\.id, l\.name, COUNT\(m\.id\) > 0, COALESCE\(array_agg\(m\.role\) FILTER \(WHERE m\.user_id = \$1 OR m\.group_name = ANY\(\$2\)\), '\{\}'\) FROM lists l LEFT JOIN list_members m ON m\.list_id = l\.id GROUP BY l\.id ORDER BY l\.id$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			user := intArg(args[0])
+			groups := make(map[string]bool)
+
+			for _, g := range arrayArg(args[1]) {
+				groups[g] = true
+			}
+
+			r := columns(4)
+
+			for _, list := range t.lists {
+				shared := false
+				var roles []string
+
+				for _, m := range t.members {
+					if m.listID != list.ID {
+						continue
+					}
+
+					shared = true
+
+					if (m.userID != 0 && m.userID == user) || (m.group != "" && groups[m.group]) {
+						roles = append(roles, m.role)
+					}
+				}
+
+				r.rows = append(r.rows, []driver.Value{int64(list.ID), list.Name, shared, "{" + strings.Join(roles, ",") + "}"})
+			}
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^SELECT ` + taskColumns + ` FROM tasks(?: WHERE (.+?))?(?: ORDER BY (priority, id|id))?(?: LIMIT \$(\d+))?$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			tasks, err := matchTasks(t, m[1], args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			sort.SliceStable(tasks, func(i, j int) bool {
+				if m[2] == "priority, id" && tasks[i].Priority != tasks[j].Priority {
+					return tasks[i].Priority < tasks[j].Priority
+				}
+
+				return tasks[i].ID < tasks[j].ID
+			})
+
+			if m[3] != "" {
+				if limit := intArg(param(args, m[3])); len(tasks) > limit {
+					tasks = tasks[:limit]
+				}
+			}
+
+			r := columns(7)
+
+			for _, task := range tasks {
+				r.rows = append(r.rows, taskRow(task))
+			}
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^SELECT COUNT\(\*\) FROM tasks(?: WHERE (.+))?$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			tasks, err := matchTasks(t, m[1], args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return rows([]driver.Value{int64(len(tasks))}), nil
+		}},
+
+	{regexp.MustCompile(`^SELECT COUNT\(\*\) FILTER \(WHERE NOT completed\), COUNT\(\*\) FILTER \(WHERE completed\) FROM tasks(?: WHERE (.+))?$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			tasks, err := matchTasks(t, m[1], args)
+
+			if err != nil {
+				return nil, err
+			}
+
+			var open, done int64
+
+			for _, task := range tasks {
+				if task.Complete {
+					done++
+				} else {
+					open++
+				}
+			}
+
+			return rows([]driver.Value{open, done}), nil
+		}},
+
+	{regexp.MustCompile(`^SELECT id, list_id FROM tasks WHERE id = ANY\(\$1\)$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			ids := intsArg(args[0])
+			r := columns(2)
+
+			for _, task := range t.tasks {
+				if ids[task.ID] {
+					r.rows = append(r.rows, []driver.Value{int64(task.ID), int64(task.ListID)})
+				}
+			}
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^SELECT list_id FROM tasks WHERE id=\$1 FOR UPDATE$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			i := t.taskIndex(intArg(args[0]))
+
+			if i < 0 {
+				return columns(1), nil
+			}
+
+			return rows([]driver.Value{int64(t.tasks[i].ListID)}), nil
+		}},
+
+	{regexp.MustCompile(`^INSERT INTO tasks \(completed, priority, title, due, completed_at, list_id\) VALUES\(\$1, \$2, \$3, \$4, CASE WHEN \$1 THEN now\(\) END, \$5\) returning id, completed_at$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			task := model.Task{Complete: args[0].(bool), Priority: intArg(args[1]), Title: args[2].(string), Due: timeArg(args[3]), ListID: intArg(args[4])}
+
+			if !t.listExists(task.ListID) {
+				return nil, errors.New("dbtest: insert or update on table \"tasks\" violates foreign key constraint")
+			}
+
+			if task.Complete {
+				now := time.Now()
+				task.CompletedAt = &now
+			}
+
+			task.ID = t.next("tasks")
+			t.tasks = append(t.tasks, task)
+
+			return rows([]driver.Value{int64(task.ID), timeValue(task.CompletedAt)}), nil
+		}},
+
+	{regexp.MustCompile(`^UPDATE tasks SET completed=\$1, priority=\$2, title=\$3, due=\$4, completed_at=CASE WHEN \$1 THEN COALESCE\((\$5, )?completed_at, now\(\)\) END, list_id=\$(\d) WHERE id=\$(\d)( RETURNING ` + taskColumns + `)?$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			i := t.taskIndex(intArg(param(args, m[3])))
+
+			if i < 0 {
+				return columns(7), nil
+			}
+
+			task := &t.tasks[i]
+			task.Complete = args[0].(bool)
+			task.Priority = intArg(args[1])
+			task.Title = args[2].(string)
+			task.Due = timeArg(args[3])
+			task.ListID = intArg(param(args, m[2]))
+
+			switch {
+			case !task.Complete:
+				task.CompletedAt = nil
+			case m[1] != "" && args[4] != nil:
+				task.CompletedAt = timeArg(args[4])
+			case task.CompletedAt == nil:
+				now := time.Now()
+				task.CompletedAt = &now
+			}
+
+			if m[4] == "" {
+				return &result{affected: 1}, nil
+			}
+
+			return rows(taskRow(*task)), nil
+		}},
+
+	{regexp.MustCompile(`^DELETE FROM tasks WHERE id=\$1 RETURNING ` + taskColumns + `$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			i := t.taskIndex(intArg(args[0]))
+
+			if i < 0 {
+				return columns(7), nil
+			}
+
+			task := t.tasks[i]
+			t.tasks = append(t.tasks[:i], t.tasks[i+1:]...)
+
+			return rows(taskRow(task)), nil
+		}},
+
+	{regexp.MustCompile(`^SELECT nextval\('tasks_id_seq'\) FROM generate_series\(1, \$1\)$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			var ids [][]driver.Value
+
+			for i := 0; i < intArg(args[0]); i++ {
+				ids = append(ids, []driver.Value{int64(t.next("tasks"))})
+			}
+
+			if len(ids) == 0 {
+				return columns(1), nil
+			}
+
+			return rows(ids...), nil
+		}},
+
+	{regexp.MustCompile(`^SELECT setval\('tasks_id_seq', .*\)$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			for _, task := range t.tasks {
+				if task.ID > t.seq["tasks"] {
+					t.seq["tasks"] = task.ID
+				}
+			}
+
+			return rows([]driver.Value{int64(t.seq["tasks"])}), nil
+		}},
+
+	{regexp.MustCompile(`^INSERT INTO lists \(name\) VALUES\(\$1\) returning id$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			list := model.List{ID: t.next("lists"), Name: args[0].(string)}
+			t.lists = append(t.lists, list)
+
+			return rows([]driver.Value{int64(list.ID)}), nil
+		}},
+
+	{regexp.MustCompile(`^UPDATE lists SET name=\$1 WHERE id=\$2$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			r := &result{}
+
+			for i := range t.lists {
+				if t.lists[i].ID == intArg(args[1]) {
+					t.lists[i].Name = args[0].(string)
+					r.affected++
+				}
+			}
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^DELETE FROM lists WHERE id=\$1$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			id := intArg(args[0])
+			r := &result{}
+
+			var lists []model.List
+
+			for _, list := range t.lists {
+				if list.ID == id {
+					r.affected++
+					continue
+				}
+
+				lists = append(lists, list)
+			}
+
+			var tasks []model.Task
+
+			for _, task := range t.tasks {
+				if task.ListID != id {
+					tasks = append(tasks, task)
+				}
+			}
+
+			var members []member
+
+			for _, m := range t.members {
+				if m.listID != id {
+					members = append(members, m)
+				}
+			}
+
+			t.lists, t.tasks, t.members = lists, tasks, members
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^SELECT m\.id, m\.list_id, COALESCE\(u\.name, ''\), COALESCE\(m\.group_name, ''\), m\.role FROM list_members m LEFT JOIN users u ON u\.id = m\.user_id WHERE m\.list_id=\$1 ORDER BY m\.id$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			r := columns(5)
+
+			for _, m := range t.members {
+				if m.listID != intArg(args[0]) {
+					continue
+				}
+
+				name := ""
+
+				for _, u := range t.users {
+					if u.ID == m.userID {
+						name = u.Name
+					}
+				}
+
+				r.rows = append(r.rows, []driver.Value{int64(m.id), int64(m.listID), name, m.group, m.role})
+			}
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^INSERT INTO list_members \(list_id, user_id, role\) SELECT \$1::integer, id, \$3::text FROM users WHERE name=\$2 ON CONFLICT \(list_id, user_id\) DO UPDATE SET role=EXCLUDED\.role RETURNING id$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			for _, u := range t.users {
+				if u.Name == args[1].(string) {
+					return rows([]driver.Value{int64(t.upsertMember(intArg(args[0]), u.ID, "", args[2].(string)))}), nil
+				}
+			}
+
+			return columns(1), nil
+		}},
+
+	{regexp.MustCompile(`^INSERT INTO list_members \(list_id, group_name, role\) VALUES\(\$1, \$2, \$3\) ON CONFLICT \(list_id, group_name\) DO UPDATE SET role=EXCLUDED\.role RETURNING id$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			return rows([]driver.Value{int64(t.upsertMember(intArg(args[0]), 0, args[1].(string), args[2].(string)))}), nil
+		}},
+
+	{regexp.MustCompile(`^DELETE FROM list_members WHERE list_id=\$1 AND id=\$2$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			r := &result{}
+			var members []member
+
+			for _, m := range t.members {
+				if m.listID == intArg(args[0]) && m.id == intArg(args[1]) {
+					r.affected++
+					continue
+				}
+
+				members = append(members, m)
+			}
+
+			t.members = members
+
+			return r, nil
+		}},
+
+	{regexp.MustCompile(`^SELECT id, name, role, groups FROM users WHERE id=\$1$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			for _, u := range t.users {
+				if u.ID == intArg(args[0]) {
+					return rows([]driver.Value{int64(u.ID), u.Name, u.Role, arrayValue(u.Groups)}), nil
+				}
+			}
+
+			return columns(4), nil
+		}},
+
+	// SchemaVersion
+	{regexp.MustCompile(`^SELECT to_regclass\('schema_migrations'\) IS NOT NULL$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			return rows([]driver.Value{t.schema > 0}), nil
+		}},
+
+	{regexp.MustCompile(`^SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			return rows([]driver.Value{int64(t.schema)}), nil
+		}},
+
+	{regexp.MustCompile(`^INSERT INTO webhook_deliveries \(webhook_id, event, payload\) SELECT w\.id, \$1, p\.payload FROM unnest\(\$2::text\[\]\) WITH ORDINALITY AS p\(payload, n\) CROSS JOIN webhooks w WHERE w\.active AND \(cardinality\(w\.events\) = 0 OR \$1 = ANY\(w\.events\)\) ORDER BY p\.n, w\.id$`),
+		func(t *tables, m []string, args []driver.Value) (*result, error) {
+			r := &result{}
+			now := time.Now()
+
+			for _, payload := range arrayArg(args[1]) {
+				for _, hook := range t.webhooks {
+					if !hook.Active || !interested(hook, args[0].(string)) {
+						continue
+					}
+
+					t.deliveries = append(t.deliveries, model.WebhookDelivery{
+						ID:            int64(t.next("webhook_deliveries")),
+						WebhookID:     hook.ID,
+						Event:         args[0].(string),
+						Payload:       payload,
+						Status:        model.DeliveryPending,
+						NextAttemptAt: now,
+						CreatedAt:     now,
+						UpdatedAt:     now,
+					})
+
+					r.affected++
+				}
+			}
+
+			return r, nil
+		}},
+}
+
+func interested(hook model.Webhook, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// upsertMember adds a member, or changes the role of the user or group on
+// the list, and returns the id of the membership
+func (t *tables) upsertMember(listID int, userID int, group string, role string) int {
+	for i, m := range t.members {
+		if m.listID == listID && ((userID != 0 && m.userID == userID) || (group != "" && m.group == group)) {
+			t.members[i].role = role
+			return m.id
+		}
+	}
+
+	m := member{id: t.next("list_members"), listID: listID, userID: userID, group: group, role: role}
+	t.members = append(t.members, m)
+
+	return m.id
+}
+
+// run answers a query
+func (d *DB) run(text string, named []driver.NamedValue) (*result, error) {
+	text = strings.Join(strings.Fields(text), " ")
+
+	args := make([]driver.Value, len(named))
+
+	for i, v := range named {
+		args[i] = v.Value
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, f := range d.fail {
+		if f.MatchString(text) {
+			return nil, fmt.Errorf("dbtest: refused: %s", text)
+		}
+	}
+
+	for _, q := range queries {
+		if m := q.pattern.FindStringSubmatch(text); m != nil {
+			return q.run(d.t, m, args)
+		}
+	}
+
+	return nil, fmt.Errorf("dbtest: unknown query: %s", text)
+}
+
+type connector struct {
+	d *DB
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{d: c.d}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("dbtest: open the database with DB.Open")
+}
+
+type conn struct {
+	d *DB
+
+	// snapshot are the tables when the transaction in progress began
+	snapshot *tables
+}
+
+func (c *conn) Prepare(text string) (driver.Stmt, error) {
+	if m := copyIn.FindStringSubmatch(text); m != nil {
+		return &copyStmt{d: c.d, columns: strings.Split(strings.ReplaceAll(m[1], `"`, ""), ", ")}, nil
+	}
+
+	return &stmt{c: c, text: text}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.txMu.Lock()
+
+	c.d.mu.Lock()
+	c.snapshot = c.d.t.clone()
+	c.d.mu.Unlock()
+
+	return c, nil
+}
+
+func (c *conn) Commit() error {
+	c.snapshot = nil
+	c.d.txMu.Unlock()
+
+	return nil
+}
+
+func (c *conn) Rollback() error {
+	c.d.mu.Lock()
+	c.d.t = c.snapshot
+	c.d.mu.Unlock()
+
+	c.snapshot = nil
+	c.d.txMu.Unlock()
+
+	return nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, text string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.d.run(text, args)
+}
+
+func (c *conn) ExecContext(ctx context.Context, text string, args []driver.NamedValue) (driver.Result, error) {
+	return c.d.run(text, args)
+}
+
+type stmt struct {
+	c    *conn
+	text string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.d.run(s.text, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.d.run(s.text, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	n := make([]driver.NamedValue, len(args))
+
+	for i, v := range args {
+		n[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+
+	return n
+}
+
+var copyIn = regexp.MustCompile(`^COPY "tasks" \((.*)\) FROM STDIN$`)
+
+// copyStmt is a COPY into tasks, each exec with values adds a row
+type copyStmt struct {
+	d       *DB
+	columns []string
+}
+
+func (s *copyStmt) Close() error {
+	return nil
+}
+
+func (s *copyStmt) NumInput() int {
+	return -1
+}
+
+func (s *copyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	// the exec without values ends the copy
+	if len(args) == 0 {
+		return &result{}, nil
+	}
+
+	task := model.Task{}
+
+	for i, column := range s.columns {
+		switch column {
+		case "id":
+			task.ID = intArg(args[i])
+		case "completed":
+			task.Complete = args[i].(bool)
+		case "priority":
+			task.Priority = intArg(args[i])
+		case "title":
+			task.Title = args[i].(string)
+		case "due":
+			task.Due = timeArg(args[i])
+		case "completed_at":
+			task.CompletedAt = timeArg(args[i])
+		case "list_id":
+			task.ListID = intArg(args[i])
+		default:
+			return nil, fmt.Errorf("dbtest: unknown column of tasks: %s", column)
+		}
+	}
+
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if task.ID == 0 {
+		task.ID = s.d.t.next("tasks")
+	} else if s.d.t.taskIndex(task.ID) >= 0 {
+		return nil, fmt.Errorf("dbtest: duplicate key value violates unique constraint \"tasks_pkey\": %d", task.ID)
+	}
+
+	if !s.d.t.listExists(task.ListID) {
+		return nil, errors.New("dbtest: insert or update on table \"tasks\" violates foreign key constraint")
+	}
+
+	s.d.t.tasks = append(s.d.t.tasks, task)
+
+	return &result{affected: 1}, nil
+}
+
+func (s *copyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("dbtest: COPY returns no rows")
+}
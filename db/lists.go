@@ -0,0 +1,230 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// ErrUnknownUser is returned when adding a member whose user does not exist
+var ErrUnknownUser = errors.New("The user does not exist")
+
+// GetLists lists, by id, the lists the principal of ctx can see with its
+// role on each of them
+func GetLists(ctx context.Context, cfg Config) ([]model.List, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return listRoles(ctx, db)
+}
+
+// GetList returns a list the principal of ctx can see, with its role on
+// it, ErrNotFound for the other lists
+func GetList(ctx context.Context, cfg Config, id int) (model.List, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return model.List{}, err
+	}
+
+	return checkList(ctx, db, id, model.RoleViewer)
+}
+
+// AddList creates a list without members, only the admins can
+func AddList(ctx context.Context, cfg Config, list model.List) (model.List, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return list, err
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return list, err
+	}
+
+	err = db.QueryRowContext(ctx, "INSERT INTO lists (name) VALUES($1) returning id", list.Name).Scan(&list.ID)
+
+	list.Shared = false
+	list.Role = model.RoleAdmin
+
+	return list, err
+}
+
+// UpdateList renames a list the principal of ctx is an admin of
+func UpdateList(ctx context.Context, cfg Config, list model.List) (model.List, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return list, err
+	}
+
+	found, err := checkList(ctx, db, list.ID, model.RoleAdmin)
+
+	if err != nil {
+		return list, err
+	}
+
+	found.Name = list.Name
+
+	_, err = db.ExecContext(ctx, "UPDATE lists SET name=$1 WHERE id=$2", found.Name, found.ID)
+
+	return found, err
+}
+
+// DeleteList deletes a list the principal of ctx is an admin of, along
+// with its tasks and members
+func DeleteList(ctx context.Context, cfg Config, id int) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = checkList(ctx, db, id, model.RoleAdmin)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM lists WHERE id=$1", id)
+
+	return err
+}
+
+// GetMembers lists the members of a list the principal of ctx is an admin
+// of, in the order they were added
+func GetMembers(ctx context.Context, cfg Config, listID int) ([]model.Member, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = checkList(ctx, db, listID, model.RoleAdmin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT m.id, m.list_id, COALESCE(u.name, ''), COALESCE(m.group_name, ''), m.role
+FROM list_members m LEFT JOIN users u ON u.id = m.user_id
+WHERE m.list_id=$1 ORDER BY m.id`, listID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var members []model.Member
+
+	for rows.Next() {
+		member := model.Member{}
+
+		err = rows.Scan(&member.ID, &member.ListID, &member.User, &member.Group, &member.Role)
+
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember shares a list the principal of ctx is an admin of with a user,
+// by name, or with a group. Sharing it again with the same user or group
+// changes their role. Once a list has a member, only its members see it
+func AddMember(ctx context.Context, cfg Config, member model.Member) (model.Member, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return member, err
+	}
+
+	_, err = checkList(ctx, db, member.ListID, model.RoleAdmin)
+
+	if err != nil {
+		return member, err
+	}
+
+	if member.User != "" {
+		err = db.QueryRowContext(ctx, `INSERT INTO list_members (list_id, user_id, role)
+SELECT $1::integer, id, $3::text FROM users WHERE name=$2
+ON CONFLICT (list_id, user_id) DO UPDATE SET role=EXCLUDED.role RETURNING id`,
+			member.ListID, member.User, member.Role).Scan(&member.ID)
+
+		if err == sql.ErrNoRows {
+			return member, ErrUnknownUser
+		}
+
+		return member, err
+	}
+
+	err = db.QueryRowContext(ctx, `INSERT INTO list_members (list_id, group_name, role) VALUES($1, $2, $3)
+ON CONFLICT (list_id, group_name) DO UPDATE SET role=EXCLUDED.role RETURNING id`,
+		member.ListID, member.Group, member.Role).Scan(&member.ID)
+
+	return member, err
+}
+
+// DeleteMember stops sharing a list the principal of ctx is an admin of
+// with one of its members
+func DeleteMember(ctx context.Context, cfg Config, listID int, id int) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = checkList(ctx, db, listID, model.RoleAdmin)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, "DELETE FROM list_members WHERE list_id=$1 AND id=$2", listID, id)
+
+	if err != nil {
+		return err
+	}
+
+	affect, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affect < 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migrations are applied in order, each of them only once. The version of
+// a migration is its position in the list, starting at 1. Never change or
+// reorder a released migration, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS tasks (
+	id SERIAL PRIMARY KEY,
+	completed boolean NOT NULL,
+	priority integer NOT NULL,
+	title text NOT NULL)`,
+
+	`CREATE TABLE webhooks (
+	id SERIAL PRIMARY KEY,
+	url text NOT NULL,
+	secret text NOT NULL,
+	events text[] NOT NULL DEFAULT '{}',
+	active boolean NOT NULL DEFAULT true,
+	created_at timestamptz NOT NULL DEFAULT now())`,
+
+	`CREATE TABLE webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id integer NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event text NOT NULL,
+	payload text NOT NULL,
+	status text NOT NULL DEFAULT 'pending',
+	attempts integer NOT NULL DEFAULT 0,
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	last_error text NOT NULL DEFAULT '',
+	response_status integer NOT NULL DEFAULT 0,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	updated_at timestamptz NOT NULL DEFAULT now())`,
+
+	`CREATE INDEX webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`,
+
+	`ALTER TABLE tasks ADD COLUMN due timestamptz, ADD COLUMN completed_at timestamptz`,
+
+	`CREATE TABLE calendar_feeds (
+	id SERIAL PRIMARY KEY,
+	name text NOT NULL,
+	token_hash text NOT NULL UNIQUE,
+	created_at timestamptz NOT NULL DEFAULT now())`,
+
+	`CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	name text NOT NULL UNIQUE,
+	password_hash text NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL DEFAULT now())`,
+
+	`CREATE TABLE api_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name text NOT NULL,
+	token_hash text NOT NULL UNIQUE,
+	created_at timestamptz NOT NULL DEFAULT now())`,
+
+	`CREATE TABLE sessions (
+	id_hash text PRIMARY KEY,
+	user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	csrf text NOT NULL,
+	expires_at timestamptz NOT NULL)`,
+
+	`ALTER TABLE users ADD COLUMN role text NOT NULL DEFAULT 'editor', ADD COLUMN groups text[] NOT NULL DEFAULT '{}'`,
+
+	`CREATE TABLE user_identities (
+	issuer text NOT NULL,
+	subject text NOT NULL,
+	user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	PRIMARY KEY (issuer, subject))`,
+
+	`CREATE TABLE lists (
+	id SERIAL PRIMARY KEY,
+	name text NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now())`,
+
+	`INSERT INTO lists (name) VALUES ('Tasks')`,
+
+	`ALTER TABLE tasks ADD COLUMN list_id integer REFERENCES lists (id) ON DELETE CASCADE`,
+
+	`UPDATE tasks SET list_id = (SELECT MIN(id) FROM lists)`,
+
+	`ALTER TABLE tasks ALTER COLUMN list_id SET NOT NULL`,
+
+	`CREATE INDEX tasks_list_id ON tasks (list_id)`,
+
+	`CREATE TABLE list_members (
+	id SERIAL PRIMARY KEY,
+	list_id integer NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+	user_id integer REFERENCES users (id) ON DELETE CASCADE,
+	group_name text,
+	role text NOT NULL,
+	CHECK ((user_id IS NULL) <> (group_name IS NULL)),
+	UNIQUE (list_id, user_id),
+	UNIQUE (list_id, group_name))`,
+
+	`ALTER TABLE calendar_feeds ADD COLUMN user_id integer REFERENCES users (id) ON DELETE CASCADE,
+	ADD COLUMN list_id integer REFERENCES lists (id) ON DELETE CASCADE`,
+
+	// the feeds created before feeds had a user showed every task, without
+	// an admin to give them to they go to an admin who can not sign in
+	`INSERT INTO users (name, role) SELECT 'calendar-feeds', 'admin'
+	WHERE EXISTS (SELECT 1 FROM calendar_feeds) AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+	ON CONFLICT (name) DO NOTHING`,
+
+	`UPDATE calendar_feeds SET user_id = (SELECT MIN(id) FROM users WHERE role = 'admin')`,
+
+	`DO $$ BEGIN
+	IF EXISTS (SELECT 1 FROM calendar_feeds WHERE user_id IS NULL) THEN
+		RAISE EXCEPTION 'The calendar feeds need an admin, run TechChallengeApp user role calendar-feeds admin and upgrade again';
+	END IF;
+	END $$`,
+
+	`ALTER TABLE calendar_feeds ALTER COLUMN user_id SET NOT NULL`,
+}
+
+// tables created by the migrations, dropped when the tables are recreated
+var tables = []string{"list_members", "lists", "user_identities", "sessions", "api_tokens", "users", "calendar_feeds", "webhook_deliveries", "webhooks", "tasks", "schema_migrations"}
+
+// Migrate applies the migrations that have not been applied to the
+// database yet, leaving existing data in place
+func Migrate(ctx context.Context, cfg Config) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = migrate(ctx, tx)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func migrate(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations ( version integer PRIMARY KEY, applied_at timestamptz NOT NULL DEFAULT now())")
+
+	if err != nil {
+		return err
+	}
+
+	// only one instance migrates at a time
+	_, err = tx.ExecContext(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE")
+
+	if err != nil {
+		return err
+	}
+
+	var version int
+
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		slog.Debug("Applying migration", "version", i+1, "sql", migrations[i])
+
+		_, err = tx.ExecContext(ctx, migrations[i])
+
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", i+1)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LatestVersion is the version of the schema once every migration is applied
+func LatestVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns the version of the last migration applied to the
+// database, 0 when none was
+func SchemaVersion(ctx context.Context, cfg Config) (int, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var exists bool
+
+	err = db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+
+	return version, err
+}
@@ -0,0 +1,74 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notify sends a payload to everyone listening on the channel
+func Notify(ctx context.Context, cfg Config, channel string, payload string) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+
+	return err
+}
+
+// Listen calls fn with the payload of every notification sent on the
+// channel, the returned function stops listening
+func Listen(cfg Config, channel string, fn func(payload string)) (func() error, error) {
+	dbinfo := getDbInfo(withPassword(cfg))
+
+	listener := pq.NewListener(dbinfo, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Error listening for notifications", "channel", channel, "error", err)
+		}
+	})
+
+	err := listener.Listen(channel)
+
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	go func() {
+		for n := range listener.Notify {
+			// a nil notification is sent after the connection was re-established
+			if n == nil {
+				continue
+			}
+
+			fn(n.Extra)
+		}
+	}()
+
+	return listener.Close, nil
+}
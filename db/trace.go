@@ -0,0 +1,82 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$.])-?\d+(?:\.\d+)?\b`)
+)
+
+// sanitizeQuery replaces the string and numeric literals of a query with ?
+// so values written into the query text never end up in a trace, the
+// placeholders of parameterised queries are kept
+func sanitizeQuery(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// openDb opens a database traced with OpenTelemetry, every query gets a
+// span named after its operation with the sanitized query as db.statement
+func openDb(c driver.Connector, dbName string) *sql.DB {
+	return otelsql.OpenDB(c,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(dbName)),
+		otelsql.WithSpanNameFormatter(func(ctx context.Context, method otelsql.Method, query string) string {
+			if fields := strings.Fields(query); len(fields) > 0 {
+				return strings.ToUpper(fields[0])
+			}
+
+			return string(method)
+		}),
+		otelsql.WithAttributesGetter(func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) []attribute.KeyValue {
+			if query == "" {
+				return nil
+			}
+
+			return []attribute.KeyValue{semconv.DBQueryText(sanitizeQuery(query))}
+		}),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			Ping:                 true,
+			DisableErrSkip:       true,
+			DisableQuery:         true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			// a COPY sends every row with its own exec, only the
+			// statement and the final exec flushing it are traced
+			SpanFilter: func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) bool {
+				return method != otelsql.MethodStmtExec || len(args) == 0 || !strings.HasPrefix(query, "COPY")
+			},
+		}),
+	)
+}
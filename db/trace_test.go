@@ -0,0 +1,111 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/db/dbtest"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestSanitizeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT id FROM tasks WHERE id=$1", "SELECT id FROM tasks WHERE id=$1"},
+		{"SELECT id FROM users WHERE name='ada' AND token = 'secret'", "SELECT id FROM users WHERE name=? AND token = ?"},
+		{"SELECT 'it''s a secret'", "SELECT ?"},
+		{"UPDATE tasks SET priority=12, title='x' WHERE id=-4", "UPDATE tasks SET priority=?, title=? WHERE id=?"},
+		{"SELECT 1.5 * 2", "SELECT ? * ?"},
+		{"SELECT nextval('tasks_id_seq') FROM generate_series(1, $1)", "SELECT nextval(?) FROM generate_series(?, $1)"},
+		{"SELECT col1, t2.id FROM t2", "SELECT col1, t2.id FROM t2"},
+		{"SELECT id\n\tFROM tasks\n\tLIMIT 10", "SELECT id FROM tasks LIMIT ?"},
+	}
+
+	for _, test := range tests {
+		if got := sanitizeQuery(test.query); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestQuerySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	pool := openDb(dbtest.NewWithLists().Connector(), "tasks")
+	defer pool.Close()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	var listID int
+
+	err := pool.QueryRowContext(ctx, "SELECT list_id FROM tasks WHERE id=$1 FOR UPDATE", 2).Scan(&listID)
+	parent.End()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var query sdktrace.ReadOnlySpan
+
+	for _, span := range recorder.Ended() {
+		if span.Name() == "SELECT" {
+			query = span
+		}
+	}
+
+	if query == nil {
+		t.Fatalf("no span of the query in %d spans", len(recorder.Ended()))
+	}
+
+	if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("the span of the query is not a child of the request")
+	}
+
+	attributes := map[string]string{}
+
+	for _, kv := range query.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	want := map[string]string{
+		string(semconv.DBQueryTextKey): "SELECT list_id FROM tasks WHERE id=$1 FOR UPDATE",
+		string(semconv.DBSystemKey):    "postgresql",
+		string(semconv.DBNamespaceKey): "tasks",
+	}
+
+	for key, value := range want {
+		if attributes[key] != value {
+			t.Errorf("%s: %q, want %q", key, attributes[key], value)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lib/pq"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// How an import handles tasks with an id that already exists
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// ErrConflict is returned when importing a task that already exists with
+// the fail conflict mode
+var ErrConflict = errors.New("Task already exists")
+
+// importBatchSize is how many tasks are loaded with each COPY
+const importBatchSize = 1000
+
+// ImportOptions - how tasks are imported
+type ImportOptions struct {
+	// Conflict is one of the Conflict modes, skip when empty
+	Conflict string
+
+	// DryRun rolls back the import once every task has been checked
+	DryRun bool
+
+	// ListID is the list of the tasks without one, the first list the
+	// principal can edit when 0
+	ListID int
+}
+
+// ImportResult - what an import did, or would have done on a dry run
+type ImportResult struct {
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+	Skipped int  `json:"skipped"`
+	DryRun  bool `json:"dryRun"`
+
+	// CreatedTasks and UpdatedTasks are the tasks stored by the import, to
+	// publish their events once it is committed
+	CreatedTasks []model.Task `json:"-"`
+	UpdatedTasks []model.Task `json:"-"`
+}
+
+// ForEachTask streams every task the principal of ctx can see ordered by
+// priority, only the tasks of a list when listID is not 0
+func ForEachTask(ctx context.Context, cfg Config, listID int, fn func(model.Task) error) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	conditions, args, err := readable(ctx, db, nil, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if listID != 0 {
+		args = append(args, listID)
+		conditions = append(conditions, fmt.Sprintf("list_id = $%d", len(args)))
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks"+whereClause(conditions)+" ORDER BY priority, id", args...)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		task, err := scanTask(rows)
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(task)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportTasks loads the tasks returned by next until it returns io.EOF, in
+// a single transaction. Tasks without an id are always created, tasks
+// with an id keep it unless it already exists, in which case the conflict
+// mode applies. The principal of ctx must be able to edit the lists of the
+// tasks, and the tasks overwritten.
+func ImportTasks(ctx context.Context, cfg Config, next func() (model.Task, error), opts ImportOptions) (ImportResult, error) {
+	result := ImportResult{DryRun: opts.DryRun}
+
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return result, fmt.Errorf("Unknown conflict mode: %s, use skip, overwrite or fail", opts.Conflict)
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer tx.Rollback()
+
+	batch := make([]model.Task, 0, importBatchSize)
+	lists := importLists{}
+
+	for {
+		task, err := next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		batch = append(batch, task)
+
+		if len(batch) == importBatchSize {
+			err = importBatch(ctx, tx, batch, opts, lists, &result)
+
+			if err != nil {
+				return result, err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	err = importBatch(ctx, tx, batch, opts, lists, &result)
+
+	if err != nil {
+		return result, err
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	err = queueDeliveries(ctx, tx, model.EventTaskCreated, result.CreatedTasks)
+
+	if err != nil {
+		return result, err
+	}
+
+	err = queueDeliveries(ctx, tx, model.EventTaskUpdated, result.UpdatedTasks)
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, tx.Commit()
+}
+
+// importLists are the lists the tasks of an import are added to, by the
+// list asked for, so each one is checked once
+type importLists map[int]int
+
+// resolve returns the list a task is added to, checking the principal of
+// ctx can edit it
+func (l importLists) resolve(ctx context.Context, tx *sql.Tx, id int) (int, error) {
+	if resolved, ok := l[id]; ok {
+		return resolved, nil
+	}
+
+	resolved, err := taskList(ctx, tx, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	l[id] = resolved
+
+	return resolved, nil
+}
+
+func importBatch(ctx context.Context, tx *sql.Tx, batch []model.Task, opts ImportOptions, lists importLists, result *ImportResult) error {
+	var ids []int64
+
+	for i, task := range batch {
+		if task.ID != 0 {
+			ids = append(ids, int64(task.ID))
+		}
+
+		if task.ListID == 0 {
+			task.ListID = opts.ListID
+		}
+
+		listID, err := lists.resolve(ctx, tx, task.ListID)
+
+		if err != nil && task.ListID != 0 {
+			return fmt.Errorf("List %d: %w", task.ListID, err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		batch[i].ListID = listID
+	}
+
+	// the lists of the tasks that exist, by id
+	existing := make(map[int]int)
+
+	if len(ids) > 0 {
+		rows, err := tx.QueryContext(ctx, "SELECT id, list_id FROM tasks WHERE id = ANY($1)", pq.Array(ids))
+
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var id, listID int
+
+			if err := rows.Scan(&id, &listID); err != nil {
+				rows.Close()
+				return err
+			}
+
+			existing[id] = listID
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	var withID, withoutID []model.Task
+
+	// tasks of this batch waiting to be copied, by id
+	pending := make(map[int]int)
+
+	for _, task := range batch {
+		if task.ID == 0 {
+			withoutID = append(withoutID, task)
+			continue
+		}
+
+		i, isPending := pending[task.ID]
+		listID, exists := existing[task.ID]
+
+		if !exists && !isPending {
+			pending[task.ID] = len(withID)
+			withID = append(withID, task)
+			continue
+		}
+
+		switch opts.Conflict {
+		case ConflictFail:
+			return fmt.Errorf("%w: %d", ErrConflict, task.ID)
+		case ConflictSkip:
+			result.Skipped++
+		case ConflictOverwrite:
+			if isPending {
+				withID[i] = task
+				result.Updated++
+				continue
+			}
+
+			// the tasks of the lists the principal can not see are as
+			// forbidden as the ones it can only view
+			_, err := lists.resolve(ctx, tx, listID)
+
+			if err == ErrNotFound {
+				err = access.ErrForbidden
+			}
+
+			if err != nil {
+				return fmt.Errorf("Task %d: %w", task.ID, err)
+			}
+
+			updated, err := scanTask(tx.QueryRowContext(ctx, `UPDATE tasks
+SET completed=$1, priority=$2, title=$3, due=$4, completed_at=CASE WHEN $1 THEN COALESCE($5, completed_at, now()) END, list_id=$6
+WHERE id=$7 RETURNING `+taskColumns,
+				task.Complete, task.Priority, task.Title, task.Due, task.CompletedAt, task.ListID, task.ID))
+
+			if err != nil {
+				return err
+			}
+
+			result.Updated++
+			result.UpdatedTasks = append(result.UpdatedTasks, updated)
+		}
+	}
+
+	if len(withID) > 0 {
+		err := copyTasks(ctx, tx, withID, true)
+
+		if err != nil {
+			return err
+		}
+
+		// move the sequence past the imported ids so new tasks do not collide
+		_, err = tx.ExecContext(ctx, "SELECT setval('tasks_id_seq', GREATEST((SELECT MAX(id) FROM tasks), (SELECT last_value FROM tasks_id_seq)))")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(withoutID) > 0 {
+		err := reserveIDs(ctx, tx, withoutID)
+
+		if err != nil {
+			return err
+		}
+
+		err = copyTasks(ctx, tx, withoutID, true)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	result.Created += len(withID) + len(withoutID)
+	result.CreatedTasks = append(append(result.CreatedTasks, withID...), withoutID...)
+
+	return nil
+}
+
+// reserveIDs takes the ids of new tasks from the sequence, so the tasks
+// copied are known by id
+func reserveIDs(ctx context.Context, tx *sql.Tx, tasks []model.Task) error {
+	rows, err := tx.QueryContext(ctx, "SELECT nextval('tasks_id_seq') FROM generate_series(1, $1)", len(tasks))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		if err := rows.Scan(&tasks[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
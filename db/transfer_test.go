@@ -0,0 +1,270 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// importing returns the tasks one at a time, as a reader of a file does
+func importing(tasks ...model.Task) func() (model.Task, error) {
+	return func() (model.Task, error) {
+		if len(tasks) == 0 {
+			return model.Task{}, io.EOF
+		}
+
+		task := tasks[0]
+		tasks = tasks[1:]
+
+		return task, nil
+	}
+}
+
+// titles are the titles of the tasks, by id
+func titles(tasks []model.Task) map[int]string {
+	byID := make(map[int]string)
+
+	for _, task := range tasks {
+		byID[task.ID] = task.Title
+	}
+
+	return byID
+}
+
+func ids(tasks []model.Task) []int {
+	var ids []int
+
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+func TestImportConflicts(t *testing.T) {
+	// the task 1 exists, 7 does not and is in the file twice
+	file := []model.Task{
+		{ID: 1, Title: "Imported 1", ListID: 1},
+		{ID: 7, Title: "Imported 7"},
+		{Title: "New"},
+		{ID: 7, Title: "Imported 7 again"},
+	}
+
+	modes := []struct {
+		conflict string
+		result   ImportResult
+		titles   map[int]string
+	}{
+		{ConflictSkip, ImportResult{Created: 2, Skipped: 2}, map[int]string{1: "Task", 7: "Imported 7", 8: "New"}},
+		{"", ImportResult{Created: 2, Skipped: 2}, map[int]string{1: "Task", 7: "Imported 7", 8: "New"}},
+		{ConflictOverwrite, ImportResult{Created: 2, Updated: 2}, map[int]string{1: "Imported 1", 7: "Imported 7 again", 8: "New"}},
+	}
+
+	for _, mode := range modes {
+		t.Run(mode.conflict, func(t *testing.T) {
+			cfg, fake := testDB(t)
+
+			result, err := ImportTasks(testPrincipals["admin"], cfg, importing(file...), ImportOptions{Conflict: mode.conflict})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := (ImportResult{Created: result.Created, Updated: result.Updated, Skipped: result.Skipped}); !reflect.DeepEqual(got, mode.result) {
+				t.Errorf("got %+v, want %+v", got, mode.result)
+			}
+
+			got := titles(fake.Tasks())
+			delete(got, 2)
+			delete(got, 3)
+
+			if !reflect.DeepEqual(got, mode.titles) {
+				t.Errorf("got the tasks %v, want %v", got, mode.titles)
+			}
+
+			// the tasks of the events are the ones stored
+			if created := ids(result.CreatedTasks); !reflect.DeepEqual(created, []int{7, 8}) {
+				t.Errorf("created %v, want 7 and 8", created)
+			}
+
+			for _, task := range append(result.CreatedTasks, result.UpdatedTasks...) {
+				if stored, _ := fake.Task(task.ID); !reflect.DeepEqual(task, stored) {
+					t.Errorf("event of %+v, stored %+v", task, stored)
+				}
+			}
+
+			if mode.conflict == ConflictOverwrite && !reflect.DeepEqual(ids(result.UpdatedTasks), []int{1}) {
+				t.Errorf("updated %v, want the task 1", ids(result.UpdatedTasks))
+			}
+		})
+	}
+
+	t.Run(ConflictFail, func(t *testing.T) {
+		for _, conflicting := range [][]model.Task{file[:1], file[1:]} {
+			cfg, fake := testDB(t)
+
+			_, err := ImportTasks(testPrincipals["admin"], cfg, importing(conflicting...), ImportOptions{Conflict: ConflictFail})
+
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("got %v, want a conflict", err)
+			}
+
+			if len(fake.Tasks()) != 3 {
+				t.Errorf("%d tasks, want the import rolled back", len(fake.Tasks()))
+			}
+		}
+	})
+
+	cfg, _ := testDB(t)
+
+	if _, err := ImportTasks(testPrincipals["admin"], cfg, importing(file...), ImportOptions{Conflict: "merge"}); err == nil {
+		t.Error("merge is a conflict mode")
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	cfg, fake := testDB(t)
+
+	result, err := ImportTasks(testPrincipals["admin"], cfg, importing(model.Task{Title: "New"}, model.Task{ID: 1, Title: "Renamed"}), ImportOptions{Conflict: ConflictOverwrite, DryRun: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.DryRun || result.Created != 1 || result.Updated != 1 {
+		t.Errorf("got %+v, want a dry run creating and updating a task", result)
+	}
+
+	if got := titles(fake.Tasks()); !reflect.DeepEqual(got, map[int]string{1: "Task", 2: "Task", 3: "Task"}) {
+		t.Errorf("got the tasks %v, want them unchanged", got)
+	}
+}
+
+func TestImportLists(t *testing.T) {
+	cfg, fake := testDB(t)
+	editor := testPrincipals["editor"]
+
+	// the tasks without a list go to the list of the options, the first
+	// list the principal can edit otherwise
+	_, err := ImportTasks(editor, cfg, importing(model.Task{Title: "In 3"}), ImportOptions{ListID: 3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ImportTasks(editor, cfg, importing(model.Task{Title: "In 1"}), ImportOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lists := map[string]int{}
+
+	for _, task := range fake.Tasks() {
+		lists[task.Title] = task.ListID
+	}
+
+	if lists["In 3"] != 3 || lists["In 1"] != 1 {
+		t.Errorf("got the lists %v", lists)
+	}
+
+	// the editor only views the list 2, and nina's task 3 can not be
+	// overwritten by the viewer who does not see it
+	refused := []struct {
+		name string
+		ctx  string
+		task model.Task
+	}{
+		{"viewed list", "editor", model.Task{Title: "In 2", ListID: 2}},
+		{"task of a viewed list", "editor", model.Task{ID: 2, Title: "Renamed"}},
+		{"task of a hidden list", "viewer", model.Task{ID: 3, Title: "Renamed", ListID: 2}},
+	}
+
+	for _, r := range refused {
+		_, err := ImportTasks(testPrincipals[r.ctx], cfg, importing(r.task), ImportOptions{Conflict: ConflictOverwrite})
+
+		if !errors.Is(err, access.ErrForbidden) {
+			t.Errorf("%s: got %v, want forbidden", r.name, err)
+		}
+	}
+}
+
+func TestImportBatches(t *testing.T) {
+	cfg, fake := testDB(t)
+
+	var file []model.Task
+
+	for i := 0; i < importBatchSize+10; i++ {
+		file = append(file, model.Task{Title: "New"})
+	}
+
+	// the same id in two batches
+	file[5].ID = 100
+	file[importBatchSize+5].ID = 100
+
+	result, err := ImportTasks(testPrincipals["admin"], cfg, importing(file...), ImportOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Created != importBatchSize+9 || result.Skipped != 1 || len(fake.Tasks()) != 3+importBatchSize+9 {
+		t.Errorf("got %+v and %d tasks", result, len(fake.Tasks()))
+	}
+
+	// the new ids start after the imported ones
+	task, err := AddTask(testPrincipals["admin"], cfg, model.Task{Title: "After"})
+
+	if err != nil || task.ID <= 100 {
+		t.Errorf("got %+v %v, want an id after 100", task, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	cfg, _ := testDB(t)
+
+	var exported []int
+
+	err := ForEachTask(testPrincipals["viewer"], cfg, 0, func(task model.Task) error {
+		exported = append(exported, task.ID)
+		return nil
+	})
+
+	if err != nil || !reflect.DeepEqual(exported, []int{1, 2}) {
+		t.Errorf("got %v %v, want the tasks of the lists of the viewer", exported, err)
+	}
+
+	stop := errors.New("stop")
+	err = ForEachTask(testPrincipals["admin"], cfg, 3, func(task model.Task) error { return stop })
+
+	if err != stop {
+		t.Errorf("got %v, want the error of the function", err)
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// ErrUserExists is returned when adding a user whose name is taken
+var ErrUserExists = errors.New("User already exists")
+
+const userColumns = "id, name, role, groups"
+
+func scanUser(row interface{ Scan(...interface{}) error }, extra ...interface{}) (model.User, error) {
+	user := model.User{}
+
+	err := row.Scan(append([]interface{}{&user.ID, &user.Name, &user.Role, pq.Array(&user.Groups)}, extra...)...)
+
+	if user.Groups == nil {
+		user.Groups = []string{}
+	}
+
+	return user, err
+}
+
+// GetUsers lists all users by name
+func GetUsers(ctx context.Context, cfg Config) ([]model.User, error) {
+	var users []model.User
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY name")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// GetUser fetches a user by id
+func GetUser(ctx context.Context, cfg Config, id int) (model.User, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user, err := scanUser(db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1", id))
+
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+
+	return user, err
+}
+
+// GetUserByName fetches a user with the hash of its password, empty when
+// the user can not sign in with a password
+func GetUserByName(ctx context.Context, cfg Config, name string) (model.User, string, error) {
+	var hash string
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return model.User{}, "", err
+	}
+
+	user, err := scanUser(db.QueryRowContext(ctx, "SELECT "+userColumns+", password_hash FROM users WHERE name=$1", name), &hash)
+
+	if err == sql.ErrNoRows {
+		return user, "", ErrNotFound
+	}
+
+	return user, hash, err
+}
+
+// AddUser creates a user signing in with the password of the hash
+func AddUser(ctx context.Context, cfg Config, user model.User, passwordHash string) (model.User, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return user, err
+	}
+
+	if user.Groups == nil {
+		user.Groups = []string{}
+	}
+
+	err = db.QueryRowContext(ctx, "INSERT INTO users (name, role, groups, password_hash) VALUES($1, $2, $3, $4) returning id",
+		user.Name, user.Role, pq.Array(user.Groups), passwordHash).Scan(&user.ID)
+
+	var pqErr *pq.Error
+
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return user, ErrUserExists
+	}
+
+	return user, err
+}
+
+// SetUserPassword changes the hash of the password of a user, its
+// sessions are ended
+func SetUserPassword(ctx context.Context, cfg Config, name string, passwordHash string) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	var id int
+
+	err = db.QueryRowContext(ctx, "UPDATE users SET password_hash=$1 WHERE name=$2 RETURNING id", passwordHash, name).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id=$1", id)
+
+	return err
+}
+
+// SetUserRole changes the role of a user
+func SetUserRole(ctx context.Context, cfg Config, name string, role string) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, "UPDATE users SET role=$1 WHERE name=$2", role, name)
+
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+
+	if err == nil && count == 0 {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// SignInExternalUser returns the user of an identity of an identity
+// provider, the subject of the issuer, with the role and groups it was
+// given. The user is created with the name on the first sign in, its role
+// and groups are updated on the next ones
+func SignInExternalUser(ctx context.Context, cfg Config, issuer string, subject string, user model.User) (model.User, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return user, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return user, err
+	}
+
+	defer tx.Rollback()
+
+	if user.Groups == nil {
+		user.Groups = []string{}
+	}
+
+	var id int
+
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM user_identities WHERE issuer=$1 AND subject=$2", issuer, subject).Scan(&id)
+
+	switch {
+	case err == sql.ErrNoRows:
+		err = tx.QueryRowContext(ctx, "INSERT INTO users (name, role, groups) VALUES($1, $2, $3) returning id",
+			user.Name, user.Role, pq.Array(user.Groups)).Scan(&user.ID)
+
+		var pqErr *pq.Error
+
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return user, ErrUserExists
+		}
+
+		if err != nil {
+			return user, err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO user_identities (issuer, subject, user_id) VALUES($1, $2, $3)", issuer, subject, user.ID)
+	case err == nil:
+		user, err = scanUser(tx.QueryRowContext(ctx, "UPDATE users SET role=$1, groups=$2 WHERE id=$3 RETURNING "+userColumns,
+			user.Role, pq.Array(user.Groups), id))
+	}
+
+	if err != nil {
+		return user, err
+	}
+
+	return user, tx.Commit()
+}
+
+// DeleteUser removes a user with its api tokens, sessions and identities
+func DeleteUser(ctx context.Context, cfg Config, name string) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, "DELETE FROM users WHERE name=$1", name)
+
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+
+	if err == nil && count == 0 {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// AddApiToken gives a user a token to call the api with, only its hash is
+// stored
+func AddApiToken(ctx context.Context, cfg Config, userID int, name string, token string) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO api_tokens (user_id, name, token_hash) VALUES($1, $2, $3)",
+		userID, name, hashToken(token))
+
+	return err
+}
+
+// GetUserByToken finds the user an api token belongs to
+func GetUserByToken(ctx context.Context, cfg Config, token string) (model.User, error) {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user, err := scanUser(db.QueryRowContext(ctx, `SELECT u.id, u.name, u.role, u.groups FROM api_tokens t JOIN users u ON u.id = t.user_id
+WHERE t.token_hash=$1`, hashToken(token)))
+
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+
+	return user, err
+}
+
+// SaveSession stores a session, the expired ones are removed on the way
+func SaveSession(ctx context.Context, cfg Config, session model.Session) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < now()")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO sessions (id_hash, user_id, csrf, expires_at) VALUES($1, $2, $3, $4)",
+		hashToken(session.ID), session.UserID, session.CSRF, session.Expires)
+
+	return err
+}
+
+// GetSession fetches a session that has not expired
+func GetSession(ctx context.Context, cfg Config, id string) (model.Session, error) {
+	session := model.Session{ID: id}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return session, err
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT user_id, csrf, expires_at FROM sessions WHERE id_hash=$1 AND expires_at > now()",
+		hashToken(id)).Scan(&session.UserID, &session.CSRF, &session.Expires)
+
+	if err == sql.ErrNoRows {
+		return session, ErrNotFound
+	}
+
+	return session, err
+}
+
+// DeleteSession ends a session
+func DeleteSession(ctx context.Context, cfg Config, id string) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM sessions WHERE id_hash=$1", hashToken(id))
+
+	return err
+}
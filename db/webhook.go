@@ -0,0 +1,360 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("Not found")
+
+// Delivery - a delivery claimed for an attempt, with the webhook it goes to
+type Delivery struct {
+	model.WebhookDelivery
+	Webhook model.Webhook
+}
+
+const webhookColumns = "id, url, secret, events, active"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (model.Webhook, error) {
+	hook := model.Webhook{}
+
+	err := row.Scan(&hook.ID, &hook.URL, &hook.Secret, pq.Array(&hook.Events), &hook.Active)
+
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+
+	return hook, err
+}
+
+// deliveryColumns are the columns read by scanDelivery
+const deliveryColumns = "id, webhook_id, event, payload, status, attempts, next_attempt_at, last_error, response_status, created_at, updated_at"
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (model.WebhookDelivery, error) {
+	d := model.WebhookDelivery{}
+
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastError, &d.ResponseStatus, &d.CreatedAt, &d.UpdatedAt)
+
+	return d, err
+}
+
+// GetAllWebhooks lists all webhook subscriptions. The webhooks receive the
+// events of every list, only the admins manage them
+func GetAllWebhooks(ctx context.Context, cfg Config) ([]model.Webhook, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return nil, err
+	}
+
+	var hooks []model.Webhook
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// GetWebhook fetches a single webhook subscription
+func GetWebhook(ctx context.Context, cfg Config, id int) (model.Webhook, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return model.Webhook{}, err
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	hook, err := scanWebhook(db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id=$1", id))
+
+	if err == sql.ErrNoRows {
+		return hook, ErrNotFound
+	}
+
+	return hook, err
+}
+
+func AddWebhook(ctx context.Context, cfg Config, hook model.Webhook) (model.Webhook, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return hook, err
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return hook, err
+	}
+
+	err = db.QueryRowContext(ctx, "INSERT INTO webhooks (url, secret, events, active) VALUES($1, $2, $3, $4) returning id",
+		hook.URL, hook.Secret, pq.Array(hook.Events), hook.Active).Scan(&hook.ID)
+
+	return hook, err
+}
+
+// UpdateWebhook changes a webhook subscription, the secret is kept when
+// none is given
+func UpdateWebhook(ctx context.Context, cfg Config, hook model.Webhook) (model.Webhook, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return hook, err
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return hook, err
+	}
+
+	hook, err = scanWebhook(db.QueryRowContext(ctx, `UPDATE webhooks SET url=$1, secret=COALESCE(NULLIF($2, ''), secret), events=$3, active=$4
+WHERE id=$5 RETURNING `+webhookColumns,
+		hook.URL, hook.Secret, pq.Array(hook.Events), hook.Active, hook.ID))
+
+	if err == sql.ErrNoRows {
+		return hook, ErrNotFound
+	}
+
+	return hook, err
+}
+
+// DeleteWebhook removes a webhook subscription and its deliveries
+func DeleteWebhook(ctx context.Context, cfg Config, id int) error {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return err
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, "DELETE FROM webhooks WHERE id=$1", id)
+
+	if err != nil {
+		return err
+	}
+
+	affect, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affect < 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// queueDeliveries queues the event of each task for every active webhook
+// interested in it. It runs in the transaction writing the tasks, so the
+// deliveries are queued exactly when the tasks change
+func queueDeliveries(ctx context.Context, tx *sql.Tx, event string, tasks []model.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	payloads := make([]string, len(tasks))
+
+	for i, task := range tasks {
+		// the deleted tasks are only known by their id and list
+		if event == model.EventTaskDeleted {
+			task = model.Task{ID: task.ID, ListID: task.ListID}
+		}
+
+		payload, err := json.Marshal(model.WebhookPayload{Event: event, Task: task, Timestamp: now})
+
+		if err != nil {
+			return err
+		}
+
+		payloads[i] = string(payload)
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload)
+SELECT w.id, $1, p.payload FROM unnest($2::text[]) WITH ORDINALITY AS p(payload, n)
+CROSS JOIN webhooks w WHERE w.active AND (cardinality(w.events) = 0 OR $1 = ANY(w.events))
+ORDER BY p.n, w.id`, event, pq.Array(payloads))
+
+	return err
+}
+
+// ClaimDeliveries picks up to limit pending deliveries that are due, and
+// holds them for the lease so no other instance attempts them meanwhile
+func ClaimDeliveries(ctx context.Context, cfg Config, limit int, lease time.Duration) ([]Delivery, error) {
+	var deliveries []Delivery
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `UPDATE webhook_deliveries d
+SET attempts = d.attempts + 1, next_attempt_at = now() + $2 * interval '1 second', updated_at = now()
+FROM webhooks w
+WHERE w.id = d.webhook_id AND d.id IN (
+	SELECT id FROM webhook_deliveries
+	WHERE status = 'pending' AND next_attempt_at <= now()
+	ORDER BY next_attempt_at
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED)
+RETURNING d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret`,
+		limit, lease.Seconds())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d := Delivery{}
+
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.CreatedAt,
+			&d.Webhook.URL, &d.Webhook.Secret)
+
+		if err != nil {
+			return nil, err
+		}
+
+		d.Webhook.ID = d.WebhookID
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// UpdateDelivery records the outcome of a delivery attempt
+func UpdateDelivery(ctx context.Context, cfg Config, d model.WebhookDelivery) error {
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `UPDATE webhook_deliveries
+SET status=$1, next_attempt_at=$2, last_error=$3, response_status=$4, updated_at=now()
+WHERE id=$5`, d.Status, d.NextAttemptAt, d.LastError, d.ResponseStatus, d.ID)
+
+	return err
+}
+
+// GetDeliveries lists the latest deliveries of a webhook, newest first
+func GetDeliveries(ctx context.Context, cfg Config, webhookID int, limit int) ([]model.WebhookDelivery, error) {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return nil, err
+	}
+
+	var deliveries []model.WebhookDelivery
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+deliveryColumns+`
+FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY id DESC LIMIT $2`, webhookID, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RetryDelivery queues a dead delivery again, with a fresh set of attempts
+func RetryDelivery(ctx context.Context, cfg Config, webhookID int, id int64) error {
+	if err := access.From(ctx).CheckAdmin(); err != nil {
+		return err
+	}
+
+	db, err := getDb(cfg)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, `UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=now(), updated_at=now()
+WHERE id=$1 AND webhook_id=$2 AND status='dead'`, id, webhookID)
+
+	if err != nil {
+		return err
+	}
+
+	affect, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affect < 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
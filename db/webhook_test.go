@@ -0,0 +1,166 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// queued are the events and tasks of the payloads queued for a webhook
+func queued(t *testing.T, deliveries []model.WebhookDelivery, webhookID int) []model.WebhookPayload {
+	var payloads []model.WebhookPayload
+
+	for _, d := range deliveries {
+		if d.WebhookID != webhookID {
+			continue
+		}
+
+		var payload model.WebhookPayload
+
+		if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+			t.Fatalf("delivery %d: %v", d.ID, err)
+		}
+
+		if payload.Event != d.Event || payload.Timestamp.IsZero() {
+			t.Errorf("delivery %d of %s: %s", d.ID, d.Event, d.Payload)
+		}
+
+		payloads = append(payloads, model.WebhookPayload{Event: payload.Event, Task: payload.Task})
+	}
+
+	return payloads
+}
+
+func TestTaskWritesQueueDeliveries(t *testing.T) {
+	cfg, fake := testDB(t)
+	all := fake.AddWebhook(model.Webhook{URL: "https://all.example.com", Active: true})
+	deleted := fake.AddWebhook(model.Webhook{URL: "https://deleted.example.com", Events: []string{model.EventTaskDeleted}, Active: true})
+	paused := fake.AddWebhook(model.Webhook{URL: "https://paused.example.com"})
+
+	ctx := testPrincipals["admin"]
+
+	created, err := AddTask(ctx, cfg, model.Task{Title: "Write \"docs\", then ship", Priority: 2, ListID: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := UpdateTask(ctx, cfg, model.Task{ID: created.ID, Title: "Ship", Complete: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payloads are read back in UTC, without the monotonic clock
+	*updated.CompletedAt = updated.CompletedAt.UTC().Round(0)
+
+	_, err = DeleteTask(ctx, cfg, model.Task{ID: created.ID})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []model.WebhookPayload{
+		{Event: model.EventTaskCreated, Task: created},
+		{Event: model.EventTaskUpdated, Task: updated},
+		{Event: model.EventTaskDeleted, Task: model.Task{ID: created.ID, ListID: 1}},
+	}
+
+	if got := queued(t, fake.Deliveries(), all.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued for every event:\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := queued(t, fake.Deliveries(), deleted.ID); !reflect.DeepEqual(got, want[2:]) {
+		t.Errorf("queued for the deleted events: %+v, want %+v", got, want[2:])
+	}
+
+	if got := queued(t, fake.Deliveries(), paused.ID); len(got) != 0 {
+		t.Errorf("queued for a paused webhook: %+v", got)
+	}
+}
+
+func TestTaskWritesFailWithTheirDeliveries(t *testing.T) {
+	cfg, fake := testDB(t)
+	fake.AddWebhook(model.Webhook{URL: "https://all.example.com", Active: true})
+	fake.FailOn("^INSERT INTO webhook_deliveries")
+
+	ctx := testPrincipals["admin"]
+
+	if _, err := AddTask(ctx, cfg, model.Task{Title: "New", ListID: 1}); err == nil {
+		t.Error("added a task without queueing its deliveries")
+	}
+
+	if _, err := UpdateTask(ctx, cfg, model.Task{ID: 1, Title: "Renamed"}); err == nil {
+		t.Error("updated a task without queueing its deliveries")
+	}
+
+	if _, err := DeleteTask(ctx, cfg, model.Task{ID: 2}); err == nil {
+		t.Error("deleted a task without queueing its deliveries")
+	}
+
+	if _, err := ImportTasks(ctx, cfg, importing(model.Task{Title: "Imported"}), ImportOptions{}); err == nil {
+		t.Error("imported a task without queueing its deliveries")
+	}
+
+	if got := titles(fake.Tasks()); !reflect.DeepEqual(got, map[int]string{1: "Task", 2: "Task", 3: "Task"}) {
+		t.Errorf("got the tasks %v, want them unchanged", got)
+	}
+}
+
+func TestImportQueuesDeliveries(t *testing.T) {
+	cfg, fake := testDB(t)
+	hook := fake.AddWebhook(model.Webhook{URL: "https://all.example.com", Active: true})
+
+	ctx := testPrincipals["admin"]
+	tasks := importing(model.Task{Title: "New"}, model.Task{ID: 1, Title: "Renamed"}, model.Task{ID: 2, Title: "Overwritten"})
+
+	_, err := ImportTasks(ctx, cfg, importing(model.Task{Title: "Dry run"}), ImportOptions{DryRun: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fake.Deliveries(); len(got) != 0 {
+		t.Errorf("a dry run queued %+v", got)
+	}
+
+	result, err := ImportTasks(ctx, cfg, tasks, ImportOptions{Conflict: ConflictOverwrite})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, payload := range queued(t, fake.Deliveries(), hook.ID) {
+		got = append(got, payload.Event+" "+payload.Task.Title)
+	}
+
+	want := []string{"created New", "updated Renamed", "updated Overwritten"}
+
+	if result.Created != 1 || result.Updated != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %+v and queued %v, want %v", result, got, want)
+	}
+}
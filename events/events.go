@@ -0,0 +1,190 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Type - the kind of change that happened to a task
+type Type string
+
+// Types of task events
+const (
+	TaskCreated Type = model.EventTaskCreated
+	TaskUpdated Type = model.EventTaskUpdated
+	TaskDeleted Type = model.EventTaskDeleted
+
+	// ListsChanged reports a list was added or deleted, or its members
+	// changed, the subscribers reload the lists they can see
+	ListsChanged Type = "lists"
+)
+
+// notifyChannel is the postgres channel used to share events between instances
+const notifyChannel = "task_events"
+
+// subscriberBuffer is how many events a subscriber can fall behind before
+// events are dropped for it
+const subscriberBuffer = 64
+
+// Event describes a change made to a task
+type Event struct {
+	Type   Type       `json:"type"`
+	Task   model.Task `json:"task"`
+	Origin string     `json:"origin,omitempty"`
+}
+
+// Broker fans out task events to every subscriber in the process, and
+// optionally to other instances through postgres LISTEN/NOTIFY
+type Broker struct {
+	origin string
+
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+
+	db     *db.Config
+	closer func() error
+}
+
+// NewBroker creates a broker only delivering events inside this process
+func NewBroker() *Broker {
+	return &Broker{
+		origin: newOrigin(),
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+func newOrigin() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Subscribe registers a new subscriber, the returned function must be
+// called once the subscriber is no longer interested in events
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Local reports if the event was published by this instance
+func (b *Broker) Local(e Event) bool {
+	return e.Origin == b.origin
+}
+
+// Publish sends an event to all local subscribers, and to the other
+// instances when postgres notifications are enabled
+func (b *Broker) Publish(ctx context.Context, e Event) {
+	e.Origin = b.origin
+	b.broadcast(e)
+
+	if b.db == nil {
+		return
+	}
+
+	payload, err := json.Marshal(e)
+
+	if err != nil {
+		slog.Error("Error encoding event", "error", err)
+		return
+	}
+
+	err = db.Notify(ctx, *b.db, notifyChannel, string(payload))
+
+	if err != nil {
+		slog.Error("Error notifying other instances", "error", err)
+	}
+}
+
+func (b *Broker) broadcast(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			slog.Warn("Subscriber is falling behind, dropping event", "event", e.Type, "task", e.Task.ID)
+		}
+	}
+}
+
+// ListenPostgres shares events with other instances connected to the same
+// database using LISTEN/NOTIFY
+func (b *Broker) ListenPostgres(cfg db.Config) error {
+	closer, err := db.Listen(cfg, notifyChannel, func(payload string) {
+		var e Event
+
+		err := json.Unmarshal([]byte(payload), &e)
+
+		if err != nil {
+			slog.Error("Error decoding event", "error", err)
+			return
+		}
+
+		// our own events have already been delivered locally
+		if e.Origin == b.origin {
+			return
+		}
+
+		b.broadcast(e)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	b.db = &cfg
+	b.closer = closer
+
+	return nil
+}
+
+// Close stops listening for events from other instances
+func (b *Broker) Close() error {
+	if b.closer == nil {
+		return nil
+	}
+
+	return b.closer()
+}
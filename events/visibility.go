@@ -0,0 +1,75 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package events
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+)
+
+// Visibility tells which events a subscriber can see. The lists its
+// principal can read are loaded on the first event and kept until an event
+// reports the lists changed, so the events of the tasks cost no query. It
+// is used by the goroutine reading the subscription only
+type Visibility struct {
+	ctx   context.Context
+	cfg   db.Config
+	lists map[int]bool
+}
+
+// NewVisibility returns the visibility of the events for the principal of
+// ctx
+func NewVisibility(ctx context.Context, cfg db.Config) *Visibility {
+	return &Visibility{ctx: ctx, cfg: cfg}
+}
+
+// Allows tells if the subscriber can see the task of the event, the events
+// of the lists themselves are never sent to clients
+func (v *Visibility) Allows(e Event) bool {
+	if e.Type == ListsChanged {
+		v.lists = nil
+		return false
+	}
+
+	if access.From(v.ctx).Admin() {
+		return true
+	}
+
+	if v.lists == nil {
+		lists, err := db.GetLists(v.ctx, v.cfg)
+
+		if err != nil {
+			slog.ErrorContext(v.ctx, "Could not read the lists of a subscriber", "error", err)
+			return false
+		}
+
+		v.lists = make(map[int]bool, len(lists))
+
+		for _, list := range lists {
+			v.lists[list.ID] = true
+		}
+	}
+
+	return v.lists[e.Task.ListID]
+}
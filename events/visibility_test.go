@@ -0,0 +1,47 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+func TestVisibilityOfTheAdmins(t *testing.T) {
+	ctx := access.WithUser(context.Background(), model.User{ID: 1, Name: "alice", Role: model.RoleAdmin})
+	visible := NewVisibility(ctx, db.Config{})
+
+	if !visible.Allows(Event{Type: TaskCreated, Task: model.Task{ID: 1, ListID: 2}}) {
+		t.Error("an admin does not see a task")
+	}
+
+	if visible.Allows(Event{Type: ListsChanged}) {
+		t.Error("the change of the lists is sent")
+	}
+
+	if visible.lists != nil {
+		t.Error("the lists of an admin are loaded")
+	}
+}
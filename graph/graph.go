@@ -0,0 +1,237 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package graph serves the tasks, webhooks and calendar feeds as a GraphQL
+// api, queries and mutations over POST and subscriptions over Server-Sent
+// Events
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/trace/otel"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+)
+
+// Schema is the GraphQL schema of the api, in SDL
+//
+//go:embed schema.graphql
+var Schema string
+
+const (
+	// maxDepth limits how deeply the fields of a query are nested
+	maxDepth = 10
+
+	// maxBody is the largest request accepted
+	maxBody = 1 << 20
+
+	// heartbeatInterval keeps idle subscriptions from being closed by proxies
+	heartbeatInterval = 15 * time.Second
+)
+
+// Config configuration for the graph package
+type Config struct {
+	DB     db.Config
+	Events *events.Broker
+}
+
+// request is a GraphQL request, as sent in a POST body or in the query
+// parameters of a GET
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler serves the GraphQL api. Queries and mutations are POSTed as JSON,
+// subscriptions are streamed as Server-Sent Events to the requests that
+// accept text/event-stream, following the distinct connections mode of the
+// GraphQL over SSE protocol.
+func Handler(cfg Config) http.Handler {
+	schema := graphql.MustParseSchema(Schema, &resolver{cfg: cfg},
+		graphql.MaxDepth(maxDepth),
+		graphql.Tracer(otel.DefaultTracer()),
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+
+		switch r.Method {
+		case http.MethodPost:
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&req)
+
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+				return
+			}
+		case http.MethodGet:
+			// EventSource can only GET, so subscriptions can be sent as query parameters
+			if !acceptsEvents(r) {
+				w.Header().Set("Allow", "POST")
+				writeError(w, http.StatusMethodNotAllowed, "Send queries and mutations with POST")
+				return
+			}
+
+			query := r.URL.Query()
+			req.Query = query.Get("query")
+			req.OperationName = query.Get("operationName")
+
+			if variables := query.Get("variables"); variables != "" {
+				err := json.Unmarshal([]byte(variables), &req.Variables)
+
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "Invalid variables: "+err.Error())
+					return
+				}
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, "Send queries and mutations with POST")
+			return
+		}
+
+		if req.Query == "" {
+			writeError(w, http.StatusBadRequest, "The query is missing")
+			return
+		}
+
+		ctx := withLoaders(r.Context(), newLoaders(cfg))
+
+		if r.Method == http.MethodGet {
+			ctx = context.WithValue(ctx, readOnlyKey{}, true)
+		}
+
+		if acceptsEvents(r) {
+			stream(w, r.WithContext(ctx), schema, req)
+			return
+		}
+
+		response := schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+		// graphql-go reports subscriptions sent without a transport as a
+		// missing graphql-ws header, sse is the transport offered here
+		for _, e := range response.Errors {
+			if e.Message == "graphql-ws protocol header is missing" {
+				e.Message = "Subscriptions are streamed to requests with Accept: text/event-stream"
+			}
+		}
+
+		js, err := json.Marshal(response)
+
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	})
+}
+
+type readOnlyKey struct{}
+
+// checkWritable refuses the mutations sent with GET, which must not change
+// anything
+func checkWritable(ctx context.Context) error {
+	if readOnly, _ := ctx.Value(readOnlyKey{}).(bool); readOnly {
+		return errors.New("Mutations must be sent with POST")
+	}
+
+	return nil
+}
+
+func acceptsEvents(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// writeError replies with a GraphQL response holding a single error
+func writeError(w http.ResponseWriter, status int, message string) {
+	js, _ := json.Marshal(graphql.Response{Errors: []*gqlerrors.QueryError{{Message: message}}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// stream sends each result of the operation as a next event, then a
+// complete event once the subscription ends. Queries and mutations send a
+// single result.
+func stream(w http.ResponseWriter, r *http.Request, schema *graphql.Schema, req request) {
+	rc := http.NewResponseController(w)
+
+	// the stream outlives the server write timeout
+	err := rc.SetWriteDeadline(time.Time{})
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Streaming not supported", "error", err)
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	results, err := schema.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case result, ok := <-results:
+			if !ok {
+				fmt.Fprint(w, "event: complete\ndata:\n\n")
+				rc.Flush()
+				return
+			}
+
+			js, _ := json.Marshal(result)
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", js)
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
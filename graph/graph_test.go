@@ -0,0 +1,138 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/db/dbtest"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// testDB gives the api a fake database holding the lists of
+// dbtest.NewWithLists
+func testDB(t *testing.T) *dbtest.DB {
+	fake := dbtest.NewWithLists()
+	pool := fake.Open()
+	db.SetPool(db.Config{DbName: t.Name()}, pool)
+
+	t.Cleanup(func() { pool.Close() })
+
+	return fake
+}
+
+// send sends the query to the api as an admin, as a GET accepting
+// Server-Sent Events, as an EventSource does, or as a JSON POST
+func send(t *testing.T, method string, query string) string {
+	testDB(t)
+
+	handler := Handler(Config{DB: db.Config{DbName: t.Name()}, Events: events.NewBroker()})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := model.User{ID: 3, Name: "ada", Role: model.RoleAdmin}
+		handler.ServeHTTP(w, r.WithContext(access.WithUser(r.Context(), admin)))
+	}))
+
+	defer server.Close()
+
+	var r *http.Request
+	var err error
+
+	if method == http.MethodGet {
+		r, err = http.NewRequest(method, server.URL+"/api/graphql?query="+url.QueryEscape(query), nil)
+	} else {
+		js, _ := json.Marshal(request{Query: query})
+		r, err = http.NewRequest(method, server.URL+"/api/graphql", bytes.NewReader(js))
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method == http.MethodGet {
+		r.Header.Set("Accept", "text/event-stream")
+	} else {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestTaskQueryOverGet(t *testing.T) {
+	body := send(t, http.MethodGet, `query { task(id: "1") { title } }`)
+
+	next := strings.Index(body, "event: next\ndata: ")
+	complete := strings.Index(body, "event: complete")
+
+	if next < 0 || complete < next || !strings.Contains(body, `"title":"Task"`) || strings.Contains(body, "errors") {
+		t.Errorf("got %q, want the task followed by complete", body)
+	}
+}
+
+func TestMutationsOverGetAreRefused(t *testing.T) {
+	body := send(t, http.MethodGet, `mutation { deleteTask(id: "1") }`)
+
+	if !strings.Contains(body, "Mutations must be sent with POST") {
+		t.Errorf("got %q, want the mutation refused", body)
+	}
+}
+
+func TestInvalidTasksAreRefused(t *testing.T) {
+	mutations := map[string]string{
+		"blank title":       `mutation { createTask(input: {title: "  ", priority: 1}) { id } }`,
+		"negative priority": `mutation { createTask(input: {title: "Task", priority: -1}) { id } }`,
+		"blank patch":       `mutation { updateTask(id: "1", patch: {title: ""}) { id } }`,
+		"negative patch":    `mutation { updateTask(id: "1", patch: {priority: -2}) { id } }`,
+	}
+
+	for name, mutation := range mutations {
+		t.Run(name, func(t *testing.T) {
+			body := send(t, http.MethodPost, mutation)
+
+			if !strings.Contains(body, "Invalid task") {
+				t.Errorf("got %s, want the task refused", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// batchWait is how long a loader waits for more keys before querying the
+// database, the resolvers of a list run concurrently so their keys arrive
+// together
+const batchWait = 2 * time.Millisecond
+
+// deliveriesKey selects the latest deliveries of a webhook
+type deliveriesKey struct {
+	WebhookID int
+	Limit     int
+}
+
+// loaders batch the rows loaded while resolving a request, so a list of
+// webhooks and their deliveries is two queries instead of one per webhook
+type loaders struct {
+	tasks      *dataloader.Loader[int, *model.Task]
+	webhooks   *dataloader.Loader[int, *model.Webhook]
+	deliveries *dataloader.Loader[deliveriesKey, []model.WebhookDelivery]
+}
+
+type loadersKey struct{}
+
+// newLoaders creates the loaders of a request, their cache lives as long
+// as the request
+func newLoaders(cfg Config) *loaders {
+	return &loaders{
+		tasks: dataloader.NewBatchedLoader(func(ctx context.Context, ids []int) []*dataloader.Result[*model.Task] {
+			tasks, err := db.GetTasks(ctx, cfg.DB, ids)
+
+			byID := map[int]*model.Task{}
+
+			for i := range tasks {
+				byID[tasks[i].ID] = &tasks[i]
+			}
+
+			return results(ids, err, func(id int) *model.Task { return byID[id] })
+		}, dataloader.WithWait[int, *model.Task](batchWait)),
+
+		webhooks: dataloader.NewBatchedLoader(func(ctx context.Context, ids []int) []*dataloader.Result[*model.Webhook] {
+			hooks, err := db.GetWebhooks(ctx, cfg.DB, ids)
+
+			byID := map[int]*model.Webhook{}
+
+			for i := range hooks {
+				byID[hooks[i].ID] = &hooks[i]
+			}
+
+			return results(ids, err, func(id int) *model.Webhook { return byID[id] })
+		}, dataloader.WithWait[int, *model.Webhook](batchWait)),
+
+		deliveries: dataloader.NewBatchedLoader(func(ctx context.Context, keys []deliveriesKey) []*dataloader.Result[[]model.WebhookDelivery] {
+			// a single query returns enough deliveries for the largest limit
+			limit := 0
+			ids := make([]int, 0, len(keys))
+
+			for _, key := range keys {
+				ids = append(ids, key.WebhookID)
+
+				if key.Limit > limit {
+					limit = key.Limit
+				}
+			}
+
+			deliveries, err := db.GetDeliveriesOfWebhooks(ctx, cfg.DB, ids, limit)
+
+			byWebhook := map[int][]model.WebhookDelivery{}
+
+			for _, d := range deliveries {
+				byWebhook[d.WebhookID] = append(byWebhook[d.WebhookID], d)
+			}
+
+			return results(keys, err, func(key deliveriesKey) []model.WebhookDelivery {
+				found := byWebhook[key.WebhookID]
+
+				if len(found) > key.Limit {
+					found = found[:key.Limit]
+				}
+
+				return found
+			})
+		}, dataloader.WithWait[deliveriesKey, []model.WebhookDelivery](batchWait)),
+	}
+}
+
+// results returns the value of each key in order, or the error of the
+// batch for every key
+func results[K comparable, V any](keys []K, err error, value func(K) V) []*dataloader.Result[V] {
+	res := make([]*dataloader.Result[V], len(keys))
+
+	for i, key := range keys {
+		if err != nil {
+			res[i] = &dataloader.Result[V]{Error: err}
+			continue
+		}
+
+		res[i] = &dataloader.Result[V]{Data: value(key)}
+	}
+
+	return res
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,691 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+const (
+	// defaultPageSize is how many items are returned when first is not set
+	defaultPageSize = 50
+
+	// maxPageSize is the most items returned at once
+	maxPageSize = 500
+)
+
+// resolver is the root of the schema
+type resolver struct {
+	cfg Config
+}
+
+// parseID reads the id of a row
+func parseID(id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid id %q", id)
+	}
+
+	return n, nil
+}
+
+func formatID(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+// validate checks a task with the rules of the other apis
+func validate(task model.Task) error {
+	violations := model.ValidateTask(task)
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	details := make([]string, len(violations))
+
+	for i, v := range violations {
+		details[i] = v.Pointer + ": " + v.Detail
+	}
+
+	return fmt.Errorf("Invalid task, %s", strings.Join(details, ", "))
+}
+
+// pageSize checks how many items are asked for
+func pageSize(first int32) (int, error) {
+	if first < 1 || first > maxPageSize {
+		return 0, fmt.Errorf("first must be between 1 and %d", maxPageSize)
+	}
+
+	return int(first), nil
+}
+
+// encodeCursor returns the opaque cursor of the task
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("task:" + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err == nil {
+		if id, found := strings.CutPrefix(string(b), "task:"); found {
+			return strconv.Atoi(id)
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid cursor %q", cursor)
+}
+
+func optionalTime(t *graphql.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	return &t.Time
+}
+
+// Task resolves task(id)
+func (r *resolver) Task(ctx context.Context, args struct{ ID graphql.ID }) (*taskResolver, error) {
+	id, err := parseID(args.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := loadersFrom(ctx).tasks.Load(ctx, id)()
+
+	if err != nil || task == nil {
+		return nil, err
+	}
+
+	return &taskResolver{*task}, nil
+}
+
+type taskFilterInput struct {
+	Complete  *bool
+	Search    *string
+	DueBefore *graphql.Time
+	DueAfter  *graphql.Time
+	ListID    *graphql.ID
+}
+
+// Tasks resolves tasks(filter, first, after)
+func (r *resolver) Tasks(ctx context.Context, args struct {
+	Filter *taskFilterInput
+	First  int32
+	After  *string
+}) (*taskConnectionResolver, error) {
+	first, err := pageSize(args.First)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after := 0
+
+	if args.After != nil {
+		after, err = decodeCursor(*args.After)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filter := db.TaskFilter{}
+
+	if f := args.Filter; f != nil {
+		filter.Complete = f.Complete
+		filter.DueBefore = optionalTime(f.DueBefore)
+		filter.DueAfter = optionalTime(f.DueAfter)
+
+		if f.Search != nil {
+			filter.Search = *f.Search
+		}
+
+		if f.ListID != nil {
+			filter.ListID, err = parseID(*f.ListID)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// one more task tells if there is a next page
+	tasks, err := db.FindTasks(ctx, r.cfg.DB, filter, after, first+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &taskConnectionResolver{cfg: r.cfg, filter: filter, hasNext: len(tasks) > first}
+
+	if conn.hasNext {
+		tasks = tasks[:first]
+	}
+
+	conn.tasks = tasks
+
+	return conn, nil
+}
+
+// Webhook resolves webhook(id)
+func (r *resolver) Webhook(ctx context.Context, args struct{ ID graphql.ID }) (*webhookResolver, error) {
+	id, err := parseID(args.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := loadersFrom(ctx).webhooks.Load(ctx, id)()
+
+	if err != nil || hook == nil {
+		return nil, err
+	}
+
+	return &webhookResolver{*hook}, nil
+}
+
+// Webhooks resolves webhooks
+func (r *resolver) Webhooks(ctx context.Context) ([]*webhookResolver, error) {
+	hooks, err := db.GetAllWebhooks(ctx, r.cfg.DB)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*webhookResolver, len(hooks))
+
+	for i, hook := range hooks {
+		loadersFrom(ctx).webhooks.Prime(ctx, hook.ID, &hooks[i])
+		res[i] = &webhookResolver{hook}
+	}
+
+	return res, nil
+}
+
+// CalendarFeeds resolves calendarFeeds
+func (r *resolver) CalendarFeeds(ctx context.Context) ([]*calendarFeedResolver, error) {
+	feeds, err := db.GetCalendarFeeds(ctx, r.cfg.DB)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*calendarFeedResolver, len(feeds))
+
+	for i, feed := range feeds {
+		res[i] = &calendarFeedResolver{feed}
+	}
+
+	return res, nil
+}
+
+type taskInput struct {
+	Title    string
+	Priority int32
+	Complete bool
+	Due      *graphql.Time
+	ListID   *graphql.ID
+}
+
+// CreateTask resolves createTask(input)
+func (r *resolver) CreateTask(ctx context.Context, args struct{ Input taskInput }) (*taskResolver, error) {
+	if err := checkWritable(ctx); err != nil {
+		return nil, err
+	}
+
+	task := model.Task{
+		Title:    args.Input.Title,
+		Priority: int(args.Input.Priority),
+		Complete: args.Input.Complete,
+		Due:      optionalTime(args.Input.Due),
+	}
+
+	if args.Input.ListID != nil {
+		listID, err := parseID(*args.Input.ListID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		task.ListID = listID
+	}
+
+	if err := validate(task); err != nil {
+		return nil, err
+	}
+
+	task, err := db.AddTask(ctx, r.cfg.DB, task)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.cfg.Events.Publish(ctx, events.Event{Type: events.TaskCreated, Task: task})
+
+	return &taskResolver{task}, nil
+}
+
+type taskPatch struct {
+	Title    *string
+	Priority *int32
+	Complete *bool
+	Due      graphql.NullTime
+	ListID   *graphql.ID
+}
+
+// UpdateTask resolves updateTask(id, patch)
+func (r *resolver) UpdateTask(ctx context.Context, args struct {
+	ID    graphql.ID
+	Patch taskPatch
+}) (*taskResolver, error) {
+	if err := checkWritable(ctx); err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(args.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// read the task again, the loader may have cached an older version
+	found, err := db.GetTasks(ctx, r.cfg.DB, []int{id})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("Task %d does not exist", id)
+	}
+
+	task := found[0]
+	patch := args.Patch
+
+	if patch.Title != nil {
+		task.Title = *patch.Title
+	}
+
+	if patch.Priority != nil {
+		task.Priority = int(*patch.Priority)
+	}
+
+	if patch.Complete != nil {
+		task.Complete = *patch.Complete
+	}
+
+	if patch.Due.Set {
+		task.Due = optionalTime(patch.Due.Value)
+	}
+
+	if patch.ListID != nil {
+		task.ListID, err = parseID(*patch.ListID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validate(task); err != nil {
+		return nil, err
+	}
+
+	updated, err := db.UpdateTask(ctx, r.cfg.DB, task)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.cfg.Events.Publish(ctx, events.Event{Type: events.TaskUpdated, Task: updated})
+
+	return &taskResolver{updated}, nil
+}
+
+// DeleteTask resolves deleteTask(id)
+func (r *resolver) DeleteTask(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	if err := checkWritable(ctx); err != nil {
+		return "", err
+	}
+
+	id, err := parseID(args.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	deleted, err := db.DeleteTask(ctx, r.cfg.DB, model.Task{ID: id})
+
+	if err != nil {
+		return "", err
+	}
+
+	r.cfg.Events.Publish(ctx, events.Event{Type: events.TaskDeleted, Task: model.Task{ID: id, ListID: deleted.ListID}})
+
+	return args.ID, nil
+}
+
+// TaskChanged resolves the taskChanged(types) subscription, with the
+// events of the broker also used by the task stream, of the lists the user
+// can see
+func (r *resolver) TaskChanged(ctx context.Context, args struct{ Types *[]string }) (<-chan *taskEventResolver, error) {
+	wanted := map[events.Type]bool{}
+
+	if args.Types != nil {
+		for _, t := range *args.Types {
+			wanted[events.Type(strings.ToLower(t))] = true
+		}
+	}
+
+	sub, unsubscribe := r.cfg.Events.Subscribe()
+	visible := events.NewVisibility(ctx, r.cfg.DB)
+	c := make(chan *taskEventResolver)
+
+	go func() {
+		defer unsubscribe()
+		defer close(c)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-sub:
+				if !ok {
+					return
+				}
+
+				// every event goes through Allows, which reloads the lists once they change
+				if !visible.Allows(e) || (len(wanted) > 0 && !wanted[e.Type]) {
+					continue
+				}
+
+				select {
+				case c <- &taskEventResolver{e}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return c, nil
+}
+
+type taskResolver struct {
+	task model.Task
+}
+
+func (t *taskResolver) ID() graphql.ID {
+	return formatID(t.task.ID)
+}
+
+func (t *taskResolver) Priority() int32 {
+	return int32(t.task.Priority)
+}
+
+func (t *taskResolver) Title() string {
+	return t.task.Title
+}
+
+func (t *taskResolver) Complete() bool {
+	return t.task.Complete
+}
+
+func (t *taskResolver) Due() *graphql.Time {
+	if t.task.Due == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: *t.task.Due}
+}
+
+func (t *taskResolver) CompletedAt() *graphql.Time {
+	if t.task.CompletedAt == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: *t.task.CompletedAt}
+}
+
+func (t *taskResolver) ListID() graphql.ID {
+	return formatID(t.task.ListID)
+}
+
+type taskConnectionResolver struct {
+	cfg     Config
+	filter  db.TaskFilter
+	tasks   []model.Task
+	hasNext bool
+}
+
+func (c *taskConnectionResolver) Edges() []*taskEdgeResolver {
+	edges := make([]*taskEdgeResolver, len(c.tasks))
+
+	for i, task := range c.tasks {
+		edges[i] = &taskEdgeResolver{task}
+	}
+
+	return edges
+}
+
+func (c *taskConnectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNext: c.hasNext}
+
+	if len(c.tasks) > 0 {
+		cursor := encodeCursor(c.tasks[len(c.tasks)-1].ID)
+		info.endCursor = &cursor
+	}
+
+	return info
+}
+
+// TotalCount is only counted when it is asked for
+func (c *taskConnectionResolver) TotalCount(ctx context.Context) (int32, error) {
+	count, err := db.CountMatchingTasks(ctx, c.cfg.DB, c.filter)
+
+	return int32(count), err
+}
+
+type taskEdgeResolver struct {
+	task model.Task
+}
+
+func (e *taskEdgeResolver) Cursor() string {
+	return encodeCursor(e.task.ID)
+}
+
+func (e *taskEdgeResolver) Node() *taskResolver {
+	return &taskResolver{e.task}
+}
+
+type pageInfoResolver struct {
+	hasNext   bool
+	endCursor *string
+}
+
+func (p *pageInfoResolver) HasNextPage() bool {
+	return p.hasNext
+}
+
+func (p *pageInfoResolver) EndCursor() *string {
+	return p.endCursor
+}
+
+type taskEventResolver struct {
+	event events.Event
+}
+
+func (e *taskEventResolver) Type() string {
+	return strings.ToUpper(string(e.event.Type))
+}
+
+func (e *taskEventResolver) Task() *taskResolver {
+	return &taskResolver{e.event.Task}
+}
+
+type webhookResolver struct {
+	hook model.Webhook
+}
+
+func (w *webhookResolver) ID() graphql.ID {
+	return formatID(w.hook.ID)
+}
+
+func (w *webhookResolver) URL() string {
+	return w.hook.URL
+}
+
+func (w *webhookResolver) Events() []string {
+	return w.hook.Events
+}
+
+func (w *webhookResolver) Active() bool {
+	return w.hook.Active
+}
+
+// Deliveries are loaded for every webhook of the request at once
+func (w *webhookResolver) Deliveries(ctx context.Context, args struct{ First int32 }) ([]*deliveryResolver, error) {
+	first, err := pageSize(args.First)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := loadersFrom(ctx).deliveries.Load(ctx, deliveriesKey{WebhookID: w.hook.ID, Limit: first})()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*deliveryResolver, len(deliveries))
+
+	for i, d := range deliveries {
+		res[i] = &deliveryResolver{d}
+	}
+
+	return res, nil
+}
+
+type deliveryResolver struct {
+	d model.WebhookDelivery
+}
+
+func (d *deliveryResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatInt(d.d.ID, 10))
+}
+
+// Webhook is loaded for every delivery of the request at once
+func (d *deliveryResolver) Webhook(ctx context.Context) (*webhookResolver, error) {
+	hook, err := loadersFrom(ctx).webhooks.Load(ctx, d.d.WebhookID)()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hook == nil {
+		return nil, fmt.Errorf("Webhook %d does not exist", d.d.WebhookID)
+	}
+
+	return &webhookResolver{*hook}, nil
+}
+
+func (d *deliveryResolver) Event() string {
+	return d.d.Event
+}
+
+func (d *deliveryResolver) Payload() string {
+	return d.d.Payload
+}
+
+func (d *deliveryResolver) Status() string {
+	return d.d.Status
+}
+
+func (d *deliveryResolver) Attempts() int32 {
+	return int32(d.d.Attempts)
+}
+
+func (d *deliveryResolver) NextAttemptAt() graphql.Time {
+	return graphql.Time{Time: d.d.NextAttemptAt}
+}
+
+func (d *deliveryResolver) LastError() *string {
+	if d.d.LastError == "" {
+		return nil
+	}
+
+	return &d.d.LastError
+}
+
+func (d *deliveryResolver) ResponseStatus() *int32 {
+	if d.d.ResponseStatus == 0 {
+		return nil
+	}
+
+	status := int32(d.d.ResponseStatus)
+
+	return &status
+}
+
+func (d *deliveryResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: d.d.CreatedAt}
+}
+
+func (d *deliveryResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: d.d.UpdatedAt}
+}
+
+type calendarFeedResolver struct {
+	feed model.CalendarFeed
+}
+
+func (f *calendarFeedResolver) ID() graphql.ID {
+	return formatID(f.feed.ID)
+}
+
+func (f *calendarFeedResolver) Name() string {
+	return f.feed.Name
+}
+
+func (f *calendarFeedResolver) ListID() *graphql.ID {
+	if f.feed.ListID == 0 {
+		return nil
+	}
+
+	id := formatID(f.feed.ListID)
+	return &id
+}
+
+func (f *calendarFeedResolver) UserID() graphql.ID {
+	return formatID(f.feed.UserID)
+}
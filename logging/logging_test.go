@@ -0,0 +1,139 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// records are the JSON records logged in buf
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var logged []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		record := map[string]interface{}{}
+
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+
+		logged = append(logged, record)
+	}
+
+	return logged
+}
+
+func TestRequestIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Format: "json", Level: "info"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-42")
+
+	if RequestID(ctx) != "req-42" || RequestID(context.Background()) != "" {
+		t.Fatal("the context does not carry the request id")
+	}
+
+	logger.InfoContext(ctx, "with an id")
+	logger.InfoContext(context.Background(), "without an id")
+	logger.With("user", "ada").WithGroup("task").InfoContext(ctx, "derived", "id", 7)
+
+	logged := records(t, &buf)
+
+	if len(logged) != 3 {
+		t.Fatalf("got %d records, want 3", len(logged))
+	}
+
+	if logged[0]["request_id"] != "req-42" {
+		t.Errorf("got %v, want the request id", logged[0])
+	}
+
+	if _, ok := logged[1]["request_id"]; ok {
+		t.Errorf("got %v, want no request id", logged[1])
+	}
+
+	// the loggers derived from it add the id too, in the group of the
+	// record
+	group, _ := logged[2]["task"].(map[string]interface{})
+
+	if logged[2]["user"] != "ada" || group["request_id"] != "req-42" || group["id"] != 7.0 {
+		t.Errorf("got %v, want the request id of the derived logger", logged[2])
+	}
+}
+
+func TestTraceIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, Config{Format: "json", Level: "info"})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	logger.InfoContext(ctx, "traced")
+
+	record := records(t, &buf)[0]
+
+	if record["trace_id"] != traceID.String() || record["span_id"] != spanID.String() {
+		t.Errorf("got %v, want the trace and the span", record)
+	}
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Format: "TEXT", Level: "warn"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "hidden")
+	logger.WarnContext(WithRequestID(context.Background(), "req-2"), "shown")
+
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=WARN msg=shown request_id=req-2") {
+		t.Errorf("got %q, want only the warning, with its request id", got)
+	}
+
+	invalid := []Config{
+		{Format: "xml", Level: "info"},
+		{Format: "json", Level: "verbose"},
+	}
+
+	for _, cfg := range invalid {
+		if _, err := New(&buf, cfg); err == nil {
+			t.Errorf("%+v: no error", cfg)
+		}
+	}
+}
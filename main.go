@@ -21,11 +21,6 @@
 // Servian Tech Challenge Application
 //
 // This application is used as part of the Servian Technical Assessment.
-//
-//     Version: 1.0
-//     Contact: Thomas Winsnes<thomas.winsnes@servian.com> https://www.servian.com
-//
-// swagger:meta
 package main
 
 import "github.com/servian/TechChallengeApp/cmd"
@@ -0,0 +1,43 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+// A calendar feed, its secret token gives read only access to the tasks
+// the user of the feed can see, as an iCalendar feed
+type CalendarFeed struct {
+	// the id of the feed
+	ID int `json:"id"`
+
+	// Who or what the feed is for
+	Name string `json:"name"`
+
+	// The list the feed shows, every list its user can see when 0
+	ListID int `json:"listId"`
+
+	// The user the feed shows the tasks of, the user who created it
+	UserID int `json:"userId"`
+
+	// The secret part of the feed url, only returned when the feed is created
+	Token string `json:"token,omitempty"`
+
+	// Path of the feed, only returned when the feed is created
+	URL string `json:"url,omitempty"`
+}
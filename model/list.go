@@ -0,0 +1,55 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+// A list of tasks. A list without members is open to every user, with the
+// role of the user, a list with members only to them
+type List struct {
+	// the id of the list
+	ID int `json:"id"`
+
+	// The name of the list
+	Name string `json:"name"`
+
+	// Is the list only open to its members
+	Shared bool `json:"shared"`
+
+	// What the current user can do with the list
+	Role string `json:"role,omitempty"`
+}
+
+// A member of a list, a user or a group of users
+type Member struct {
+	// the id of the membership
+	ID int `json:"id"`
+
+	// The list the member belongs to
+	ListID int `json:"listId"`
+
+	// The name of the user, empty for a group
+	User string `json:"user,omitempty"`
+
+	// The group, as given by the identity provider, empty for a user
+	Group string `json:"group,omitempty"`
+
+	// What the member can do with the list: viewer, editor or admin
+	Role string `json:"role"`
+}
@@ -20,23 +20,62 @@
 
 package model
 
+import (
+	"strings"
+	"time"
+)
+
 // A task
-// swagger:model
 type Task struct {
 	// the id of the task
-	// required: true
-	// min: 0
 	ID int `json:"id"`
 
 	// Where the task fits in the list
-	// required: true
-	// min: 0
 	Priority int `json:"priority"`
 
 	// The task name or description
-	// required: true
 	Title string `json:"title"`
 
 	// Is the task finished
 	Complete bool `json:"complete"`
+
+	// When the task has to be finished by
+	Due *time.Time `json:"due,omitempty"`
+
+	// When the task was finished, set when it is marked complete
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+
+	// The list of the task, the first list the user can edit when 0
+	ListID int `json:"listId"`
+}
+
+// Violation is a value of a task that breaks the rules every api checks
+type Violation struct {
+	// Pointer is the JSON pointer of the value, e.g. #/priority
+	Pointer string
+	Detail  string
+}
+
+// ValidateTask checks a task with the rules of the Task schema of the REST
+// api, so the other transports store the same tasks
+func ValidateTask(task Task) []Violation {
+	var violations []Violation
+
+	if task.ID < 0 {
+		violations = append(violations, Violation{Pointer: "#/id", Detail: "number must be at least 0"})
+	}
+
+	if task.Priority < 0 {
+		violations = append(violations, Violation{Pointer: "#/priority", Detail: "number must be at least 0"})
+	}
+
+	if strings.TrimSpace(task.Title) == "" {
+		violations = append(violations, Violation{Pointer: "#/title", Detail: "the title must not be blank"})
+	}
+
+	if task.ListID < 0 {
+		violations = append(violations, Violation{Pointer: "#/listId", Detail: "number must be at least 0"})
+	}
+
+	return violations
 }
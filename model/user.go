@@ -0,0 +1,71 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import "time"
+
+// A user of the web UI and the api
+type User struct {
+	// the id of the user
+	ID int `json:"id"`
+
+	// The name the user signs in with
+	Name string `json:"name"`
+
+	// What the user can do: viewer, editor or admin
+	Role string `json:"role"`
+
+	// The groups of the user, given by the identity provider
+	Groups []string `json:"groups"`
+}
+
+// Roles of the users, each one can do what the previous ones can
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Roles are the roles of the users, from the least to the most powerful
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// RoleRank orders the roles, 0 is not a role
+func RoleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// A session of a user signed in to the web UI, its id is only known to the
+// browser of the user, in an encrypted cookie
+type Session struct {
+	ID     string
+	UserID int
+
+	// CSRF is the token the scripts of the web UI send back in a header
+	CSRF string
+
+	Expires time.Time
+}
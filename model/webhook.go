@@ -0,0 +1,97 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package model
+
+import "time"
+
+// Task events delivered to the webhooks
+const (
+	EventTaskCreated = "created"
+	EventTaskUpdated = "updated"
+	EventTaskDeleted = "deleted"
+)
+
+// WebhookPayload is the body posted to webhooks
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	Task      Task      `json:"task"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// A webhook subscription, events are posted to the url when tasks change
+type Webhook struct {
+	// the id of the webhook
+	ID int `json:"id"`
+
+	// Where the events are posted to
+	URL string `json:"url"`
+
+	// Key used to sign the payloads with HMAC-SHA256, generated when empty.
+	// Only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+
+	// The task events to deliver (created, updated, deleted), all events
+	// are delivered when empty
+	Events []string `json:"events"`
+
+	// Is the webhook receiving events
+	Active bool `json:"active"`
+}
+
+// An attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	// the id of the delivery
+	ID int64 `json:"id"`
+
+	// the webhook the event is delivered to
+	WebhookID int `json:"webhookId"`
+
+	// The task event being delivered
+	Event string `json:"event"`
+
+	// The body posted to the webhook
+	Payload string `json:"payload"`
+
+	// pending, delivered, or dead once every attempt failed
+	Status string `json:"status"`
+
+	// How many times the delivery was attempted
+	Attempts int `json:"attempts"`
+
+	// When the next attempt happens, while pending
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+
+	// Why the last attempt failed
+	LastError string `json:"lastError,omitempty"`
+
+	// HTTP status returned by the last attempt
+	ResponseStatus int `json:"responseStatus,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,184 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package rpc
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+)
+
+// publicServices are the services anyone can call when authentication is
+// required, probes and tools do not carry tokens
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.",
+}
+
+func public(method string) bool {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticate returns the context of a call with the user of the api token
+// sent as a bearer token in the authorization metadata. Calls without a
+// token are anonymous, unless authentication is required. The addresses
+// sending too many invalid tokens are refused before their tokens are
+// looked up, like on the HTTP api
+func (s *taskServer) authenticate(ctx context.Context, method string) (context.Context, error) {
+	var header string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	if header == "" {
+		if s.cfg.AuthRequired && !public(method) {
+			return nil, status.Error(codes.Unauthenticated, "Send an api token as a bearer token in the authorization metadata")
+		}
+
+		return ctx, nil
+	}
+
+	ip := peerIP(ctx)
+
+	if err := s.throttled(ip); err != nil {
+		return nil, err
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+
+	if !ok {
+		s.failed(ip)
+		return nil, status.Error(codes.Unauthenticated, "Only bearer tokens are accepted in authorization")
+	}
+
+	user, err := db.GetUserByToken(ctx, s.cfg.DB, strings.TrimSpace(token))
+
+	if err == db.ErrNotFound {
+		s.failed(ip)
+		return nil, status.Error(codes.Unauthenticated, "The bearer token is invalid")
+	}
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Could not check the bearer token")
+	}
+
+	return access.WithUser(ctx, user), nil
+}
+
+// peerIP is the address of the client of the call, gRPC clients connect
+// directly as there is no X-Forwarded-For to trust
+func peerIP(ctx context.Context) netip.Addr {
+	p, ok := peer.FromContext(ctx)
+
+	if !ok {
+		return netip.Addr{}
+	}
+
+	addr, err := netip.ParseAddrPort(p.Addr.String())
+
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addr.Addr().Unmap()
+}
+
+// throttled refuses the calls of the addresses that sent as many invalid
+// tokens as the burst of the rate limit, with the time to wait as the
+// RetryInfo of the status
+func (s *taskServer) throttled(ip netip.Addr) error {
+	if s.cfg.Failures == nil {
+		return nil
+	}
+
+	delay := s.cfg.Failures.Delay(ip, time.Now())
+
+	if delay <= 0 {
+		return nil
+	}
+
+	st, err := status.New(codes.ResourceExhausted, "Too many invalid tokens, retry after the delay of the RetryInfo").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "Too many invalid tokens")
+	}
+
+	return st.Err()
+}
+
+// failed counts an invalid token sent from the address
+func (s *taskServer) failed(ip netip.Addr) {
+	if s.cfg.Failures != nil {
+		s.cfg.Failures.Failed(ip)
+	}
+}
+
+func (s *taskServer) authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *taskServer) authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream is a stream whose context carries its user
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
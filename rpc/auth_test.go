@@ -0,0 +1,145 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/ui"
+)
+
+func TestAuthenticate(t *testing.T) {
+	const createTask = "/techchallengeapp.task.v1.TaskService/CreateTask"
+
+	tests := []struct {
+		name     string
+		required bool
+		method   string
+		header   string
+		want     codes.Code
+	}{
+		{"anonymous", false, createTask, "", codes.OK},
+		{"anonymous when required", true, createTask, "", codes.Unauthenticated},
+		{"health when required", true, "/grpc.health.v1.Health/Check", "", codes.OK},
+		{"reflection when required", true, "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", "", codes.OK},
+		{"basic credentials", false, createTask, "Basic YWxpY2U6c2VjcmV0", codes.Unauthenticated},
+		{"basic credentials when required", true, createTask, "Basic YWxpY2U6c2VjcmV0", codes.Unauthenticated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &taskServer{cfg: Config{AuthRequired: test.required}}
+			ctx := context.Background()
+
+			if test.header != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", test.header))
+			}
+
+			called := false
+
+			_, err := s.authUnary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+
+				if access.From(ctx).User != nil {
+					t.Error("an anonymous call has a user")
+				}
+
+				return nil, nil
+			})
+
+			if code := status.Code(err); code != test.want {
+				t.Fatalf("code %s, want %s", code, test.want)
+			}
+
+			if called != (test.want == codes.OK) {
+				t.Errorf("handler called %t", called)
+			}
+		})
+	}
+}
+
+func TestInvalidTokensAreThrottled(t *testing.T) {
+	failures := ui.NewFailures(ui.RateLimit{Rate: 0.01, Burst: 2})
+	s := &taskServer{cfg: Config{Failures: failures}}
+
+	call := func(addr string, header string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))})
+
+		if header != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", header))
+		}
+
+		_, err := s.authUnary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/techchallengeapp.task.v1.TaskService/ListTasks"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := status.Code(call("192.0.2.1:1234", "Basic YWxpY2U6c2VjcmV0")); code != codes.Unauthenticated {
+			t.Fatalf("invalid token %d: %s, want %s", i, code, codes.Unauthenticated)
+		}
+	}
+
+	err := call("192.0.2.1:1234", "Basic YWxpY2U6c2VjcmV0")
+	st := status.Convert(err)
+
+	if st.Code() != codes.ResourceExhausted || len(st.Details()) != 1 {
+		t.Fatalf("token over the burst: %v, want %s with a RetryInfo", err, codes.ResourceExhausted)
+	}
+
+	if retry, ok := st.Details()[0].(*errdetails.RetryInfo); !ok || retry.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("details %v, want a delay", st.Details())
+	}
+
+	if err := call("192.0.2.1:1234", ""); err != nil {
+		t.Errorf("anonymous call of the same address: %v", err)
+	}
+
+	if code := status.Code(call("192.0.2.2:1234", "Basic YWxpY2U6c2VjcmV0")); code != codes.Unauthenticated {
+		t.Errorf("invalid token of another address: %s, want %s", code, codes.Unauthenticated)
+	}
+
+	// the failures on the HTTP api count too
+	failures.Failed(netip.MustParseAddr("192.0.2.3"))
+	failures.Failed(netip.MustParseAddr("192.0.2.3"))
+
+	if code := status.Code(call("192.0.2.3:1234", "Bearer token")); code != codes.ResourceExhausted {
+		t.Errorf("token after the failures of the HTTP api: %s, want %s", code, codes.ResourceExhausted)
+	}
+
+	if delay := failures.Delay(netip.MustParseAddr("192.0.2.2"), time.Now()); delay != 0 {
+		t.Errorf("an address with a single failure waits %s", delay)
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package rpc serves the tasks as the gRPC TaskService, with the standard
+// health and reflection services
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/servian/TechChallengeApp/rpc/taskpb"
+	"github.com/servian/TechChallengeApp/ui"
+)
+
+const (
+	// defaultPageSize is how many tasks are listed when the page size is 0
+	defaultPageSize = 50
+
+	// maxPageSize is the most tasks listed at once
+	maxPageSize = 500
+
+	// healthInterval is how often the database is checked for the health service
+	healthInterval = 10 * time.Second
+)
+
+// Config configuration for the rpc package
+type Config struct {
+	DB     db.Config
+	Events *events.Broker
+
+	// AuthRequired refuses the calls without an api token, anonymous
+	// calls are accepted otherwise
+	AuthRequired bool
+
+	// Failures throttles the addresses sending invalid tokens, the ones of
+	// the HTTP api so both are limited together. Nothing is throttled when
+	// nil
+	Failures *ui.Failures
+}
+
+// Start serves the gRPC api on the listener, the returned function stops
+// the server once the calls in progress are done
+func Start(cfg Config, listener net.Listener) func() {
+	tasks := &taskServer{cfg: cfg}
+
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(logUnary, tasks.authUnary),
+		grpc.ChainStreamInterceptor(logStream, tasks.authStream),
+	)
+
+	taskpb.RegisterTaskServiceServer(server, tasks)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go watchHealth(ctx, cfg, healthServer)
+
+	go server.Serve(listener)
+
+	return func() {
+		cancel()
+		healthServer.Shutdown()
+		server.GracefulStop()
+	}
+}
+
+// watchHealth reports the server as serving while the database answers,
+// like /readyz does
+func watchHealth(ctx context.Context, cfg Config, healthServer *health.Server) {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := db.Ping(pingCtx, cfg.DB)
+		cancel()
+
+		serving := healthpb.HealthCheckResponse_SERVING
+
+		if err != nil {
+			slog.Warn("The database is not answering, gRPC health is not serving", "error", err)
+			serving = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		healthServer.SetServingStatus("", serving)
+		healthServer.SetServingStatus(taskpb.TaskService_ServiceDesc.ServiceName, serving)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+func logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(ss.Context(), info.FullMethod, start, err)
+
+	return err
+}
+
+// logCall logs a call once handled, like the access log of the http server
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+
+	if code == codes.Internal || code == codes.Unknown {
+		level = slog.LevelError
+	}
+
+	slog.Log(ctx, level, "gRPC call", "method", method, "code", code.String(), "duration", time.Since(start), "error", err)
+}
+
+type taskServer struct {
+	taskpb.UnimplementedTaskServiceServer
+	cfg Config
+}
+
+func toProto(task model.Task) *taskpb.Task {
+	t := &taskpb.Task{
+		Id:       int64(task.ID),
+		Priority: int32(task.Priority),
+		Title:    task.Title,
+		Complete: task.Complete,
+		ListId:   int64(task.ListID),
+	}
+
+	if task.Due != nil {
+		t.Due = timestamppb.New(*task.Due)
+	}
+
+	if task.CompletedAt != nil {
+		t.CompletedAt = timestamppb.New(*task.CompletedAt)
+	}
+
+	return t
+}
+
+func optionalTime(t *timestamppb.Timestamp) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	value := t.AsTime()
+
+	return &value
+}
+
+// validate checks a task with the rules of the REST api, the violations
+// are returned as the field violations of a BadRequest
+func validate(task model.Task) error {
+	violations := model.ValidateTask(task)
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	badRequest := &errdetails.BadRequest{}
+
+	for _, v := range violations {
+		field := "task"
+
+		for _, token := range strings.Split(strings.TrimPrefix(v.Pointer, "#"), "/") {
+			if token != "" {
+				field += "." + token
+			}
+		}
+
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Detail,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, "The task is invalid").WithDetails(badRequest)
+
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "The task is invalid")
+	}
+
+	return st.Err()
+}
+
+// dbError is the status of an error of the db package, PERMISSION_DENIED
+// when the role of the client does not allow the call
+func dbError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, access.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+// getTask reads a task, NOT_FOUND when it does not exist
+func (s *taskServer) getTask(ctx context.Context, id int64) (model.Task, error) {
+	if id < 0 {
+		return model.Task{}, status.Errorf(codes.InvalidArgument, "Invalid id %d", id)
+	}
+
+	tasks, err := db.GetTasks(ctx, s.cfg.DB, []int{int(id)})
+
+	if err != nil {
+		return model.Task{}, status.Error(codes.Internal, err.Error())
+	}
+
+	if len(tasks) == 0 {
+		return model.Task{}, status.Errorf(codes.NotFound, "Task %d does not exist", id)
+	}
+
+	return tasks[0], nil
+}
+
+func (s *taskServer) GetTask(ctx context.Context, req *taskpb.GetTaskRequest) (*taskpb.Task, error) {
+	task, err := s.getTask(ctx, req.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toProto(task), nil
+}
+
+// encodePageToken returns the opaque token of the page after the task
+func encodePageToken(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("task:" + strconv.Itoa(id)))
+}
+
+func decodePageToken(token string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err == nil {
+		if id, found := strings.CutPrefix(string(b), "task:"); found {
+			return strconv.Atoi(id)
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid page token %q", token)
+}
+
+func (s *taskServer) ListTasks(ctx context.Context, req *taskpb.ListTasksRequest) (*taskpb.ListTasksResponse, error) {
+	size := int(req.PageSize)
+
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	if size < 1 || size > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d", maxPageSize)
+	}
+
+	after := 0
+
+	if req.PageToken != "" {
+		var err error
+		after, err = decodePageToken(req.PageToken)
+
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	filter := db.TaskFilter{
+		Complete:  req.Complete,
+		Search:    req.Search,
+		DueBefore: optionalTime(req.DueBefore),
+		DueAfter:  optionalTime(req.DueAfter),
+		ListID:    int(req.ListId),
+	}
+
+	// one more task tells if there is a next page
+	tasks, err := db.FindTasks(ctx, s.cfg.DB, filter, after, size+1)
+
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	count, err := db.CountMatchingTasks(ctx, s.cfg.DB, filter)
+
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	resp := &taskpb.ListTasksResponse{TotalSize: int32(count)}
+
+	if len(tasks) > size {
+		tasks = tasks[:size]
+		resp.NextPageToken = encodePageToken(tasks[size-1].ID)
+	}
+
+	for _, task := range tasks {
+		resp.Tasks = append(resp.Tasks, toProto(task))
+	}
+
+	return resp, nil
+}
+
+func (s *taskServer) CreateTask(ctx context.Context, req *taskpb.CreateTaskRequest) (*taskpb.Task, error) {
+	if req.Task == nil {
+		return nil, status.Error(codes.InvalidArgument, "The task is missing")
+	}
+
+	task := model.Task{
+		Priority: int(req.Task.Priority),
+		Title:    req.Task.Title,
+		Complete: req.Task.Complete,
+		Due:      optionalTime(req.Task.Due),
+		ListID:   int(req.Task.ListId),
+	}
+
+	err := validate(task)
+
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := db.AddTask(ctx, s.cfg.DB, task)
+
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	s.cfg.Events.Publish(ctx, events.Event{Type: events.TaskCreated, Task: created})
+
+	return toProto(created), nil
+}
+
+func (s *taskServer) UpdateTask(ctx context.Context, req *taskpb.UpdateTaskRequest) (*taskpb.Task, error) {
+	if req.Task == nil {
+		return nil, status.Error(codes.InvalidArgument, "The task is missing")
+	}
+
+	task, err := s.getTask(ctx, req.Task.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := req.UpdateMask.GetPaths()
+
+	if len(paths) == 0 {
+		paths = []string{"title", "priority", "complete", "due", "list_id"}
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "title":
+			task.Title = req.Task.Title
+		case "priority":
+			task.Priority = int(req.Task.Priority)
+		case "complete":
+			task.Complete = req.Task.Complete
+		case "due":
+			task.Due = optionalTime(req.Task.Due)
+		case "list_id":
+			// the task stays in its list when none is given
+			if req.Task.ListId != 0 {
+				task.ListID = int(req.Task.ListId)
+			}
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "%q can not be updated, only title, priority, complete, due and list_id", path)
+		}
+	}
+
+	err = validate(task)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := db.UpdateTask(ctx, s.cfg.DB, task)
+
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	s.cfg.Events.Publish(ctx, events.Event{Type: events.TaskUpdated, Task: updated})
+
+	return toProto(updated), nil
+}
+
+func (s *taskServer) DeleteTask(ctx context.Context, req *taskpb.DeleteTaskRequest) (*emptypb.Empty, error) {
+	task, err := s.getTask(ctx, req.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.DeleteTask(ctx, s.cfg.DB, task)
+
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	s.cfg.Events.Publish(ctx, events.Event{Type: events.TaskDeleted, Task: model.Task{ID: task.ID, ListID: task.ListID}})
+
+	return &emptypb.Empty{}, nil
+}
+
+// eventTypes maps the event types of the broker to the ones of the api
+var eventTypes = map[events.Type]taskpb.TaskEvent_Type{
+	events.TaskCreated: taskpb.TaskEvent_CREATED,
+	events.TaskUpdated: taskpb.TaskEvent_UPDATED,
+	events.TaskDeleted: taskpb.TaskEvent_DELETED,
+}
+
+// WatchTasks streams the events of the broker also used by the task stream,
+// of the tasks of the lists the user can see
+func (s *taskServer) WatchTasks(req *taskpb.WatchTasksRequest, stream taskpb.TaskService_WatchTasksServer) error {
+	wanted := map[taskpb.TaskEvent_Type]bool{}
+
+	for _, t := range req.Types {
+		wanted[t] = true
+	}
+
+	sub, unsubscribe := s.cfg.Events.Subscribe()
+	defer unsubscribe()
+
+	visible := events.NewVisibility(stream.Context(), s.cfg.DB)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-sub:
+			if !ok {
+				return status.Error(codes.Unavailable, "The server is shutting down")
+			}
+
+			if !visible.Allows(e) || (req.ListId != 0 && int64(e.Task.ListID) != req.ListId) {
+				continue
+			}
+
+			t := eventTypes[e.Type]
+
+			if len(wanted) > 0 && !wanted[t] {
+				continue
+			}
+
+			err := stream.Send(&taskpb.TaskEvent{Type: t, Task: toProto(e.Task)})
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
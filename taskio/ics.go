@@ -0,0 +1,347 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package taskio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+const (
+	icsDateTime    = "20060102T150405Z"
+	icsLocalTime   = "20060102T150405"
+	icsDate        = "20060102"
+	icsLineLength  = 75
+	icsUIDSuffix   = "@techchallengeapp"
+	icsProductID   = "-//Servian//TechChallengeApp//EN"
+	icsDefaultName = "To Do"
+)
+
+// icsUID matches the UID given to exported tasks, so importing a feed
+// back keeps the ids
+var icsUID = regexp.MustCompile(`^task-([0-9]+)` + regexp.QuoteMeta(icsUIDSuffix) + `$`)
+
+// icsPriority maps the priority of a task, where lower values come first,
+// to the 1 (highest) to 9 (lowest) range of RFC 5545. 0 is left undefined.
+func icsPriority(priority int) int {
+	switch {
+	case priority <= 0:
+		return 0
+	case priority > 9:
+		return 9
+	}
+
+	return priority
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+var icsTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// icsWriter renders tasks as the VTODO components of an RFC 5545 calendar
+type icsWriter struct {
+	w       io.Writer
+	name    string
+	stamp   time.Time
+	started bool
+	err     error
+}
+
+// NewCalendarWriter creates an iCalendar writer for a calendar with the
+// given name
+func NewCalendarWriter(w io.Writer, name string) Writer {
+	return &icsWriter{w: w, name: name, stamp: time.Now().UTC()}
+}
+
+// line writes a content line, folded to 75 octets as required by RFC 5545,
+// the space starting the continuation lines included
+func (iw *icsWriter) line(name string, value string) {
+	if iw.err != nil {
+		return
+	}
+
+	content := name + ":" + value
+	length := icsLineLength
+
+	var b strings.Builder
+
+	for len(content) > length {
+		// never split a multi-byte character
+		cut := length
+
+		for cut > 0 && !isRuneStart(content[cut]) {
+			cut--
+		}
+
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		length = icsLineLength - 1
+	}
+
+	b.WriteString(content)
+	b.WriteString("\r\n")
+
+	_, iw.err = io.WriteString(iw.w, b.String())
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func (iw *icsWriter) start() {
+	if iw.started {
+		return
+	}
+
+	iw.started = true
+
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", icsProductID)
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("X-WR-CALNAME", icsTextEscaper.Replace(iw.name))
+}
+
+func (iw *icsWriter) Write(task model.Task) error {
+	iw.start()
+
+	iw.line("BEGIN", "VTODO")
+	iw.line("UID", fmt.Sprintf("task-%d%s", task.ID, icsUIDSuffix))
+	iw.line("DTSTAMP", iw.stamp.Format(icsDateTime))
+	iw.line("SUMMARY", icsTextEscaper.Replace(task.Title))
+
+	if priority := icsPriority(task.Priority); priority > 0 {
+		iw.line("PRIORITY", strconv.Itoa(priority))
+	}
+
+	if task.Due != nil {
+		iw.line("DUE", task.Due.UTC().Format(icsDateTime))
+	}
+
+	if task.Complete {
+		iw.line("STATUS", "COMPLETED")
+
+		if task.CompletedAt != nil {
+			iw.line("COMPLETED", task.CompletedAt.UTC().Format(icsDateTime))
+		}
+	} else {
+		iw.line("STATUS", "NEEDS-ACTION")
+	}
+
+	iw.line("END", "VTODO")
+
+	return iw.err
+}
+
+func (iw *icsWriter) Close() error {
+	iw.start()
+	iw.line("END", "VCALENDAR")
+
+	return iw.err
+}
+
+// icsReader reads the VTODO components of an RFC 5545 calendar, every
+// other component is ignored
+type icsReader struct {
+	s    *bufio.Scanner
+	next string
+
+	// line is where the content line returned by unfold starts, nextAt
+	// where the line read ahead starts, and scanned counts the lines read
+	line    int
+	nextAt  int
+	scanned int
+}
+
+// unfold returns the next content line, joining the folded lines
+func (ir *icsReader) unfold() (string, bool) {
+	for ir.s.Scan() {
+		ir.scanned++
+		text := strings.TrimRight(ir.s.Text(), "\r")
+
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			ir.next += text[1:]
+			continue
+		}
+
+		current, at := ir.next, ir.nextAt
+		ir.next, ir.nextAt = text, ir.scanned
+
+		if current != "" {
+			ir.line = at
+			return current, true
+		}
+	}
+
+	current := ir.next
+	ir.line = ir.nextAt
+	ir.next = ""
+
+	return current, current != ""
+}
+
+// icsProperty splits a content line into its name, parameters and value
+func icsProperty(line string) (string, map[string]string, string) {
+	params := make(map[string]string)
+
+	// the value starts at the first colon outside of a quoted parameter
+	quoted := false
+	split := -1
+
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+
+		if r == ':' && !quoted {
+			split = i
+			break
+		}
+	}
+
+	if split < 0 {
+		return strings.ToUpper(line), params, ""
+	}
+
+	parts := strings.Split(line[:split], ";")
+
+	for _, param := range parts[1:] {
+		if kv := strings.SplitN(param, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, line[split+1:]
+}
+
+// icsTime parses DATE-TIME and DATE values, honouring the TZID parameter
+// when the time zone is known
+func icsTime(params map[string]string, value string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(icsDate) {
+		return time.ParseInLocation(icsDate, value, time.UTC)
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(icsDateTime, value)
+	}
+
+	loc := time.UTC
+
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	return time.ParseInLocation(icsLocalTime, value, loc)
+}
+
+func (ir *icsReader) Read() (model.Task, error) {
+	var task model.Task
+	inTodo := false
+
+	// how deep inside the components of the VTODO, like VALARM, we are
+	depth := 0
+
+	for {
+		line, ok := ir.unfold()
+
+		if !ok {
+			break
+		}
+
+		name, params, value := icsProperty(line)
+
+		if name == "BEGIN" && strings.EqualFold(value, "VTODO") {
+			inTodo = true
+			task = model.Task{}
+			continue
+		}
+
+		if !inTodo {
+			continue
+		}
+
+		if name == "BEGIN" {
+			depth++
+			continue
+		}
+
+		if name == "END" && depth > 0 {
+			depth--
+			continue
+		}
+
+		if depth > 0 {
+			continue
+		}
+
+		var err error
+
+		switch name {
+		case "END":
+			if strings.EqualFold(value, "VTODO") {
+				return task, nil
+			}
+		case "UID":
+			if match := icsUID.FindStringSubmatch(value); match != nil {
+				task.ID, _ = strconv.Atoi(match[1])
+			}
+		case "SUMMARY":
+			task.Title = icsTextUnescaper.Replace(value)
+		case "STATUS":
+			task.Complete = strings.EqualFold(value, "COMPLETED")
+		case "PRIORITY":
+			task.Priority, err = strconv.Atoi(value)
+		case "DUE":
+			var due time.Time
+			due, err = icsTime(params, value)
+			task.Due = &due
+		case "COMPLETED":
+			var completed time.Time
+			completed, err = icsTime(params, value)
+			task.CompletedAt = &completed
+			task.Complete = true
+		}
+
+		if err != nil {
+			return task, fmt.Errorf("line %d: invalid %s: %s", ir.line, name, value)
+		}
+	}
+
+	if err := ir.s.Err(); err != nil {
+		return task, err
+	}
+
+	if inTodo {
+		return task, io.ErrUnexpectedEOF
+	}
+
+	return task, io.EOF
+}
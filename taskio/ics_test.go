@@ -0,0 +1,162 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package taskio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// writeCalendar exports the tasks as an iCalendar file
+func writeCalendar(t *testing.T, tasks ...model.Task) string {
+	var b bytes.Buffer
+
+	w := NewCalendarWriter(&b, "Tâches; à faire")
+
+	for _, task := range tasks {
+		if err := w.Write(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestCalendarLinesAreFolded(t *testing.T) {
+	// multi-byte characters straddle every possible fold position
+	title := strings.Repeat("é", 40) + strings.Repeat("日本語", 20) + "a🎉" + strings.Repeat("🎉", 30)
+	ics := writeCalendar(t, model.Task{ID: 1, Title: title})
+
+	if !strings.HasSuffix(ics, "\r\n") {
+		t.Error("the lines do not end with CRLF")
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > icsLineLength {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+
+	tasks := readAll(t, strings.NewReader(ics), Calendar)
+
+	if len(tasks) != 1 || tasks[0].Title != title {
+		t.Errorf("got %+v, want the title %q", tasks, title)
+	}
+}
+
+func TestCalendarEscaping(t *testing.T) {
+	title := `a; b, c \ d` + "\nsecond line"
+	ics := writeCalendar(t, model.Task{ID: 1, Title: title})
+
+	if !strings.Contains(ics, `SUMMARY:a\; b\, c \\ d\nsecond line`+"\r\n") {
+		t.Errorf("the summary is not escaped: %s", ics)
+	}
+
+	if !strings.Contains(ics, `X-WR-CALNAME:Tâches\; à faire`+"\r\n") {
+		t.Errorf("the name is not escaped: %s", ics)
+	}
+
+	tasks := readAll(t, strings.NewReader(ics), Calendar)
+
+	if len(tasks) != 1 || tasks[0].Title != title {
+		t.Errorf("got %+v, want the title %q", tasks, title)
+	}
+}
+
+func TestCalendarTimes(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	due := []struct {
+		line string
+		want time.Time
+	}{
+		{"DUE:20240301T093000Z", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"DUE;TZID=Australia/Sydney:20240301T093000", time.Date(2024, 3, 1, 9, 30, 0, 0, sydney)},
+		{`DUE;TZID="Australia/Sydney":20240301T093000`, time.Date(2024, 3, 1, 9, 30, 0, 0, sydney)},
+		{"DUE;TZID=Nowhere/Unknown:20240301T093000", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"DUE:20240301T093000", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"DUE;VALUE=DATE:20240301", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"DUE:20240301", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, d := range due {
+		ics := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Task\r\n" + d.line + "\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+		tasks := readAll(t, strings.NewReader(ics), Calendar)
+
+		if len(tasks) != 1 || tasks[0].Due == nil || !tasks[0].Due.Equal(d.want) {
+			t.Errorf("%s: got %+v, want due %v", d.line, tasks, d.want)
+		}
+	}
+
+	r, _ := NewReader(strings.NewReader("BEGIN:VTODO\r\nDUE;VALUE=DATE:2024-03-01\r\nEND:VTODO\r\n"), Calendar)
+
+	if _, err := r.Read(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v, want the invalid due of line 2", err)
+	}
+}
+
+func TestCalendarIgnoresNestedComponents(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"SUMMARY:Meeting",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"UID:task-7@techchallengeapp",
+		"SUMMARY:Rem",
+		" ind me",
+		"BEGIN:VALARM",
+		"SUMMARY:Alarm",
+		"END:VALARM",
+		"STATUS:COMPLETED",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:not-ours@example.com",
+		"SUMMARY:Other",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	got := readAll(t, strings.NewReader(ics), Calendar)
+	want := []model.Task{{ID: 7, Title: "Remind me", Complete: true}, {Title: "Other"}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package taskio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Format - a file format tasks can be imported from and exported to
+type Format string
+
+// Supported formats
+const (
+	JSON     Format = "json"
+	CSV      Format = "csv"
+	Markdown Format = "md"
+	Calendar Format = "ics"
+)
+
+// csvHeader is the header row written to csv exports
+var csvHeader = []string{"id", "priority", "title", "complete", "due", "list_id"}
+
+// ParseFormat validates the name of a format
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case JSON, CSV, Markdown, Calendar:
+		return f, nil
+	case "markdown":
+		return Markdown, nil
+	}
+
+	return "", fmt.Errorf("Unknown format: %s, use json, csv, md or ics", name)
+}
+
+// FormatFromFilename infers the format from the file extension
+func FormatFromFilename(name string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(filepath.Ext(name), "."))
+}
+
+// FormatFromContentType infers the format from a mime type
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+
+	switch mediaType {
+	case "application/json":
+		return JSON, nil
+	case "text/csv":
+		return CSV, nil
+	case "text/markdown":
+		return Markdown, nil
+	case "text/calendar":
+		return Calendar, nil
+	}
+
+	return "", fmt.Errorf("Unknown content type: %s", contentType)
+}
+
+// ContentType is the mime type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	case Calendar:
+		return "text/calendar; charset=utf-8"
+	}
+
+	return "application/json"
+}
+
+// Writer writes tasks one at a time, Close must be called once every task
+// has been written
+type Writer interface {
+	Write(task model.Task) error
+	Close() error
+}
+
+// NewWriter creates a writer for the format
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case JSON:
+		return &jsonWriter{w: w}, nil
+	case CSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case Markdown:
+		return &markdownWriter{w: w}, nil
+	case Calendar:
+		return NewCalendarWriter(w, icsDefaultName), nil
+	}
+
+	return nil, fmt.Errorf("Unknown format: %s", format)
+}
+
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (jw *jsonWriter) Write(task model.Task) error {
+	sep := ",\n"
+
+	if jw.count == 0 {
+		sep = "[\n"
+	}
+
+	js, err := json.Marshal(task)
+
+	if err != nil {
+		return err
+	}
+
+	jw.count++
+
+	_, err = fmt.Fprintf(jw.w, "%s  %s", sep, js)
+
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "\n]\n"
+
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(jw.w, end)
+
+	return err
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (cw *csvWriter) Write(task model.Task) error {
+	if !cw.started {
+		cw.started = true
+
+		if err := cw.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	due := ""
+
+	if task.Due != nil {
+		due = task.Due.Format(time.RFC3339)
+	}
+
+	return cw.w.Write([]string{
+		strconv.Itoa(task.ID),
+		strconv.Itoa(task.Priority),
+		task.Title,
+		strconv.FormatBool(task.Complete),
+		due,
+		strconv.Itoa(task.ListID),
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	if !cw.started {
+		cw.started = true
+		cw.w.Write(csvHeader)
+	}
+
+	cw.w.Flush()
+
+	return cw.w.Error()
+}
+
+type markdownWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (mw *markdownWriter) Write(task model.Task) error {
+	if !mw.started {
+		mw.started = true
+
+		if _, err := io.WriteString(mw.w, "# To Do\n\n"); err != nil {
+			return err
+		}
+	}
+
+	check := " "
+
+	if task.Complete {
+		check = "x"
+	}
+
+	// a checklist item has to fit on a single line
+	title := strings.Join(strings.Fields(task.Title), " ")
+
+	_, err := fmt.Fprintf(mw.w, "- [%s] %s\n", check, title)
+
+	return err
+}
+
+func (mw *markdownWriter) Close() error {
+	if !mw.started {
+		_, err := io.WriteString(mw.w, "# To Do\n")
+		return err
+	}
+
+	return nil
+}
+
+// Reader reads tasks one at a time, Read returns io.EOF once every task
+// has been read
+type Reader interface {
+	Read() (model.Task, error)
+}
+
+// NewReader creates a reader for the format
+func NewReader(r io.Reader, format Format) (Reader, error) {
+	switch format {
+	case JSON:
+		return &jsonReader{d: json.NewDecoder(r)}, nil
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+
+		return &csvReader{r: cr}, nil
+	case Markdown:
+		return &markdownReader{s: bufio.NewScanner(r)}, nil
+	case Calendar:
+		return &icsReader{s: bufio.NewScanner(r)}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown format: %s", format)
+}
+
+// jsonReader decodes an array of tasks, one element at a time
+type jsonReader struct {
+	d       *json.Decoder
+	started bool
+}
+
+func (jr *jsonReader) Read() (model.Task, error) {
+	var task model.Task
+
+	if !jr.started {
+		jr.started = true
+
+		tok, err := jr.d.Token()
+
+		if err == io.EOF {
+			return task, io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return task, err
+		}
+
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return task, errors.New("Expected an array of tasks")
+		}
+	}
+
+	if !jr.d.More() {
+		// consume the closing bracket
+		if _, err := jr.d.Token(); err != nil {
+			return task, err
+		}
+
+		return task, io.EOF
+	}
+
+	err := jr.d.Decode(&task)
+
+	return task, err
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func (cr *csvReader) Read() (model.Task, error) {
+	var task model.Task
+
+	if cr.columns == nil {
+		header, err := cr.r.Read()
+
+		if err == io.EOF {
+			return task, io.EOF
+		}
+
+		if err != nil {
+			return task, err
+		}
+
+		cr.line++
+		cr.columns = make(map[string]int)
+
+		for i, name := range header {
+			cr.columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+
+		if _, ok := cr.columns["title"]; !ok {
+			return task, errors.New("csv header has no title column")
+		}
+	}
+
+	record, err := cr.r.Read()
+
+	if err != nil {
+		return task, err
+	}
+
+	cr.line++
+
+	field := func(name string) string {
+		i, ok := cr.columns[name]
+
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	task.Title = field("title")
+
+	if value := field("id"); value != "" {
+		if task.ID, err = strconv.Atoi(value); err != nil {
+			return task, fmt.Errorf("line %d: invalid id: %s", cr.line, value)
+		}
+	}
+
+	if value := field("priority"); value != "" {
+		if task.Priority, err = strconv.Atoi(value); err != nil {
+			return task, fmt.Errorf("line %d: invalid priority: %s", cr.line, value)
+		}
+	}
+
+	if value := field("complete"); value != "" {
+		if task.Complete, err = strconv.ParseBool(value); err != nil {
+			return task, fmt.Errorf("line %d: invalid complete: %s", cr.line, value)
+		}
+	}
+
+	if value := field("due"); value != "" {
+		due, err := time.Parse(time.RFC3339, value)
+
+		if err != nil {
+			return task, fmt.Errorf("line %d: invalid due: %s", cr.line, value)
+		}
+
+		task.Due = &due
+	}
+
+	if value := field("list_id"); value != "" {
+		if task.ListID, err = strconv.Atoi(value); err != nil || task.ListID < 0 {
+			return task, fmt.Errorf("line %d: invalid list_id: %s", cr.line, value)
+		}
+	}
+
+	return task, nil
+}
+
+// checklistItem matches markdown task list items like "- [x] title"
+var checklistItem = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.+?)\s*$`)
+
+// markdownReader reads the checklist items of a markdown document, the
+// priority of a task is its position in the document
+type markdownReader struct {
+	s     *bufio.Scanner
+	count int
+}
+
+func (mr *markdownReader) Read() (model.Task, error) {
+	for mr.s.Scan() {
+		match := checklistItem.FindStringSubmatch(mr.s.Text())
+
+		if match == nil {
+			continue
+		}
+
+		task := model.Task{
+			Priority: mr.count,
+			Title:    match[2],
+			Complete: match[1] != " ",
+		}
+
+		mr.count++
+
+		return task, nil
+	}
+
+	if err := mr.s.Err(); err != nil {
+		return model.Task{}, err
+	}
+
+	return model.Task{}, io.EOF
+}
@@ -0,0 +1,224 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package taskio
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// readAll reads every task of a file
+func readAll(t *testing.T, r io.Reader, format Format) []model.Task {
+	t.Helper()
+
+	reader, err := NewReader(r, format)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks []model.Task
+
+	for {
+		task, err := reader.Read()
+
+		if err == io.EOF {
+			return tasks
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tasks = append(tasks, task)
+	}
+}
+
+// export writes the tasks in the format
+func export(t *testing.T, format Format, tasks []model.Task) string {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	writer, err := NewWriter(&b, format)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range tasks {
+		if err := writer.Write(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	done := time.Date(2024, 2, 28, 17, 0, 0, 0, time.UTC)
+
+	tasks := []model.Task{
+		{ID: 4, Priority: 1, Title: "Write the docs", Due: &due, ListID: 2},
+		{ID: 9, Priority: 3, Title: `Quotes "and", commas; \ and ünïcode`, Complete: true, CompletedAt: &done, ListID: 3},
+	}
+
+	// what each format keeps of the tasks
+	keep := map[Format]func(model.Task) model.Task{
+		JSON: func(task model.Task) model.Task { return task },
+		CSV: func(task model.Task) model.Task {
+			task.CompletedAt = nil
+			return task
+		},
+		Markdown: func(task model.Task) model.Task {
+			return model.Task{Title: task.Title, Complete: task.Complete}
+		},
+		Calendar: func(task model.Task) model.Task {
+			task.ListID = 0
+			return task
+		},
+	}
+
+	for format, kept := range keep {
+		t.Run(string(format), func(t *testing.T) {
+			got := readAll(t, strings.NewReader(export(t, format, tasks)), format)
+
+			var want []model.Task
+
+			for i, task := range tasks {
+				task = kept(task)
+
+				// the position of a checklist item is its priority
+				if format == Markdown {
+					task.Priority = i
+				}
+
+				want = append(want, task)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEmptyExports(t *testing.T) {
+	for _, format := range []Format{JSON, CSV, Markdown, Calendar} {
+		if tasks := readAll(t, strings.NewReader(export(t, format, nil)), format); len(tasks) != 0 {
+			t.Errorf("%s: got %+v, want no tasks", format, tasks)
+		}
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	csv := export(t, CSV, []model.Task{{ID: 1, Title: "Task", ListID: 5}})
+
+	if header, _, _ := strings.Cut(csv, "\n"); header != "id,priority,title,complete,due,list_id" {
+		t.Errorf("header %q", header)
+	}
+
+	// the columns can come in any order, and be missing
+	tasks := readAll(t, strings.NewReader("Title, LIST_ID\nFirst,2\nSecond\n"), CSV)
+	want := []model.Task{{Title: "First", ListID: 2}, {Title: "Second"}}
+
+	if !reflect.DeepEqual(tasks, want) {
+		t.Errorf("got %+v, want %+v", tasks, want)
+	}
+
+	invalid := map[string]string{
+		"id,title\nx,Task\n":       "line 2: invalid id",
+		"title,list_id\nTask,-1\n": "line 2: invalid list_id",
+		"title,due\nTask,soon\n":   "line 2: invalid due",
+		"name\nTask\n":             "no title column",
+	}
+
+	for file, want := range invalid {
+		r, _ := NewReader(strings.NewReader(file), CSV)
+
+		if _, err := r.Read(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want %q", file, err, want)
+		}
+	}
+}
+
+func TestMarkdownChecklist(t *testing.T) {
+	md := "# Groceries\n\nSome text\n- [ ] milk\n* [x] eggs  \n  + [X] nested\n- not a task\n- [] broken\n"
+
+	got := readAll(t, strings.NewReader(md), Markdown)
+	want := []model.Task{
+		{Priority: 0, Title: "milk"},
+		{Priority: 1, Title: "eggs", Complete: true},
+		{Priority: 2, Title: "nested", Complete: true},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// a title spanning lines is written as a single item
+	if out := export(t, Markdown, []model.Task{{Title: "two\nlines"}}); out != "# To Do\n\n- [ ] two lines\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestJSONMustBeAnArray(t *testing.T) {
+	for _, file := range []string{"", `{"title":"Task"}`, `[{"title":1}]`} {
+		r, _ := NewReader(strings.NewReader(file), JSON)
+
+		if _, err := r.Read(); err == nil || err == io.EOF {
+			t.Errorf("%q: got %v, want an error", file, err)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	names := map[string]Format{"JSON": JSON, "csv": CSV, "markdown": Markdown, "md": Markdown, "ics": Calendar}
+
+	for name, want := range names {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("%s: got %s %v, want %s", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("xml is a format")
+	}
+
+	if got, err := FormatFromContentType("text/csv; charset=utf-8"); err != nil || got != CSV {
+		t.Errorf("got %s %v, want csv", got, err)
+	}
+
+	if got, err := FormatFromFilename("backup/tasks.ics"); err != nil || got != Calendar {
+		t.Errorf("got %s %v, want ics", got, err)
+	}
+}
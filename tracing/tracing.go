@@ -0,0 +1,158 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName is the name of the service in the exported traces
+const ServiceName = "techchallengeapp"
+
+// Config - configuration for the tracing package
+type Config struct {
+	// Exporter is where spans are sent: none, stdout, file or otlp
+	Exporter string
+
+	// Endpoint is the url of the OTLP/HTTP collector, for example
+	// http://localhost:4318, the OTEL_EXPORTER_OTLP_* variables are used
+	// when it is empty
+	Endpoint string
+
+	// File is the file spans are appended to by the file exporter
+	File string
+
+	// SampleRatio is the share of new traces recorded, from 0 to 1, the
+	// decision of the caller is kept for requests that are part of a trace
+	SampleRatio float64
+
+	// Version is the version of the service in the exported traces
+	Version string
+}
+
+// Setup installs the W3C trace context propagator and a tracer provider
+// sending spans to the configured exporter, the returned function flushes
+// the pending spans and must be called before exiting
+func Setup(cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("Invalid trace sample ratio: %v, use a number from 0 to 1", cfg.SampleRatio)
+	}
+
+	exporter, closer, err := newExporter(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// without an exporter trace contexts are still propagated, but no span is recorded
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(cfg.Version),
+	))
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+
+		return err
+	}, nil
+}
+
+// newExporter creates the exporter of the config, and the file it writes
+// to when it has to be closed
+func newExporter(cfg Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return nil, nil, nil
+
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, nil, err
+
+	case "file":
+		if cfg.File == "" {
+			return nil, nil, fmt.Errorf("The file trace exporter needs a file to write to")
+		}
+
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+
+		return exporter, f, nil
+
+	case "otlp":
+		var opts []otlptracehttp.Option
+
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		return exporter, nil, err
+
+	default:
+		return nil, nil, fmt.Errorf("Unknown trace exporter: %s, use none, stdout, file or otlp", cfg.Exporter)
+	}
+}
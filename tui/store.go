@@ -0,0 +1,175 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tui
+
+import (
+	"context"
+	"errors"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/client"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Store is where the tasks managed by the terminal UI are kept
+type Store interface {
+	ListTasks(ctx context.Context, filter client.TaskFilter) ([]model.Task, error)
+	AddTask(ctx context.Context, task model.Task) (model.Task, error)
+	UpdateTask(ctx context.Context, task model.Task) (model.Task, error)
+	DeleteTask(ctx context.Context, id int) error
+
+	// Watch receives a value for each change made to the tasks until ctx
+	// is done, it is closed when the changes can no longer be watched
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// RemoteStore manages the tasks of a running server through its api
+func RemoteStore(c *client.Client) Store {
+	return remoteStore{c}
+}
+
+type remoteStore struct {
+	*client.Client
+}
+
+func (s remoteStore) Watch(ctx context.Context) (<-chan struct{}, error) {
+	events, err := s.WatchTasks(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan struct{})
+
+	go func() {
+		defer close(changes)
+
+		for range events {
+			select {
+			case changes <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// LocalStore manages the tasks of the database directly. Changes are
+// published to the broker listening to postgres, so they reach the servers
+// sharing their events and the changes of the servers are watched. Without
+// a broker changes are not shared and can not be watched. Whoever can reach
+// the database can do anything, the tasks of every list are managed
+func LocalStore(cfg db.Config, broker *events.Broker) Store {
+	return localStore{cfg: cfg, broker: broker}
+}
+
+type localStore struct {
+	cfg    db.Config
+	broker *events.Broker
+}
+
+func (s localStore) publish(ctx context.Context, e events.Event) {
+	if s.broker != nil {
+		s.broker.Publish(ctx, e)
+	}
+}
+
+func (s localStore) ListTasks(ctx context.Context, filter client.TaskFilter) ([]model.Task, error) {
+	return db.FilterTasks(access.AsSystem(ctx), s.cfg, db.TaskFilter{
+		Complete:  filter.Complete,
+		Search:    filter.Search,
+		DueBefore: filter.DueBefore,
+		DueAfter:  filter.DueAfter,
+	})
+}
+
+func (s localStore) AddTask(ctx context.Context, task model.Task) (model.Task, error) {
+	created, err := db.AddTask(access.AsSystem(ctx), s.cfg, task)
+
+	if err != nil {
+		return created, err
+	}
+
+	s.publish(ctx, events.Event{Type: events.TaskCreated, Task: created})
+
+	return created, nil
+}
+
+func (s localStore) UpdateTask(ctx context.Context, task model.Task) (model.Task, error) {
+	updated, err := db.UpdateTask(access.AsSystem(ctx), s.cfg, task)
+
+	if err != nil {
+		return updated, err
+	}
+
+	s.publish(ctx, events.Event{Type: events.TaskUpdated, Task: updated})
+
+	return updated, nil
+}
+
+func (s localStore) DeleteTask(ctx context.Context, id int) error {
+	deleted, err := db.DeleteTask(access.AsSystem(ctx), s.cfg, model.Task{ID: id})
+
+	if err != nil {
+		return err
+	}
+
+	s.publish(ctx, events.Event{Type: events.TaskDeleted, Task: model.Task{ID: id, ListID: deleted.ListID}})
+
+	return nil
+}
+
+func (s localStore) Watch(ctx context.Context) (<-chan struct{}, error) {
+	if s.broker == nil {
+		return nil, errors.New("changes are only shared through the database with DbNotify")
+	}
+
+	sub, unsubscribe := s.broker.Subscribe()
+	changes := make(chan struct{})
+
+	go func() {
+		defer close(changes)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-sub:
+				if !ok {
+					return
+				}
+
+				select {
+				case changes <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
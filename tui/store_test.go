@@ -0,0 +1,292 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/client"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/db/dbtest"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// testStore returns a local store of a fake database holding the lists of
+// dbtest.NewWithLists
+func testStore(t *testing.T, broker *events.Broker) (Store, *dbtest.DB) {
+	cfg := db.Config{DbName: t.Name()}
+	fake := dbtest.NewWithLists()
+	pool := fake.Open()
+	db.SetPool(cfg, pool)
+
+	t.Cleanup(func() { pool.Close() })
+
+	return LocalStore(cfg, broker), fake
+}
+
+// next returns the next event of the subscription
+func next(t *testing.T, sub <-chan events.Event) events.Event {
+	select {
+	case e := <-sub:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return events.Event{}
+	}
+}
+
+// changed waits for a change, or for the changes to be closed when closed is set
+func changed(t *testing.T, changes <-chan struct{}, closed bool) {
+	select {
+	case _, ok := <-changes:
+		if ok == closed {
+			t.Errorf("got a change, want closed %v", closed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change")
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	broker := events.NewBroker()
+	store, fake := testStore(t, broker)
+
+	sub, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	created, err := store.AddTask(ctx, model.Task{Title: "Local", Priority: 1, ListID: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := next(t, sub); e.Type != events.TaskCreated || e.Task != created {
+		t.Errorf("published %+v", e)
+	}
+
+	created.Title = "Edited"
+	updated, err := store.UpdateTask(ctx, created)
+
+	if err != nil || updated.Title != "Edited" {
+		t.Fatalf("updated %+v: %v", updated, err)
+	}
+
+	if e := next(t, sub); e.Type != events.TaskUpdated || e.Task != updated {
+		t.Errorf("published %+v", e)
+	}
+
+	if err := store.DeleteTask(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := next(t, sub); e.Type != events.TaskDeleted || e.Task != (model.Task{ID: created.ID, ListID: 2}) {
+		t.Errorf("published %+v", e)
+	}
+
+	if _, ok := fake.Task(created.ID); ok {
+		t.Error("the task is not deleted")
+	}
+}
+
+func TestLocalStoreManagesEveryList(t *testing.T) {
+	store, fake := testStore(t, nil)
+
+	tasks, err := store.ListTasks(context.Background(), client.TaskFilter{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tasks, fake.Tasks()) {
+		t.Errorf("got %+v, want every task %+v", tasks, fake.Tasks())
+	}
+}
+
+func TestLocalStoreFilters(t *testing.T) {
+	store, fake := testStore(t, nil)
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	fake.AddTask(model.Task{ID: 10, Title: "Write the Report", ListID: 1, Complete: true})
+	fake.AddTask(model.Task{ID: 11, Title: "Read the report", ListID: 1, Due: &due})
+
+	done := true
+	before, after := due.Add(time.Hour), due.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		filter client.TaskFilter
+		want   []int
+	}{
+		{"complete", client.TaskFilter{Complete: &done}, []int{10}},
+		{"search", client.TaskFilter{Search: "REPORT"}, []int{10, 11}},
+		{"due before", client.TaskFilter{DueBefore: &before}, []int{11}},
+		{"due after", client.TaskFilter{DueAfter: &after}, []int{11}},
+		{"due later", client.TaskFilter{DueAfter: &before}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := store.ListTasks(context.Background(), tt.filter)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int
+
+			for _, task := range tasks {
+				ids = append(ids, task.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalStoreErrorsAreNotPublished(t *testing.T) {
+	broker := events.NewBroker()
+	store, fake := testStore(t, broker)
+	fake.FailOn("^INSERT INTO tasks|^UPDATE tasks|^DELETE FROM tasks")
+
+	sub, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	ctx := context.Background()
+
+	if _, err := store.AddTask(ctx, model.Task{Title: "Failing", ListID: 1}); err == nil {
+		t.Error("add: no error")
+	}
+
+	if _, err := store.UpdateTask(ctx, model.Task{ID: 1, Title: "Failing", ListID: 1}); err == nil {
+		t.Error("update: no error")
+	}
+
+	if err := store.DeleteTask(ctx, 1); err == nil {
+		t.Error("delete: no error")
+	}
+
+	select {
+	case e := <-sub:
+		t.Errorf("published %+v", e)
+	default:
+	}
+}
+
+func TestLocalStoreWatch(t *testing.T) {
+	broker := events.NewBroker()
+	store, _ := testStore(t, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := store.Watch(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the changes of the other stores and servers sharing the broker
+	broker.Publish(ctx, events.Event{Type: events.TaskCreated, Task: model.Task{ID: 9}})
+	changed(t, changes, false)
+
+	store.AddTask(ctx, model.Task{Title: "Mine", ListID: 1})
+	changed(t, changes, false)
+
+	cancel()
+	changed(t, changes, true)
+}
+
+func TestLocalStoreWatchNeedsABroker(t *testing.T) {
+	store, _ := testStore(t, nil)
+
+	if _, err := store.Watch(context.Background()); err == nil {
+		t.Error("no error without a broker")
+	}
+
+	// changes are not published without a broker
+	if _, err := store.AddTask(context.Background(), model.Task{Title: "Alone", ListID: 1}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRemoteStoreWatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "event: created\ndata: {\"id\":%d}\n\n", i)
+		}
+	}))
+	defer server.Close()
+
+	changes, err := RemoteStore(client.New(client.Config{URL: server.URL})).Watch(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		changed(t, changes, false)
+	}
+
+	// the server closed the stream
+	changed(t, changes, true)
+}
+
+func TestRemoteStoreWatchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "signed out", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if _, err := RemoteStore(client.New(client.Config{URL: server.URL})).Watch(context.Background()); err == nil {
+		t.Error("no error when the stream is refused")
+	}
+}
+
+func TestRemoteStoreWatchEndsWithTheContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: created\ndata: {\"id\":1}\n\n")
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := RemoteStore(client.New(client.Config{URL: server.URL})).Watch(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed(t, changes, false)
+	cancel()
+	changed(t, changes, true)
+}
@@ -0,0 +1,585 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package tui is a full screen task manager for the terminal
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/servian/TechChallengeApp/client"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// reconnectDelay is how long to wait before watching the changes again
+// once the change stream closed
+const reconnectDelay = 5 * time.Second
+
+// Config configuration for the tui package
+type Config struct {
+	Store Store
+
+	// Source describes the store in the header, e.g. the url of the server
+	Source string
+}
+
+// Run shows the task manager until it is quit
+func Run(cfg Config) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := tea.NewProgram(newModel(ctx, cfg), tea.WithAltScreen()).Run()
+
+	return err
+}
+
+type mode int
+
+const (
+	modeList mode = iota
+	modeAdd
+	modeEdit
+	modeSearch
+	modeDelete
+)
+
+// show selects the tasks listed by whether they are finished
+type show int
+
+const (
+	showAll show = iota
+	showOpen
+	showDone
+)
+
+func (s show) String() string {
+	return [...]string{"all tasks", "open tasks", "finished tasks"}[s]
+}
+
+type tasksMsg []model.Task
+
+type errMsg struct{ err error }
+
+// savedMsg reports a change made by the user to a task, the list is
+// reloaded after it with the cursor on the task
+type savedMsg struct {
+	status string
+	id     int
+}
+
+type watchingMsg struct{ changes <-chan struct{} }
+
+type changedMsg struct{ changes <-chan struct{} }
+
+type watchFailedMsg struct{ err error }
+
+type reconnectMsg struct{}
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	doneStyle     = lipgloss.NewStyle().Faint(true).Strikethrough(true)
+	helpStyle     = lipgloss.NewStyle().Faint(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+type tuiModel struct {
+	ctx context.Context
+	cfg Config
+
+	tasks    []model.Task
+	loaded   bool
+	cursor   int
+	offset   int
+	selected int
+
+	search string
+	show   show
+
+	mode  mode
+	input textinput.Model
+
+	live   bool
+	status string
+	err    error
+
+	width  int
+	height int
+}
+
+func newModel(ctx context.Context, cfg Config) *tuiModel {
+	input := textinput.New()
+	input.CharLimit = 256
+
+	return &tuiModel{ctx: ctx, cfg: cfg, input: input, selected: -1}
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.load(), m.watch())
+}
+
+func (m *tuiModel) filter() client.TaskFilter {
+	filter := client.TaskFilter{Search: m.search}
+
+	if m.show != showAll {
+		complete := m.show == showDone
+		filter.Complete = &complete
+	}
+
+	return filter
+}
+
+func (m *tuiModel) load() tea.Cmd {
+	filter := m.filter()
+
+	return func() tea.Msg {
+		tasks, err := m.cfg.Store.ListTasks(m.ctx, filter)
+
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return tasksMsg(tasks)
+	}
+}
+
+func (m *tuiModel) watch() tea.Cmd {
+	return func() tea.Msg {
+		changes, err := m.cfg.Store.Watch(m.ctx)
+
+		if err != nil {
+			return watchFailedMsg{err}
+		}
+
+		return watchingMsg{changes}
+	}
+}
+
+// waitForChange waits for the next change, the changes made meanwhile are
+// handled by the same reload
+func waitForChange(changes <-chan struct{}) tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-changes; !ok {
+			return watchFailedMsg{errors.New("the change stream closed")}
+		}
+
+		timeout := time.After(100 * time.Millisecond)
+
+		for {
+			select {
+			case _, ok := <-changes:
+				if !ok {
+					return changedMsg{changes}
+				}
+			case <-timeout:
+				return changedMsg{changes}
+			}
+		}
+	}
+}
+
+// save runs a change of the user in the background, the status is
+// formatted with the id of the task changed
+func (m *tuiModel) save(status string, change func(ctx context.Context) (model.Task, error)) tea.Cmd {
+	return func() tea.Msg {
+		task, err := change(m.ctx)
+
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return savedMsg{status: fmt.Sprintf(status, task.ID), id: task.ID}
+	}
+}
+
+func (m *tuiModel) current() (model.Task, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.tasks) {
+		return model.Task{}, false
+	}
+
+	return m.tasks[m.cursor], true
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.Width = msg.Width - 12
+		return m, nil
+
+	case tasksMsg:
+		m.setTasks(msg)
+		return m, nil
+
+	case errMsg:
+		m.err = msg.err
+		return m, nil
+
+	case savedMsg:
+		m.status, m.err = msg.status, nil
+		m.selected = msg.id
+
+		return m, m.load()
+
+	case watchingMsg:
+		m.live = true
+		return m, waitForChange(msg.changes)
+
+	case changedMsg:
+		return m, tea.Batch(m.load(), waitForChange(msg.changes))
+
+	case watchFailedMsg:
+		wasLive := m.live
+		m.live = false
+		m.status = "Not refreshing live: " + msg.err.Error()
+
+		if wasLive {
+			return m, tea.Tick(reconnectDelay, func(time.Time) tea.Msg { return reconnectMsg{} })
+		}
+
+		return m, nil
+
+	case reconnectMsg:
+		return m, tea.Batch(m.load(), m.watch())
+
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+
+		if m.mode == modeList {
+			return m, m.listKey(msg)
+		}
+
+		if m.mode == modeDelete {
+			return m, m.deleteKey(msg)
+		}
+
+		return m, m.inputKey(msg)
+	}
+
+	return m, nil
+}
+
+// setTasks shows the tasks by priority, keeping the cursor on the same task
+func (m *tuiModel) setTasks(tasks []model.Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].Priority != tasks[j].Priority {
+			return tasks[i].Priority < tasks[j].Priority
+		}
+
+		return tasks[i].ID < tasks[j].ID
+	})
+
+	if task, ok := m.current(); ok && m.selected < 0 {
+		m.selected = task.ID
+	}
+
+	m.tasks = tasks
+	m.loaded = true
+	m.err = nil
+
+	for i, task := range tasks {
+		if task.ID == m.selected {
+			m.cursor = i
+		}
+	}
+
+	m.selected = -1
+	m.moveCursor(0)
+}
+
+func (m *tuiModel) moveCursor(delta int) {
+	m.cursor += delta
+
+	if m.cursor >= len(m.tasks) {
+		m.cursor = len(m.tasks) - 1
+	}
+
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+
+	rows := m.rows()
+
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+}
+
+// rows is how many tasks fit on the screen
+func (m *tuiModel) rows() int {
+	if m.height == 0 {
+		return 20
+	}
+
+	return max(m.height-4, 1)
+}
+
+func (m *tuiModel) prompt(mode mode, prompt string, value string) tea.Cmd {
+	m.mode = mode
+	m.input.Prompt = prompt
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+
+	return m.input.Focus()
+}
+
+func (m *tuiModel) listKey(msg tea.KeyMsg) tea.Cmd {
+	task, ok := m.current()
+
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	case "pgup":
+		m.moveCursor(-m.rows())
+	case "pgdown":
+		m.moveCursor(m.rows())
+	case "home", "g":
+		m.moveCursor(-len(m.tasks))
+	case "end", "G":
+		m.moveCursor(len(m.tasks))
+	case "a":
+		return m.prompt(modeAdd, "New task: ", "")
+	case "/":
+		return m.prompt(modeSearch, "Search: ", m.search)
+	case "tab":
+		m.show = (m.show + 1) % 3
+		return m.load()
+	case "esc":
+		m.search, m.show = "", showAll
+		return m.load()
+	case "r":
+		if !m.live {
+			return tea.Batch(m.load(), m.watch())
+		}
+
+		return m.load()
+	}
+
+	if !ok {
+		return nil
+	}
+
+	switch msg.String() {
+	case "e", "enter":
+		return m.prompt(modeEdit, "Title: ", task.Title)
+	case " ", "x":
+		task.Complete = !task.Complete
+		return m.update(task, "Task %d finished", "Task %d reopened")
+	case "+", "K", "shift+up":
+		if task.Priority > 0 {
+			task.Priority--
+			return m.update(task, "Task %d moved up", "")
+		}
+	case "-", "J", "shift+down":
+		task.Priority++
+		return m.update(task, "Task %d moved down", "")
+	case "d", "delete":
+		m.mode = modeDelete
+	}
+
+	return nil
+}
+
+// update saves the task, reporting done or, when the task is not
+// complete and undone is set, undone
+func (m *tuiModel) update(task model.Task, done string, undone string) tea.Cmd {
+	status := done
+
+	if !task.Complete && undone != "" {
+		status = undone
+	}
+
+	return m.save(status, func(ctx context.Context) (model.Task, error) {
+		return m.cfg.Store.UpdateTask(ctx, task)
+	})
+}
+
+func (m *tuiModel) deleteKey(msg tea.KeyMsg) tea.Cmd {
+	m.mode = modeList
+	task, ok := m.current()
+
+	if !ok || msg.String() != "y" {
+		return nil
+	}
+
+	return m.save("Task %d deleted", func(ctx context.Context) (model.Task, error) {
+		return task, m.cfg.Store.DeleteTask(ctx, task.ID)
+	})
+}
+
+func (m *tuiModel) inputKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeList
+		m.input.Blur()
+		return nil
+	case tea.KeyEnter:
+		mode, value := m.mode, strings.TrimSpace(m.input.Value())
+		m.mode = modeList
+		m.input.Blur()
+
+		return m.submit(mode, value)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+
+	return cmd
+}
+
+func (m *tuiModel) submit(mode mode, value string) tea.Cmd {
+	if mode == modeSearch {
+		m.search = value
+		return m.load()
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	if mode == modeEdit {
+		task, ok := m.current()
+
+		if !ok {
+			return nil
+		}
+
+		task.Title = value
+
+		return m.update(task, "Task %d renamed", "")
+	}
+
+	// new tasks go to the end of the list
+	task := model.Task{Title: value}
+
+	for _, t := range m.tasks {
+		task.Priority = max(task.Priority, t.Priority+1)
+	}
+
+	return m.save("Task %d added", func(ctx context.Context) (model.Task, error) {
+		return m.cfg.Store.AddTask(ctx, task)
+	})
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+
+	header := "Tasks - " + m.cfg.Source + " - " + m.show.String()
+
+	if m.search != "" {
+		header += fmt.Sprintf(" matching %q", m.search)
+	}
+
+	if m.live {
+		header += " - live"
+	}
+
+	b.WriteString(titleStyle.Render(header) + "\n\n")
+
+	lines := 0
+
+	for i := m.offset; i < len(m.tasks) && lines < m.rows(); i++ {
+		b.WriteString(m.taskLine(i) + "\n")
+		lines++
+	}
+
+	if m.loaded && len(m.tasks) == 0 {
+		b.WriteString(helpStyle.Render("No tasks, press a to add one") + "\n")
+		lines++
+	}
+
+	for ; lines < m.rows(); lines++ {
+		b.WriteString("\n")
+	}
+
+	switch {
+	case m.mode == modeDelete:
+		task, _ := m.current()
+		b.WriteString(fmt.Sprintf("Delete task %d %q? y/n\n", task.ID, task.Title))
+	case m.mode != modeList:
+		b.WriteString(m.input.View() + "\n")
+	case m.err != nil:
+		b.WriteString(errorStyle.Render("Error: "+m.err.Error()) + "\n")
+	default:
+		b.WriteString(m.status + "\n")
+	}
+
+	b.WriteString(helpStyle.Render(m.help()))
+
+	return b.String()
+}
+
+func (m *tuiModel) taskLine(i int) string {
+	task := m.tasks[i]
+	check := "[ ]"
+
+	if task.Complete {
+		check = "[x]"
+	}
+
+	line := fmt.Sprintf("%s %4d  %s", check, task.Priority, task.Title)
+
+	if task.Due != nil {
+		line += "  due " + task.Due.Local().Format(time.DateOnly)
+	}
+
+	if m.width > 0 && lipgloss.Width(line) > m.width {
+		line = string([]rune(line)[:max(m.width-1, 0)]) + "…"
+	}
+
+	switch {
+	case i == m.cursor:
+		return selectedStyle.Render(line)
+	case task.Complete:
+		return doneStyle.Render(line)
+	default:
+		return line
+	}
+}
+
+func (m *tuiModel) help() string {
+	switch m.mode {
+	case modeList:
+		return "↑/↓ move  a add  e edit  space done  +/- priority  d delete  / search  tab open/done  esc clear  r refresh  q quit"
+	case modeDelete:
+		return ""
+	default:
+		return "enter save  esc cancel"
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/db/dbtest"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// testUsers are the users of dbtest.NewWithLists, by role, along with the
+// anonymous client
+var testUsers = map[string]*model.User{
+	"anonymous": nil,
+	"viewer":    {ID: 1, Name: "vera", Role: model.RoleViewer, Groups: []string{}},
+	"editor":    {ID: 2, Name: "ed", Role: model.RoleEditor, Groups: []string{"staff", "leads"}},
+	"admin":     {ID: 3, Name: "ada", Role: model.RoleAdmin, Groups: []string{}},
+}
+
+// testAPI serves the v1 api on a fake database holding the lists of
+// dbtest.NewWithLists
+func testAPI(t *testing.T) (Config, *dbtest.DB, http.Handler) {
+	cfg := Config{DB: db.Config{DbName: t.Name()}, Events: events.NewBroker()}
+	fake := resetDB(t, cfg)
+
+	router := mux.NewRouter()
+	apiHandler(cfg, router.PathPrefix(apiV1.Prefix).Subrouter(), apiV1)
+
+	return cfg, fake, router
+}
+
+// resetDB replaces the database of the api with a new one holding the
+// lists of dbtest.NewWithLists
+func resetDB(t *testing.T, cfg Config) *dbtest.DB {
+	fake := dbtest.NewWithLists()
+	pool := fake.Open()
+	db.SetPool(cfg.DB, pool)
+
+	t.Cleanup(func() { pool.Close() })
+
+	return fake
+}
+
+// call sends a request to the api as the user, nil for an anonymous client
+func call(api http.Handler, user *model.User, method string, path string, body string) *httptest.ResponseRecorder {
+	var reader io.Reader
+
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	if user != nil {
+		r = r.WithContext(withUser(context.Background(), *user))
+	}
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestRoutesCheckRoles(t *testing.T) {
+	// what each user gets on the lists 1, 2 and 3, ok is the status of
+	// the route when the role of the user allows it
+	viewing := map[string][3]int{
+		"anonymous": {0, 404, 404},
+		"viewer":    {0, 0, 404},
+		"editor":    {0, 0, 0},
+		"admin":     {0, 0, 0},
+	}
+
+	editing := map[string][3]int{
+		"anonymous": {0, 404, 404},
+		"viewer":    {403, 0, 404},
+		"editor":    {0, 403, 0},
+		"admin":     {0, 0, 0},
+	}
+
+	administering := map[string][3]int{
+		"anonymous": {403, 404, 404},
+		"viewer":    {403, 403, 404},
+		"editor":    {403, 403, 0},
+		"admin":     {0, 0, 0},
+	}
+
+	// the routes, {id} is the id of the list and of its task
+	routes := []struct {
+		method string
+		path   string
+		body   string
+		ok     int
+		want   map[string][3]int
+	}{
+		{"GET", "/api/v1/task/?list={id}", "", 200, viewing},
+		{"POST", "/api/v1/task/", `{"title":"New","listId":{id}}`, 200, editing},
+		{"PUT", "/api/v1/task/{id}/", `{"title":"Renamed"}`, 200, editing},
+		{"DELETE", "/api/v1/task/{id}/", "", 204, editing},
+		{"PUT", "/api/v1/list/{id}/", `{"name":"Renamed"}`, 200, administering},
+		{"DELETE", "/api/v1/list/{id}/", "", 204, administering},
+		{"GET", "/api/v1/list/{id}/members/", "", 200, administering},
+		{"POST", "/api/v1/list/{id}/members/", `{"group":"interns","role":"viewer"}`, 200, administering},
+	}
+
+	cfg, _, api := testAPI(t)
+
+	for _, route := range routes {
+		for name, user := range testUsers {
+			for i, want := range route.want[name] {
+				id := strconv.Itoa(i + 1)
+
+				if want == 0 {
+					want = route.ok
+				}
+
+				resetDB(t, cfg)
+				w := call(api, user, route.method, strings.ReplaceAll(route.path, "{id}", id), strings.ReplaceAll(route.body, "{id}", id))
+
+				if w.Code != want {
+					t.Errorf("%s %s %s on list %s: %d %s, want %d", name, route.method, route.path, id, w.Code, w.Body, want)
+				}
+			}
+		}
+	}
+}
+
+func TestOnlyAdminsAddLists(t *testing.T) {
+	cfg, _, api := testAPI(t)
+
+	for name, user := range testUsers {
+		want := 403
+
+		if name == "admin" {
+			want = 201
+		}
+
+		fake := resetDB(t, cfg)
+		w := call(api, user, "POST", "/api/v1/list/", `{"name":"New"}`)
+
+		if w.Code != want {
+			t.Errorf("%s adds a list: %d %s, want %d", name, w.Code, w.Body, want)
+		}
+
+		if added := len(fake.Lists()) == 4; added != (want == 201) {
+			t.Errorf("%s adds a list: added %v", name, added)
+		}
+	}
+}
@@ -22,85 +22,90 @@ package ui
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
 	"github.com/servian/TechChallengeApp/model"
 )
 
-// TaskID parameter.
-//
-// swagger:parameters deleteTask
-type TaskID struct {
-	// The ID of the task
-	//
-	// in: path
-	// min: 0
-	// required: true
-	ID int `json:"id"`
-}
-
-// Sucessful Task Array Response
-//
-// swagger:response allTasks
-type allTasks struct {
-	// in: body
-	// The tasks being returned
-	// required: true
-	Tasks []model.Task `json:"tasks"`
-}
-
-// swagger:route GET /api/task/ getTasks
-//
-// Fetch all tasks
-//
-//    Produces:
-//      - application/json
-//
-//    Responses:
-//      200: allTasks
+// getTasks - GET /api/task/
 //
+// Fetch all tasks of the lists the user can see, or the ones matching the
+// filters
 func getTasks(cfg Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		output, _ := db.GetAllTasks(cfg.DB)
-		js, _ := json.Marshal(output)
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, string(js))
+		filter, err := taskFilter(r.URL.Query())
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		output, err := db.FilterTasks(r.Context(), cfg.DB, filter)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		if output == nil {
+			output = []model.Task{}
+		}
+
+		writeJSON(w, 200, output)
 	})
 }
 
-// Sucessful Single Task Response
-//
-// swagger:response aTask
-type aTask struct {
-	// in: body
-	// The tasks being returned
-	// required: true
-	Task model.Task `json:"task"`
-}
+// taskFilter reads the filters of the task list from the query parameters
+func taskFilter(query url.Values) (db.TaskFilter, error) {
+	filter := db.TaskFilter{Search: query.Get("search")}
+
+	if value := query.Get("complete"); value != "" {
+		complete, err := strconv.ParseBool(value)
 
-// swagger:parameters addTask
-type taskParameter struct {
-	// in:body
-	Task model.Task `json:"task"`
+		if err != nil {
+			return filter, errors.New("complete must be true or false")
+		}
+
+		filter.Complete = &complete
+	}
+
+	for name, field := range map[string]**time.Time{"dueBefore": &filter.DueBefore, "dueAfter": &filter.DueAfter} {
+		if value := query.Get(name); value != "" {
+			due, err := time.Parse(time.RFC3339, value)
+
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a date-time like 2006-01-02T15:04:05Z", name)
+			}
+
+			*field = &due
+		}
+	}
+
+	if value := query.Get("list"); value != "" {
+		list, err := strconv.Atoi(value)
+
+		if err != nil {
+			return filter, errors.New("list must be the id of a list")
+		}
+
+		filter.ListID = list
+	}
+
+	return filter, nil
 }
 
-// swagger:route POST /api/task/ addTask
-//
-// Add a new task to the list.
-//
-//    Produces:
-//      - application/json
-//
-//    Responses:
-//      200: aTask
-//      400:
-//      500:
+// addTask - POST /api/task/
 //
+// Add a new task to its list, or to the first list the user can edit.
 func addTask(cfg Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
@@ -109,34 +114,68 @@ func addTask(cfg Config) http.Handler {
 		err := decoder.Decode(&task)
 
 		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), 400)
+			slog.WarnContext(r.Context(), "Invalid request to add task", "error", err)
+			writeProblem(w, r, 400, err.Error())
 			return
 		}
 
-		newTask, err := db.AddTask(cfg.DB, task)
+		newTask, err := db.AddTask(r.Context(), cfg.DB, task)
 
 		if err != nil {
-			log.Println(err)
-			http.Error(w, err.Error(), 500)
+			writeDbError(w, r, err)
 			return
 		}
 
-		js, _ := json.Marshal(newTask)
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, string(js))
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.TaskCreated, Task: newTask})
+
+		writeJSON(w, 200, newTask)
 	})
 }
 
-// swagger:route DELETE /api/task/{id}/ deleteTask
-//
-// Delete a Task by ID
+// updateTask - PUT /api/task/{id}/
 //
-// Responses:
-//    204:
-//    404:
-//    500:
+// Update a Task by ID, set its list to move it
+func updateTask(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		id, err := strconv.Atoi(vars["id"])
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error in update task", "error", err)
+			writeProblem(w, r, 500, internalError)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var task model.Task
+
+		err = decoder.Decode(&task)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to update task", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		task.ID = id
+
+		updated, err := db.UpdateTask(r.Context(), cfg.DB, task)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.TaskUpdated, Task: updated})
+
+		writeJSON(w, 200, updated)
+	})
+}
+
+// deleteTask - DELETE /api/task/{id}/
 //
+// Delete a Task by ID
 func deleteTask(cfg Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -144,25 +183,113 @@ func deleteTask(cfg Config) http.Handler {
 		id, err := strconv.Atoi(vars["id"])
 
 		if err != nil {
-			fmt.Print(err)
-			http.Error(w, err.Error(), 500)
+			slog.ErrorContext(r.Context(), "Error in delete task", "error", err)
+			writeProblem(w, r, 500, internalError)
 			return
 		}
 
-		err = db.DeleteTask(cfg.DB, model.Task{ID: id})
+		deleted, err := db.DeleteTask(r.Context(), cfg.DB, model.Task{ID: id})
 
 		if err != nil {
-			fmt.Print(err)
-			http.Error(w, err.Error(), 500)
+			writeDbError(w, r, err)
 			return
 		}
 
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.TaskDeleted, Task: model.Task{ID: id, ListID: deleted.ListID}})
+
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
 
-func apiHandler(cfg Config, router *mux.Router) {
+// heartbeatInterval keeps idle event streams from being closed by proxies
+const heartbeatInterval = 15 * time.Second
+
+// streamTasks - GET /api/task/stream
+//
+// Stream task changes as Server-Sent Events. Each event is named after the
+// change (created, updated or deleted) and carries the task as JSON data.
+// Only the changes of the lists the user can see are sent.
+func streamTasks(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		// the stream outlives the server write timeout
+		err := rc.SetWriteDeadline(time.Time{})
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Streaming not supported", "error", err)
+			writeProblem(w, r, 500, "Streaming is not supported")
+			return
+		}
+
+		sub, unsubscribe := cfg.Events.Subscribe()
+		defer unsubscribe()
+
+		visible := events.NewVisibility(r.Context(), cfg.DB)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		rc.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case e, ok := <-sub:
+				if !ok {
+					return
+				}
+
+				if !visible.Allows(e) {
+					continue
+				}
+
+				js, _ := json.Marshal(e.Task)
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, js)
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func apiHandler(cfg Config, router *mux.Router, version apiVersion) {
+	doc, err := loadSpec(version)
+
+	if err != nil {
+		panic("ui: the OpenAPI document is invalid, run TechChallengeApp openapi --check: " + err.Error())
+	}
+
+	router.Use(requireUser(cfg, doc, version.Prefix), validateRequests(doc, version.Prefix))
+
+	if version.Envelope {
+		router.Use(envelope)
+	}
+
 	router.Handle("/task/{id:[0-9]+}/", deleteTask(cfg)).Methods("DELETE")
+	router.Handle("/task/{id:[0-9]+}/", updateTask(cfg)).Methods("PUT")
+	router.Handle("/task/stream", streamTasks(cfg)).Methods("GET")
+	router.Handle("/task/export", exportTasks(cfg)).Methods("GET")
+	router.Handle("/task/import", importTasks(cfg)).Methods("POST")
+	router.Handle("/ws", websocketHandler(cfg)).Methods("GET")
+	router.Handle("/openapi.json", openapiHandler(version)).Methods("GET")
+
+	authHandler(cfg, router)
+	listHandler(cfg, router)
+	webhookHandler(cfg, router)
+	calendarHandler(cfg, router)
 	router.Handle("/task/", getTasks(cfg)).Methods("GET")
 	router.Handle("/task/", addTask(cfg)).Methods("POST")
 }
@@ -0,0 +1,80 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+func TestTaskResponsesAreNotFormatted(t *testing.T) {
+	_, _, api := testAPI(t)
+	title := "100% done, %d %s left"
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/api/v1/task/"},
+		{"PUT", "/api/v1/task/1/"},
+	}
+
+	for _, r := range requests {
+		w := call(api, testUsers["admin"], r.method, r.path, `{"title":"`+title+`"}`)
+
+		var body struct {
+			Data model.Task `json:"data"`
+		}
+
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Data.Title != title {
+			t.Errorf("%s %s: %d %s, want the title %q", r.method, r.path, w.Code, w.Body, title)
+		}
+	}
+
+	w := call(api, testUsers["admin"], "GET", "/api/v1/task/?search=done", "")
+
+	var body struct {
+		Data []model.Task `json:"data"`
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Data) != 2 || body.Data[0].Title != title {
+		t.Errorf("GET /api/v1/task/: %d %s, want the title %q twice", w.Code, w.Body, title)
+	}
+}
+
+func TestBlankTitlesAreRefused(t *testing.T) {
+	_, fake, api := testAPI(t)
+
+	for _, title := range []string{"", "  \t"} {
+		w := call(api, testUsers["admin"], "POST", "/api/v1/task/", `{"title":"`+strings.ReplaceAll(title, "\t", `\t`)+`"}`)
+
+		if w.Code != 400 || !strings.Contains(w.Body.String(), "#/title") {
+			t.Errorf("title %q: %d %s, want 400 for #/title", title, w.Code, w.Body)
+		}
+	}
+
+	if len(fake.Tasks()) != 3 {
+		t.Errorf("%d tasks, want the 3 tasks of the lists", len(fake.Tasks()))
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// assetgen builds the front-end of the ui package: app.jsx is compiled and
+// bundled with its css by esbuild, then every file is written to dist with
+// a content hash in its name, next to gzip and brotli variants and to the
+// manifest mapping the source names to the hashed ones.
+//
+// Run it with go generate ./ui after changing a file of ui/web, and commit
+// the result, building the application itself needs neither node nor npm.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// static files are copied as they are
+var static = []string{"servian_logo.png"}
+
+// compressible files get precompressed variants
+var compressible = map[string]bool{".js": true, ".css": true, ".svg": true, ".json": true}
+
+func main() {
+	src := flag.String("src", "web", "directory of the front-end sources")
+	out := flag.String("out", "dist", "directory the built assets are written to")
+	flag.Parse()
+
+	if err := build(*src, *out); err != nil {
+		slog.Error("Error building assets", "error", err)
+		os.Exit(1)
+	}
+}
+
+func build(src string, out string) error {
+	files, err := bundle(filepath.Join(src, "app.jsx"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range static {
+		data, err := os.ReadFile(filepath.Join(src, name))
+
+		if err != nil {
+			return err
+		}
+
+		files[name] = data
+	}
+
+	err = os.RemoveAll(out)
+
+	if err == nil {
+		err = os.MkdirAll(out, 0755)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	manifest := make(map[string]string, len(files))
+
+	for name, data := range files {
+		hashed := hashName(name, data)
+		manifest[name] = hashed
+
+		err = write(filepath.Join(out, hashed), data)
+
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Built asset", "file", hashed, "size", len(data))
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(out, "manifest.json"), append(data, '\n'), 0644)
+}
+
+// bundle compiles the entry point and everything it imports, it returns
+// the bundle by file name, app.js and app.css
+func bundle(entry string) (map[string][]byte, error) {
+	result := api.Build(api.BuildOptions{
+		EntryPoints:       []string{entry},
+		Bundle:            true,
+		Outdir:            "out",
+		Format:            api.FormatIIFE,
+		Target:            api.ES2017,
+		JSX:               api.JSXTransform,
+		JSXFactory:        "h",
+		MinifyWhitespace:  true,
+		MinifyIdentifiers: true,
+		MinifySyntax:      true,
+		Charset:           api.CharsetUTF8,
+		LegalComments:     api.LegalCommentsNone,
+		Write:             false,
+	})
+
+	if len(result.Errors) > 0 {
+		messages := api.FormatMessages(result.Errors, api.FormatMessagesOptions{Kind: api.ErrorMessage})
+		return nil, fmt.Errorf("%s", strings.Join(messages, "\n"))
+	}
+
+	files := make(map[string][]byte, len(result.OutputFiles))
+
+	for _, f := range result.OutputFiles {
+		files[filepath.Base(f.Path)] = f.Contents
+	}
+
+	return files, nil
+}
+
+// hashName adds the start of the sha256 of the content to the file name,
+// app.js becomes app.0123456789.js
+func hashName(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := filepath.Ext(name)
+
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:5]) + ext
+}
+
+// write writes the file, and its .gz and .br variants when they are smaller
+func write(path string, data []byte) error {
+	err := os.WriteFile(path, data, 0644)
+
+	if err != nil || !compressible[filepath.Ext(path)] {
+		return err
+	}
+
+	variants := []struct {
+		ext      string
+		compress func(*bytes.Buffer) error
+	}{
+		{".gz", func(buf *bytes.Buffer) error {
+			w, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+
+			return w.Close()
+		}},
+		{".br", func(buf *bytes.Buffer) error {
+			w := brotli.NewWriterLevel(buf, brotli.BestCompression)
+
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+
+			return w.Close()
+		}},
+	}
+
+	for _, v := range variants {
+		var buf bytes.Buffer
+
+		err = v.compress(&buf)
+
+		if err != nil {
+			return err
+		}
+
+		if buf.Len() >= len(data) {
+			continue
+		}
+
+		err = os.WriteFile(path+v.ext, buf.Bytes(), 0644)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func readManifest(t *testing.T, dir string) map[string]string {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := map[string]string{}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestDistIsUpToDate(t *testing.T) {
+	out := t.TempDir()
+
+	if err := build("../web", out); err != nil {
+		t.Fatal(err)
+	}
+
+	built, committed := readManifest(t, out), readManifest(t, "../dist")
+
+	for name, hashed := range built {
+		if committed[name] != hashed {
+			t.Errorf("%s is %s in ui/dist, %s once built, run go generate ./ui", name, committed[name], hashed)
+		}
+	}
+
+	if len(committed) != len(built) {
+		t.Errorf("ui/dist has %d assets, %d once built", len(committed), len(built))
+	}
+}
+
+func TestVariants(t *testing.T) {
+	out := t.TempDir()
+
+	if err := build("../web", out); err != nil {
+		t.Fatal(err)
+	}
+
+	m := readManifest(t, out)
+
+	for _, name := range []string{"app.js", "app.css"} {
+		data, err := os.ReadFile(filepath.Join(out, m[name]))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		readers := map[string]func(io.Reader) (io.Reader, error){
+			".gz": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+			".br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		}
+
+		for ext, reader := range readers {
+			f, err := os.Open(filepath.Join(out, m[name]+ext))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := reader(f)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := io.ReadAll(r)
+			f.Close()
+
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s%s does not decompress to %s: %v", m[name], ext, m[name], err)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(out, m["servian_logo.png"]+".gz")); !os.IsNotExist(err) {
+		t.Errorf("the logo is compressed: %v", err)
+	}
+}
+
+func TestHashName(t *testing.T) {
+	a, b := hashName("app.js", []byte("a")), hashName("app.js", []byte("b"))
+
+	if a == b {
+		t.Errorf("%s for different contents", a)
+	}
+
+	if a != hashName("app.js", []byte("a")) {
+		t.Error("the name changes for the same content")
+	}
+
+	if filepath.Ext(a) != ".js" || len(a) != len("app.0123456789.js") {
+		t.Errorf("got %s", a)
+	}
+}
+
+func TestBuildFails(t *testing.T) {
+	src := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(src, "app.jsx"), []byte("const = ;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := build(src, t.TempDir()); err == nil {
+		t.Error("no error for a syntax error")
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/auth"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Auth configures how the users sign in
+type Auth struct {
+	// Sessions keeps the sessions of the web UI, in memory with a random
+	// key when nil
+	Sessions *auth.Sessions
+
+	// Required refuses the api requests of anonymous clients, they are
+	// accepted otherwise
+	Required bool
+
+	// OIDC signs the users in with an OpenID Connect provider, single sign
+	// on is disabled when nil
+	OIDC *auth.OIDC
+}
+
+// signInExternalUser records the user signed in by the identity provider,
+// the tests replace it to run without a database
+var signInExternalUser = db.SignInExternalUser
+
+// credentials are what a user signs in with
+type credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// withUser records the user the request was authenticated as, the
+// principal of the calls made for the request
+func withUser(ctx context.Context, user model.User) context.Context {
+	return withClient(access.WithUser(ctx, user), "user:"+strconv.Itoa(user.ID))
+}
+
+// currentUser returns the user of the request, false for anonymous ones
+func currentUser(ctx context.Context) (model.User, bool) {
+	user := access.From(ctx).User
+
+	if user == nil {
+		return model.User{}, false
+	}
+
+	return *user, true
+}
+
+// safeMethod tells if the method only reads, other sites can make a browser
+// send these requests without any harm
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+// unauthorized replies 401 with the challenge of the bearer tokens
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="TechChallengeApp"`)
+	writeProblem(w, r, http.StatusUnauthorized, detail)
+}
+
+// authenticate identifies the user of the request by its bearer token, or
+// else by its session cookie. The requests with unsafe methods relying on
+// the cookie must carry the csrf token of the session, the browsers only
+// send the bearer tokens the scripts of the page set themselves. The
+// addresses sending too many invalid tokens are answered 429 before their
+// tokens are looked up, the session cookies can not be guessed as they are
+// encrypted
+func authenticate(cfg Config, limiter *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if header := r.Header.Get("Authorization"); header != "" {
+				if delay := limiter.failureDelay(r, time.Now()); delay > 0 {
+					limiter.throttle(w, r, delay)
+					return
+				}
+
+				token, ok := strings.CutPrefix(header, "Bearer ")
+
+				if !ok {
+					limiter.failed(r)
+					unauthorized(w, r, "Only bearer tokens are accepted in Authorization")
+					return
+				}
+
+				user, err := db.GetUserByToken(ctx, cfg.DB, strings.TrimSpace(token))
+
+				if err == db.ErrNotFound {
+					limiter.failed(r)
+					unauthorized(w, r, "The bearer token is invalid")
+					return
+				}
+
+				if err != nil {
+					slog.ErrorContext(ctx, "Could not check the bearer token", "error", err)
+					writeProblem(w, r, http.StatusInternalServerError, "Could not check the bearer token")
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(withUser(ctx, user)))
+				return
+			}
+
+			session, err := cfg.Auth.Sessions.Get(r)
+
+			if err == auth.ErrNoSession {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err != nil {
+				slog.ErrorContext(ctx, "Could not read the session", "error", err)
+				writeProblem(w, r, http.StatusInternalServerError, "Could not read the session")
+				return
+			}
+
+			if !safeMethod(r.Method) && !auth.CheckCSRF(r, session) {
+				writeProblem(w, r, http.StatusForbidden, "The csrf token is missing or invalid, send the value of the "+auth.CSRFCookie+" cookie in "+auth.CSRFHeader)
+				return
+			}
+
+			user, err := db.GetUser(ctx, cfg.DB, session.UserID)
+
+			// the user was deleted, the session is as good as expired
+			if err == db.ErrNotFound {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err != nil {
+				slog.ErrorContext(ctx, "Could not read the user of the session", "error", err)
+				writeProblem(w, r, http.StatusInternalServerError, "Could not read the session")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withUser(ctx, user)))
+		})
+	}
+}
+
+// public tells if anyone can call the operation, the other operations need
+// a user when authentication is required
+func public(op *openapi3.Operation) bool {
+	return op.Security != nil && len(*op.Security) == 0
+}
+
+// requireUser refuses the anonymous requests of the operations of the
+// OpenAPI document that are not public, when authentication is required
+func requireUser(cfg Config, doc *openapi3.T, prefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if !cfg.Auth.Required {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _, op := specOperation(doc, prefix, r)
+
+			if _, ok := currentUser(r.Context()); ok || op == nil || public(op) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			unauthorized(w, r, "Sign in or send a bearer token")
+		})
+	}
+}
+
+// adminOnly refuses the requests of anyone but the admins, for the
+// handlers showing the internals of the server
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := currentUser(r.Context()); !ok {
+			unauthorized(w, r, "Sign in as an admin or send the bearer token of one")
+			return
+		}
+
+		if err := access.From(r.Context()).CheckAdmin(); err != nil {
+			writeProblem(w, r, http.StatusForbidden, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// signedIn refuses the anonymous requests of a handler outside of the
+// OpenAPI document, when authentication is required
+func signedIn(cfg Config, next http.Handler) http.Handler {
+	if !cfg.Auth.Required {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := currentUser(r.Context()); !ok {
+			unauthorized(w, r, "Sign in or send a bearer token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// login - POST /api/auth/login
+//
+// Sign in to the web UI with a name and a password, the session is kept in
+// a cookie
+func login(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var creds credentials
+
+		err := json.NewDecoder(r.Body).Decode(&creds)
+
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		user, hash, err := db.GetUserByName(r.Context(), cfg.DB, creds.Name)
+
+		if err != nil && err != db.ErrNotFound {
+			writeDbError(w, r, err)
+			return
+		}
+
+		// the hash of an unknown name is empty, the password is still
+		// checked so both take as long
+		if !auth.CheckPassword(hash, creds.Password) {
+			slog.WarnContext(r.Context(), "Failed sign in", "name", creds.Name)
+			writeProblem(w, r, http.StatusUnauthorized, "The name or the password is wrong")
+			return
+		}
+
+		secure := isTLS(r, cfg.TrustedProxies)
+
+		// a new session is started even when one exists, so an id planted
+		// before signing in is never used after
+		err = cfg.Auth.Sessions.End(w, r, secure)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		_, err = cfg.Auth.Sessions.Start(r.Context(), w, user.ID, secure)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Signed in", "user", user.Name)
+		writeJSON(w, 200, user)
+	})
+}
+
+// logout - POST /api/auth/logout
+//
+// Sign out of the web UI, the session ends
+func logout(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := cfg.Auth.Sessions.End(w, r, isTLS(r, cfg.TrustedProxies))
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// getCurrentUser - GET /api/auth/me
+//
+// Fetch the user signed in
+func getCurrentUser(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r.Context())
+
+		if !ok {
+			unauthorized(w, r, "Not signed in")
+			return
+		}
+
+		writeJSON(w, 200, user)
+	})
+}
+
+// loginOIDC - GET /api/auth/oidc/login
+//
+// Sign in to the web UI with the OpenID Connect provider, the user is
+// redirected to it
+func loginOIDC(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Auth.OIDC == nil {
+			writeProblem(w, r, http.StatusNotFound, "Single sign on is not configured")
+			return
+		}
+
+		url, err := cfg.Auth.OIDC.Begin(w, cfg.Auth.Sessions, isTLS(r, cfg.TrustedProxies))
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Could not reach the identity provider", "error", err)
+			writeProblem(w, r, http.StatusBadGateway, "Could not reach the identity provider")
+			return
+		}
+
+		http.Redirect(w, r, url, http.StatusFound)
+	})
+}
+
+// oidcCallback - GET /api/auth/oidc/callback
+//
+// Complete a sign in with the OpenID Connect provider, which redirects the
+// user here. The user is created on their first sign in, and gets the role
+// of their groups on every sign in
+func oidcCallback(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Auth.OIDC == nil {
+			writeProblem(w, r, http.StatusNotFound, "Single sign on is not configured")
+			return
+		}
+
+		secure := isTLS(r, cfg.TrustedProxies)
+		identity, err := cfg.Auth.OIDC.Finish(w, r, cfg.Auth.Sessions, secure)
+
+		switch {
+		case errors.Is(err, auth.ErrFlow):
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, auth.ErrRefused):
+			slog.WarnContext(r.Context(), "Failed single sign on", "error", err)
+			writeProblem(w, r, http.StatusUnauthorized, err.Error())
+			return
+		case errors.Is(err, auth.ErrNoRole):
+			slog.WarnContext(r.Context(), "Single sign on of a user without a role", "user", identity.User.Name, "groups", identity.User.Groups)
+			writeProblem(w, r, http.StatusForbidden, err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "Could not reach the identity provider", "error", err)
+			writeProblem(w, r, http.StatusBadGateway, "Could not reach the identity provider")
+			return
+		}
+
+		user, err := signInExternalUser(r.Context(), cfg.DB, identity.Issuer, identity.Subject, identity.User)
+
+		if err == db.ErrUserExists {
+			writeProblem(w, r, http.StatusConflict, "The name "+identity.User.Name+" is taken by another user")
+			return
+		}
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		err = cfg.Auth.Sessions.End(w, r, secure)
+
+		if err == nil {
+			_, err = cfg.Auth.Sessions.Start(r.Context(), w, user.ID, secure)
+		}
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Signed in", "user", user.Name, "issuer", identity.Issuer)
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+}
+
+func authHandler(cfg Config, router *mux.Router) {
+	router.Handle("/auth/oidc/login", loginOIDC(cfg)).Methods("GET")
+	router.Handle("/auth/oidc/callback", oidcCallback(cfg)).Methods("GET")
+	router.Handle("/auth/login", login(cfg)).Methods("POST")
+	router.Handle("/auth/logout", logout(cfg)).Methods("POST")
+	router.Handle("/auth/me", getCurrentUser(cfg)).Methods("GET")
+}
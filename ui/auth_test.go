@@ -0,0 +1,187 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/auth"
+	"github.com/servian/TechChallengeApp/auth/oidctest"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+func TestOIDCCallback(t *testing.T) {
+	provider := oidctest.NewProvider("tasks", "s3cret")
+	defer provider.Close()
+
+	// the users already in the database, by name
+	existing := map[string]bool{"alice": true}
+	var signedIn model.User
+
+	signInExternalUser = func(ctx context.Context, cfg db.Config, issuer string, subject string, user model.User) (model.User, error) {
+		if existing[user.Name] {
+			return user, db.ErrUserExists
+		}
+
+		user.ID = 5
+		signedIn = user
+
+		return user, nil
+	}
+	defer func() { signInExternalUser = db.SignInExternalUser }()
+
+	tests := []struct {
+		name        string
+		defaultRole string
+		claims      map[string]interface{}
+		want        int
+		role        string
+	}{
+		{"new user", "", map[string]interface{}{"preferred_username": "bob", "groups": []string{"staff"}}, http.StatusFound, model.RoleEditor},
+		{"default role", model.RoleViewer, map[string]interface{}{"preferred_username": "carol"}, http.StatusFound, model.RoleViewer},
+		{"no role", "", map[string]interface{}{"preferred_username": "dave"}, http.StatusForbidden, ""},
+		{"name taken by another user", "", map[string]interface{}{"preferred_username": "alice", "groups": []string{"staff"}}, http.StatusConflict, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signedIn = model.User{}
+			provider.Claims = test.claims
+
+			cfg := Config{Auth: Auth{
+				Sessions: auth.NewSessions(auth.MemoryStore(), "", time.Hour),
+				OIDC: auth.NewOIDC(auth.OIDCConfig{
+					Issuer:        provider.URL,
+					ClientID:      provider.ClientID,
+					ClientSecret:  provider.ClientSecret,
+					RedirectURL:   "http://example.com/api/v1/auth/oidc/callback",
+					Scopes:        []string{"openid"},
+					UsernameClaim: "preferred_username",
+					GroupsClaim:   "groups",
+					Roles:         map[string]string{"staff": model.RoleEditor},
+					DefaultRole:   test.defaultRole,
+				}),
+			}}
+
+			w := httptest.NewRecorder()
+			loginOIDC(cfg).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/login", nil))
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("login: %d, want 302", w.Code)
+			}
+
+			callback, err := provider.SignIn(w.Header().Get("Location"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", callback.String(), nil)
+
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+
+			w = httptest.NewRecorder()
+			oidcCallback(cfg).ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Fatalf("callback: %d %s, want %d", w.Code, w.Body, test.want)
+			}
+
+			if test.want != http.StatusFound {
+				return
+			}
+
+			if signedIn.Role != test.role || signedIn.Name != test.claims["preferred_username"] {
+				t.Errorf("signed in %+v, want the role %s", signedIn, test.role)
+			}
+
+			session := false
+
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == auth.SessionCookie && cookie.Value != "" {
+					session = true
+				}
+			}
+
+			if !session || w.Header().Get("Location") != "/" {
+				t.Errorf("no session started, redirected to %q", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestSessionsNeedTheCSRFToken(t *testing.T) {
+	cfg := Config{DB: db.Config{DbName: t.Name()}}
+	cfg.Auth.Sessions = auth.NewSessions(auth.MemoryStore(), "", time.Hour)
+	resetDB(t, cfg)
+
+	handler := authenticate(cfg, newRateLimiter(cfg.RateLimit, nil, newMetrics(cfg), nil))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := currentUser(r.Context()); ok {
+			w.Write([]byte(user.Name))
+		}
+	}))
+
+	started := httptest.NewRecorder()
+	session, err := cfg.Auth.Sessions.Start(context.Background(), started, 2, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		csrf   string
+		status int
+		user   string
+	}{
+		{"safe method", "GET", "", http.StatusOK, "ed"},
+		{"unsafe method with the token", "POST", session.CSRF, http.StatusOK, "ed"},
+		{"unsafe method without the token", "POST", "", http.StatusForbidden, ""},
+		{"unsafe method with another token", "DELETE", "forged", http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/api/v1/task/", nil)
+
+		for _, cookie := range started.Result().Cookies() {
+			r.AddCookie(cookie)
+		}
+
+		if test.csrf != "" {
+			r.Header.Set(auth.CSRFHeader, test.csrf)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status || (test.user != "" && w.Body.String() != test.user) {
+			t.Errorf("%s: %d %s, want %d as %q", test.name, w.Code, w.Body, test.status, test.user)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/servian/TechChallengeApp/taskio"
+)
+
+// calendarName is the name calendar clients show for the feeds
+const calendarName = "Servian To Do"
+
+// writeCalendar writes the tasks the principal of the request can see, of
+// a single list when listID is not 0
+func writeCalendar(cfg Config, w http.ResponseWriter, r *http.Request, listID int) {
+	w.Header().Set("Content-Type", taskio.Calendar.ContentType())
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+
+	writer := taskio.NewCalendarWriter(w, calendarName)
+
+	err := db.ForEachTask(r.Context(), cfg.DB, listID, writer.Write)
+
+	if err != nil {
+		// the response has started, the client sees a truncated calendar
+		slog.ErrorContext(r.Context(), "Error reading tasks for the calendar", "error", err)
+		return
+	}
+
+	err = writer.Close()
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error writing calendar", "error", err)
+	}
+}
+
+// getCalendar - GET /api/task/calendar.ics
+//
+// Fetch all tasks of the lists the user can see as RFC 5545 VTODO
+// components
+func getCalendar(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeCalendar(cfg, w, r, 0)
+	})
+}
+
+// getCalendarFeed - GET /api/calendar/{token}.ics
+//
+// Fetch the tasks the user of the feed can see, of the list of the feed
+// when it has one, as RFC 5545 VTODO components through a secret feed url,
+// for calendar clients to subscribe to
+func getCalendarFeed(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed, err := db.GetCalendarFeedByToken(r.Context(), cfg.DB, mux.Vars(r)["token"])
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		// the feed shows what its user sees now, with its current role
+		user, err := db.GetUser(r.Context(), cfg.DB, feed.UserID)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		ctx := withUser(r.Context(), user)
+
+		if feed.ListID != 0 {
+			_, err = db.GetList(ctx, cfg.DB, feed.ListID)
+
+			if err != nil {
+				writeDbError(w, r, err)
+				return
+			}
+		}
+
+		writeCalendar(cfg, w, r.WithContext(ctx), feed.ListID)
+	})
+}
+
+// getCalendarFeeds - GET /api/calendar/feed/
+//
+// Fetch the calendar feeds of the user, of every user for the admins,
+// without their secret tokens
+func getCalendarFeeds(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feeds, err := db.GetCalendarFeeds(r.Context(), cfg.DB)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		if feeds == nil {
+			feeds = []model.CalendarFeed{}
+		}
+
+		writeJSON(w, 200, feeds)
+	})
+}
+
+// addCalendarFeed - POST /api/calendar/feed/
+//
+// Create a calendar feed of the tasks of the user, of one of its lists
+// when listId is set, with a new secret url. The response is the only time
+// the url is returned.
+func addCalendarFeed(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		var feed model.CalendarFeed
+
+		err := decoder.Decode(&feed)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to add calendar feed", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		feed.Name = strings.TrimSpace(feed.Name)
+
+		if feed.Name == "" {
+			writeProblem(w, r, 400, "name is required")
+			return
+		}
+
+		token := make([]byte, 24)
+		rand.Read(token)
+		feed.Token = hex.EncodeToString(token)
+
+		newFeed, err := db.AddCalendarFeed(r.Context(), cfg.DB, feed)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		// the feed is served by the version of the api it was created with
+		prefix := strings.TrimSuffix(r.URL.Path, "/calendar/feed/")
+		newFeed.URL = prefix + "/calendar/" + newFeed.Token + ".ics"
+
+		writeJSON(w, 201, newFeed)
+	})
+}
+
+// deleteCalendarFeed - DELETE /api/calendar/feed/{id}/
+//
+// Revoke a calendar feed of the user, of any user for the admins
+func deleteCalendarFeed(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = db.DeleteCalendarFeed(r.Context(), cfg.DB, id)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func calendarHandler(cfg Config, router *mux.Router) {
+	router.Handle("/task/calendar.ics", getCalendar(cfg)).Methods("GET")
+	router.Handle("/calendar/feed/", getCalendarFeeds(cfg)).Methods("GET")
+	router.Handle("/calendar/feed/", addCalendarFeed(cfg)).Methods("POST")
+	router.Handle("/calendar/feed/{id:[0-9]+}/", deleteCalendarFeed(cfg)).Methods("DELETE")
+	router.Handle("/calendar/{token:[0-9a-f]+}.ics", getCalendarFeed(cfg)).Methods("GET")
+}
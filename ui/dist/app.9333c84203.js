@@ -0,0 +1 @@
+(()=>{var k=Object.defineProperty,x=Object.defineProperties;var w=Object.getOwnPropertyDescriptors;var g=Object.getOwnPropertySymbols;var S=Object.prototype.hasOwnProperty,T=Object.prototype.propertyIsEnumerable;var h=(o,e,t)=>e in o?k(o,e,{enumerable:!0,configurable:!0,writable:!0,value:t}):o[e]=t,u=(o,e)=>{for(var t in e||(e={}))S.call(e,t)&&h(o,t,e[t]);if(g)for(var t of g(e))T.call(e,t)&&h(o,t,e[t]);return o},m=(o,e)=>x(o,w(e));var y="http://www.w3.org/2000/svg",C=new Set(["svg","path"]);function n(o,e,...t){if(e=e||{},typeof o=="function")return o(m(u({},e),{children:t}));let r=C.has(o),s=r?document.createElementNS(y,o):document.createElement(o);for(let[d,l]of Object.entries(e))d==="key"||l===void 0||l===null||l===!1||(d.startsWith("on")?s.addEventListener(d.slice(2).toLowerCase(),l):d==="className"?s.setAttribute("class",l):d==="value"&&!r?s.value=l:s.setAttribute(d,l===!0?"":l));return v(s,t),s}function v(o,e){for(let t of e)Array.isArray(t)?v(o,t):t instanceof Node?o.appendChild(t):t!=null&&t!==!1&&o.appendChild(document.createTextNode(String(t)))}var b="/api/v1",F=()=>{let o=document.cookie.split("; ").find(e=>e.startsWith("csrf_token="));return o?decodeURIComponent(o.slice(11)):""},c=(o,e={})=>{let t=u({},e.headers),r=F();return e.method&&e.method!=="GET"&&r!==""&&(t["X-CSRF-Token"]=r),fetch(b+o,m(u({},e),{headers:t}))},N=()=>n("svg",{viewBox:"0 0 16 16",width:"16",height:"16","aria-hidden":"true"},n("path",{fill:"currentColor",d:"M7 1h2v6h6v2H9v6H7V9H1V7h6z"})),E=()=>n("svg",{viewBox:"0 0 16 16",width:"14",height:"14","aria-hidden":"true"},n("path",{fill:"currentColor",d:"M5.5 1h5l.5 1H14v2H2V2h3zM3 5h10l-.8 10H3.8zm3 2v6h1V7zm3 0v6h1V7z"})),L=({task:o,onDelete:e})=>n("li",{key:o.id},n("span",{className:"delete",title:"Delete",onClick:()=>e(o)},n(E,null)),n("span",{className:"title"},o.title));function A({onAddTask:o}){let e=n("input",{id:"Title",name:"Title",type:"Text",placeholder:"title..."});return n("form",{onSubmit:r=>{r.preventDefault();let s=e.value;s!==""&&c("/task/",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({title:s,priority:1e3,complete:!1,id:0})}).then(d=>{if(d.ok)return d.json().then(l=>o(l.data)).then(()=>e.value="")})},className:"taskForm"},e,n("button",{title:"Add"},n(N,null)))}function z({onLogin:o}){let e=n("input",{name:"name",type:"text",placeholder:"name...",autocomplete:"username"}),t=n("input",{name:"password",type:"password",placeholder:"password...",autocomplete:"current-password"}),r=n("p",{className:"error"}),s=l=>{l.preventDefault(),c("/auth/login",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({name:e.value,password:t.value})}).then(p=>p.ok?o():p.json().then(f=>r.textContent=f.detail))},d=document.querySelector("#root").dataset.sso;return n("form",{onSubmit:s,className:"loginForm"},e,t,n("button",null,"Sign in"),d&&n("a",{className:"sso",href:d},"Sign in with single sign on"),r)}function D(){let o=n("p",{className:"account"}),e=t=>{t.preventDefault(),c("/auth/logout",{method:"POST"}).then(()=>location.reload())};return c("/auth/me").then(t=>t.ok?t.json():null).then(t=>{t&&o.replaceChildren(t.data.name+" ",n("a",{href:"#",onClick:e},"Sign out"))}),o}function H(o){let e=[{id:0,title:"Loading...",complete:!1,priority:0}],t=n("ul",{className:"theList"}),r=()=>{t.replaceChildren(...e.map(i=>n(L,{task:i,onDelete:p})))},s=i=>{e=e.filter(a=>a.id!==i.id),e.push(i),r()},d=i=>{e=e.map(a=>a.id===i.id?i:a),r()},l=i=>{e=e.filter(a=>a.id!==i.id),r()},p=i=>{l(i),c("/task/"+i.id+"/",{method:"DELETE"}).then(a=>a.ok||s(i))};o.replaceChildren(n("div",null,n(D,null),n("h1",null,"To Do"),n(A,{onAddTask:s}),t)),r();let f=()=>{let i=new EventSource(b+"/task/stream");i.addEventListener("created",a=>s(JSON.parse(a.data))),i.addEventListener("updated",a=>d(JSON.parse(a.data))),i.addEventListener("deleted",a=>l(JSON.parse(a.data))),window.addEventListener("pagehide",()=>i.close())};c("/task/").then(i=>{if(i.status===401){o.replaceChildren(n("div",null,n("h1",null,"Sign in"),n(z,{onLogin:()=>location.reload()})));return}return i.json().then(a=>{e=a.data||[],r(),f()})})}H(document.querySelector("#root"));})();
@@ -0,0 +1,206 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/servian/TechChallengeApp/db"
+)
+
+// checkTimeout bounds each dependency check so a hung database fails the
+// probe instead of blocking it
+const checkTimeout = 2 * time.Second
+
+// healthCheck is a dependency that must work for the application to serve requests
+type healthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a single check in the verbose report
+type checkResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// healthReport is returned by the probes when verbose is set
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// readinessChecks are the dependencies checked before taking traffic
+func readinessChecks(cfg Config) []healthCheck {
+	return []healthCheck{
+		{
+			Name: "database",
+			Check: func(ctx context.Context) error {
+				return db.Ping(ctx, cfg.DB)
+			},
+		},
+		{
+			Name: "migrations",
+			Check: func(ctx context.Context) error {
+				version, err := db.SchemaVersion(ctx, cfg.DB)
+
+				if err != nil {
+					return err
+				}
+
+				if version < db.LatestVersion() {
+					return fmt.Errorf("Schema is at version %d, %d expected, run updatedb -m", version, db.LatestVersion())
+				}
+
+				return nil
+			},
+		},
+	}
+}
+
+// runChecks runs the checks concurrently, and reports if all of them passed
+func runChecks(ctx context.Context, checks []healthCheck) healthReport {
+	report := healthReport{Status: "ok", Checks: make([]checkResult, len(checks))}
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Add(1)
+
+		go func(i int, check healthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+
+			result := checkResult{
+				Name:      check.Name,
+				Status:    "ok",
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+
+			report.Checks[i] = result
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != "ok" {
+			report.Status = "fail"
+			slog.WarnContext(ctx, "Health check failed", "check", result.Name, "error", result.Error)
+		}
+	}
+
+	return report
+}
+
+// healthHandler answers a probe with the outcome of the checks: 200 when
+// they all pass and 503 otherwise. The body is ok or the failed checks,
+// or the report as JSON when verbose=1
+func healthHandler(checks []healthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := runChecks(r.Context(), checks)
+
+		status := http.StatusOK
+
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+			writeJSON(w, status, report)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+
+		if status == http.StatusOK {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+
+		for _, result := range report.Checks {
+			if result.Status != "ok" {
+				fmt.Fprintf(w, "%s: %s\n", result.Name, result.Error)
+			}
+		}
+	})
+}
+
+// livezHandler - GET /livez
+//
+// Liveness probe, fails only when the process can no longer serve requests,
+// it does not depend on the database so an outage does not restart the app
+func livezHandler() http.Handler {
+	return healthHandler(nil)
+}
+
+// readyzHandler - GET /readyz
+//
+// Readiness probe, checks the database answers and its schema is up to date
+func readyzHandler(cfg Config) http.Handler {
+	return healthHandler(readinessChecks(cfg))
+}
+
+// healthcheckHandler is kept for the deployments probing /healthcheck/, it
+// runs the readiness checks and answers OK when they pass
+func healthcheckHandler(cfg Config) http.Handler {
+	checks := readinessChecks(cfg)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := runChecks(r.Context(), checks)
+
+		if report.Status != "ok" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			for _, result := range report.Checks {
+				if result.Status != "ok" {
+					fmt.Fprintf(w, "Error: %s: %s\n", result.Name, result.Error)
+				}
+			}
+
+			return
+		}
+
+		fmt.Fprintf(w, "OK")
+	})
+}
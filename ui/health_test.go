@@ -0,0 +1,192 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/db"
+)
+
+// probe sends a GET to a health handler
+func probe(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+	return w
+}
+
+func passing(name string) healthCheck {
+	return healthCheck{Name: name, Check: func(ctx context.Context) error { return nil }}
+}
+
+func failing(name string, err error) healthCheck {
+	return healthCheck{Name: name, Check: func(ctx context.Context) error { return err }}
+}
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []healthCheck
+		status int
+		body   string
+	}{
+		{"no checks", nil, 200, "ok\n"},
+		{"passing", []healthCheck{passing("a"), passing("b")}, 200, "ok\n"},
+		{"failing", []healthCheck{passing("a"), failing("b", errors.New("down"))}, 503, "b: down\n"},
+		{"all failing", []healthCheck{failing("a", errors.New("down")), failing("b", errors.New("slow"))}, 503, "a: down\nb: slow\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := probe(healthHandler(tt.checks), "/readyz")
+
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.status, tt.body)
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control is %q, want no-store", got)
+			}
+
+			if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Errorf("Content-Type is %q", got)
+			}
+		})
+	}
+}
+
+func TestHealthReport(t *testing.T) {
+	checks := []healthCheck{passing("a"), failing("b", errors.New("down"))}
+
+	w := probe(healthHandler(checks), "/readyz?verbose=1")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", w.Code)
+	}
+
+	var report healthReport
+
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+
+	if report.Status != "fail" || len(report.Checks) != 2 {
+		t.Fatalf("got %+v", report)
+	}
+
+	for i, want := range []checkResult{{Name: "a", Status: "ok"}, {Name: "b", Status: "fail", Error: "down"}} {
+		got := report.Checks[i]
+		got.LatencyMs = 0
+
+		if got != want {
+			t.Errorf("check %d is %+v, want %+v", i, got, want)
+		}
+	}
+
+	w = probe(healthHandler([]healthCheck{passing("a")}), "/readyz?verbose=true")
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ok"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestChecksHaveADeadline(t *testing.T) {
+	hung := healthCheck{Name: "hung", Check: func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+
+		if !ok || time.Until(deadline) > checkTimeout {
+			return errors.New("no deadline")
+		}
+
+		return nil
+	}}
+
+	if w := probe(healthHandler([]healthCheck{hung}), "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestLivezDoesNotNeedTheDatabase(t *testing.T) {
+	cfg := Config{DB: db.Config{DbName: t.Name()}}
+	fake := resetDB(t, cfg)
+	fake.FailOn(".")
+
+	if w := probe(livezHandler(), "/livez"); w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	cfg := Config{DB: db.Config{DbName: t.Name()}}
+	fake := resetDB(t, cfg)
+
+	fake.SetSchemaVersion(db.LatestVersion())
+
+	if w := probe(readyzHandler(cfg), "/readyz"); w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("up to date: got %d %q", w.Code, w.Body.String())
+	}
+
+	fake.SetSchemaVersion(db.LatestVersion() - 1)
+
+	want := "migrations: Schema is at version " + strconv.Itoa(db.LatestVersion()-1) + ", " + strconv.Itoa(db.LatestVersion()) + " expected, run updatedb -m\n"
+
+	if w := probe(readyzHandler(cfg), "/readyz"); w.Code != http.StatusServiceUnavailable || w.Body.String() != want {
+		t.Errorf("behind: got %d %q, want %q", w.Code, w.Body.String(), want)
+	}
+
+	fake.SetSchemaVersion(0)
+
+	if w := probe(readyzHandler(cfg), "/readyz"); w.Code != http.StatusServiceUnavailable || !strings.HasPrefix(w.Body.String(), "migrations: Schema is at version 0,") {
+		t.Errorf("not migrated: got %d %q", w.Code, w.Body.String())
+	}
+
+	fake.SetSchemaVersion(db.LatestVersion())
+	fake.FailOn("schema_migrations")
+
+	if w := probe(readyzHandler(cfg), "/readyz"); w.Code != http.StatusServiceUnavailable || !strings.HasPrefix(w.Body.String(), "migrations: ") {
+		t.Errorf("failing: got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestLegacyHealthcheck(t *testing.T) {
+	cfg := Config{DB: db.Config{DbName: t.Name()}}
+	fake := resetDB(t, cfg)
+
+	fake.SetSchemaVersion(db.LatestVersion())
+
+	if w := probe(healthcheckHandler(cfg), "/healthcheck/"); w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+
+	fake.SetSchemaVersion(db.LatestVersion() - 1)
+
+	if w := probe(healthcheckHandler(cfg), "/healthcheck/"); w.Code != http.StatusServiceUnavailable || !strings.HasPrefix(w.Body.String(), "Error: migrations: Schema is at version") {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -20,63 +20,194 @@
 
 package ui
 
+//go:generate go run ./assetgen
+
 import (
-	"expvar"
-	"fmt"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/GeertJohan/go.rice"
 	"github.com/gorilla/mux"
 )
 
-const (
-	cdnReact           = "https://cdnjs.cloudflare.com/ajax/libs/react/15.5.4/react.min.js"
-	cdnReactDom        = "https://cdnjs.cloudflare.com/ajax/libs/react/15.5.4/react-dom.min.js"
-	cdnBabelStandalone = "https://cdnjs.cloudflare.com/ajax/libs/babel-standalone/6.24.0/babel.min.js"
-	cdnAxios           = "https://cdnjs.cloudflare.com/ajax/libs/axios/0.16.1/axios.min.js"
-)
+// dist holds the front-end built by assetgen, see ui/web
+//
+//go:embed dist
+var dist embed.FS
+
+// staticPrefix is where the built assets are served, their names change
+// with their content so they are cached for good
+const staticPrefix = "/static/"
+
+// encodings are the precompressed variants of the assets, in order of preference
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
 
-const indexHTML = `
-<!DOCTYPE HTML>
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE HTML>
 <html>
   <head>
     <meta charset="utf-8">
 	<title>Servian Tech Challenge App</title>
-	<link rel="stylesheet" href="/css/site.css" type="text/css" />
-	<link href="https://fonts.googleapis.com/css?family=Arimo" rel="stylesheet">
-	<link href="https://fonts.googleapis.com/css?family=Roboto" rel="stylesheet">
-	<script defer src="https://use.fontawesome.com/releases/v5.0.6/js/all.js"></script>
+	<link rel="stylesheet" href="{{.Asset "app.css"}}" type="text/css" />
   </head>
   <body>
   	<header>
-    	<img src="/images/servian_logo.png" width="197" height="30"/>
+    	<img src="{{.Asset "servian_logo.png"}}" width="197" height="30"/>
     </header>
-    <div id='root'></div>
+    <div id='root'{{if .SingleSignOn}} data-sso='{{.SingleSignOn}}'{{end}}></div>
 	<footer>
         &COPY; Servian
 	</footer>
-	<script src="` + cdnReact + `"></script>
-    <script src="` + cdnReactDom + `"></script>
-    <script src="` + cdnBabelStandalone + `"></script>
-    <script src="` + cdnAxios + `"></script>
-	<script src="/js/app.jsx" type="text/babel"></script>
+	<script src="{{.Asset "app.js"}}"></script>
   </body>
 </html>
-`
+`))
+
+// indexPage is what the index template shows, SingleSignOn is the url
+// signing in with the identity provider when it is configured
+type indexPage struct {
+	manifest
+	SingleSignOn string
+}
+
+// manifest maps the names of the sources of the assets to their hashed names
+type manifest map[string]string
+
+// Asset returns the url of an asset
+func (m manifest) Asset(name string) string {
+	return staticPrefix + m[name]
+}
+
+func loadManifest(files fs.FS) (manifest, error) {
+	data, err := fs.ReadFile(files, "manifest.json")
 
-func indexHandler() http.Handler {
+	if err != nil {
+		return nil, err
+	}
+
+	m := manifest{}
+
+	err = json.Unmarshal(data, &m)
+
+	return m, err
+}
+
+func indexHandler(m manifest, sso string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, indexHTML)
+		// the page links the current assets, it has to be checked on every visit
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		indexTemplate.Execute(w, indexPage{manifest: m, SingleSignOn: sso})
+	})
+}
+
+// acceptsEncoding reports if the Accept-Encoding header of the request
+// allows the encoding
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+			if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+				continue
+			}
+
+			q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+
+			if !found {
+				return true
+			}
+
+			weight, err := strconv.ParseFloat(q, 64)
+
+			return err == nil && weight > 0
+		}
+	}
+
+	return false
+}
+
+// staticHandler serves the hashed assets of the manifest, with the
+// precompressed variant accepted by the client when there is one
+func staticHandler(files fs.FS, m manifest) http.Handler {
+	hashed := make(map[string]bool, len(m))
+
+	for _, name := range m {
+		hashed[name] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["file"]
+
+		if !hashed[name] {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+
+		file := name
+
+		for _, encoding := range encodings {
+			if _, err := fs.Stat(files, name+encoding.ext); err == nil && acceptsEncoding(r, encoding.name) {
+				w.Header().Set("Content-Encoding", encoding.name)
+				file = name + encoding.ext
+				break
+			}
+		}
+
+		f, err := files.Open(file)
+
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		defer f.Close()
+
+		http.ServeContent(w, r, name, time.Time{}, f.(io.ReadSeeker))
 	})
 }
 
 func uiHandler(cfg Config, router *mux.Router) {
-	box := rice.MustFindBox("assets")
-	staticFileServer := http.FileServer(box.HTTPBox())
-	router.Handle("/js/{path:.*}", staticFileServer)
-	router.Handle("/css/{path:.*}", staticFileServer)
-	router.Handle("/images/{path:.*}", staticFileServer)
-	router.Handle("/swagger/{path:.*}", staticFileServer)
-	router.Handle("/metrics", expvar.Handler())
-	router.Handle("/", indexHandler())
+	files := cfg.Assets
+
+	if files == nil {
+		files, _ = fs.Sub(dist, "dist")
+	}
+
+	m, err := loadManifest(files)
+
+	if err != nil {
+		panic("ui: the assets are not built, run go generate ./ui: " + err.Error())
+	}
+
+	router.Handle(staticPrefix+"{file}", staticHandler(files, m))
+	router.Handle("/swagger/{path:.*}", swaggerHandler())
+	sso := ""
+
+	if cfg.Auth.OIDC != nil {
+		sso = apiV1.Prefix + "/auth/oidc/login"
+	}
+
+	router.Handle("/", indexHandler(m, sso))
 }
@@ -0,0 +1,259 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package ui
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gorilla/mux"
+)
+
+// embedded returns the router of the front-end on the embedded assets and
+// their manifest
+func embedded(t *testing.T, cfg Config) (http.Handler, manifest) {
+	files, _ := fs.Sub(dist, "dist")
+	m, err := loadManifest(files)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	uiHandler(cfg, router)
+
+	return router, m
+}
+
+// fetch sends a GET to the router with the Accept-Encoding header
+func fetch(h http.Handler, path string, encoding string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+
+	if encoding != "" {
+		r.Header.Set("Accept-Encoding", encoding)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestEmbeddedAssets(t *testing.T) {
+	files, _ := fs.Sub(dist, "dist")
+	m, err := loadManifest(files)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"app.js", "app.css", "servian_logo.png"} {
+		hashed, ok := m[name]
+
+		if !ok {
+			t.Errorf("%s is not in the manifest", name)
+			continue
+		}
+
+		if _, err := fs.Stat(files, hashed); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	router, m := embedded(t, Config{})
+
+	w := fetch(router, "/", "")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control is %q, want no-cache", got)
+	}
+
+	for _, name := range []string{"app.js", "app.css", "servian_logo.png"} {
+		if !strings.Contains(w.Body.String(), `"`+m.Asset(name)+`"`) {
+			t.Errorf("the page does not link %s", m.Asset(name))
+		}
+	}
+
+	for _, cdn := range []string{"unpkg", "cdnjs", "jsdelivr", "https://"} {
+		if strings.Contains(w.Body.String(), cdn) {
+			t.Errorf("the page loads from %s", cdn)
+		}
+	}
+
+	if strings.Contains(w.Body.String(), "data-sso") {
+		t.Error("the page links the single sign-on without an identity provider")
+	}
+
+	w = fetch(indexHandler(m, "/api/v1/auth/oidc/login"), "/", "")
+
+	if !strings.Contains(w.Body.String(), `data-sso='/api/v1/auth/oidc/login'`) {
+		t.Errorf("the page does not link the single sign-on: %s", w.Body)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	router, m := embedded(t, Config{})
+	files, _ := fs.Sub(dist, "dist")
+	js, _ := fs.ReadFile(files, m["app.js"])
+
+	tests := []struct {
+		name     string
+		encoding string
+		want     string
+	}{
+		{"identity", "", ""},
+		{"gzip", "gzip", "gzip"},
+		{"brotli", "br", "br"},
+		{"brotli preferred", "gzip, br", "br"},
+		{"brotli refused", "gzip, br;q=0", "gzip"},
+		{"unknown", "deflate", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := fetch(router, m.Asset("app.js"), tt.encoding)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got %d", w.Code)
+			}
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.want {
+				t.Errorf("Content-Encoding is %q, want %q", got, tt.want)
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+				t.Errorf("Cache-Control is %q", got)
+			}
+
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary is %q", got)
+			}
+
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/javascript") {
+				t.Errorf("Content-Type is %q", got)
+			}
+
+			body := w.Body.Bytes()
+
+			if tt.want == "gzip" {
+				r, err := gzip.NewReader(w.Body)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				body, _ = io.ReadAll(r)
+			}
+
+			if tt.want != "br" && !bytes.Equal(body, js) {
+				t.Error("the content is not the one of the asset")
+			}
+		})
+	}
+}
+
+func TestStaticServesOnlyTheManifest(t *testing.T) {
+	router, m := embedded(t, Config{})
+
+	for _, path := range []string{
+		"/static/app.js",
+		"/static/manifest.json",
+		"/static/" + m["app.js"] + ".gz",
+		"/static/missing.0123456789.js",
+	} {
+		if w := fetch(router, path, "gzip"); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=0", false},
+		{"gzip;q=bad", false},
+		{"x-gzip", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+
+		if got := acceptsEncoding(r, "gzip"); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestAssetsOfTheConfig(t *testing.T) {
+	files := fstest.MapFS{
+		"manifest.json":  {Data: []byte(`{"app.js": "app.1.js", "app.css": "app.1.css", "servian_logo.png": "logo.1.png"}`)},
+		"app.1.js":       {Data: []byte("local()")},
+		"app.1.css":      {Data: []byte("body{}")},
+		"logo.1.png":     {Data: []byte("png")},
+		"app.1.js.gz":    {Data: []byte("not served")},
+		"unlisted.1.css": {Data: []byte("body{}")},
+	}
+
+	router := mux.NewRouter()
+	uiHandler(Config{Assets: files}, router)
+
+	if w := fetch(router, "/static/app.1.js", ""); w.Code != http.StatusOK || w.Body.String() != "local()" {
+		t.Errorf("got %d %q", w.Code, w.Body)
+	}
+
+	if w := fetch(router, "/static/unlisted.1.css", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unlisted: got %d, want 404", w.Code)
+	}
+
+	if w := fetch(router, "/", ""); !strings.Contains(w.Body.String(), `src="/static/app.1.js"`) {
+		t.Errorf("the page does not link the assets of the config: %s", w.Body)
+	}
+}
+
+func TestAssetsNeedAManifest(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic without a manifest")
+		}
+	}()
+
+	uiHandler(Config{Assets: fstest.MapFS{}}, mux.NewRouter())
+}
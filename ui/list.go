@@ -0,0 +1,287 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// decodeList reads a list from the body of the request, it must be named
+func decodeList(r *http.Request) (model.List, error) {
+	var list model.List
+
+	err := json.NewDecoder(r.Body).Decode(&list)
+
+	if err != nil {
+		return list, err
+	}
+
+	list.Name = strings.TrimSpace(list.Name)
+
+	if list.Name == "" {
+		return list, errors.New("The name of the list is missing")
+	}
+
+	return list, nil
+}
+
+// getLists - GET /api/list/
+//
+// Fetch the lists the user can see, with their role on each of them
+func getLists(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lists, err := db.GetLists(r.Context(), cfg.DB)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		if lists == nil {
+			lists = []model.List{}
+		}
+
+		writeJSON(w, 200, lists)
+	})
+}
+
+// addList - POST /api/list/
+//
+// Create a list, open to every user until it is shared with some of them.
+// Only the admins can.
+func addList(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, err := decodeList(r)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to add list", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		newList, err := db.AddList(r.Context(), cfg.DB, list)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.ListsChanged})
+
+		writeJSON(w, 201, newList)
+	})
+}
+
+func listID(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// updateList - PUT /api/list/{id}/
+//
+// Rename a list, the admins of the list can
+func updateList(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := listID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		list, err := decodeList(r)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to update list", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		list.ID = id
+
+		updated, err := db.UpdateList(r.Context(), cfg.DB, list)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		writeJSON(w, 200, updated)
+	})
+}
+
+// deleteList - DELETE /api/list/{id}/
+//
+// Delete a list with its tasks and members, the admins of the list can
+func deleteList(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := listID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = db.DeleteList(r.Context(), cfg.DB, id)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.ListsChanged})
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// getListMembers - GET /api/list/{id}/members/
+//
+// Fetch the users and groups a list is shared with, the admins of the list
+// can
+func getListMembers(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := listID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		members, err := db.GetMembers(r.Context(), cfg.DB, id)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		if members == nil {
+			members = []model.Member{}
+		}
+
+		writeJSON(w, 200, members)
+	})
+}
+
+// addListMember - POST /api/list/{id}/members/
+//
+// Share a list with a user or a group at a role, or change the role of a
+// member. Once a list has members only they can see it. The admins of the
+// list can
+func addListMember(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := listID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		var member model.Member
+
+		err = json.NewDecoder(r.Body).Decode(&member)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to add list member", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		if (member.User == "") == (member.Group == "") {
+			writeProblem(w, r, 400, "A member is either a user or a group")
+			return
+		}
+
+		if model.RoleRank(member.Role) == 0 {
+			writeProblem(w, r, 400, "The role must be one of "+strings.Join(model.Roles, ", "))
+			return
+		}
+
+		member.ListID = id
+
+		added, err := db.AddMember(r.Context(), cfg.DB, member)
+
+		if err == db.ErrUnknownUser {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.ListsChanged})
+
+		writeJSON(w, 200, added)
+	})
+}
+
+// deleteListMember - DELETE /api/list/{id}/members/{member}/
+//
+// Stop sharing a list with one of its members, the admins of the list can
+func deleteListMember(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := listID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		member, err := strconv.Atoi(mux.Vars(r)["member"])
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = db.DeleteMember(r.Context(), cfg.DB, id, member)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		cfg.Events.Publish(r.Context(), events.Event{Type: events.ListsChanged})
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func listHandler(cfg Config, router *mux.Router) {
+	router.Handle("/list/", getLists(cfg)).Methods("GET")
+	router.Handle("/list/", addList(cfg)).Methods("POST")
+	router.Handle("/list/{id:[0-9]+}/", updateList(cfg)).Methods("PUT")
+	router.Handle("/list/{id:[0-9]+}/", deleteList(cfg)).Methods("DELETE")
+	router.Handle("/list/{id:[0-9]+}/members/", getListMembers(cfg)).Methods("GET")
+	router.Handle("/list/{id:[0-9]+}/members/", addListMember(cfg)).Methods("POST")
+	router.Handle("/list/{id:[0-9]+}/members/{member:[0-9]+}/", deleteListMember(cfg)).Methods("DELETE")
+}
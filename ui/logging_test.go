@@ -0,0 +1,153 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/logging"
+)
+
+// capturingLogs logs to the buffer returned until the end of the test
+func capturingLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Format: "json", Level: "info"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &buf
+}
+
+func TestRequestIDs(t *testing.T) {
+	var seen string
+
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"id of a proxy", "a1b2c3d4-e5f6-4789-abcd-ef0123456789", true},
+		{"id of a load balancer", "Root=1-67891233-abcdef012345678912345678", true},
+		{"no id", "", false},
+		{"id with spaces", "id with spaces", false},
+		{"id with a newline", "forged\nlevel=ERROR", false},
+		{"id too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/task/", nil)
+
+		if test.header != "" {
+			r.Header.Set(requestIDHeader, test.header)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		id := w.Header().Get(requestIDHeader)
+
+		if id != seen {
+			t.Errorf("%s: answered %q, the context carried %q", test.name, id, seen)
+		}
+
+		if test.kept && id != test.header {
+			t.Errorf("%s: got %q, want the id of the request", test.name, id)
+		}
+
+		if !test.kept && (id == test.header || !validRequestID(id) || len(id) != 32) {
+			t.Errorf("%s: got %q, want a generated id", test.name, id)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := capturingLogs(t)
+
+	router := mux.NewRouter()
+	router.Use(accessLog)
+	router.Handle("/api/v1/task/{id}/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			writeProblem(w, r, http.StatusInternalServerError, internalError)
+			return
+		}
+
+		w.Write([]byte("{}"))
+	}))
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		r := httptest.NewRequest(method, "/api/v1/task/7/", nil)
+		r.Header.Set(requestIDHeader, "req-"+method)
+		withRequestID(router).ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var logged []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		record := map[string]interface{}{}
+
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+
+		if record["msg"] == "Request" {
+			logged = append(logged, record)
+		}
+	}
+
+	if len(logged) != 2 {
+		t.Fatalf("got the access logs %v, want one per request", logged)
+	}
+
+	want := []struct {
+		level  string
+		status float64
+		id     string
+	}{
+		{"INFO", 200, "req-PUT"},
+		{"ERROR", 500, "req-DELETE"},
+	}
+
+	for i, w := range want {
+		record := logged[i]
+
+		if record["level"] != w.level || record["status"] != w.status || record["request_id"] != w.id ||
+			record["route"] != "/api/v1/task/{id}/" || record["path"] != "/api/v1/task/7/" {
+			t.Errorf("got %v, want %s %v of %s", record, w.level, w.status, w.id)
+		}
+	}
+}
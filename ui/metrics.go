@@ -0,0 +1,251 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+)
+
+// metricsNamespace prefixes the application metrics
+const metricsNamespace = "techchallengeapp"
+
+// metrics - the prometheus metrics of the application
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+
+	throttled *prometheus.CounterVec
+}
+
+func newMetrics(cfg Config) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests being handled, by route template.",
+		}, []string{"route"}),
+
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_throttled_total",
+			Help:      "HTTP requests refused with 429 by the rate limit, by route template.",
+		}, []string{"route"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.inFlight,
+		m.throttled,
+		&taskCollector{cfg: cfg.DB},
+	)
+
+	pool, err := db.Pool(cfg.DB)
+
+	if err != nil {
+		slog.Warn("Database pool metrics disabled", "error", err)
+	} else {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(pool, cfg.DB.DbName))
+	}
+
+	return m
+}
+
+// handler serves the metrics in the prometheus text format, the metrics
+// that could be collected are still served when the database is down
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorLog:      log.Default(),
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// serveMetrics serves the metrics and the expvar variables to anyone on
+// their own listener, one only the scrapers can reach
+func serveMetrics(m *metrics, listener net.Listener) {
+	router := http.NewServeMux()
+	router.Handle("/metrics", m.handler())
+	router.Handle("/debug/vars", expvar.Handler())
+
+	server := &http.Server{
+		Handler:        router,
+		ReadTimeout:    60 * time.Second,
+		WriteTimeout:   60 * time.Second,
+		MaxHeaderBytes: 1 << 16,
+	}
+
+	server.Serve(listener)
+}
+
+// middleware records the requests handled by the routes of the router
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		inFlight := m.inFlight.WithLabelValues(route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		code := strconv.Itoa(rec.Status())
+		m.requests.WithLabelValues(route, r.Method, code).Inc()
+		m.duration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeTemplate is the template of the route of the request, unknown when
+// no route matched
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+
+	return "unknown"
+}
+
+// responseRecorder captures the status code of a response, while still
+// letting handlers flush, hijack or reach the original writer
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+
+	return n, err
+}
+
+// Status is the status code sent to the client, 200 when nothing was sent
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+
+	return rec.status
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+
+	// a hijacked connection is switching protocols
+	rec.status = http.StatusSwitchingProtocols
+
+	return h.Hijack()
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// taskCollector reports how many tasks are open and completed each time
+// the metrics are scraped
+type taskCollector struct {
+	cfg db.Config
+}
+
+var tasksDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metricsNamespace, "", "tasks"),
+	"Tasks in the database, by state.",
+	[]string{"state"}, nil,
+)
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tasksDesc
+}
+
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	open, completed, err := db.CountTasks(access.AsSystem(context.Background()), c.cfg)
+
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(tasksDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(tasksDesc, prometheus.GaugeValue, float64(open), "open")
+	ch <- prometheus.MustNewConstMetric(tasksDesc, prometheus.GaugeValue, float64(completed), "completed")
+}
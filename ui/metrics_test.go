@@ -0,0 +1,57 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/model"
+)
+
+func TestMetricsAreForAdmins(t *testing.T) {
+	handler := adminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# metrics"))
+	}))
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{"anonymous", context.Background(), http.StatusUnauthorized},
+		{"viewer", withUser(context.Background(), model.User{ID: 1, Role: model.RoleViewer}), http.StatusForbidden},
+		{"editor", withUser(context.Background(), model.User{ID: 2, Role: model.RoleEditor}), http.StatusForbidden},
+		{"admin", withUser(context.Background(), model.User{ID: 3, Role: model.RoleAdmin}), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil).WithContext(test.ctx)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("%s: %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
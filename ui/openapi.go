@@ -0,0 +1,792 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/auth"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// specVersion is the version of the api described by the OpenAPI document
+const specVersion = "1.0.0"
+
+// specModels are the go types of the schemas of the document, CheckSpec
+// reports the fields missing from either side
+var specModels = map[string]reflect.Type{
+	"Task":            reflect.TypeOf(model.Task{}),
+	"Webhook":         reflect.TypeOf(model.Webhook{}),
+	"WebhookDelivery": reflect.TypeOf(model.WebhookDelivery{}),
+	"CalendarFeed":    reflect.TypeOf(model.CalendarFeed{}),
+	"ImportResult":    reflect.TypeOf(db.ImportResult{}),
+	"User":            reflect.TypeOf(model.User{}),
+	"Credentials":     reflect.TypeOf(credentials{}),
+	"List":            reflect.TypeOf(model.List{}),
+	"Member":          reflect.TypeOf(model.Member{}),
+}
+
+// operation helps describing a route
+type operation struct {
+	*openapi3.Operation
+}
+
+func newOperation(id string, summary string) operation {
+	op := openapi3.NewOperation()
+	op.OperationID = id
+	op.Summary = summary
+	op.Responses = openapi3.NewResponsesWithCapacity(4)
+
+	return operation{op}
+}
+
+func (op operation) param(p *openapi3.Parameter) operation {
+	op.AddParameter(p)
+	return op
+}
+
+func (op operation) body(description string, content openapi3.Content) operation {
+	op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().
+		WithDescription(description).
+		WithRequired(true).
+		WithContent(content)}
+
+	return op
+}
+
+func (op operation) response(status int, description string, content openapi3.Content) operation {
+	op.AddResponse(status, openapi3.NewResponse().WithDescription(description).WithContent(content))
+	return op
+}
+
+// public lets anyone call the operation, even when authentication is
+// required
+func (op operation) public() operation {
+	op.Security = openapi3.NewSecurityRequirements()
+	return op
+}
+
+// fails documents the errors of the operation
+func (op operation) fails(statuses ...int) operation {
+	for _, status := range statuses {
+		if op.Responses.Status(status) == nil {
+			op.response(status, http.StatusText(status), errorContent())
+		}
+	}
+
+	return op
+}
+
+func schemaRef(name string) *openapi3.SchemaRef {
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, nil)
+}
+
+func arrayOf(name string) *openapi3.SchemaRef {
+	array := openapi3.NewArraySchema()
+	array.Items = schemaRef(name)
+
+	return array.NewRef()
+}
+
+func jsonContent(schema *openapi3.SchemaRef) openapi3.Content {
+	return openapi3.NewContentWithJSONSchemaRef(schema)
+}
+
+// textContent is a plain file in any of the media types
+func textContent(mediaTypes ...string) openapi3.Content {
+	return openapi3.NewContentWithSchema(openapi3.NewStringSchema(), mediaTypes)
+}
+
+// errorContent is the body of an error, the problem details of an invalid
+// request, or the message of the handler
+func errorContent() openapi3.Content {
+	return openapi3.Content{
+		"application/problem+json": openapi3.NewMediaType().WithSchemaRef(schemaRef("Problem")),
+	}
+}
+
+func idParam(name string, description string) *openapi3.Parameter {
+	return openapi3.NewPathParameter(name).
+		WithDescription(description).
+		WithSchema(openapi3.NewInt64Schema().WithMin(0))
+}
+
+// fileFormats are the formats of the import and export, see taskio
+var fileFormats = []string{"application/json", "text/csv", "text/markdown", "text/calendar"}
+
+func formatParam(description string) *openapi3.Parameter {
+	return openapi3.NewQueryParameter("format").
+		WithDescription(description).
+		WithSchema(openapi3.NewStringSchema().WithEnum("json", "csv", "md", "ics"))
+}
+
+func specSchemas() openapi3.Schemas {
+	dateTime := func(description string) *openapi3.Schema {
+		s := openapi3.NewDateTimeSchema()
+		s.Description = description
+		return s
+	}
+
+	describe := func(s *openapi3.Schema, description string) *openapi3.Schema {
+		s.Description = description
+		return s
+	}
+
+	roles := func() *openapi3.Schema {
+		return openapi3.NewStringSchema().WithEnum(model.RoleViewer, model.RoleEditor, model.RoleAdmin)
+	}
+
+	task := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema().WithMin(0), "The id of the task, ignored when creating or updating it")).
+		WithProperty("priority", describe(openapi3.NewInt64Schema().WithMin(0), "Where the task fits in the list")).
+		WithProperty("title", describe(openapi3.NewStringSchema().WithMinLength(1).WithPattern(`\S`), "The task name or description, not blank")).
+		WithProperty("complete", describe(openapi3.NewBoolSchema(), "Is the task finished")).
+		WithProperty("due", dateTime("When the task has to be finished by").WithNullable()).
+		WithProperty("completedAt", dateTime("When the task was finished, set by the server when it is marked complete").WithNullable()).
+		WithProperty("listId", describe(openapi3.NewInt64Schema().WithMin(0), "The list of the task. A new task goes to the first list the user can edit when 0 or missing, an updated task stays in its list"))
+	task.Required = []string{"title"}
+	task.WithoutAdditionalProperties()
+
+	events := openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithEnum("created", "updated", "deleted"))
+
+	hook := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema().WithMin(0), "The id of the webhook")).
+		WithProperty("url", describe(openapi3.NewStringSchema().WithFormat("uri"), "Where the events are posted to, an absolute http or https url")).
+		WithProperty("secret", describe(openapi3.NewStringSchema(), "Key used to sign the payloads with HMAC-SHA256, generated when empty. Only returned when the webhook is created.")).
+		WithProperty("events", describe(events, "The task events to deliver, all events are delivered when empty")).
+		WithProperty("active", describe(openapi3.NewBoolSchema().WithDefault(true), "Is the webhook receiving events"))
+	hook.Required = []string{"url"}
+	hook.WithoutAdditionalProperties()
+
+	delivery := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema(), "The id of the delivery")).
+		WithProperty("webhookId", describe(openapi3.NewInt64Schema(), "The webhook the event is delivered to")).
+		WithProperty("event", describe(openapi3.NewStringSchema(), "The task event being delivered")).
+		WithProperty("payload", describe(openapi3.NewStringSchema(), "The body posted to the webhook")).
+		WithProperty("status", describe(openapi3.NewStringSchema().WithEnum(model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead), "pending, delivered, or dead once every attempt failed")).
+		WithProperty("attempts", describe(openapi3.NewInt64Schema(), "How many times the delivery was attempted")).
+		WithProperty("nextAttemptAt", dateTime("When the next attempt happens, while pending")).
+		WithProperty("lastError", describe(openapi3.NewStringSchema(), "Why the last attempt failed")).
+		WithProperty("responseStatus", describe(openapi3.NewInt64Schema(), "HTTP status returned by the last attempt")).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithProperty("updatedAt", openapi3.NewDateTimeSchema())
+	delivery.Required = []string{"id", "webhookId", "event", "status"}
+
+	feed := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema().WithMin(0), "The id of the feed")).
+		WithProperty("name", describe(openapi3.NewStringSchema().WithMinLength(1), "Who or what the feed is for")).
+		WithProperty("listId", describe(openapi3.NewInt64Schema().WithMin(0), "The list the feed shows, every list the user of the feed can see when 0 or missing")).
+		WithProperty("userId", describe(openapi3.NewInt64Schema(), "The user the feed shows the tasks of, the user who created it. Ignored when creating a feed")).
+		WithProperty("token", describe(openapi3.NewStringSchema(), "The secret part of the feed url, only returned when the feed is created")).
+		WithProperty("url", describe(openapi3.NewStringSchema(), "Path of the feed, only returned when the feed is created"))
+	feed.Required = []string{"name"}
+	feed.WithoutAdditionalProperties()
+
+	result := openapi3.NewObjectSchema().
+		WithProperty("created", describe(openapi3.NewInt64Schema(), "Tasks created")).
+		WithProperty("updated", describe(openapi3.NewInt64Schema(), "Tasks overwritten")).
+		WithProperty("skipped", describe(openapi3.NewInt64Schema(), "Tasks skipped as their id already exists")).
+		WithProperty("dryRun", describe(openapi3.NewBoolSchema(), "Nothing was imported, the counts are what would have been"))
+
+	user := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema().WithMin(0), "The id of the user")).
+		WithProperty("name", describe(openapi3.NewStringSchema(), "The name the user signs in with")).
+		WithProperty("role", describe(roles(), "What the user can do")).
+		WithProperty("groups", describe(openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()), "The groups of the user, given by the identity provider"))
+	user.Required = []string{"id", "name", "role"}
+
+	list := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema().WithMin(0), "The id of the list")).
+		WithProperty("name", describe(openapi3.NewStringSchema().WithMinLength(1), "The name of the list")).
+		WithProperty("shared", describe(openapi3.NewBoolSchema(), "Is the list only open to its members, set by the server")).
+		WithProperty("role", describe(roles(), "What the user can do with the list, set by the server"))
+	list.Required = []string{"name"}
+	list.WithoutAdditionalProperties()
+
+	member := openapi3.NewObjectSchema().
+		WithProperty("id", describe(openapi3.NewInt64Schema().WithMin(0), "The id of the membership")).
+		WithProperty("listId", describe(openapi3.NewInt64Schema().WithMin(0), "The list the member belongs to, set by the server")).
+		WithProperty("user", describe(openapi3.NewStringSchema(), "The name of the user, when the member is not a group")).
+		WithProperty("group", describe(openapi3.NewStringSchema(), "The group, as given by the identity provider, when the member is not a user")).
+		WithProperty("role", describe(roles(), "What the member can do with the list"))
+	member.Required = []string{"role"}
+	member.WithoutAdditionalProperties()
+
+	creds := openapi3.NewObjectSchema().
+		WithProperty("name", describe(openapi3.NewStringSchema().WithMinLength(1), "The name of the user")).
+		WithProperty("password", describe(openapi3.NewStringSchema().WithMinLength(1), "The password of the user"))
+	creds.Required = []string{"name", "password"}
+	creds.WithoutAdditionalProperties()
+
+	invalid := openapi3.NewObjectSchema().
+		WithProperty("detail", describe(openapi3.NewStringSchema(), "Why the value is invalid")).
+		WithProperty("pointer", describe(openapi3.NewStringSchema(), "JSON pointer of the invalid value of the body, e.g. #/title")).
+		WithProperty("parameter", describe(openapi3.NewStringSchema(), "Name of the invalid parameter")).
+		WithProperty("in", describe(openapi3.NewStringSchema().WithEnum("path", "query", "header"), "Where the invalid parameter is"))
+	invalid.Required = []string{"detail"}
+
+	problem := openapi3.NewObjectSchema().
+		WithProperty("type", openapi3.NewStringSchema()).
+		WithProperty("title", openapi3.NewStringSchema()).
+		WithProperty("status", openapi3.NewInt64Schema()).
+		WithProperty("detail", openapi3.NewStringSchema()).
+		WithProperty("instance", openapi3.NewStringSchema()).
+		WithProperty("errors", describe(openapi3.NewArraySchema().WithItems(invalid), "The invalid values of the request"))
+	problem.Description = "RFC 9457 problem details, returned when a request does not match this document"
+	problem.Required = []string{"type", "title", "status"}
+
+	return openapi3.Schemas{
+		"Problem":         problem.NewRef(),
+		"Task":            task.NewRef(),
+		"Webhook":         hook.NewRef(),
+		"WebhookDelivery": delivery.NewRef(),
+		"CalendarFeed":    feed.NewRef(),
+		"ImportResult":    result.NewRef(),
+		"User":            user.NewRef(),
+		"Credentials":     creds.NewRef(),
+		"List":            list.NewRef(),
+		"Member":          member.NewRef(),
+	}
+}
+
+// securitySchemes are how the clients authenticate, with a bearer token or
+// with the session cookie of the web UI, see authenticate
+func securitySchemes() openapi3.SecuritySchemes {
+	bearer := openapi3.NewSecurityScheme()
+	bearer.Type = "http"
+	bearer.Scheme = "bearer"
+	bearer.Description = "An api token of a user, created with TechChallengeApp user token"
+
+	cookie := openapi3.NewSecurityScheme()
+	cookie.Type = "apiKey"
+	cookie.In = "cookie"
+	cookie.Name = auth.SessionCookie
+	cookie.Description = "The session of the web UI, set by /auth/login. The requests with other methods than GET must send the value of the " +
+		auth.CSRFCookie + " cookie in the " + auth.CSRFHeader + " header"
+
+	return openapi3.SecuritySchemes{
+		"bearerToken":   &openapi3.SecuritySchemeRef{Value: bearer},
+		"sessionCookie": &openapi3.SecuritySchemeRef{Value: cookie},
+	}
+}
+
+// specMediaType is the media type of the OpenAPI document, it is not
+// application/json so the document is not wrapped in an envelope
+const specMediaType = "application/vnd.oai.openapi+json;version=3.0"
+
+// apiSpec describes every route of apiHandler as an OpenAPI 3 document
+func apiSpec(version apiVersion) *openapi3.T {
+	description := "Manage a shared to do list, its webhooks and calendar feeds. Successful JSON responses are wrapped as {\"data\": ...}."
+
+	if !version.Envelope {
+		description = "Manage a shared to do list, its webhooks and calendar feeds. This is the legacy api, kept for the existing clients, new clients use " + apiV1.Prefix + "."
+	}
+
+	description += " Anonymous clients are accepted unless the server requires authentication." +
+		" The tasks belong to lists, open to every user with the role of the user, or shared with some users and groups at a role." +
+		" Viewers read the tasks, editors also change them, and admins also manage the lists, their members, the webhooks and the calendar feeds."
+
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "TechChallengeApp",
+			Description: description,
+			Version:     specVersion,
+		},
+		Servers:    openapi3.Servers{{URL: version.Prefix}},
+		Paths:      openapi3.NewPaths(),
+		Components: &openapi3.Components{Schemas: specSchemas(), SecuritySchemes: securitySchemes()},
+		Security: openapi3.SecurityRequirements{
+			openapi3.NewSecurityRequirement().Authenticate("bearerToken"),
+			openapi3.NewSecurityRequirement().Authenticate("sessionCookie"),
+		},
+	}
+
+	add := func(method string, path string, op operation) {
+		// the parameters and body are validated, see validateRequests
+		if len(op.Parameters) > 0 || op.RequestBody != nil {
+			op.fails(400)
+		}
+
+		if op.RequestBody != nil {
+			op.fails(413, 415)
+		}
+
+		// an invalid bearer token is refused, and so are the anonymous
+		// requests when authentication is required, see authenticate
+		op.fails(401)
+
+		// the requests changing anything with the session cookie need the
+		// csrf token, and a role allowing the change
+		if method != "GET" {
+			op.fails(403)
+		}
+
+		// every request counts towards the rate limit, see rateLimiter
+		op.fails(429)
+
+		item := doc.Paths.Find(path)
+
+		if item == nil {
+			item = &openapi3.PathItem{}
+			doc.Paths.Set(path, item)
+		}
+
+		item.SetOperation(method, op.Operation)
+	}
+
+	taskID := idParam("id", "The id of the task")
+	webhookID := idParam("id", "The id of the webhook")
+	listID := idParam("id", "The id of the list")
+
+	add("GET", "/task/", newOperation("getTasks", "Fetch all tasks of the lists the user can see by id, or the ones matching the filters").
+		param(openapi3.NewQueryParameter("complete").
+			WithDescription("Only the finished tasks when true, the open ones when false").
+			WithSchema(openapi3.NewBoolSchema())).
+		param(openapi3.NewQueryParameter("search").
+			WithDescription("Only the tasks whose title contains it, ignoring case").
+			WithSchema(openapi3.NewStringSchema())).
+		param(openapi3.NewQueryParameter("dueBefore").
+			WithDescription("Only the tasks due before it").
+			WithSchema(openapi3.NewDateTimeSchema())).
+		param(openapi3.NewQueryParameter("dueAfter").
+			WithDescription("Only the tasks due after it").
+			WithSchema(openapi3.NewDateTimeSchema())).
+		param(openapi3.NewQueryParameter("list").
+			WithDescription("Only the tasks of the list").
+			WithSchema(openapi3.NewInt64Schema().WithMin(0))).
+		response(200, "The tasks", jsonContent(arrayOf("Task"))).
+		fails(400, 404, 500))
+
+	add("POST", "/task/", newOperation("addTask", "Add a new task to its list, or to the first list the user can edit").
+		body("The task", jsonContent(schemaRef("Task"))).
+		response(200, "The task created", jsonContent(schemaRef("Task"))).
+		fails(400, 404, 500))
+
+	add("PUT", "/task/{id}/", newOperation("updateTask", "Update a task by id, set its list to move it to another list").
+		param(taskID).
+		body("The task", jsonContent(schemaRef("Task"))).
+		response(200, "The task updated", jsonContent(schemaRef("Task"))).
+		fails(400, 404, 500))
+
+	add("DELETE", "/task/{id}/", newOperation("deleteTask", "Delete a task by id").
+		param(taskID).
+		response(204, "The task was deleted", nil).
+		fails(404, 500))
+
+	add("GET", "/task/stream", newOperation("streamTasks", "Stream the changes of the tasks of the lists the user can see as Server-Sent Events, each event is named after the change, created, updated or deleted, and carries the task as JSON").
+		response(200, "The event stream", textContent("text/event-stream")).
+		fails(500))
+
+	add("GET", "/task/export", newOperation("exportTasks", "Export all tasks of the lists the user can see as a JSON array, a CSV file, a Markdown checklist or an iCalendar file").
+		param(formatParam("The file format, json by default")).
+		response(200, "The file", textContent(fileFormats...)).
+		fails(400))
+
+	add("POST", "/task/import", newOperation("importTasks", "Import tasks from a JSON array, a CSV file, a Markdown checklist or an iCalendar file in a single transaction").
+		param(formatParam("The file format, inferred from the Content-Type when missing")).
+		param(openapi3.NewQueryParameter("dryRun").
+			WithDescription("Check the file and report what would be imported without importing it").
+			WithSchema(openapi3.NewBoolSchema())).
+		param(openapi3.NewQueryParameter("conflict").
+			WithDescription("What to do with tasks whose id already exists").
+			WithSchema(openapi3.NewStringSchema().WithEnum(db.ConflictSkip, db.ConflictOverwrite, db.ConflictFail).WithDefault(db.ConflictSkip))).
+		param(openapi3.NewQueryParameter("list").
+			WithDescription("The list of the tasks without one, the first list the user can edit when missing").
+			WithSchema(openapi3.NewInt64Schema().WithMin(0))).
+		body("The file", textContent(fileFormats...)).
+		response(200, "What the import did, or would have done on a dry run", jsonContent(schemaRef("ImportResult"))).
+		fails(400, 404, 409, 500))
+
+	add("GET", "/task/calendar.ics", newOperation("getCalendar", "Fetch all tasks of the lists the user can see as RFC 5545 VTODO components").
+		response(200, "The calendar", textContent("text/calendar")))
+
+	add("GET", "/calendar/feed/", newOperation("getCalendarFeeds", "Fetch the calendar feeds of the user, of every user for the admins, without their secret urls").
+		response(200, "The feeds", jsonContent(arrayOf("CalendarFeed"))).
+		fails(403, 500))
+
+	add("POST", "/calendar/feed/", newOperation("addCalendarFeed", "Create a calendar feed of the tasks the user can see, of one of its lists when listId is set, with a new secret url. The response is the only time the url is returned").
+		body("The feed", jsonContent(schemaRef("CalendarFeed"))).
+		response(201, "The feed created", jsonContent(schemaRef("CalendarFeed"))).
+		fails(400, 403, 404, 500))
+
+	add("DELETE", "/calendar/feed/{id}/", newOperation("deleteCalendarFeed", "Delete a calendar feed of the user, of any user for the admins, its url stops working").
+		param(idParam("id", "The id of the calendar feed")).
+		response(204, "The feed was deleted", nil).
+		fails(400, 403, 404, 500))
+
+	add("GET", "/calendar/{token}.ics", newOperation("getCalendarFeed", "Fetch the tasks the user of the feed can see, of the list of the feed when it has one, as RFC 5545 VTODO components through a secret feed url, for calendar clients to subscribe to").
+		public().
+		param(openapi3.NewPathParameter("token").
+			WithDescription("The secret token of the calendar feed").
+			WithSchema(openapi3.NewStringSchema().WithPattern("^[0-9a-f]+$"))).
+		response(200, "The calendar", textContent("text/calendar")).
+		fails(404))
+
+	add("GET", "/webhook/", newOperation("getWebhooks", "Fetch all webhook subscriptions, only the admins manage the webhooks, they receive the events of every list").
+		response(200, "The webhooks", jsonContent(arrayOf("Webhook"))).
+		fails(403, 500))
+
+	add("POST", "/webhook/", newOperation("addWebhook", "Subscribe a webhook to task events, the response is the only time the secret used to sign the payloads is returned").
+		body("The webhook", jsonContent(schemaRef("Webhook"))).
+		response(201, "The webhook created", jsonContent(schemaRef("Webhook"))).
+		fails(400, 403, 500))
+
+	add("GET", "/webhook/{id}/", newOperation("getWebhook", "Fetch a webhook subscription").
+		param(webhookID).
+		response(200, "The webhook", jsonContent(schemaRef("Webhook"))).
+		fails(400, 403, 404, 500))
+
+	add("PUT", "/webhook/{id}/", newOperation("updateWebhook", "Update a webhook subscription, the secret is kept when empty").
+		param(webhookID).
+		body("The webhook", jsonContent(schemaRef("Webhook"))).
+		response(200, "The webhook updated", jsonContent(schemaRef("Webhook"))).
+		fails(400, 403, 404, 500))
+
+	add("DELETE", "/webhook/{id}/", newOperation("deleteWebhook", "Delete a webhook subscription and its deliveries").
+		param(webhookID).
+		response(204, "The webhook was deleted", nil).
+		fails(400, 403, 404, 500))
+
+	add("GET", "/webhook/{id}/deliveries/", newOperation("getWebhookDeliveries", "Fetch the delivery log of a webhook, newest first").
+		param(webhookID).
+		param(openapi3.NewQueryParameter("limit").
+			WithDescription("How many deliveries to return").
+			WithSchema(openapi3.NewInt64Schema().WithMin(1).WithMax(maxDeliveryLimit).WithDefault(defaultDeliveryLimit))).
+		response(200, "The deliveries", jsonContent(arrayOf("WebhookDelivery"))).
+		fails(400, 403, 404, 500))
+
+	add("POST", "/webhook/{id}/deliveries/{delivery}/retry", newOperation("retryWebhookDelivery", "Queue a dead delivery again").
+		param(webhookID).
+		param(idParam("delivery", "The id of the delivery")).
+		response(202, "The delivery is queued", nil).
+		fails(400, 403, 404, 500))
+
+	add("GET", "/list/", newOperation("getLists", "Fetch the lists the user can see, with the role of the user on each of them").
+		response(200, "The lists", jsonContent(arrayOf("List"))).
+		fails(500))
+
+	add("POST", "/list/", newOperation("addList", "Create a list, open to every user until it is shared with some of them. Only the admins can").
+		body("The list", jsonContent(schemaRef("List"))).
+		response(201, "The list created", jsonContent(schemaRef("List"))).
+		fails(400, 403, 500))
+
+	add("PUT", "/list/{id}/", newOperation("updateList", "Rename a list, the admins of the list can").
+		param(listID).
+		body("The list", jsonContent(schemaRef("List"))).
+		response(200, "The list updated", jsonContent(schemaRef("List"))).
+		fails(400, 403, 404, 500))
+
+	add("DELETE", "/list/{id}/", newOperation("deleteList", "Delete a list with its tasks and members, the admins of the list can").
+		param(listID).
+		response(204, "The list was deleted", nil).
+		fails(400, 403, 404, 500))
+
+	add("GET", "/list/{id}/members/", newOperation("getListMembers", "Fetch the users and groups a list is shared with, the admins of the list can").
+		param(listID).
+		response(200, "The members", jsonContent(arrayOf("Member"))).
+		fails(400, 403, 404, 500))
+
+	add("POST", "/list/{id}/members/", newOperation("addListMember", "Share a list with a user, by name, or a group at a role, or change the role of a member. Once a list has members only they can see it. The admins of the list can").
+		param(listID).
+		body("The member", jsonContent(schemaRef("Member"))).
+		response(200, "The member", jsonContent(schemaRef("Member"))).
+		fails(400, 403, 404, 500))
+
+	add("DELETE", "/list/{id}/members/{member}/", newOperation("deleteListMember", "Stop sharing a list with one of its members, the admins of the list can").
+		param(listID).
+		param(idParam("member", "The id of the membership")).
+		response(204, "The member was removed", nil).
+		fails(400, 403, 404, 500))
+
+	add("GET", "/ws", newOperation("websocket", "Edit tasks collaboratively over a websocket, see doc/websocket.md").
+		response(101, "The connection is upgraded to a websocket", nil).
+		fails(400))
+
+	add("POST", "/auth/login", newOperation("login", "Sign in to the web UI with a name and a password, the session is kept in a cookie along with its csrf token").
+		public().
+		body("The name and password", jsonContent(schemaRef("Credentials"))).
+		response(200, "The user signed in", jsonContent(schemaRef("User"))).
+		fails(400, 500))
+
+	add("GET", "/auth/oidc/login", newOperation("loginOIDC", "Sign in to the web UI with the OpenID Connect provider, the user is redirected to it").
+		public().
+		response(302, "Redirect to the identity provider", nil).
+		fails(404, 502))
+
+	add("GET", "/auth/oidc/callback", newOperation("oidcCallback", "Complete a sign in with the OpenID Connect provider, which redirects the user here. The user is created on their first sign in, and gets the role of their groups on every sign in").
+		public().
+		param(openapi3.NewQueryParameter("code").
+			WithDescription("The authorization code").
+			WithSchema(openapi3.NewStringSchema())).
+		param(openapi3.NewQueryParameter("state").
+			WithDescription("The state of the sign in").
+			WithSchema(openapi3.NewStringSchema())).
+		param(openapi3.NewQueryParameter("error").
+			WithDescription("Why the provider refused the sign in").
+			WithSchema(openapi3.NewStringSchema())).
+		param(openapi3.NewQueryParameter("error_description").
+			WithDescription("Details of the error").
+			WithSchema(openapi3.NewStringSchema())).
+		response(302, "Signed in, redirect to the web UI", nil).
+		fails(400, 403, 404, 409, 500, 502))
+
+	add("POST", "/auth/logout", newOperation("logout", "Sign out of the web UI, the session ends").
+		public().
+		response(204, "The session ended", nil).
+		fails(500))
+
+	add("GET", "/auth/me", newOperation("getCurrentUser", "Fetch the user signed in").
+		response(200, "The user", jsonContent(schemaRef("User"))))
+
+	add("GET", "/openapi.json", newOperation("getOpenAPI", "Fetch this document").
+		public().
+		response(200, "The OpenAPI document", openapi3.NewContentWithSchema(openapi3.NewObjectSchema(), []string{specMediaType})))
+
+	if version.Envelope {
+		wrapResponses(doc)
+	}
+
+	return doc
+}
+
+// wrapResponses describes the envelope of the successful JSON responses
+func wrapResponses(doc *openapi3.T) {
+	for _, item := range doc.Paths.Map() {
+		for _, op := range item.Operations() {
+			for status, response := range op.Responses.Map() {
+				media := response.Value.Content.Get("application/json")
+
+				if media == nil || !strings.HasPrefix(status, "2") {
+					continue
+				}
+
+				data := openapi3.NewObjectSchema().WithPropertyRef("data", media.Schema)
+				data.Required = []string{"data"}
+				media.Schema = data.NewRef()
+			}
+		}
+	}
+}
+
+// openapiHandler serves the OpenAPI document of a version of the api
+func openapiHandler(version apiVersion) http.Handler {
+	js, err := json.Marshal(apiSpec(version))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding the OpenAPI document", "error", err)
+			writeProblem(w, r, 500, internalError)
+			return
+		}
+
+		w.Header().Set("Content-Type", specMediaType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(js)
+	})
+}
+
+// swaggerInitializer points the swagger ui at the OpenAPI documents, the
+// current version first. The validator badge is off, the content security
+// policy does not let it load from another origin
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    urls: [
+      {url: "/api/v1/openapi.json", name: "v1"},
+      {url: "/api/openapi.json", name: "legacy"}
+    ],
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout",
+    validatorUrl: null
+  });
+};
+`
+
+// swaggerHandler serves the swagger ui embedded in the binary
+func swaggerHandler() http.Handler {
+	files := http.FileServer(http.FS(swaggerFiles.FS))
+
+	return http.StripPrefix("/swagger/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "swagger-initializer.js" {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Write([]byte(swaggerInitializer))
+			return
+		}
+
+		files.ServeHTTP(w, r)
+	}))
+}
+
+// routeVariable matches the variables of a mux route template, the
+// pattern they must match is not part of an OpenAPI path
+var routeVariable = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// specPath is the path of the document matching a route template of the
+// version served under prefix
+func specPath(prefix string, template string) string {
+	return routeVariable.ReplaceAllString(strings.TrimPrefix(template, prefix), "{$1}")
+}
+
+// specDrift lists the routes missing from the document, the operations of
+// the document that are not routed, and the fields of the schemas that do
+// not match their go type
+func specDrift(router *mux.Router, prefix string, doc *openapi3.T) []string {
+	routed := map[string]bool{}
+
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+
+		if err != nil {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+
+		// prefixes and subrouters have no methods
+		if err != nil {
+			return nil
+		}
+
+		path := specPath(prefix, template)
+
+		for _, method := range methods {
+			routed[method+" "+path] = true
+		}
+
+		return nil
+	})
+
+	var problems []string
+
+	documented := map[string]bool{}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+
+			if !routed[method+" "+path] {
+				problems = append(problems, fmt.Sprintf("%s is documented but not routed", method+" "+path))
+			}
+		}
+	}
+
+	for route := range routed {
+		if !documented[route] {
+			problems = append(problems, fmt.Sprintf("%s is not documented", route))
+		}
+	}
+
+	for name, t := range specModels {
+		schema := doc.Components.Schemas[name]
+
+		if schema == nil {
+			problems = append(problems, fmt.Sprintf("schema %s is missing", name))
+			continue
+		}
+
+		fields := map[string]bool{}
+
+		for i := 0; i < t.NumField(); i++ {
+			field, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+
+			if field == "" || field == "-" {
+				continue
+			}
+
+			fields[field] = true
+
+			if schema.Value.Properties[field] == nil {
+				problems = append(problems, fmt.Sprintf("schema %s is missing the field %s of %s", name, field, t))
+			}
+		}
+
+		for property := range schema.Value.Properties {
+			if !fields[property] {
+				problems = append(problems, fmt.Sprintf("schema %s has the property %s, which %s does not", name, property, t))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+
+	return problems
+}
+
+// loadSpec returns the OpenAPI document with its references resolved, as
+// needed to validate requests against it
+func loadSpec(version apiVersion) (*openapi3.T, error) {
+	js, err := json.Marshal(apiSpec(version))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return openapi3.NewLoader().LoadFromData(js)
+}
+
+// CheckSpec verifies the OpenAPI documents are valid and describe every
+// route of their version of the api, and nothing more
+func CheckSpec() error {
+	for _, version := range apiVersions {
+		doc, err := loadSpec(version)
+
+		if err != nil {
+			return fmt.Errorf("The OpenAPI document of %s is invalid: %v", version.Prefix, err)
+		}
+
+		err = doc.Validate(context.Background())
+
+		if err != nil {
+			return fmt.Errorf("The OpenAPI document of %s is invalid: %v", version.Prefix, err)
+		}
+
+		router := mux.NewRouter()
+		apiHandler(Config{}, router.PathPrefix(version.Prefix).Subrouter(), version)
+
+		problems := specDrift(router, version.Prefix, doc)
+
+		if len(problems) > 0 {
+			return fmt.Errorf("The OpenAPI document of %s does not match the routes:\n  %s", version.Prefix, strings.Join(problems, "\n  "))
+		}
+	}
+
+	return nil
+}
+
+// Spec returns the OpenAPI document of the current version of the api as JSON
+func Spec() ([]byte, error) {
+	return json.MarshalIndent(apiSpec(apiV1), "", "  ")
+}
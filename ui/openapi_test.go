@@ -0,0 +1,64 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCheckSpec(t *testing.T) {
+	err := CheckSpec()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpecDrift(t *testing.T) {
+	doc, err := loadSpec(apiV1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix(apiV1.Prefix).Subrouter()
+	apiHandler(Config{}, api, apiV1)
+	api.Handle("/undocumented/{id:[0-9]+}/", http.NotFoundHandler()).Methods("GET")
+
+	problems := specDrift(router, apiV1.Prefix, doc)
+
+	if len(problems) != 1 || !strings.Contains(problems[0], "GET /undocumented/{id}/ is not documented") {
+		t.Errorf("drift of an undocumented route: %q", problems)
+	}
+
+	delete(doc.Components.Schemas["Task"].Value.Properties, "title")
+
+	problems = specDrift(router, apiV1.Prefix, doc)
+
+	if len(problems) != 2 {
+		t.Errorf("drift of a missing field: %q", problems)
+	}
+}
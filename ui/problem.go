@@ -0,0 +1,90 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+)
+
+// internalError is the detail of the 500 responses, the errors themselves
+// are only logged
+const internalError = "The request could not be completed, try again later"
+
+// problem is an RFC 9457 problem details response
+type problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Errors   []problemError `json:"errors,omitempty"`
+}
+
+// problemError is one of the reasons a request is invalid, pointer is the
+// JSON pointer of the invalid value of the body, parameter the name of the
+// invalid parameter
+type problemError struct {
+	Detail    string `json:"detail"`
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	In        string `json:"in,omitempty"`
+}
+
+// writeProblem replies with the problem details of status
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, errs ...problemError) {
+	js, _ := json.Marshal(problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Errors:   errs,
+	})
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// writeDbError replies with 404 when the row does not exist or the user
+// can not see it, 403 when the role of the user does not allow the change,
+// 500 otherwise
+func writeDbError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, db.ErrNotFound) {
+		writeProblem(w, r, 404, err.Error())
+		return
+	}
+
+	if errors.Is(err, access.ErrForbidden) {
+		writeProblem(w, r, 403, err.Error())
+		return
+	}
+
+	slog.ErrorContext(r.Context(), "Database error", "error", err)
+	writeProblem(w, r, 500, internalError)
+}
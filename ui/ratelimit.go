@@ -0,0 +1,297 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit configures the token buckets limiting the api requests of each
+// client
+type RateLimit struct {
+	// Rate is how many requests per second a client can make, 0 disables
+	// the limit
+	Rate float64
+
+	// Burst is how many requests a client can make at once
+	Burst int
+}
+
+// idleClient is how long the bucket of a client is kept after its last
+// request, a full bucket is the same as a new one
+const idleClient = 10 * time.Minute
+
+type clientKey struct{}
+
+// withClient identifies the client of a request once it is authenticated,
+// its requests are then limited by identity rather than by address
+func withClient(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientKey{}, id)
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// rateLimiter keeps a token bucket per client
+type rateLimiter struct {
+	cfg      RateLimit
+	trusted  []netip.Prefix
+	m        *metrics
+	failures *Failures
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// newRateLimiter creates the limiter of the requests, the invalid
+// credentials are counted with failures, in buckets of their own when nil
+func newRateLimiter(cfg RateLimit, trusted []netip.Prefix, m *metrics, failures *Failures) *rateLimiter {
+	if failures == nil {
+		failures = NewFailures(cfg)
+	}
+
+	return &rateLimiter{cfg: cfg, trusted: trusted, m: m, failures: failures, buckets: make(map[string]*bucket)}
+}
+
+// client identifies the client of the request: the identity it was
+// authenticated with, or its address. Credentials are not used before they
+// are checked, a client could otherwise get a new bucket by sending a new
+// token
+func (l *rateLimiter) client(r *http.Request) string {
+	if id, ok := r.Context().Value(clientKey{}).(string); ok && id != "" {
+		return id
+	}
+
+	return "ip:" + clientIP(r, l.trusted).String()
+}
+
+// reserve takes a token from the bucket of the client, it returns how long
+// to wait for one when the bucket is empty
+func (l *rateLimiter) reserve(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) > idleClient {
+		for key, b := range l.buckets {
+			if now.Sub(b.seen) > idleClient {
+				delete(l.buckets, key)
+			}
+		}
+
+		l.swept = now
+	}
+
+	b, ok := l.buckets[client]
+
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.cfg.Rate), l.cfg.Burst)}
+		l.buckets[client] = b
+	}
+
+	b.seen = now
+	reservation := b.limiter.ReserveN(now, 1)
+
+	if !reservation.OK() {
+		return time.Second
+	}
+
+	delay := reservation.DelayFrom(now)
+
+	if delay > 0 {
+		// the request is refused, it does not use the token
+		reservation.CancelAt(now)
+	}
+
+	return delay
+}
+
+// middleware answers 429 to the clients making requests faster than the
+// rate, with the seconds to wait in Retry-After
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	if l.cfg.Rate <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := l.reserve(l.client(r), time.Now())
+
+		if delay <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		l.throttle(w, r, delay)
+	})
+}
+
+// throttle answers 429 with the seconds to wait in Retry-After
+func (l *rateLimiter) throttle(w http.ResponseWriter, r *http.Request, delay time.Duration) {
+	l.m.throttled.WithLabelValues(routeTemplate(r)).Inc()
+
+	seconds := int(math.Ceil(delay.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeProblem(w, r, http.StatusTooManyRequests, "Too many requests, retry after the seconds of Retry-After")
+}
+
+// failureDelay returns how long the address of the request has to wait
+// before its credentials are checked again. Credentials are checked before
+// the requests are limited, the failures are counted by address so
+// guessing tokens is limited too
+func (l *rateLimiter) failureDelay(r *http.Request, now time.Time) time.Duration {
+	return l.failures.Delay(clientIP(r, l.trusted), now)
+}
+
+// failed counts invalid credentials sent from the address of the request
+func (l *rateLimiter) failed(r *http.Request) {
+	l.failures.Failed(clientIP(r, l.trusted))
+}
+
+// Failures counts the invalid credentials sent from each address, in token
+// buckets of the rate limit. The HTTP and gRPC servers share them, so
+// guessing tokens is as slow on both.
+type Failures struct {
+	l *rateLimiter
+}
+
+// NewFailures creates the buckets of the invalid credentials, nothing is
+// throttled when the rate is 0
+func NewFailures(cfg RateLimit) *Failures {
+	return &Failures{l: &rateLimiter{cfg: cfg, buckets: make(map[string]*bucket)}}
+}
+
+// Delay returns how long the address has to wait before its credentials
+// are checked again, once it sent as many invalid ones as the burst
+func (f *Failures) Delay(ip netip.Addr, now time.Time) time.Duration {
+	l := f.l
+
+	if l.cfg.Rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip.String()]
+
+	if !ok {
+		return 0
+	}
+
+	tokens := b.limiter.TokensAt(now)
+
+	if tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - tokens) / l.cfg.Rate * float64(time.Second))
+}
+
+// Failed counts invalid credentials sent from the address
+func (f *Failures) Failed(ip netip.Addr) {
+	if f.l.cfg.Rate <= 0 {
+		return
+	}
+
+	f.l.reserve(ip.String(), time.Now())
+}
+
+// clientIP is the address of the client of the request. When the request
+// comes from a trusted proxy the address is the last one of X-Forwarded-For
+// not added by a trusted proxy
+func clientIP(r *http.Request, trusted []netip.Prefix) netip.Addr {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	ip := addr.Addr().Unmap()
+
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	var hops []string
+
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+
+		// a proxy wrote garbage, the last valid hop is the client
+		if err != nil {
+			return ip
+		}
+
+		ip = hop.Unmap()
+
+		if !isTrusted(ip, trusted) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limitBody refuses the bodies larger than max bytes, with 413 when the
+// length is known up front, and stops reading them otherwise. 0 is no limit
+func limitBody(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("The body is larger than %d bytes", max))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInvalidTokensAreThrottled(t *testing.T) {
+	cfg := Config{RateLimit: RateLimit{Rate: 0.01, Burst: 2}}
+	limiter := newRateLimiter(cfg.RateLimit, nil, newMetrics(cfg), nil)
+
+	handler := authenticate(cfg, limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(addr string, header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/v1/task/", nil)
+		r.RemoteAddr = addr
+
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	for i := 0; i < cfg.RateLimit.Burst; i++ {
+		if w := send("192.0.2.1:1234", "Basic YWxpY2U6c2VjcmV0"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("invalid credentials %d: %d, want 401", i, w.Code)
+		}
+	}
+
+	w := send("192.0.2.1:1234", "Basic YWxpY2U6c2VjcmV0")
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("credentials over the burst: %d, retry after %q, want 429", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if w := send("192.0.2.1:1234", ""); w.Code != http.StatusNoContent {
+		t.Errorf("anonymous request of the same address: %d, want 204", w.Code)
+	}
+
+	if w := send("192.0.2.2:1234", "Basic YWxpY2U6c2VjcmV0"); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid credentials of another address: %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS is the policy for the browsers of other origins calling the api
+type CORS struct {
+	// Origins are the origins allowed, e.g. https://example.com, * allows
+	// every origin. CORS is disabled when empty
+	Origins []string
+
+	// Methods and Headers are the methods and request headers allowed
+	Methods []string
+	Headers []string
+
+	// Credentials lets the browsers send cookies and authorization headers,
+	// it can not be used with every origin
+	Credentials bool
+
+	// MaxAge is how long the browsers cache a preflight response
+	MaxAge time.Duration
+}
+
+// exposedHeaders are the response headers the scripts of other origins
+// can read
+var exposedHeaders = []string{"Location", "Retry-After", requestIDHeader, "Deprecation", "Sunset", "Link"}
+
+// allows tells if the origin is allowed by the policy
+func (c CORS) allows(origin string) bool {
+	for _, o := range c.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cors adds the headers of the policy to the responses to the allowed
+// origins, and answers their preflight requests
+func cors(c CORS) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(c.Origins) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+
+			if origin == "" || !c.allows(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the origin is only echoed when it can differ between requests
+			if len(c.Origins) == 1 && c.Origins[0] == "*" {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if c.Credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the browser compares the requested method and headers with
+			// the allowed ones
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+
+			if len(c.Headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+			}
+
+			if c.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// optionsHandler answers the OPTIONS requests that are not a preflight of
+// an allowed origin, the cors middleware answers the others
+func optionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProblem(w, r, http.StatusMethodNotAllowed, "OPTIONS is only answered to the preflight requests of the allowed origins")
+	})
+}
+
+// SecurityHeaders configures the headers added to every response
+type SecurityHeaders struct {
+	// HSTS is the max-age of Strict-Transport-Security, sent on the
+	// requests made over TLS. 0 disables it
+	HSTS time.Duration
+
+	// FrameAncestors are the origins allowed to embed the pages in a
+	// frame, none when empty
+	FrameAncestors []string
+}
+
+// contentSecurityPolicy is the policy of the embedded ui, which only loads
+// its own scripts, styles and images and talks to its own api and
+// websocket
+const contentSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self'; " +
+	"img-src 'self' data:; connect-src 'self'; font-src 'self'; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'"
+
+// swaggerSecurityPolicy relaxes the styles for the swagger ui, which sets
+// inline styles
+const swaggerSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; connect-src 'self'; font-src 'self'; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'"
+
+// securityHeaders adds the content security policy and the other headers
+// hardening the browsers against sniffing, framing and downgrades. TLS is on
+// when the server terminates it, or when a trusted proxy says so in
+// X-Forwarded-Proto
+func securityHeaders(cfg SecurityHeaders, trusted []netip.Prefix) func(http.Handler) http.Handler {
+	ancestors := "'none'"
+
+	if len(cfg.FrameAncestors) > 0 {
+		ancestors = strings.Join(cfg.FrameAncestors, " ")
+	}
+
+	policy := contentSecurityPolicy + "; frame-ancestors " + ancestors
+	swaggerPolicy := swaggerSecurityPolicy + "; frame-ancestors " + ancestors
+	hsts := "max-age=" + strconv.Itoa(int(cfg.HSTS.Seconds())) + "; includeSubDomains"
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+
+			if strings.HasPrefix(r.URL.Path, "/swagger/") {
+				h.Set("Content-Security-Policy", swaggerPolicy)
+			} else {
+				h.Set("Content-Security-Policy", policy)
+			}
+
+			// X-Frame-Options can not list origins, frame-ancestors
+			// supersedes it in the browsers supporting both
+			if len(cfg.FrameAncestors) == 0 {
+				h.Set("X-Frame-Options", "DENY")
+			}
+
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("Referrer-Policy", "no-referrer")
+			h.Set("Cross-Origin-Opener-Policy", "same-origin")
+
+			if cfg.HSTS > 0 && isTLS(r, trusted) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isTLS tells if the client made the request over TLS
+func isTLS(r *http.Request, trusted []netip.Prefix) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+
+	if err != nil || !isTrusted(addr.Addr().Unmap(), trusted) {
+		return false
+	}
+
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,204 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// corsRouter routes the preflight requests as Start does, to a single
+// route answering 200
+func corsRouter(c CORS) http.Handler {
+	router := mux.NewRouter()
+	router.Use(cors(c))
+	router.PathPrefix("/").Methods(http.MethodOptions).Handler(optionsHandler())
+	router.Handle("/api/v1/task/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	})).Methods("GET")
+
+	return router
+}
+
+// fromOrigin sends a request from the origin, a preflight of method when
+// it is set
+func fromOrigin(handler http.Handler, httpMethod string, origin string, preflight string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(httpMethod, "/api/v1/task/", nil)
+
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+
+	if preflight != "" {
+		r.Header.Set("Access-Control-Request-Method", preflight)
+		r.Header.Set("Access-Control-Request-Headers", "authorization")
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+var testCORS = CORS{
+	Origins: []string{"https://app.example.com", "http://localhost:5173"},
+	Methods: []string{"GET", "POST"},
+	Headers: []string{"Authorization", "Content-Type"},
+	MaxAge:  10 * time.Minute,
+}
+
+func TestPreflight(t *testing.T) {
+	w := fromOrigin(corsRouter(testCORS), "OPTIONS", "https://app.example.com", "POST")
+	h := w.Header()
+
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Fatalf("preflight: %d %s, want 204", w.Code, w.Body)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+
+	for header, value := range want {
+		if got := h.Get(header); got != value {
+			t.Errorf("%s: %q, want %q", header, got, value)
+		}
+	}
+
+	if vary := strings.Join(h.Values("Vary"), ", "); vary != "Origin, Access-Control-Request-Method, Access-Control-Request-Headers" {
+		t.Errorf("Vary: %q", vary)
+	}
+
+	if h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("credentials allowed without Credentials")
+	}
+
+	// the browsers refuse the preflight without the headers
+	w = fromOrigin(corsRouter(testCORS), "OPTIONS", "https://evil.example.com", "POST")
+
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("preflight of another origin: %d with %v, want 405 without the headers", w.Code, w.Header())
+	}
+
+	// OPTIONS without a method to check is not a preflight
+	w = fromOrigin(corsRouter(testCORS), "OPTIONS", "https://app.example.com", "")
+
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("OPTIONS of an allowed origin: %d with %v, want 405", w.Code, w.Header())
+	}
+}
+
+func TestOriginAllowList(t *testing.T) {
+	tests := []struct {
+		name   string
+		cors   CORS
+		origin string
+		want   string
+	}{
+		{"allowed origin", testCORS, "https://app.example.com", "https://app.example.com"},
+		{"origins are not case sensitive", testCORS, "HTTPS://APP.EXAMPLE.COM", "HTTPS://APP.EXAMPLE.COM"},
+		{"another port", testCORS, "http://localhost:5173", "http://localhost:5173"},
+		{"another origin", testCORS, "https://evil.example.com", ""},
+		{"a subdomain", testCORS, "https://x.app.example.com", ""},
+		{"another scheme", testCORS, "http://app.example.com", ""},
+		{"same origin request", testCORS, "", ""},
+		{"every origin", CORS{Origins: []string{"*"}, Methods: []string{"GET"}}, "https://any.example.com", "*"},
+		{"every origin among others", CORS{Origins: []string{"https://app.example.com", "*"}, Methods: []string{"GET"}}, "https://any.example.com", "https://any.example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := fromOrigin(corsRouter(test.cors), "GET", test.origin, "")
+			h := w.Header()
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("%d, want the request served", w.Code)
+			}
+
+			if got := h.Get("Access-Control-Allow-Origin"); got != test.want {
+				t.Errorf("Access-Control-Allow-Origin: %q, want %q", got, test.want)
+			}
+
+			if h.Get("Vary") != "Origin" {
+				t.Errorf("Vary: %q, want Origin so caches keep the responses of each origin apart", h.Get("Vary"))
+			}
+
+			exposed := h.Get("Access-Control-Expose-Headers")
+
+			if test.want != "" && !strings.Contains(exposed, "Retry-After") {
+				t.Errorf("Access-Control-Expose-Headers: %q", exposed)
+			}
+
+			if test.want == "" && exposed != "" {
+				t.Errorf("headers exposed to another origin: %q", exposed)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	c := testCORS
+	c.Credentials = true
+
+	requests := []struct {
+		method    string
+		preflight string
+	}{
+		{"GET", ""},
+		{"OPTIONS", "PUT"},
+	}
+
+	for _, r := range requests {
+		h := fromOrigin(corsRouter(c), r.method, "http://localhost:5173", r.preflight).Header()
+
+		if h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Access-Control-Allow-Origin") != "http://localhost:5173" {
+			t.Errorf("%s: %v, want the credentials allowed for the origin", r.method, h)
+		}
+	}
+
+	w := fromOrigin(corsRouter(c), "GET", "https://evil.example.com", "")
+
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("credentials allowed for another origin: %v", w.Header())
+	}
+}
+
+func TestCORSDisabled(t *testing.T) {
+	w := fromOrigin(corsRouter(CORS{}), "GET", "https://app.example.com", "")
+
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("without origins: %d with %v, want no CORS headers", w.Code, w.Header())
+	}
+
+	w = fromOrigin(corsRouter(CORS{}), "OPTIONS", "https://app.example.com", "GET")
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("preflight without origins: %d, want 405", w.Code)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/logging"
+	"github.com/servian/TechChallengeApp/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/servian/TechChallengeApp/ui")
+
+// untracedPaths are polled by monitoring every few seconds
+var untracedPaths = map[string]bool{
+	"/metrics":      true,
+	"/livez":        true,
+	"/readyz":       true,
+	"/healthcheck":  true,
+	"/healthcheck/": true,
+}
+
+// tracingMiddleware continues the trace of the traceparent header, or
+// starts a new one, with a span named after the route template
+func tracingMiddleware() mux.MiddlewareFunc {
+	traced := otelmux.Middleware(tracing.ServiceName,
+		otelmux.WithSpanNameFormatter(func(route string, r *http.Request) string {
+			return r.Method + " " + route
+		}),
+		// scrapes and probes would drown the traces of the application
+		otelmux.WithFilter(func(r *http.Request) bool {
+			return !untracedPaths[r.URL.Path]
+		}),
+	)
+
+	return func(next http.Handler) http.Handler {
+		return traced(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := logging.RequestID(r.Context()); id != "" {
+				trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request.id", id))
+			}
+
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingSpans records the spans ended until the end of the test
+func recordingSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+
+	previous, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	return recorder
+}
+
+func TestRequestSpans(t *testing.T) {
+	recorder := recordingSpans(t)
+
+	router := mux.NewRouter()
+	router.Use(tracingMiddleware())
+	router.Handle("/api/v1/task/{id}/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	router.Handle("/livez", livezHandler())
+
+	handler := withRequestID(router)
+
+	r := httptest.NewRequest("PUT", "/api/v1/task/7/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set(requestIDHeader, "req-7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/livez", nil))
+
+	spans := recorder.Ended()
+
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want the request without the probe", len(spans))
+	}
+
+	span := spans[0]
+
+	if span.Name() != "PUT /api/v1/task/{id}/" {
+		t.Errorf("span %q, want it named after the route", span.Name())
+	}
+
+	// the trace of the caller goes on
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span of the trace %s, parent %s, want the ones of traceparent", span.SpanContext().TraceID(), span.Parent().SpanID())
+	}
+
+	found := false
+
+	for _, kv := range span.Attributes() {
+		if kv.Key == "http.request.id" && kv.Value.AsString() == "req-7" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("attributes %v, want the request id", span.Attributes())
+	}
+}
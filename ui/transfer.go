@@ -0,0 +1,192 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/servian/TechChallengeApp/taskio"
+)
+
+// exportTasks - GET /api/task/export
+//
+// Export all tasks of the lists the user can see as a JSON array, a CSV
+// file, a Markdown checklist or an iCalendar file
+func exportTasks(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := taskio.JSON
+
+		if value := r.URL.Query().Get("format"); value != "" {
+			var err error
+
+			format, err = taskio.ParseFormat(value)
+
+			if err != nil {
+				writeProblem(w, r, 400, err.Error())
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tasks.%s"`, format))
+
+		writer, _ := taskio.NewWriter(w, format)
+
+		err := db.ForEachTask(r.Context(), cfg.DB, 0, writer.Write)
+
+		if err != nil {
+			// the response has started, the client sees a truncated file
+			slog.ErrorContext(r.Context(), "Error reading tasks for the export", "error", err)
+			return
+		}
+
+		err = writer.Close()
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error writing the export", "error", err)
+		}
+	})
+}
+
+// errBadFile marks errors caused by the imported file
+type errBadFile struct {
+	err error
+}
+
+func (e errBadFile) Error() string {
+	return e.err.Error()
+}
+
+func (e errBadFile) Unwrap() error {
+	return e.err
+}
+
+// importTasks - POST /api/task/import
+//
+// Import tasks from a JSON array, a CSV file, a Markdown checklist or an
+// iCalendar file. The file is streamed into the database in a single
+// transaction.
+func importTasks(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var format taskio.Format
+		var err error
+
+		if value := query.Get("format"); value != "" {
+			format, err = taskio.ParseFormat(value)
+		} else {
+			format, err = taskio.FormatFromContentType(r.Header.Get("Content-Type"))
+		}
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		opts := db.ImportOptions{Conflict: query.Get("conflict")}
+
+		switch opts.Conflict {
+		case "", db.ConflictSkip, db.ConflictOverwrite, db.ConflictFail:
+		default:
+			writeProblem(w, r, 400, "conflict must be skip, overwrite or fail")
+			return
+		}
+
+		if value := query.Get("dryRun"); value != "" {
+			opts.DryRun, err = strconv.ParseBool(value)
+
+			if err != nil {
+				writeProblem(w, r, 400, "dryRun must be true or false")
+				return
+			}
+		}
+
+		if value := query.Get("list"); value != "" {
+			opts.ListID, err = strconv.Atoi(value)
+
+			if err != nil {
+				writeProblem(w, r, 400, "list must be the id of a list")
+				return
+			}
+		}
+
+		reader, _ := taskio.NewReader(r.Body, format)
+
+		next := func() (model.Task, error) {
+			task, err := reader.Read()
+
+			if err != nil && err != io.EOF {
+				return task, errBadFile{err}
+			}
+
+			return task, err
+		}
+
+		result, err := db.ImportTasks(r.Context(), cfg.DB, next, opts)
+
+		var badFile errBadFile
+		var tooLarge *http.MaxBytesError
+
+		switch {
+		case err == nil:
+			publishImport(r.Context(), cfg, result)
+			writeJSON(w, 200, result)
+		case errors.As(err, &tooLarge):
+			writeProblem(w, r, 413, fmt.Sprintf("The file is larger than %d bytes", tooLarge.Limit))
+		case errors.As(err, &badFile):
+			writeProblem(w, r, 400, err.Error())
+		case errors.Is(err, db.ErrConflict):
+			writeProblem(w, r, 409, err.Error())
+		case errors.Is(err, db.ErrNotFound), errors.Is(err, access.ErrForbidden):
+			writeDbError(w, r, err)
+		default:
+			slog.ErrorContext(r.Context(), "Error in import tasks", "error", err)
+			writeProblem(w, r, 500, "The tasks could not be imported")
+		}
+	})
+}
+
+// publishImport sends the events of the tasks stored by an import, nothing
+// is stored on a dry run
+func publishImport(ctx context.Context, cfg Config, result db.ImportResult) {
+	if result.DryRun {
+		return
+	}
+
+	for _, task := range result.CreatedTasks {
+		cfg.Events.Publish(ctx, events.Event{Type: events.TaskCreated, Task: task})
+	}
+
+	for _, task := range result.UpdatedTasks {
+		cfg.Events.Publish(ctx, events.Event{Type: events.TaskUpdated, Task: task})
+	}
+}
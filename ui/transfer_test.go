@@ -0,0 +1,98 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/servian/TechChallengeApp/events"
+)
+
+func TestImportPublishesTasks(t *testing.T) {
+	cfg, fake, api := testAPI(t)
+
+	sub, unsubscribe := cfg.Events.Subscribe()
+	defer unsubscribe()
+
+	// a dry run publishes nothing
+	w := call(api, testUsers["admin"], "POST", "/api/v1/task/import?format=csv&dryRun=true", "title\nNew\n")
+
+	if w.Code != 200 || len(sub) != 0 {
+		t.Fatalf("dry run: %d %s and %d events", w.Code, w.Body, len(sub))
+	}
+
+	w = call(api, testUsers["admin"], "POST", "/api/v1/task/import?format=csv&conflict=overwrite", "id,title,list_id\n1,Renamed,2\n,New,3\n")
+
+	if w.Code != 200 {
+		t.Fatalf("%d %s", w.Code, w.Body)
+	}
+
+	got := map[events.Type]int{}
+
+	for len(sub) > 0 {
+		e := <-sub
+		got[e.Type] = e.Task.ID
+
+		if stored, _ := fake.Task(e.Task.ID); stored.Title != e.Task.Title || stored.ListID != e.Task.ListID {
+			t.Errorf("%s %+v, stored %+v", e.Type, e.Task, stored)
+		}
+	}
+
+	if len(got) != 2 || got[events.TaskUpdated] != 1 || got[events.TaskCreated] == 0 {
+		t.Errorf("got the events %v, want task 1 updated and a task created", got)
+	}
+}
+
+func TestImportProblems(t *testing.T) {
+	_, fake, api := testAPI(t)
+
+	requests := []struct {
+		path   string
+		body   string
+		status int
+		detail string
+	}{
+		{"/api/v1/task/import?format=xml", "", 400, `"parameter":"format"`},
+		{"/api/v1/task/import?format=csv&conflict=merge", "title\nNew\n", 400, `"parameter":"conflict"`},
+		{"/api/v1/task/import?format=csv&dryRun=maybe", "title\nNew\n", 400, `"parameter":"dryRun"`},
+		{"/api/v1/task/import?format=csv&list=first", "title\nNew\n", 400, `"parameter":"list"`},
+		{"/api/v1/task/import?format=csv", "id,title\nx,New\n", 400, "line 2: invalid id"},
+		{"/api/v1/task/import?format=csv&conflict=fail", "id,title\n1,New\n", 409, "Task already exists: 1"},
+		{"/api/v1/task/import?format=csv", "title,list_id\nNew,9\n", 404, "List 9: Not found"},
+	}
+
+	for _, r := range requests {
+		w := call(api, testUsers["admin"], "POST", r.path, r.body)
+
+		if w.Code != r.status || w.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(w.Body.String(), r.detail) {
+			t.Errorf("%s: %d %s %s, want %d %q", r.path, w.Code, w.Header().Get("Content-Type"), w.Body, r.status, r.detail)
+		}
+	}
+
+	fake.FailOn("nextval")
+
+	w := call(api, testUsers["admin"], "POST", "/api/v1/task/import?format=csv", "title\nNew\n")
+
+	if w.Code != 500 || strings.Contains(w.Body.String(), "dbtest") {
+		t.Errorf("%d %s, want a 500 without the error of the database", w.Code, w.Body)
+	}
+}
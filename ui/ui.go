@@ -21,52 +21,96 @@
 package ui
 
 import (
-	"fmt"
+	"expvar"
+	"io/fs"
 	"net"
 	"net/http"
+	"net/netip"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/auth"
 	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/graph"
 )
 
 // Config configuration for ui package
 type Config struct {
-	Assets http.FileSystem
+	// Assets are the built front-end, the ones embedded in the binary when nil
+	Assets fs.FS
 	DB     db.Config
+	Events *events.Broker
+	// LegacyAPI announces the end of the routes served directly under /api
+	LegacyAPI Deprecation
+	// RateLimit limits the api requests of each client
+	RateLimit RateLimit
+	// Failures counts the invalid credentials of each address, with
+	// buckets of the rate limit of its own when nil
+	Failures *Failures
+	// MaxBodySize is the largest body of any request, in bytes
+	MaxBodySize int64
+	// TrustedProxies are the proxies whose X-Forwarded-For and
+	// X-Forwarded-Proto headers are believed
+	TrustedProxies []netip.Prefix
+	// CORS lets the browsers of other origins call the api
+	CORS CORS
+	// Security configures the security headers of every response
+	Security SecurityHeaders
+	// Auth configures how the users sign in
+	Auth Auth
 }
 
-// Start - start web server and handle web requets
-func Start(cfg Config, listener net.Listener) {
+// Start - start web server and handle web requets. The metrics are served
+// on their own listener when it is set, or to the admins with the api
+func Start(cfg Config, listener net.Listener, metricsListener net.Listener) {
 	server := &http.Server{
 		ReadTimeout:    60 * time.Second,
 		WriteTimeout:   60 * time.Second,
 		MaxHeaderBytes: 1 << 16,
 	}
 
+	if cfg.Auth.Sessions == nil {
+		cfg.Auth.Sessions = auth.NewSessions(auth.MemoryStore(), "", 12*time.Hour)
+	}
+
+	m := newMetrics(cfg)
+
 	mainRouter := mux.NewRouter()
+	limiter := newRateLimiter(cfg.RateLimit, cfg.TrustedProxies, m, cfg.Failures)
+
+	mainRouter.Use(tracingMiddleware(), accessLog, m.middleware, securityHeaders(cfg.Security, cfg.TrustedProxies), cors(cfg.CORS), authenticate(cfg, limiter), limitBody(cfg.MaxBodySize))
+
+	// the routes only match their own methods, the preflight requests are
+	// routed here for the middlewares to answer them
+	mainRouter.PathPrefix("/").Methods(http.MethodOptions).Handler(optionsHandler())
+
+	if metricsListener == nil {
+		mainRouter.Handle("/metrics", adminOnly(m.handler()))
+		mainRouter.Handle("/debug/vars", adminOnly(expvar.Handler()))
+	} else {
+		go serveMetrics(m, metricsListener)
+	}
+
 	mainRouter.Handle("/healthcheck", healthcheckHandler(cfg))
 	mainRouter.Handle("/healthcheck/", healthcheckHandler(cfg))
+	mainRouter.Handle("/livez", livezHandler())
+	mainRouter.Handle("/readyz", readyzHandler(cfg))
+
+	mainRouter.Handle("/api/graphql", limiter.middleware(signedIn(cfg, graph.Handler(graph.Config{DB: cfg.DB, Events: cfg.Events})))).Methods("GET", "POST")
 
-	apiRouter := mainRouter.PathPrefix("/api").Subrouter()
-	apiHandler(cfg, apiRouter)
+	v1Router := mainRouter.PathPrefix(apiV1.Prefix).Subrouter()
+	v1Router.Use(limiter.middleware)
+	apiHandler(cfg, v1Router, apiV1)
+
+	// the legacy routes are an alias of v1 without the envelope
+	apiRouter := mainRouter.PathPrefix(legacyAPI.Prefix).Subrouter()
+	apiRouter.Use(limiter.middleware, deprecate(cfg.LegacyAPI))
+	apiHandler(cfg, apiRouter, legacyAPI)
 
 	uiRouter := mainRouter.PathPrefix("/").Subrouter()
 	uiHandler(cfg, uiRouter)
 
-	http.Handle("/", mainRouter)
+	http.Handle("/", withRequestID(mainRouter))
 	go server.Serve(listener)
 }
-
-func healthcheckHandler(cfg Config) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := db.GetAllTasks(cfg.DB)
-
-		if err != nil {
-			fmt.Fprintf(w, "Error: db connection down")
-			return
-		}
-
-		fmt.Fprintf(w, "OK")
-	})
-}
@@ -0,0 +1,260 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxJSONBody is the largest JSON body accepted, tasks, webhooks and
+	// feeds are much smaller
+	maxJSONBody = 1 << 20
+
+	// maxFileBody is the largest file accepted by an import
+	maxFileBody = 32 << 20
+)
+
+// hasJSONBody tells if the body of the operation is validated, files are
+// read by their handler
+func hasJSONBody(op *openapi3.Operation) bool {
+	if op.RequestBody == nil {
+		return false
+	}
+
+	content := op.RequestBody.Value.Content
+
+	return len(content) == 1 && content.Get("application/json") != nil
+}
+
+// specOperation finds the operation of the OpenAPI document of the version
+// served under prefix matching the route of the request, nil when none does
+func specOperation(doc *openapi3.T, prefix string, r *http.Request) (string, *openapi3.PathItem, *openapi3.Operation) {
+	route := mux.CurrentRoute(r)
+
+	if route == nil {
+		return "", nil, nil
+	}
+
+	template, _ := route.GetPathTemplate()
+	path := specPath(prefix, template)
+	item := doc.Paths.Value(path)
+
+	if item == nil {
+		return path, nil, nil
+	}
+
+	return path, item, item.GetOperation(r.Method)
+}
+
+// validateRequests rejects the requests whose parameters or body do not
+// match the OpenAPI document of the version served under prefix before
+// they reach the handlers
+func validateRequests(doc *openapi3.T, prefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, item, op := specOperation(doc, prefix, r)
+
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if op.RequestBody != nil {
+				limit := int64(maxFileBody)
+
+				if hasJSONBody(op) {
+					limit = maxJSONBody
+				}
+
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: mux.Vars(r),
+				Route: &routers.Route{
+					Spec:      doc,
+					Path:      path,
+					PathItem:  item,
+					Method:    r.Method,
+					Operation: op,
+				},
+				Options: &openapi3filter.Options{
+					ExcludeRequestBody:  !hasJSONBody(op),
+					MultiError:          true,
+					SkipSettingDefaults: true,
+					AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+				},
+			}
+
+			err := openapi3filter.ValidateRequest(r.Context(), input)
+
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var tooLarge *http.MaxBytesError
+
+			if errors.As(err, &tooLarge) {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("The body is larger than %d bytes", tooLarge.Limit))
+				return
+			}
+
+			errs := requestErrors(err)
+
+			for _, e := range errs {
+				if e.Pointer == "#" && strings.HasPrefix(e.Detail, "header Content-Type") {
+					writeProblem(w, r, http.StatusUnsupportedMediaType, e.Detail)
+					return
+				}
+			}
+
+			writeProblem(w, r, http.StatusBadRequest, "The request does not match the api schema, see "+prefix+"/openapi.json", errs...)
+		})
+	}
+}
+
+// requestErrors lists the invalid values reported by openapi3filter
+func requestErrors(err error) []problemError {
+	var errs []problemError
+
+	if multi, ok := err.(openapi3.MultiError); ok {
+		for _, e := range multi {
+			errs = append(errs, requestErrors(e)...)
+		}
+
+		return errs
+	}
+
+	var reqErr *openapi3filter.RequestError
+
+	if !errors.As(err, &reqErr) {
+		return []problemError{{Detail: err.Error()}}
+	}
+
+	at := func(e problemError) problemError {
+		if reqErr.Parameter != nil {
+			e.Parameter = reqErr.Parameter.Name
+			e.In = reqErr.Parameter.In
+		}
+
+		return e
+	}
+
+	var schemaErrs []*openapi3.SchemaError
+	collectSchemaErrors(reqErr.Err, &schemaErrs)
+
+	if len(schemaErrs) == 0 {
+		e := problemError{Detail: reqErr.Reason}
+
+		if reqErr.Err != nil {
+			e.Detail = reqErr.Err.Error()
+
+			if reqErr.Reason != "" && reqErr.Reason != e.Detail {
+				e.Detail = reqErr.Reason + ": " + e.Detail
+			}
+		}
+
+		if reqErr.Parameter == nil {
+			e.Pointer = "#"
+		}
+
+		return []problemError{at(e)}
+	}
+
+	for _, schemaErr := range schemaErrs {
+		e := problemError{Detail: schemaErrorDetail(schemaErr)}
+
+		if reqErr.Parameter == nil {
+			e.Pointer = schemaErrorPointer(schemaErr)
+		}
+
+		errs = append(errs, at(e))
+	}
+
+	return errs
+}
+
+func schemaErrorDetail(err *openapi3.SchemaError) string {
+	if err.Reason == "" {
+		return err.Error()
+	}
+
+	return err.Reason
+}
+
+// schemaErrorPointer is the JSON pointer of the invalid value
+func schemaErrorPointer(err *openapi3.SchemaError) string {
+	path := err.JSONPointer()
+
+	// point at the unknown property rather than its object
+	var property string
+
+	if err.SchemaField == "properties" {
+		if _, scanErr := fmt.Sscanf(err.Reason, "property %q is unsupported", &property); scanErr == nil {
+			path = append(path, property)
+		}
+	}
+
+	return jsonPointer(path)
+}
+
+// collectSchemaErrors flattens the schema errors of err
+func collectSchemaErrors(err error, errs *[]*openapi3.SchemaError) {
+	var multi openapi3.MultiError
+
+	if errors.As(err, &multi) {
+		for _, e := range multi {
+			collectSchemaErrors(e, errs)
+		}
+
+		return
+	}
+
+	var schemaErr *openapi3.SchemaError
+
+	if errors.As(err, &schemaErr) {
+		*errs = append(*errs, schemaErr)
+	}
+}
+
+// jsonPointer is the RFC 6901 URI fragment of the path of a value
+func jsonPointer(path []string) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+
+	pointer := "#"
+
+	for _, token := range path {
+		pointer += "/" + escaper.Replace(token)
+	}
+
+	return pointer
+}
@@ -0,0 +1,185 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// problemOf decodes the problem details of a response
+func problemOf(t *testing.T, w *httptest.ResponseRecorder) problem {
+	t.Helper()
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("%d %s: Content-Type %q, want problem details", w.Code, w.Body, ct)
+	}
+
+	var p problem
+
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("%s: %v", w.Body, err)
+	}
+
+	return p
+}
+
+func TestRequestsAreValidated(t *testing.T) {
+	_, fake, api := testAPI(t)
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+		errs   []problemError
+	}{
+		{"POST", "/api/v1/task/", `{"title":"Task","completed":true,"priority":"high"}`, []problemError{
+			{Detail: `property "completed" is unsupported`, Pointer: "#/completed"},
+			{Detail: "value must be an integer", Pointer: "#/priority"},
+		}},
+		{"POST", "/api/v1/task/", `{"priority":1}`, []problemError{
+			{Detail: `property "title" is missing`, Pointer: "#/title"},
+		}},
+		{"PUT", "/api/v1/task/1/", `{"title":"Task","listId":-1}`, []problemError{
+			{Detail: "number must be at least 0", Pointer: "#/listId"},
+		}},
+		{"POST", "/api/v1/webhook/", `{"url":"https://example.com/hook","events":["created","moved"]}`, []problemError{
+			{Detail: `value is not one of the allowed values ["created","updated","deleted"]`, Pointer: "#/events/1"},
+		}},
+		{"POST", "/api/v1/task/", `{"title":`, []problemError{
+			{Pointer: "#"},
+		}},
+		{"GET", "/api/v1/task/?complete=perhaps", "", []problemError{
+			{Parameter: "complete", In: "query"},
+		}},
+	}
+
+	for _, r := range requests {
+		w := call(api, testUsers["admin"], r.method, r.path, r.body)
+
+		if w.Code != 400 {
+			t.Errorf("%s %s: %d %s, want 400", r.method, r.path, w.Code, w.Body)
+			continue
+		}
+
+		p := problemOf(t, w)
+
+		if p.Status != 400 || p.Title != "Bad Request" || p.Instance != strings.Split(r.path, "?")[0] || !strings.Contains(p.Detail, "/api/v1/openapi.json") {
+			t.Errorf("%s %s: got %+v", r.method, r.path, p)
+		}
+
+		// the details of the errors without one come from the parser
+		for i := range r.errs {
+			if r.errs[i].Detail == "" && i < len(p.Errors) {
+				r.errs[i].Detail = p.Errors[i].Detail
+			}
+		}
+
+		if !reflect.DeepEqual(p.Errors, r.errs) {
+			t.Errorf("%s %s: got the errors %+v, want %+v", r.method, r.path, p.Errors, r.errs)
+		}
+	}
+
+	if len(fake.Tasks()) != 3 {
+		t.Errorf("%d tasks, want the invalid tasks refused", len(fake.Tasks()))
+	}
+}
+
+func TestBodyLimits(t *testing.T) {
+	_, _, api := testAPI(t)
+
+	r := httptest.NewRequest("POST", "/api/v1/task/", strings.NewReader(`{"title":"Task"}`))
+	r.Header.Set("Content-Type", "text/plain")
+	r = r.WithContext(withUser(r.Context(), *testUsers["admin"]))
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+
+	if w.Code != 415 || problemOf(t, w).Status != 415 {
+		t.Errorf("text body: %d %s, want 415", w.Code, w.Body)
+	}
+
+	w = call(api, testUsers["admin"], "POST", "/api/v1/task/", `{"title":"`+strings.Repeat("a", maxJSONBody)+`"}`)
+
+	if w.Code != 413 || problemOf(t, w).Status != 413 {
+		t.Errorf("large body: %d, want 413", w.Code)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	pointers := map[string][]string{
+		"#":             nil,
+		"#/title":       {"title"},
+		"#/events/1":    {"events", "1"},
+		"#/a~1b/c~0d":   {"a/b", "c~d"},
+		"#/~01/~10/%20": {"~1", "/0", "%20"},
+	}
+
+	for want, path := range pointers {
+		if got := jsonPointer(path); got != want {
+			t.Errorf("%q: got %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestDatabaseErrorsAreProblems(t *testing.T) {
+	_, fake, api := testAPI(t)
+
+	responses := []struct {
+		user   string
+		method string
+		path   string
+		status int
+		detail string
+	}{
+		{"admin", "PUT", "/api/v1/task/9/", 404, "Not found"},
+		{"viewer", "DELETE", "/api/v1/task/1/", 403, "does not allow"},
+		{"viewer", "DELETE", "/api/v1/list/1/", 403, "does not allow"},
+		{"admin", "DELETE", "/api/v1/list/9/", 404, "Not found"},
+	}
+
+	for _, r := range responses {
+		body := ""
+
+		if r.method == "PUT" {
+			body = `{"title":"Task"}`
+		}
+
+		w := call(api, testUsers[r.user], r.method, r.path, body)
+		p := problemOf(t, w)
+
+		if w.Code != r.status || p.Status != r.status || !strings.Contains(p.Detail, r.detail) {
+			t.Errorf("%s %s as %s: %d %+v, want %d", r.method, r.path, r.user, w.Code, p, r.status)
+		}
+	}
+
+	fake.FailOn("FROM tasks")
+
+	w := call(api, testUsers["admin"], "GET", "/api/v1/task/", "")
+	p := problemOf(t, w)
+
+	if w.Code != 500 || p.Detail != internalError || strings.Contains(w.Body.String(), "dbtest") {
+		t.Errorf("%d %s, want a 500 without the error of the database", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiVersion is a namespace the api is served under
+type apiVersion struct {
+	// Prefix is where the routes of the version are served
+	Prefix string
+	// Envelope wraps the JSON responses as {"data": ...}
+	Envelope bool
+}
+
+var (
+	// legacyAPI is the api as first served, kept for the existing clients
+	legacyAPI = apiVersion{Prefix: "/api"}
+
+	apiV1 = apiVersion{Prefix: "/api/v1", Envelope: true}
+)
+
+// apiVersions are the namespaces served, the most specific prefix first
+var apiVersions = []apiVersion{apiV1, legacyAPI}
+
+// Deprecation announces the end of the legacy api to its clients
+type Deprecation struct {
+	// Deprecated is when the legacy api was deprecated, not announced when zero
+	Deprecated time.Time
+	// Sunset is when the legacy api stops being served, not announced when zero
+	Sunset time.Time
+}
+
+// deprecate adds the Deprecation (RFC 9745) and Sunset (RFC 8594) headers
+// to the responses of the legacy api, with a link to the same route of the
+// current version
+func deprecate(d Deprecation) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if d.Deprecated.IsZero() && d.Sunset.IsZero() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !d.Deprecated.IsZero() {
+				w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Deprecated.Unix(), 10))
+			}
+
+			if !d.Sunset.IsZero() {
+				w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+
+			successor := apiV1.Prefix + strings.TrimPrefix(r.URL.Path, legacyAPI.Prefix)
+			w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// envelope wraps the successful JSON responses as {"data": ...}, errors,
+// files and streams are sent as they are
+func envelope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &envelopeWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		ew.close()
+	})
+}
+
+// envelopeWriter writes the envelope around the body as it is written, so
+// the response is not buffered
+type envelopeWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	wrapping    bool
+	empty       bool
+}
+
+func (ew *envelopeWriter) WriteHeader(status int) {
+	if ew.wroteHeader {
+		return
+	}
+
+	ew.wroteHeader = true
+
+	mediaType, _, _ := mime.ParseMediaType(ew.Header().Get("Content-Type"))
+
+	if mediaType == "application/json" && status >= 200 && status < 300 && status != http.StatusNoContent {
+		ew.wrapping = true
+		ew.empty = true
+		ew.Header().Del("Content-Length")
+	}
+
+	ew.ResponseWriter.WriteHeader(status)
+
+	if ew.wrapping {
+		ew.ResponseWriter.Write([]byte(`{"data":`))
+	}
+}
+
+func (ew *envelopeWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	if len(b) > 0 {
+		ew.empty = false
+	}
+
+	return ew.ResponseWriter.Write(b)
+}
+
+// close ends the envelope once the handler is done
+func (ew *envelopeWriter) close() {
+	if !ew.wrapping {
+		return
+	}
+
+	if ew.empty {
+		ew.ResponseWriter.Write([]byte("null"))
+	}
+
+	ew.ResponseWriter.Write([]byte("}"))
+}
+
+func (ew *envelopeWriter) Flush() {
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (ew *envelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := ew.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+
+	return h.Hijack()
+}
+
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
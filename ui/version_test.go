@@ -0,0 +1,249 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+)
+
+// testVersions serves the v1 api and the legacy api, deprecated as d
+func testVersions(t *testing.T, d Deprecation) http.Handler {
+	cfg := Config{DB: db.Config{DbName: t.Name()}, Events: events.NewBroker()}
+	resetDB(t, cfg)
+
+	router := mux.NewRouter()
+	apiHandler(cfg, router.PathPrefix(apiV1.Prefix).Subrouter(), apiV1)
+
+	legacy := router.PathPrefix(legacyAPI.Prefix).Subrouter()
+	legacy.Use(deprecate(d))
+	apiHandler(cfg, legacy, legacyAPI)
+
+	return router
+}
+
+func TestEnvelope(t *testing.T) {
+	api := testVersions(t, Deprecation{})
+
+	w := call(api, testUsers["admin"], "GET", "/api/v1/task/", "")
+
+	var body map[string]json.RawMessage
+
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body) != 1 || body["data"] == nil {
+		t.Fatalf("GET /api/v1/task/: %d %s, want the tasks in data", w.Code, w.Body)
+	}
+
+	// the legacy api sends the same tasks without the envelope
+	legacy := call(api, testUsers["admin"], "GET", "/api/task/", "")
+
+	if legacy.Code != http.StatusOK || strings.TrimSpace(legacy.Body.String()) != strings.TrimSpace(string(body["data"])) {
+		t.Errorf("GET /api/task/: %d %s, want %s", legacy.Code, legacy.Body, body["data"])
+	}
+
+	if legacy.Header().Get("Deprecation") != "" || legacy.Header().Get("Link") != "" {
+		t.Errorf("the legacy api is deprecated without a date: %v", legacy.Header())
+	}
+
+	// errors are problem details, as they are
+	w = call(api, testUsers["admin"], "PUT", "/api/v1/task/99/", `{"title":"Missing"}`)
+
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), `"data"`) {
+		t.Errorf("PUT /api/v1/task/99/: %d %s, want a problem", w.Code, w.Body)
+	}
+
+	w = call(api, testUsers["admin"], "DELETE", "/api/v1/task/1/", "")
+
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("DELETE /api/v1/task/1/: %d %q, want no content", w.Code, w.Body)
+	}
+
+	// files are sent as they are
+	w = call(api, testUsers["admin"], "GET", "/api/v1/task/export?format=csv", "")
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "id,") {
+		t.Errorf("GET /api/v1/task/export: %d %s, want a csv file", w.Code, w.Body)
+	}
+}
+
+func TestEnvelopeWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"json", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Content-Length", "7")
+			w.Write([]byte(`{"a":1}`))
+		}, `{"data":{"a":1}}`},
+		{"json written in parts", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`[1,`))
+			w.Write([]byte(`2]`))
+		}, `{"data":[1,2]}`},
+		{"empty json", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+		}, `{"data":null}`},
+		{"problem", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"bad"}`))
+		}, `{"error":"bad"}`},
+		{"text", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`ok`))
+		}, `ok`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			envelope(test.handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			if w.Body.String() != test.want {
+				t.Errorf("got %s, want %s", w.Body, test.want)
+			}
+
+			if cl := w.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(w.Body.Len()) {
+				t.Errorf("Content-Length %s of a %d bytes body", cl, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	deprecated := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 1, 1, 12, 0, 0, 0, time.FixedZone("AEDT", 11*60*60))
+
+	api := testVersions(t, Deprecation{Deprecated: deprecated, Sunset: sunset})
+
+	h := call(api, testUsers["admin"], "GET", "/api/task/", "").Header()
+
+	want := map[string]string{
+		"Deprecation": "@" + strconv.FormatInt(deprecated.Unix(), 10),
+		"Sunset":      "Fri, 01 Jan 2027 01:00:00 GMT",
+		"Link":        `</api/v1/task/>; rel="successor-version"`,
+	}
+
+	for header, value := range want {
+		if got := h.Get(header); got != value {
+			t.Errorf("%s: %q, want %q", header, got, value)
+		}
+	}
+
+	// the errors of the legacy api are deprecated too
+	if w := call(api, testUsers["admin"], "PUT", "/api/task/99/", `{"title":"Missing"}`); w.Code != http.StatusNotFound || w.Header().Get("Deprecation") == "" {
+		t.Errorf("PUT /api/task/99/: %d without Deprecation", w.Code)
+	}
+
+	w := call(api, testUsers["admin"], "GET", "/api/v1/task/", "")
+
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" || w.Header().Get("Link") != "" {
+		t.Errorf("the v1 api is deprecated: %v", w.Header())
+	}
+
+	api = testVersions(t, Deprecation{Sunset: sunset})
+
+	if h := call(api, testUsers["admin"], "GET", "/api/task/", "").Header(); h.Get("Deprecation") != "" || h.Get("Sunset") == "" {
+		t.Errorf("with only a sunset: %v", h)
+	}
+}
+
+func TestEnvelopeStreams(t *testing.T) {
+	next := make(chan struct{})
+
+	server := httptest.NewServer(envelope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: created\ndata: {}\n\n"))
+
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+
+		// the event reaches the client before the handler returns
+		<-next
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+	defer close(next)
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+
+	if err != nil || line != "event: created\n" {
+		t.Errorf("got %q %v, want the event unwrapped as it is flushed", line, err)
+	}
+}
+
+func TestEnvelopeHijack(t *testing.T) {
+	server := httptest.NewServer(envelope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 9\r\nConnection: close\r\n\r\n{\"raw\":1}")
+		rw.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if string(body) != `{"raw":1}` {
+		t.Errorf("got %s, want the bytes written to the hijacked connection", body)
+	}
+
+	// the writer itself hijacks too, as the websocket upgrader does
+	if _, ok := interface{}(&envelopeWriter{ResponseWriter: httptest.NewRecorder()}).(http.Hijacker); !ok {
+		t.Error("the envelope hides http.Hijacker")
+	}
+}
@@ -0,0 +1,210 @@
+import { h } from "./dom";
+import "./site.css";
+
+// api is the version of the api used, its JSON responses are wrapped as {"data": ...}
+const api = "/api/v1";
+
+// csrfToken is the token of the session of the user signed in, set in a
+// cookie when signing in
+const csrfToken = () => {
+    const cookie = document.cookie.split("; ").find(c => c.startsWith("csrf_token="));
+    return cookie ? decodeURIComponent(cookie.slice("csrf_token=".length)) : "";
+};
+
+// request calls the api, the requests changing anything carry the csrf
+// token, the server refuses them without it once signed in
+const request = (path, options = {}) => {
+    const headers = {...options.headers};
+    const token = csrfToken();
+
+    if (options.method && options.method !== "GET" && token !== "") {
+        headers["X-CSRF-Token"] = token;
+    }
+
+    return fetch(api + path, {...options, headers});
+};
+
+const PlusIcon = () => (
+    <svg viewBox="0 0 16 16" width="16" height="16" aria-hidden="true">
+        <path fill="currentColor" d="M7 1h2v6h6v2H9v6H7V9H1V7h6z"/>
+    </svg>
+);
+
+const TrashIcon = () => (
+    <svg viewBox="0 0 16 16" width="14" height="14" aria-hidden="true">
+        <path fill="currentColor" d="M5.5 1h5l.5 1H14v2H2V2h3zM3 5h10l-.8 10H3.8zm3 2v6h1V7zm3 0v6h1V7z"/>
+    </svg>
+);
+
+const TaskItem = ({task, onDelete}) => (
+    <li key={task.id}>
+        <span className="delete" title="Delete" onClick={() => onDelete(task)}><TrashIcon/></span>
+        <span className="title">{task.title}</span>
+    </li>
+);
+
+function TaskForm({onAddTask}) {
+    const input = <input id="Title" name="Title" type="Text" placeholder="title..."/>;
+
+    const handleSubmit = (event) => {
+        event.preventDefault();
+
+        const title = input.value;
+
+        if (title === "") {
+            return;
+        }
+
+        request("/task/", {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({title: title, priority: 1000, complete: false, id: 0}),
+        }).then(response => {
+            // the role of the user may not allow adding tasks
+            if (!response.ok) {
+                return;
+            }
+
+            return response.json()
+                .then(body => onAddTask(body.data))
+                .then(() => input.value = "");
+        });
+    };
+
+    return (
+        <form onSubmit={handleSubmit} className="taskForm">
+            {input}
+            <button title="Add"><PlusIcon/></button>
+        </form>
+    );
+}
+
+// LoginForm signs the user in with a name and a password
+function LoginForm({onLogin}) {
+    const name = <input name="name" type="text" placeholder="name..." autocomplete="username"/>;
+    const password = <input name="password" type="password" placeholder="password..." autocomplete="current-password"/>;
+    const error = <p className="error"/>;
+
+    const handleSubmit = (event) => {
+        event.preventDefault();
+
+        request("/auth/login", {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({name: name.value, password: password.value}),
+        }).then(response => response.ok ? onLogin() : response.json().then(problem => error.textContent = problem.detail));
+    };
+
+    // the server sets the url of the single sign on when it is configured
+    const sso = document.querySelector("#root").dataset.sso;
+
+    return (
+        <form onSubmit={handleSubmit} className="loginForm">
+            {name}
+            {password}
+            <button>Sign in</button>
+            {sso && <a className="sso" href={sso}>Sign in with single sign on</a>}
+            {error}
+        </form>
+    );
+}
+
+// Account shows who is signed in, with a link to sign out
+function Account() {
+    const account = <p className="account"/>;
+
+    const logout = (event) => {
+        event.preventDefault();
+        request("/auth/logout", {method: "POST"}).then(() => location.reload());
+    };
+
+    request("/auth/me")
+        .then(response => response.ok ? response.json() : null)
+        .then(body => {
+            if (body) {
+                account.replaceChildren(body.data.name + " ", <a href="#" onClick={logout}>Sign out</a>);
+            }
+        });
+
+    return account;
+}
+
+// TaskContainer renders the list of tasks, and keeps it in sync with the
+// changes made by other users
+function TaskContainer(root) {
+    let tasks = [{id: 0, title: "Loading...", complete: false, priority: 0}];
+
+    const list = <ul className="theList"/>;
+
+    const render = () => {
+        list.replaceChildren(...tasks.map(task => <TaskItem task={task} onDelete={deleteTask}/>));
+    };
+
+    const addTask = (task) => {
+        tasks = tasks.filter(item => item.id !== task.id);
+        tasks.push(task);
+        render();
+    };
+
+    const replaceTask = (task) => {
+        tasks = tasks.map(item => item.id === task.id ? task : item);
+        render();
+    };
+
+    const removeTask = (task) => {
+        tasks = tasks.filter(item => item.id !== task.id);
+        render();
+    };
+
+    const deleteTask = (task) => {
+        removeTask(task);
+
+        // the task is back when the role of the user does not allow deleting it
+        request("/task/" + task.id + "/", {
+            method: "DELETE",
+        }).then(response => response.ok || addTask(task));
+    };
+
+    root.replaceChildren(
+        <div>
+            <Account/>
+            <h1>To Do</h1>
+            <TaskForm onAddTask={addTask}/>
+            {list}
+        </div>
+    );
+
+    render();
+
+    const watch = () => {
+        const stream = new EventSource(api + "/task/stream");
+
+        stream.addEventListener("created", e => addTask(JSON.parse(e.data)));
+        stream.addEventListener("updated", e => replaceTask(JSON.parse(e.data)));
+        stream.addEventListener("deleted", e => removeTask(JSON.parse(e.data)));
+
+        window.addEventListener("pagehide", () => stream.close());
+    };
+
+    request("/task/")
+        .then(response => {
+            // the server requires users to sign in
+            if (response.status === 401) {
+                root.replaceChildren(
+                    <div>
+                        <h1>Sign in</h1>
+                        <LoginForm onLogin={() => location.reload()}/>
+                    </div>
+                );
+                return;
+            }
+
+            return response.json().then(body => {
+                tasks = body.data || [];
+                render();
+                watch();
+            });
+        });
+}
+
+TaskContainer(document.querySelector("#root"));
@@ -0,0 +1,49 @@
+// h creates the DOM element of a JSX tag. The JSX of the app is compiled
+// to calls of h when the assets are built, so the browser runs plain
+// javascript and no framework has to be downloaded.
+
+const svgNamespace = "http://www.w3.org/2000/svg";
+const svgTags = new Set(["svg", "path"]);
+
+export function h(tag, props, ...children) {
+    props = props || {};
+
+    if (typeof tag === "function") {
+        return tag({...props, children});
+    }
+
+    const svg = svgTags.has(tag);
+    const el = svg ? document.createElementNS(svgNamespace, tag) : document.createElement(tag);
+
+    for (const [name, value] of Object.entries(props)) {
+        if (name === "key" || value === undefined || value === null || value === false) {
+            continue;
+        }
+
+        if (name.startsWith("on")) {
+            el.addEventListener(name.slice(2).toLowerCase(), value);
+        } else if (name === "className") {
+            el.setAttribute("class", value);
+        } else if (name === "value" && !svg) {
+            el.value = value;
+        } else {
+            el.setAttribute(name, value === true ? "" : value);
+        }
+    }
+
+    append(el, children);
+
+    return el;
+}
+
+function append(el, children) {
+    for (const child of children) {
+        if (Array.isArray(child)) {
+            append(el, child);
+        } else if (child instanceof Node) {
+            el.appendChild(child);
+        } else if (child !== undefined && child !== null && child !== false) {
+            el.appendChild(document.createTextNode(String(child)));
+        }
+    }
+}
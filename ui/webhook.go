@@ -0,0 +1,300 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+	"github.com/servian/TechChallengeApp/webhook"
+)
+
+// how many deliveries are returned by the delivery log by default, and at most
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	js, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// getWebhooks - GET /api/webhook/
+//
+// Fetch all webhook subscriptions
+func getWebhooks(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hooks, err := db.GetAllWebhooks(r.Context(), cfg.DB)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		output := []model.Webhook{}
+
+		for _, hook := range hooks {
+			hook.Secret = ""
+			output = append(output, hook)
+		}
+
+		writeJSON(w, 200, output)
+	})
+}
+
+// addWebhook - POST /api/webhook/
+//
+// Subscribe a webhook to task events. The response is the only time the
+// secret used to sign the payloads is returned.
+func addWebhook(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		hook := model.Webhook{Active: true}
+
+		err := decoder.Decode(&hook)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to add webhook", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = webhook.Validate(hook)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		if hook.Secret == "" {
+			hook.Secret = webhook.NewSecret()
+		}
+
+		if hook.Events == nil {
+			hook.Events = []string{}
+		}
+
+		newHook, err := db.AddWebhook(r.Context(), cfg.DB, hook)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		writeJSON(w, 201, newHook)
+	})
+}
+
+func webhookID(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// getWebhook - GET /api/webhook/{id}/
+//
+// Fetch a webhook subscription by ID
+func getWebhook(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := webhookID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		hook, err := db.GetWebhook(r.Context(), cfg.DB, id)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		hook.Secret = ""
+
+		writeJSON(w, 200, hook)
+	})
+}
+
+// updateWebhook - PUT /api/webhook/{id}/
+//
+// Update a webhook subscription by ID, the secret is only changed when one
+// is given
+func updateWebhook(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := webhookID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var hook model.Webhook
+
+		err = decoder.Decode(&hook)
+
+		if err != nil {
+			slog.WarnContext(r.Context(), "Invalid request to update webhook", "error", err)
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = webhook.Validate(hook)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		if hook.Events == nil {
+			hook.Events = []string{}
+		}
+
+		hook.ID = id
+
+		updated, err := db.UpdateWebhook(r.Context(), cfg.DB, hook)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		updated.Secret = ""
+
+		writeJSON(w, 200, updated)
+	})
+}
+
+// deleteWebhook - DELETE /api/webhook/{id}/
+//
+// Delete a webhook subscription and its delivery log
+func deleteWebhook(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := webhookID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = db.DeleteWebhook(r.Context(), cfg.DB, id)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// getWebhookDeliveries - GET /api/webhook/{id}/deliveries/
+//
+// Fetch the delivery log of a webhook, newest first
+func getWebhookDeliveries(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := webhookID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		limit := defaultDeliveryLimit
+
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+
+			if err != nil || limit < 1 || limit > maxDeliveryLimit {
+				writeProblem(w, r, 400, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit))
+				return
+			}
+		}
+
+		_, err = db.GetWebhook(r.Context(), cfg.DB, id)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		deliveries, err := db.GetDeliveries(r.Context(), cfg.DB, id, limit)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		if deliveries == nil {
+			deliveries = []model.WebhookDelivery{}
+		}
+
+		writeJSON(w, 200, deliveries)
+	})
+}
+
+// retryWebhookDelivery - POST /api/webhook/{id}/deliveries/{delivery}/retry
+//
+// Queue a dead delivery again
+func retryWebhookDelivery(cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := webhookID(r)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		delivery, err := strconv.ParseInt(mux.Vars(r)["delivery"], 10, 64)
+
+		if err != nil {
+			writeProblem(w, r, 400, err.Error())
+			return
+		}
+
+		err = db.RetryDelivery(r.Context(), cfg.DB, id, delivery)
+
+		if err != nil {
+			writeDbError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func webhookHandler(cfg Config, router *mux.Router) {
+	router.Handle("/webhook/", getWebhooks(cfg)).Methods("GET")
+	router.Handle("/webhook/", addWebhook(cfg)).Methods("POST")
+	router.Handle("/webhook/{id:[0-9]+}/", getWebhook(cfg)).Methods("GET")
+	router.Handle("/webhook/{id:[0-9]+}/", updateWebhook(cfg)).Methods("PUT")
+	router.Handle("/webhook/{id:[0-9]+}/", deleteWebhook(cfg)).Methods("DELETE")
+	router.Handle("/webhook/{id:[0-9]+}/deliveries/", getWebhookDeliveries(cfg)).Methods("GET")
+	router.Handle("/webhook/{id:[0-9]+}/deliveries/{delivery:[0-9]+}/retry", retryWebhookDelivery(cfg)).Methods("POST")
+}
@@ -0,0 +1,566 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = (wsPongWait * 9) / 10
+	wsMaxMessage = 64 << 10
+	wsSendBuffer = 64
+)
+
+// JSON-RPC error codes used by the websocket api
+const (
+	wsParseError     = -32700
+	wsInvalidRequest = -32600
+	wsMethodNotFound = -32601
+	wsInvalidParams  = -32602
+	wsServerError    = -32000
+	wsNotFound       = -32001
+	wsForbidden      = -32003
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsRequest is a JSON-RPC style call sent by a client. Calls without an id
+// are still executed but never acknowledged.
+type wsRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// wsMessage is either the acknowledgement of a call, or a notification
+// pushed by the server when it has a method
+type wsMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *wsError        `json:"error,omitempty"`
+}
+
+type wsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Data holds the invalid values of a task, as in the problems of the
+	// REST api
+	Data []problemError `json:"data,omitempty"`
+}
+
+type listParams struct {
+	List int `json:"list"`
+}
+
+type taskIDParams struct {
+	ID int `json:"id"`
+}
+
+type taskNotification struct {
+	List int        `json:"list"`
+	Task model.Task `json:"task"`
+}
+
+type presenceNotification struct {
+	List    int      `json:"list"`
+	Viewers []string `json:"viewers"`
+}
+
+// wsClient is a single websocket connection
+type wsClient struct {
+	id   string
+	ctx  context.Context
+	conn *websocket.Conn
+	send chan wsMessage
+	done chan struct{}
+}
+
+// name is the name other viewers see the client as, the user it signed
+// in as
+func (c *wsClient) name() string {
+	if user, ok := currentUser(c.ctx); ok {
+		return user.Name
+	}
+
+	return "anonymous-" + c.id
+}
+
+// push queues a message to be written to the client, it gives up once
+// the connection is closed
+func (c *wsClient) push(msg wsMessage) {
+	msg.JSONRPC = "2.0"
+
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	}
+}
+
+// presence keeps track of who is viewing each list, by list id
+type presence struct {
+	mu    sync.Mutex
+	lists map[int]map[*wsClient]string
+}
+
+func newPresence() *presence {
+	return &presence{lists: make(map[int]map[*wsClient]string)}
+}
+
+func (p *presence) join(list int, c *wsClient, name string) {
+	p.mu.Lock()
+	viewers, ok := p.lists[list]
+
+	if !ok {
+		viewers = make(map[*wsClient]string)
+		p.lists[list] = viewers
+	}
+
+	viewers[c] = name
+	p.mu.Unlock()
+
+	p.broadcast(list)
+}
+
+func (p *presence) leave(list int, c *wsClient) {
+	p.mu.Lock()
+	viewers := p.lists[list]
+
+	if _, ok := viewers[c]; !ok {
+		p.mu.Unlock()
+		return
+	}
+
+	delete(viewers, c)
+
+	if len(viewers) == 0 {
+		delete(p.lists, list)
+	}
+
+	p.mu.Unlock()
+
+	p.broadcast(list)
+}
+
+// joined are the lists the client is viewing
+func (p *presence) joined(c *wsClient) []int {
+	var lists []int
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for list, viewers := range p.lists {
+		if _, ok := viewers[c]; ok {
+			lists = append(lists, list)
+		}
+	}
+
+	return lists
+}
+
+// leaveAll removes the client from every list it was viewing
+func (p *presence) leaveAll(c *wsClient) {
+	for _, list := range p.joined(c) {
+		p.leave(list, c)
+	}
+}
+
+func (p *presence) viewing(list int, c *wsClient) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.lists[list][c]
+	return ok
+}
+
+func (p *presence) viewers(list int) ([]*wsClient, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var clients []*wsClient
+	names := []string{}
+
+	for c, name := range p.lists[list] {
+		clients = append(clients, c)
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return clients, names
+}
+
+func (p *presence) broadcast(list int) {
+	clients, names := p.viewers(list)
+
+	for _, c := range clients {
+		c.push(wsMessage{Method: "presence", Params: presenceNotification{List: list, Viewers: names}})
+	}
+}
+
+// websocketHandler - GET /api/ws
+//
+// Upgrade to a websocket for collaborative editing. Clients send JSON-RPC
+// style calls (subscribe, unsubscribe, task.list, task.create, task.update,
+// task.delete) and receive acknowledgements, task change notifications and
+// presence updates for the lists they subscribed to.
+func websocketHandler(cfg Config) http.Handler {
+	viewers := newPresence()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			// the upgrader has already replied to the client
+			slog.WarnContext(r.Context(), "Websocket upgrade failed", "error", err)
+			return
+		}
+
+		client := &wsClient{
+			id:   newClientID(),
+			ctx:  r.Context(),
+			conn: conn,
+			send: make(chan wsMessage, wsSendBuffer),
+			done: make(chan struct{}),
+		}
+
+		sub, unsubscribe := cfg.Events.Subscribe()
+
+		go client.writePump()
+		go client.forward(cfg, sub, viewers)
+
+		client.readPump(cfg, viewers)
+
+		viewers.leaveAll(client)
+		unsubscribe()
+	})
+}
+
+func newClientID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// forward pushes the events of the tasks of a list to the client while
+// it views the list
+func (c *wsClient) forward(cfg Config, sub <-chan events.Event, viewers *presence) {
+	visible := events.NewVisibility(c.ctx, cfg.DB)
+
+	for e := range sub {
+		if e.Type == events.ListsChanged {
+			c.recheck(cfg, viewers)
+		}
+
+		if !visible.Allows(e) || !viewers.viewing(e.Task.ListID, c) {
+			continue
+		}
+
+		c.push(wsMessage{Method: "task." + string(e.Type), Params: taskNotification{List: e.Task.ListID, Task: e.Task}})
+	}
+}
+
+// recheck unsubscribes the client from the lists it can no longer see,
+// once it is removed from a list or the list is deleted
+func (c *wsClient) recheck(cfg Config, viewers *presence) {
+	for _, list := range viewers.joined(c) {
+		_, err := db.GetList(c.ctx, cfg.DB, list)
+
+		if err != nil && !errors.Is(err, db.ErrNotFound) && !errors.Is(err, access.ErrForbidden) {
+			slog.ErrorContext(c.ctx, "Websocket access check failed", "client", c.id, "list", list, "error", err)
+			continue
+		}
+
+		if err != nil {
+			viewers.leave(list, c)
+			c.push(wsMessage{Method: "unsubscribed", Params: listParams{List: list}})
+		}
+	}
+}
+
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsClient) readPump(cfg Config, viewers *presence) {
+	defer close(c.done)
+
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.WarnContext(c.ctx, "Websocket closed unexpectedly", "client", c.id, "error", err)
+			}
+			return
+		}
+
+		var req wsRequest
+
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.push(wsMessage{Error: &wsError{Code: wsParseError, Message: err.Error()}})
+			continue
+		}
+
+		// the connection lives as long as the client, every call gets a
+		// span of its own under the span of the upgrade request
+		ctx, span := tracer.Start(c.ctx, "ws "+req.Method, trace.WithAttributes(attribute.String("rpc.method", req.Method)))
+
+		result, rpcErr := c.call(ctx, cfg, viewers, req)
+
+		if rpcErr != nil {
+			span.SetStatus(codes.Error, rpcErr.Message)
+		}
+
+		span.End()
+
+		// calls without an id are notifications and are never acknowledged
+		if len(req.ID) == 0 {
+			continue
+		}
+
+		if rpcErr != nil {
+			c.push(wsMessage{ID: req.ID, Error: rpcErr})
+			continue
+		}
+
+		c.push(wsMessage{ID: req.ID, Result: result})
+	}
+}
+
+// call executes a single request sent by the client
+func (c *wsClient) call(ctx context.Context, cfg Config, viewers *presence, req wsRequest) (interface{}, *wsError) {
+	switch req.Method {
+	case "subscribe":
+		var params listParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		_, err := db.GetList(ctx, cfg.DB, params.List)
+
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, &wsError{Code: wsInvalidParams, Message: fmt.Sprintf("Unknown list: %d", params.List)}
+		}
+
+		if err != nil {
+			return nil, c.dbError(ctx, req.Method, err)
+		}
+
+		viewers.join(params.List, c, c.name())
+
+		_, names := viewers.viewers(params.List)
+
+		return presenceNotification{List: params.List, Viewers: names}, nil
+
+	case "unsubscribe":
+		var params listParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		viewers.leave(params.List, c)
+
+		return listParams{List: params.List}, nil
+
+	case "task.list":
+		tasks, err := db.GetAllTasks(ctx, cfg.DB)
+
+		if err != nil {
+			return nil, c.dbError(ctx, req.Method, err)
+		}
+
+		if tasks == nil {
+			tasks = []model.Task{}
+		}
+
+		return tasks, nil
+
+	case "task.create":
+		var task model.Task
+
+		if err := decodeParams(req.Params, &task); err != nil {
+			return nil, err
+		}
+
+		if err := validateTask(task); err != nil {
+			return nil, err
+		}
+
+		newTask, err := db.AddTask(ctx, cfg.DB, task)
+
+		if err != nil {
+			return nil, c.dbError(ctx, req.Method, err)
+		}
+
+		cfg.Events.Publish(ctx, events.Event{Type: events.TaskCreated, Task: newTask})
+
+		return newTask, nil
+
+	case "task.update":
+		var task model.Task
+
+		if err := decodeParams(req.Params, &task); err != nil {
+			return nil, err
+		}
+
+		if err := validateTask(task); err != nil {
+			return nil, err
+		}
+
+		updated, err := db.UpdateTask(ctx, cfg.DB, task)
+
+		if err != nil {
+			return nil, c.dbError(ctx, req.Method, err)
+		}
+
+		cfg.Events.Publish(ctx, events.Event{Type: events.TaskUpdated, Task: updated})
+
+		return updated, nil
+
+	case "task.delete":
+		var params taskIDParams
+
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+
+		deleted, err := db.DeleteTask(ctx, cfg.DB, model.Task{ID: params.ID})
+
+		if err != nil {
+			return nil, c.dbError(ctx, req.Method, err)
+		}
+
+		cfg.Events.Publish(ctx, events.Event{Type: events.TaskDeleted, Task: model.Task{ID: params.ID, ListID: deleted.ListID}})
+
+		return params, nil
+
+	case "":
+		return nil, &wsError{Code: wsInvalidRequest, Message: "Missing method"}
+	}
+
+	return nil, &wsError{Code: wsMethodNotFound, Message: "Unknown method: " + req.Method}
+}
+
+func decodeParams(params json.RawMessage, v interface{}) *wsError {
+	if len(params) == 0 {
+		return &wsError{Code: wsInvalidParams, Message: "Missing params"}
+	}
+
+	if err := json.Unmarshal(params, v); err != nil {
+		return &wsError{Code: wsInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// validateTask checks a task with the rules of the other apis
+func validateTask(task model.Task) *wsError {
+	violations := model.ValidateTask(task)
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	wsErr := &wsError{Code: wsInvalidParams, Message: "Invalid task"}
+
+	for _, v := range violations {
+		wsErr.Data = append(wsErr.Data, problemError{Detail: v.Detail, Pointer: v.Pointer})
+	}
+
+	return wsErr
+}
+
+// dbError is the error of a call that failed in the db package, the
+// details of unexpected errors are only logged
+func (c *wsClient) dbError(ctx context.Context, method string, err error) *wsError {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return &wsError{Code: wsNotFound, Message: "Not found"}
+	case errors.Is(err, access.ErrForbidden):
+		return &wsError{Code: wsForbidden, Message: "Forbidden"}
+	}
+
+	slog.ErrorContext(ctx, "Websocket call failed", "client", c.id, "method", method, "error", err)
+
+	return &wsError{Code: wsServerError, Message: "Internal server error"}
+}
@@ -0,0 +1,210 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/servian/TechChallengeApp/access"
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+)
+
+// dialWS connects to the websocket api as the user of testUsers
+func dialWS(t *testing.T, server *httptest.Server, user string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?as=" + user
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// testWS serves the websocket api on a fake database, the clients choose
+// who they are with the as query parameter
+func testWS(t *testing.T) (Config, *httptest.Server) {
+	cfg := Config{DB: db.Config{DbName: t.Name()}, Events: events.NewBroker()}
+	resetDB(t, cfg)
+
+	ws := websocketHandler(cfg)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := testUsers[r.URL.Query().Get("as")]; user != nil {
+			r = r.WithContext(withUser(r.Context(), *user))
+		}
+
+		ws.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return cfg, server
+}
+
+// callWS sends a call and returns its acknowledgement, skipping the
+// notifications received meanwhile
+func callWS(t *testing.T, conn *websocket.Conn, method string, params string) wsMessage {
+	err := conn.WriteJSON(wsRequest{ID: json.RawMessage("1"), Method: method, Params: json.RawMessage(params)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		msg := readWS(t, conn)
+
+		if msg.Method == "" {
+			return msg
+		}
+	}
+}
+
+// readWS reads the next message sent to the client
+func readWS(t *testing.T, conn *websocket.Conn) wsMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg struct {
+		wsMessage
+		Params json.RawMessage `json:"params"`
+	}
+
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	msg.wsMessage.Params = msg.Params
+
+	return msg.wsMessage
+}
+
+func TestWebsocketValidatesTasks(t *testing.T) {
+	_, server := testWS(t)
+	conn := dialWS(t, server, "admin")
+
+	calls := []struct {
+		method  string
+		params  string
+		pointer string
+	}{
+		{"task.create", `{"title":"","listId":1}`, "#/title"},
+		{"task.create", `{"title":"Task","priority":-1}`, "#/priority"},
+		{"task.update", `{"id":1,"title":"   "}`, "#/title"},
+		{"task.update", `{"id":1,"title":"Task","priority":-3}`, "#/priority"},
+	}
+
+	for _, c := range calls {
+		msg := callWS(t, conn, c.method, c.params)
+
+		if msg.Error == nil || msg.Error.Code != wsInvalidParams || len(msg.Error.Data) != 1 || msg.Error.Data[0].Pointer != c.pointer {
+			t.Errorf("%s %s: got %+v, want %d for %s", c.method, c.params, msg.Error, wsInvalidParams, c.pointer)
+		}
+	}
+}
+
+func TestWebsocketErrorCodes(t *testing.T) {
+	_, server := testWS(t)
+
+	calls := []struct {
+		user   string
+		method string
+		params string
+		code   int
+	}{
+		{"admin", "task.update", `{"id":99,"title":"Task"}`, wsNotFound},
+		{"admin", "task.delete", `{"id":99}`, wsNotFound},
+		{"viewer", "task.create", `{"title":"Task","listId":1}`, wsForbidden},
+		{"viewer", "task.delete", `{"id":1}`, wsForbidden},
+	}
+
+	for _, c := range calls {
+		msg := callWS(t, dialWS(t, server, c.user), c.method, c.params)
+
+		if msg.Error == nil || msg.Error.Code != c.code {
+			t.Errorf("%s %s as %s: got %+v, want the code %d", c.method, c.params, c.user, msg.Error, c.code)
+		}
+	}
+}
+
+func TestWebsocketRecheckPresence(t *testing.T) {
+	cfg, server := testWS(t)
+	admin := withUser(context.Background(), *testUsers["admin"])
+
+	vera := dialWS(t, server, "viewer")
+	ed := dialWS(t, server, "editor")
+
+	for _, conn := range []*websocket.Conn{vera, ed} {
+		if msg := callWS(t, conn, "subscribe", `{"list":2}`); msg.Error != nil {
+			t.Fatalf("subscribe: %+v", msg.Error)
+		}
+	}
+
+	members, err := db.GetMembers(admin, cfg.DB, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, member := range members {
+		if member.User == "vera" {
+			if err := db.DeleteMember(admin, cfg.DB, 2, member.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cfg.Events.Publish(access.AsSystem(context.Background()), events.Event{Type: events.ListsChanged})
+
+	for {
+		msg := readWS(t, vera)
+
+		if msg.Method == "unsubscribed" {
+			if params := string(msg.Params.(json.RawMessage)); params != `{"list":2}` {
+				t.Errorf("unsubscribed from %s, want the list 2", params)
+			}
+
+			break
+		}
+	}
+
+	// ed sees vera leave
+	for {
+		msg := readWS(t, ed)
+
+		if msg.Method == "presence" && string(msg.Params.(json.RawMessage)) == `{"list":2,"viewers":["ed"]}` {
+			break
+		}
+	}
+
+	if msg := callWS(t, vera, "subscribe", `{"list":2}`); msg.Error == nil {
+		t.Error("the removed viewer subscribed to the list again")
+	}
+}
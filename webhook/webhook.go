@@ -0,0 +1,353 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/events"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature-256"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+)
+
+// Config - configuration for the webhook package
+type Config struct {
+	DB db.Config
+
+	// Client posts the payloads, its timeout bounds each attempt
+	Client *http.Client
+
+	// PollInterval is how often the queue is checked for due deliveries
+	PollInterval time.Duration
+
+	// BatchSize is how many deliveries are attempted at once
+	BatchSize int
+
+	// MaxAttempts before a delivery is moved to the dead state
+	MaxAttempts int
+
+	// BackoffBase is the delay after the first failed attempt, it doubles
+	// with every attempt until it reaches BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 10
+	}
+
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 8
+	}
+
+	if cfg.BackoffBase == 0 {
+		cfg.BackoffBase = 10 * time.Second
+	}
+
+	if cfg.BackoffMax == 0 {
+		cfg.BackoffMax = time.Hour
+	}
+}
+
+// Payload is the body posted to webhooks
+type Payload = model.WebhookPayload
+
+// Dispatcher delivers the queue of webhook deliveries with retries. The
+// deliveries are queued by the db package, in the transactions writing the
+// tasks
+type Dispatcher struct {
+	cfg  Config
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher, zero values in the config are
+// replaced by defaults
+func NewDispatcher(cfg Config) *Dispatcher {
+	cfg.setDefaults()
+
+	return &Dispatcher{
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// Start delivers the queue in the background until Stop is called. The
+// queue is checked every PollInterval, and whenever a task event is
+// published. The broker only wakes the dispatcher, an event it drops
+// delays its deliveries until the next check but does not lose them
+func (d *Dispatcher) Start(broker *events.Broker) {
+	sub, unsubscribe := broker.Subscribe()
+
+	d.wg.Add(2)
+
+	go func() {
+		defer d.wg.Done()
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-d.done:
+				return
+			case e := <-sub:
+				if e.Type == events.ListsChanged {
+					continue
+				}
+
+				select {
+				case d.wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+
+			if _, err := d.DeliverPending(context.Background()); err != nil {
+				slog.Error("Error delivering webhooks", "error", err)
+			}
+		}
+	}()
+}
+
+// Stop waits for the background deliveries to finish
+func (d *Dispatcher) Stop() {
+	close(d.done)
+	d.wg.Wait()
+}
+
+// DeliverPending attempts one batch of due deliveries, and returns how
+// many were attempted
+func (d *Dispatcher) DeliverPending(ctx context.Context) (int, error) {
+	// hold the deliveries long enough for every attempt to time out
+	lease := d.cfg.Client.Timeout + time.Minute
+
+	deliveries, err := db.ClaimDeliveries(ctx, d.cfg.DB, d.cfg.BatchSize, lease)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+
+	for _, delivery := range deliveries {
+		wg.Add(1)
+
+		go func(delivery db.Delivery) {
+			defer wg.Done()
+
+			result := d.attempt(ctx, delivery)
+
+			if err := db.UpdateDelivery(ctx, d.cfg.DB, result); err != nil {
+				slog.Error("Error recording webhook delivery", "delivery", delivery.ID, "error", err)
+			}
+		}(delivery)
+	}
+
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// attempt posts the delivery and returns it with the outcome of the attempt
+func (d *Dispatcher) attempt(ctx context.Context, delivery db.Delivery) model.WebhookDelivery {
+	result := delivery.WebhookDelivery
+	status, err := d.post(ctx, delivery)
+
+	result.ResponseStatus = status
+
+	if err == nil {
+		result.Status = model.DeliveryDelivered
+		result.LastError = ""
+		result.NextAttemptAt = time.Now()
+		return result
+	}
+
+	result.LastError = err.Error()
+
+	if result.Attempts >= d.cfg.MaxAttempts {
+		slog.Warn("Webhook delivery failed too many times, giving up", "delivery", result.ID, "webhook", delivery.WebhookID, "url", delivery.Webhook.URL, "attempts", result.Attempts, "error", err)
+		result.Status = model.DeliveryDead
+		result.NextAttemptAt = time.Now()
+		return result
+	}
+
+	result.Status = model.DeliveryPending
+	result.NextAttemptAt = time.Now().Add(Backoff(d.cfg.BackoffBase, d.cfg.BackoffMax, result.Attempts))
+
+	return result
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery db.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TechChallengeApp-Webhook")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, fmt.Sprint(delivery.ID))
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := d.cfg.Client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	// drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Backoff is the delay before the next attempt once attempts have failed
+func Backoff(base time.Duration, max time.Duration, attempts int) time.Duration {
+	delay := base
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+
+		if delay >= max {
+			return max
+		}
+	}
+
+	return delay
+}
+
+// Sign returns the signature header value of a payload, the hex encoded
+// HMAC-SHA256 of the timestamp of the attempt, a dot and the body, keyed
+// with the webhook secret. Signing the timestamp lets the receivers refuse
+// the old deliveries replayed to them
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header value received with a payload, and
+// that it was sent less than tolerance ago
+func Verify(secret string, timestamp string, body []byte, signature string, tolerance time.Duration) bool {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return false
+	}
+
+	if age := time.Since(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// NewSecret generates a random secret to sign payloads with
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Validate checks the webhook can be stored
+func Validate(hook model.Webhook) error {
+	u, err := url.Parse(hook.URL)
+
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+
+	for _, event := range hook.Events {
+		switch events.Type(event) {
+		case events.TaskCreated, events.TaskUpdated, events.TaskDeleted:
+		default:
+			return fmt.Errorf("Unknown event: %s", event)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright © 2022 Servian
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/servian/TechChallengeApp/db"
+	"github.com/servian/TechChallengeApp/model"
+)
+
+const testPayload = `{"event":"created","task":{"id":42,"listId":1,"priority":1,"title":"Write docs","complete":false},"timestamp":"2026-10-19T10:00:00Z"}`
+
+func testDelivery(url string, attempts int) db.Delivery {
+	return db.Delivery{
+		WebhookDelivery: model.WebhookDelivery{ID: 7, WebhookID: 3, Event: "created", Payload: testPayload, Status: model.DeliveryPending, Attempts: attempts},
+		Webhook:         model.Webhook{ID: 3, URL: url, Secret: "s3cret", Active: true},
+	}
+}
+
+func TestDeliverySignature(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer receiver.Close()
+
+	d := NewDispatcher(Config{})
+	result := d.attempt(context.Background(), testDelivery(receiver.URL, 1))
+
+	if result.Status != model.DeliveryDelivered || result.ResponseStatus != 200 {
+		t.Fatalf("delivery %s with %d, want delivered", result.Status, result.ResponseStatus)
+	}
+
+	r := <-received
+	timestamp := r.Header.Get(HeaderTimestamp)
+	signature := r.Header.Get(HeaderSignature)
+
+	if string(body) != testPayload || r.Header.Get(HeaderEvent) != "created" || r.Header.Get(HeaderDelivery) != "7" {
+		t.Errorf("posted %s with %v", body, r.Header)
+	}
+
+	if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Errorf("timestamp %q", timestamp)
+	}
+
+	if signature[:7] != "sha256=" || len(signature) != 7+64 {
+		t.Errorf("signature %q", signature)
+	}
+
+	if !Verify("s3cret", timestamp, body, signature, 5*time.Minute) {
+		t.Error("the signature does not verify")
+	}
+
+	if Verify("other", timestamp, body, signature, 5*time.Minute) {
+		t.Error("the signature verifies with another secret")
+	}
+
+	if Verify("s3cret", timestamp, append(body, ' '), signature, 5*time.Minute) {
+		t.Error("the signature verifies another body")
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	if Verify("s3cret", old, body, Sign("s3cret", old, body), 5*time.Minute) {
+		t.Error("a delivery replayed an hour later verifies")
+	}
+
+	if Verify("s3cret", old, body, signature, 2*time.Hour) {
+		t.Error("the signature verifies with another timestamp")
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer receiver.Close()
+
+	d := NewDispatcher(Config{MaxAttempts: 4, BackoffBase: 10 * time.Second, BackoffMax: 30 * time.Second})
+
+	// the delay after each failed attempt, doubling up to the max
+	backoffs := []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second}
+
+	for i, backoff := range backoffs {
+		start := time.Now()
+		result := d.attempt(context.Background(), testDelivery(receiver.URL, i+1))
+
+		if result.Status != model.DeliveryPending || result.ResponseStatus != http.StatusServiceUnavailable || result.LastError == "" {
+			t.Fatalf("attempt %d: %s with %d, want pending", i+1, result.Status, result.ResponseStatus)
+		}
+
+		if delay := result.NextAttemptAt.Sub(start); delay < backoff || delay > backoff+time.Second {
+			t.Errorf("attempt %d retried after %s, want %s", i+1, delay, backoff)
+		}
+	}
+
+	result := d.attempt(context.Background(), testDelivery(receiver.URL, 4))
+
+	if result.Status != model.DeliveryDead {
+		t.Errorf("last attempt: %s, want dead", result.Status)
+	}
+
+	status.Store(http.StatusNoContent)
+	result = d.attempt(context.Background(), testDelivery(receiver.URL, 2))
+
+	if result.Status != model.DeliveryDelivered || result.LastError != "" {
+		t.Errorf("retry answered 204: %s %q, want delivered", result.Status, result.LastError)
+	}
+}
+
+func TestDeliveryToUnreachableReceiver(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	d := NewDispatcher(Config{MaxAttempts: 2})
+	result := d.attempt(context.Background(), testDelivery(url, 1))
+
+	if result.Status != model.DeliveryPending || result.ResponseStatus != 0 || result.LastError == "" {
+		t.Errorf("%s with %d %q, want pending without a status", result.Status, result.ResponseStatus, result.LastError)
+	}
+}